@@ -0,0 +1,245 @@
+package apperror
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/labstack/echo/v4"
+	"gorm.io/gorm"
+)
+
+// Machine-readable error codes returned to clients
+const (
+	CodeBadRequest       = "bad_request"
+	CodeInvalidParameter = "invalid_parameter"
+	CodeInvalidBody      = "invalid_body"
+	CodeUnauthorized     = "unauthorized"
+	CodeForbidden        = "forbidden"
+	CodeNotFound         = "not_found"
+	CodeConflict         = "conflict"
+	CodePrecondition     = "precondition_failed"
+	CodeValidation       = "validation_failed"
+	CodeTooManyRequests  = "too_many_requests"
+	CodeDatabase         = "database_unavailable"
+	CodeUnavailable      = "service_unavailable"
+	CodeInternal         = "internal_error"
+)
+
+// Exception is a typed application error that knows which HTTP status it maps to
+type Exception struct {
+	Status  int
+	Code    string
+	Message string
+
+	// Field level problems for validation failures
+	Fields []FieldError
+
+	// The underlying error, never shown to the client
+	Internal error
+}
+
+// FieldError describes a single invalid field of a request payload
+type FieldError struct {
+	Field   string `json:"field"`
+	Code    string `json:"code"`
+	Message string `json:"message"`
+}
+
+func (e *Exception) Error() string {
+	if e.Internal != nil {
+		return fmt.Sprintf("%s: %s (%s)", e.Code, e.Message, e.Internal.Error())
+	}
+	return fmt.Sprintf("%s: %s", e.Code, e.Message)
+}
+
+func (e *Exception) Unwrap() error {
+	return e.Internal
+}
+
+// New returns an Exception with the given status, code and message
+func New(status int, code string, message string) *Exception {
+	return &Exception{
+		Status:  status,
+		Code:    code,
+		Message: message,
+	}
+}
+
+// InvalidParameter is used when a path or query parameter can not be parsed
+func InvalidParameter(name string, internal error) *Exception {
+	return &Exception{
+		Status:   http.StatusBadRequest,
+		Code:     CodeInvalidParameter,
+		Message:  fmt.Sprintf("Invalid value for parameter '%s'", name),
+		Internal: internal,
+	}
+}
+
+// InvalidBody is used when the request body can not be bound
+func InvalidBody(internal error) *Exception {
+	return &Exception{
+		Status:   http.StatusBadRequest,
+		Code:     CodeInvalidBody,
+		Message:  "The request body is malformed",
+		Internal: internal,
+	}
+}
+
+// Unauthorized is used when the caller could not be authenticated
+func Unauthorized(message string, internal error) *Exception {
+	return &Exception{
+		Status:   http.StatusUnauthorized,
+		Code:     CodeUnauthorized,
+		Message:  message,
+		Internal: internal,
+	}
+}
+
+// Forbidden is used when the caller is authenticated but not allowed to do this
+func Forbidden(message string) *Exception {
+	return New(http.StatusForbidden, CodeForbidden, message)
+}
+
+// NotFound is used when the requested resource does not exist
+func NotFound(message string) *Exception {
+	return New(http.StatusNotFound, CodeNotFound, message)
+}
+
+// Conflict is used when the request clashes with the current state of the resource
+func Conflict(message string, internal error) *Exception {
+	return &Exception{
+		Status:   http.StatusConflict,
+		Code:     CodeConflict,
+		Message:  message,
+		Internal: internal,
+	}
+}
+
+// PreconditionFailed is used when the If-Match header of the request no longer matches the resource
+func PreconditionFailed(message string, internal error) *Exception {
+	return &Exception{
+		Status:   http.StatusPreconditionFailed,
+		Code:     CodePrecondition,
+		Message:  message,
+		Internal: internal,
+	}
+}
+
+// TooManyRequests is used when the caller went over the rate limit of the route
+func TooManyRequests(message string) *Exception {
+	return New(http.StatusTooManyRequests, CodeTooManyRequests, message)
+}
+
+// Validation is used when a payload was readable but its content is not acceptable
+func Validation(fields ...FieldError) *Exception {
+	return &Exception{
+		Status:  http.StatusUnprocessableEntity,
+		Code:    CodeValidation,
+		Message: "The request payload failed validation",
+		Fields:  fields,
+	}
+}
+
+// Database maps an error returned by Gorm, a missing row is a 404 and anything else means the DB is unavailable
+func Database(internal error) *Exception {
+	if errors.Is(internal, gorm.ErrRecordNotFound) {
+		return &Exception{
+			Status:   http.StatusNotFound,
+			Code:     CodeNotFound,
+			Message:  "The requested resource was not found",
+			Internal: internal,
+		}
+	}
+
+	return &Exception{
+		Status:   http.StatusServiceUnavailable,
+		Code:     CodeDatabase,
+		Message:  "The database is currently unavailable",
+		Internal: internal,
+	}
+}
+
+// From converts any error into an Exception
+func From(err error) *Exception {
+
+	// Already typed, nothing to do
+	var typed *Exception
+	if errors.As(err, &typed) {
+		return typed
+	}
+
+	// Errors raised by echo itself (routing, binding etc.)
+	var httpError *echo.HTTPError
+	if errors.As(err, &httpError) {
+		message := http.StatusText(httpError.Code)
+		if text, isString := httpError.Message.(string); isString {
+			message = text
+		}
+		return &Exception{
+			Status:   httpError.Code,
+			Code:     codeFromStatus(httpError.Code),
+			Message:  message,
+			Internal: httpError.Internal,
+		}
+	}
+
+	// A number that could not be parsed
+	var numError *strconv.NumError
+	if errors.As(err, &numError) {
+		return &Exception{
+			Status:   http.StatusBadRequest,
+			Code:     CodeBadRequest,
+			Message:  "Invalid numeric value",
+			Internal: err,
+		}
+	}
+
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return Database(err)
+	}
+
+	return &Exception{
+		Status:   http.StatusInternalServerError,
+		Code:     CodeInternal,
+		Message:  "An unexpected error occurred",
+		Internal: err,
+	}
+}
+
+func codeFromStatus(status int) string {
+	switch status {
+	case http.StatusBadRequest:
+		return CodeBadRequest
+	case http.StatusUnauthorized:
+		return CodeUnauthorized
+	case http.StatusForbidden:
+		return CodeForbidden
+	case http.StatusNotFound:
+		return CodeNotFound
+	case http.StatusConflict:
+		return CodeConflict
+	case http.StatusPreconditionFailed:
+		return CodePrecondition
+	case http.StatusUnprocessableEntity:
+		return CodeValidation
+	case http.StatusServiceUnavailable:
+		return CodeDatabase
+	case http.StatusInternalServerError:
+		return CodeInternal
+	}
+
+	// Fall back to the status text, e.g. "method_not_allowed"
+	code := []byte(http.StatusText(status))
+	for i, char := range code {
+		switch {
+		case char == ' ' || char == '-':
+			code[i] = '_'
+		case char >= 'A' && char <= 'Z':
+			code[i] = char + ('a' - 'A')
+		}
+	}
+
+	return string(code)
+}
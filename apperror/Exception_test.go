@@ -0,0 +1,66 @@
+package apperror
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/assert"
+	"gorm.io/gorm"
+)
+
+func TestFrom(t *testing.T) {
+
+	_, numError := strconv.Atoi("abc")
+
+	tests := []struct {
+		name       string
+		err        error
+		wantStatus int
+		wantCode   string
+	}{
+		{"strconv failure", numError, http.StatusBadRequest, CodeBadRequest},
+		{"invalid parameter", InvalidParameter("commentId", numError), http.StatusBadRequest, CodeInvalidParameter},
+		{"record not found", gorm.ErrRecordNotFound, http.StatusNotFound, CodeNotFound},
+		{"database not found", Database(gorm.ErrRecordNotFound), http.StatusNotFound, CodeNotFound},
+		{"database failure", Database(errors.New("connection refused")), http.StatusServiceUnavailable, CodeDatabase},
+		{"validation", Validation(FieldError{Field: "body", Code: "required"}), http.StatusUnprocessableEntity, CodeValidation},
+		{"conflict", Conflict("changed", nil), http.StatusConflict, CodeConflict},
+		{"precondition failed", PreconditionFailed("stale", nil), http.StatusPreconditionFailed, CodePrecondition},
+		{"too many requests", TooManyRequests("slow down"), http.StatusTooManyRequests, CodeTooManyRequests},
+		{"echo too many requests", echo.ErrTooManyRequests, http.StatusTooManyRequests, CodeTooManyRequests},
+		{"echo error", echo.ErrMethodNotAllowed, http.StatusMethodNotAllowed, "method_not_allowed"},
+		{"unknown", errors.New("boom"), http.StatusInternalServerError, CodeInternal},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			typed := From(test.err)
+			assert.Equal(t, test.wantStatus, typed.Status)
+			assert.Equal(t, test.wantCode, typed.Code)
+		})
+	}
+}
+
+func TestHandler(t *testing.T) {
+
+	request := httptest.NewRequest(http.MethodGet, "/", nil)
+	recorder := httptest.NewRecorder()
+	c := echo.New().NewContext(request, recorder)
+	c.Response().Header().Set(echo.HeaderXRequestID, "request-1")
+
+	Handler(Validation(FieldError{Field: "body", Code: "required", Message: "body is required"}), c)
+
+	var response Response
+	assert.NoError(t, json.Unmarshal(recorder.Body.Bytes(), &response))
+
+	assert.Equal(t, http.StatusUnprocessableEntity, recorder.Code)
+	assert.Equal(t, CodeValidation, response.Error.Code)
+	assert.Equal(t, "request-1", response.Error.RequestId)
+	assert.Len(t, response.Error.Fields, 1)
+	assert.Equal(t, "body", response.Error.Fields[0].Field)
+}
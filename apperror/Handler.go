@@ -0,0 +1,59 @@
+package apperror
+
+import (
+	"net/http"
+
+	"github.com/labstack/echo/v4"
+)
+
+// Response is the JSON envelope every error is returned in
+type Response struct {
+	Error ResponseError `json:"error"`
+}
+
+type ResponseError struct {
+	Code      string       `json:"code"`
+	Message   string       `json:"message"`
+	RequestId string       `json:"requestId"`
+	Fields    []FieldError `json:"fields,omitempty"`
+}
+
+// Handler is an echo.HTTPErrorHandler writing every error as a Response
+func Handler(err error, c echo.Context) {
+
+	// Nothing we can do once the headers are out
+	if c.Response().Committed {
+		return
+	}
+
+	typed := From(err)
+
+	// Server side errors are worth a log line, the client only sees the generic message
+	if typed.Status >= http.StatusInternalServerError {
+		c.Logger().Error(typed.Error())
+	}
+
+	// Set by the RequestID middleware, fall back to whatever the client sent
+	requestId := c.Response().Header().Get(echo.HeaderXRequestID)
+	if requestId == "" {
+		requestId = c.Request().Header.Get(echo.HeaderXRequestID)
+	}
+
+	var exception error
+	if c.Request().Method == http.MethodHead {
+		exception = c.NoContent(typed.Status)
+	} else {
+		exception = c.JSON(typed.Status, Response{
+			Error: ResponseError{
+				Code:      typed.Code,
+				Message:   typed.Message,
+				RequestId: requestId,
+				Fields:    typed.Fields,
+			},
+		})
+	}
+
+	if exception != nil {
+		c.Logger().Error(exception)
+	}
+}
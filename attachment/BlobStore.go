@@ -0,0 +1,63 @@
+package attachment
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"io"
+)
+
+// ErrBlobNotFound is returned for keys nothing is stored under
+var ErrBlobNotFound = errors.New("blob not found")
+
+// BlobStore keeps the content of attachments, the database only has their metadata
+type BlobStore interface {
+	// Put stores the content under the key, replacing whatever was there
+	Put(key string, content io.Reader) error
+
+	// Get opens the content stored under the key, the caller closes it
+	Get(key string) (io.ReadCloser, error)
+
+	// Delete removes the content stored under the key, a missing key is not an error
+	Delete(key string) error
+}
+
+// Blob describes content saved in a BlobStore
+type Blob struct {
+	Key  string
+	Size int64
+
+	// SHA-256 of the content, hex encoded
+	Checksum string
+}
+
+// Save stores content under a new random key, measuring and hashing it on the way
+func Save(store BlobStore, content io.Reader) (*Blob, error) {
+	random := make([]byte, 16)
+	if _, exception := rand.Read(random); exception != nil {
+		return nil, exception
+	}
+
+	key := hex.EncodeToString(random)
+	hash := sha256.New()
+	counter := &countingReader{reader: io.TeeReader(content, hash)}
+
+	if exception := store.Put(key, counter); exception != nil {
+		return nil, exception
+	}
+
+	return &Blob{Key: key, Size: counter.count, Checksum: hex.EncodeToString(hash.Sum(nil))}, nil
+}
+
+// countingReader counts the bytes read through it
+type countingReader struct {
+	reader io.Reader
+	count  int64
+}
+
+func (r *countingReader) Read(buffer []byte) (int, error) {
+	read, exception := r.reader.Read(buffer)
+	r.count += int64(read)
+	return read, exception
+}
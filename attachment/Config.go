@@ -0,0 +1,93 @@
+package attachment
+
+import (
+	"fmt"
+	"mime"
+	"os"
+	"strconv"
+	"strings"
+)
+
+const (
+	// Where uploads are kept by default, relative to the working directory
+	defaultDirectory = "data/attachments"
+
+	// 10 MiB per file and 5 files per comment by default
+	defaultMaxSize  = 10 << 20
+	defaultMaxCount = 5
+)
+
+// Images, PDFs and plain text by default
+var defaultTypes = []string{"image/png", "image/jpeg", "image/gif", "image/webp", "application/pdf", "text/plain"}
+
+// Config limits what can be attached to a comment
+type Config struct {
+	// Root of the local blob store
+	Directory string
+
+	// Largest file in bytes
+	MaxSize int64
+
+	// Most files a comment can have
+	MaxCount int
+
+	// Allowed MIME types, checked against the content of the file rather than what the client claims
+	Types []string
+}
+
+// ConfigFromEnv reads ATTACHMENT_DIR, ATTACHMENT_MAX_SIZE (bytes), ATTACHMENT_MAX_COUNT and ATTACHMENT_TYPES (comma separated)
+func ConfigFromEnv() (*Config, error) {
+	config := &Config{
+		Directory: defaultDirectory,
+		MaxSize:   defaultMaxSize,
+		MaxCount:  defaultMaxCount,
+		Types:     defaultTypes,
+	}
+
+	if directory := os.Getenv("ATTACHMENT_DIR"); directory != "" {
+		config.Directory = directory
+	}
+
+	if maxSize := os.Getenv("ATTACHMENT_MAX_SIZE"); maxSize != "" {
+		value, exception := strconv.ParseInt(maxSize, 10, 64)
+		if exception != nil || value <= 0 {
+			return nil, fmt.Errorf("invalid ATTACHMENT_MAX_SIZE %q", maxSize)
+		}
+		config.MaxSize = value
+	}
+
+	if maxCount := os.Getenv("ATTACHMENT_MAX_COUNT"); maxCount != "" {
+		value, exception := strconv.Atoi(maxCount)
+		if exception != nil || value < 0 {
+			return nil, fmt.Errorf("invalid ATTACHMENT_MAX_COUNT %q", maxCount)
+		}
+		config.MaxCount = value
+	}
+
+	if types := os.Getenv("ATTACHMENT_TYPES"); types != "" {
+		config.Types = nil
+		for _, value := range strings.Split(types, ",") {
+			if value = strings.ToLower(strings.TrimSpace(value)); value != "" {
+				config.Types = append(config.Types, value)
+			}
+		}
+	}
+
+	return config, nil
+}
+
+// Allows tells whether files of the content type may be attached, parameters like the charset don't matter
+func (config *Config) Allows(contentType string) bool {
+	mediaType, _, exception := mime.ParseMediaType(contentType)
+	if exception != nil {
+		return false
+	}
+
+	for _, allowed := range config.Types {
+		if mediaType == allowed {
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,33 @@
+package attachment
+
+import (
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestConfigFromEnv(t *testing.T) {
+	defer os.Unsetenv("ATTACHMENT_MAX_SIZE")
+	defer os.Unsetenv("ATTACHMENT_TYPES")
+
+	config, exception := ConfigFromEnv()
+	assert.NoError(t, exception)
+	assert.Equal(t, int64(defaultMaxSize), config.MaxSize)
+	assert.Equal(t, defaultMaxCount, config.MaxCount)
+	assert.True(t, config.Allows("image/png"))
+	assert.True(t, config.Allows("text/plain; charset=utf-8"))
+	assert.False(t, config.Allows("text/html; charset=utf-8"))
+	assert.False(t, config.Allows(""))
+
+	_ = os.Setenv("ATTACHMENT_MAX_SIZE", "1024")
+	_ = os.Setenv("ATTACHMENT_TYPES", "Image/PNG, application/zip")
+	config, exception = ConfigFromEnv()
+	assert.NoError(t, exception)
+	assert.Equal(t, int64(1024), config.MaxSize)
+	assert.Equal(t, []string{"image/png", "application/zip"}, config.Types)
+
+	_ = os.Setenv("ATTACHMENT_MAX_SIZE", "10MB")
+	_, exception = ConfigFromEnv()
+	assert.Error(t, exception)
+}
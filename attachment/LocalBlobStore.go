@@ -0,0 +1,88 @@
+package attachment
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
+)
+
+// Keys are names we made up ourselves, anything else could escape the root
+var validKey = regexp.MustCompile(`^[A-Za-z0-9_-]{4,128}$`)
+
+// LocalBlobStore keeps blobs as files below a root directory, spread over subdirectories by the first characters of the key
+type LocalBlobStore struct {
+	root string
+}
+
+func NewLocalBlobStore(root string) *LocalBlobStore {
+	return &LocalBlobStore{root: root}
+}
+
+func (s *LocalBlobStore) Put(key string, content io.Reader) error {
+	path, exception := s.path(key)
+	if exception != nil {
+		return exception
+	}
+
+	if exception := os.MkdirAll(filepath.Dir(path), 0o750); exception != nil {
+		return exception
+	}
+
+	// Written next to its final place and renamed, so a reader never sees half a file
+	file, exception := ioutil.TempFile(filepath.Dir(path), ".upload-*")
+	if exception != nil {
+		return exception
+	}
+	defer os.Remove(file.Name())
+
+	if _, exception := io.Copy(file, content); exception != nil {
+		_ = file.Close()
+		return exception
+	}
+
+	if exception := file.Close(); exception != nil {
+		return exception
+	}
+
+	return os.Rename(file.Name(), path)
+}
+
+func (s *LocalBlobStore) Get(key string) (io.ReadCloser, error) {
+	path, exception := s.path(key)
+	if exception != nil {
+		return nil, exception
+	}
+
+	file, exception := os.Open(path)
+	if errors.Is(exception, os.ErrNotExist) {
+		return nil, ErrBlobNotFound
+	}
+
+	return file, exception
+}
+
+func (s *LocalBlobStore) Delete(key string) error {
+	path, exception := s.path(key)
+	if exception != nil {
+		return exception
+	}
+
+	if exception := os.Remove(path); exception != nil && !errors.Is(exception, os.ErrNotExist) {
+		return exception
+	}
+
+	return nil
+}
+
+// path maps a key to its file, e.g. "ab/cd/abcdef..."
+func (s *LocalBlobStore) path(key string) (string, error) {
+	if !validKey.MatchString(key) {
+		return "", fmt.Errorf("invalid blob key %q", key)
+	}
+
+	return filepath.Join(s.root, key[0:2], key[2:4], key), nil
+}
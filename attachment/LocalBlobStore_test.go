@@ -0,0 +1,48 @@
+package attachment
+
+import (
+	"io/ioutil"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLocalBlobStore(t *testing.T) {
+	store := NewLocalBlobStore(t.TempDir())
+
+	require.NoError(t, store.Put("abcdef", strings.NewReader("first")))
+	require.NoError(t, store.Put("abcdef", strings.NewReader("replaced")))
+
+	content, exception := store.Get("abcdef")
+	require.NoError(t, exception)
+	data, _ := ioutil.ReadAll(content)
+	_ = content.Close()
+	assert.Equal(t, "replaced", string(data))
+
+	require.NoError(t, store.Delete("abcdef"))
+	require.NoError(t, store.Delete("abcdef"))
+
+	_, exception = store.Get("abcdef")
+	assert.ErrorIs(t, exception, ErrBlobNotFound)
+
+	// Keys can't leave the root
+	assert.Error(t, store.Put("../../etc/passwd", strings.NewReader("")))
+	_, exception = store.Get("ab/../../cd")
+	assert.Error(t, exception)
+}
+
+func TestSave(t *testing.T) {
+	store := NewLocalBlobStore(t.TempDir())
+
+	blob, exception := Save(store, strings.NewReader("hello"))
+	require.NoError(t, exception)
+	assert.Len(t, blob.Key, 32)
+	assert.Equal(t, int64(5), blob.Size)
+	assert.Equal(t, "2cf24dba5fb0a30e26e83b2ac5b9e29e1b161e5c1fa7425e73043362938b9824", blob.Checksum)
+
+	other, exception := Save(store, strings.NewReader("hello"))
+	require.NoError(t, exception)
+	assert.NotEqual(t, blob.Key, other.Key)
+}
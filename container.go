@@ -1,23 +1,90 @@
 package main
 
 import (
+	"two-in-one/attachment"
 	"two-in-one/controller"
+	"two-in-one/helper/cache"
+	"two-in-one/middleware"
+	"two-in-one/moderation"
+	"two-in-one/ratelimit"
+	"two-in-one/repository"
+	"two-in-one/stream"
+	"two-in-one/webhook"
 
 	dic "github.com/DrBenton/minidic"
 	"gorm.io/gorm"
 )
 
-func buildContainer(gormDb *gorm.DB) dic.Container {
+func buildContainer(
+	gormDb *gorm.DB,
+	authConfig *middleware.AuthConfig,
+	moderator *moderation.Moderator,
+	idempotencyConfig *middleware.IdempotencyConfig,
+	blobs attachment.BlobStore,
+	attachmentConfig *attachment.Config,
+	dispatcher *webhook.Dispatcher,
+	events *stream.Bus,
+	rateLimitConfig *ratelimit.Config,
+	queryCache *cache.Cache,
+) dic.Container {
 
 	// Create our container
 	container := dic.NewContainer()
 
 	container.Add(dic.NewInjection("Controller.Comment", func(c dic.Container) *controller.CommentController {
-		return controller.NewCommentController(gormDb)
+		return controller.NewCommentController(
+			gormDb,
+			c.Get("Repository.Comment").(repository.CommentRepository),
+			c.Get("Moderation.Moderator").(*moderation.Moderator),
+			c.Get("Attachment.BlobStore").(attachment.BlobStore),
+			attachmentConfig,
+			c.Get("Stream.Bus").(*stream.Bus),
+		)
+	}))
+	container.Add(dic.NewInjection("Controller.Moderation", func(c dic.Container) *controller.ModerationController {
+		return controller.NewModerationController(gormDb, c.Get("Stream.Bus").(*stream.Bus))
+	}))
+	container.Add(dic.NewInjection("Controller.Webhook", func(c dic.Container) *controller.WebhookController {
+		return controller.NewWebhookController(gormDb, c.Get("Webhook.Dispatcher").(*webhook.Dispatcher))
+	}))
+	container.Add(dic.NewInjection("Controller.Privacy", func(c dic.Container) *controller.PrivacyController {
+		return controller.NewPrivacyController(gormDb, c.Get("Attachment.BlobStore").(attachment.BlobStore))
+	}))
+	container.Add(dic.NewInjection("Controller.Cache", func(c dic.Container) *controller.CacheController {
+		return controller.NewCacheController(queryCache)
 	}))
 	container.Add(dic.NewInjection("Controller.Fibonacci", func(c dic.Container) *controller.FibonacciController {
 		return controller.NewFibonacciController()
 	}))
+	container.Add(dic.NewInjection("Middleware.Auth", func(c dic.Container) *middleware.Auth {
+		return middleware.NewAuth(authConfig)
+	}))
+	container.Add(dic.NewInjection("Middleware.Idempotency", func(c dic.Container) *middleware.Idempotency {
+		return middleware.NewIdempotency(gormDb, idempotencyConfig)
+	}))
+	container.Add(dic.NewInjection("Middleware.RateLimit", func(c dic.Container) *middleware.RateLimit {
+		return middleware.NewRateLimit(c.Get("RateLimit.Store").(ratelimit.Store), rateLimitConfig)
+	}))
+	container.Add(dic.NewInjection("Repository.Comment", func(c dic.Container) repository.CommentRepository {
+		return repository.NewGormCommentRepository(gormDb)
+	}))
+	container.Add(dic.NewInjection("Moderation.Moderator", func(c dic.Container) *moderation.Moderator {
+		return moderator
+	}))
+	container.Add(dic.NewInjection("Attachment.BlobStore", func(c dic.Container) attachment.BlobStore {
+		return blobs
+	}))
+
+	container.Add(dic.NewInjection("RateLimit.Store", func(c dic.Container) ratelimit.Store {
+		return ratelimit.NewMemoryStore()
+	}))
+
+	container.Add(dic.NewInjection("Webhook.Dispatcher", func(c dic.Container) *webhook.Dispatcher {
+		return dispatcher
+	}))
+	container.Add(dic.NewInjection("Stream.Bus", func(c dic.Container) *stream.Bus {
+		return events
+	}))
 
 	return container
 }
@@ -3,7 +3,15 @@ package main
 import (
 	"testing"
 
+	"two-in-one/attachment"
 	"two-in-one/controller"
+	"two-in-one/helper/cache"
+	"two-in-one/middleware"
+	"two-in-one/moderation"
+	"two-in-one/ratelimit"
+	"two-in-one/repository"
+	"two-in-one/stream"
+	"two-in-one/webhook"
 
 	"github.com/joho/godotenv"
 	"github.com/stretchr/testify/assert"
@@ -21,10 +29,24 @@ func Test_buildContainer(t *testing.T) {
 	defer closeConnection(gormDb)
 
 	// Build our container
-	container := buildContainer(gormDb)
+	container := buildContainer(gormDb, &middleware.AuthConfig{}, moderation.New(), &middleware.IdempotencyConfig{}, attachment.NewLocalBlobStore(t.TempDir()), &attachment.Config{}, webhook.NewDispatcher(gormDb, &webhook.Config{}), stream.NewBus(&stream.Config{BufferSize: 1}), &ratelimit.Config{}, cache.New(&cache.Config{}))
 
 	// Get the workers
 	commentController := container.Get("Controller.Comment")
 	// Controllers or workers
 	assert.IsType(t, &controller.CommentController{}, commentController)
+	assert.IsType(t, &controller.ModerationController{}, container.Get("Controller.Moderation"))
+	assert.IsType(t, &controller.WebhookController{}, container.Get("Controller.Webhook"))
+	assert.IsType(t, &controller.PrivacyController{}, container.Get("Controller.Privacy"))
+	assert.IsType(t, &controller.CacheController{}, container.Get("Controller.Cache"))
+
+	// Repositories
+	assert.IsType(t, &repository.GormCommentRepository{}, container.Get("Repository.Comment"))
+	assert.IsType(t, &attachment.LocalBlobStore{}, container.Get("Attachment.BlobStore"))
+
+	// Middlewares
+	assert.IsType(t, &middleware.Auth{}, container.Get("Middleware.Auth"))
+	assert.IsType(t, &middleware.Idempotency{}, container.Get("Middleware.Idempotency"))
+	assert.IsType(t, &middleware.RateLimit{}, container.Get("Middleware.RateLimit"))
+	assert.IsType(t, &ratelimit.MemoryStore{}, container.Get("RateLimit.Store"))
 }
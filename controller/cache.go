@@ -0,0 +1,30 @@
+package controller
+
+import (
+	"net/http"
+	"two-in-one/helper/cache"
+
+	"github.com/labstack/echo/v4"
+)
+
+// CacheController shows how well the query cache is doing
+type CacheController struct {
+	queryCache *cache.Cache
+}
+
+func NewCacheController(
+	queryCache *cache.Cache,
+) *CacheController {
+
+	// Create the base controller instance
+	newInstance := &CacheController{}
+
+	newInstance.queryCache = queryCache
+
+	return newInstance
+}
+
+// GetCacheStats returns the hit, miss and eviction counters of the query cache since the server started
+func (tc *CacheController) GetCacheStats(c echo.Context) error {
+	return c.JSON(http.StatusOK, tc.queryCache.Stats())
+}
@@ -3,7 +3,16 @@ package controller
 import (
 	"net/http"
 	"strconv"
+	"time"
+	"two-in-one/apperror"
+	"two-in-one/attachment"
+	"two-in-one/entity"
+	"two-in-one/markdown"
+	"two-in-one/middleware"
 	"two-in-one/model"
+	"two-in-one/moderation"
+	"two-in-one/repository"
+	"two-in-one/stream"
 
 	"github.com/labstack/echo/v4"
 	"gorm.io/gorm"
@@ -11,116 +20,433 @@ import (
 
 // CommentController controller object
 type CommentController struct {
-	gormDb *gorm.DB
+	// Threads, revisions and search still query the database directly
+	gormDb    *gorm.DB
+	comments  repository.CommentRepository
+	moderator *moderation.Moderator
+	blobs     attachment.BlobStore
+	limits    *attachment.Config
+
+	// Live streams get the changes from here once they are committed
+	events *stream.Bus
 }
 
 func NewCommentController(
 	gormDb *gorm.DB,
+	comments repository.CommentRepository,
+	moderator *moderation.Moderator,
+	blobs attachment.BlobStore,
+	limits *attachment.Config,
+	events *stream.Bus,
 ) *CommentController {
 
 	// Create the base controller instance
 	newInstance := &CommentController{}
 
 	newInstance.gormDb = gormDb
+	newInstance.comments = comments
+	newInstance.moderator = moderator
+	newInstance.blobs = blobs
+	newInstance.limits = limits
+	newInstance.events = events
 
 	return newInstance
 }
 
 func (tc *CommentController) GetCommentById(c echo.Context) error {
 
-	commentId, exception := strconv.Atoi(c.Param("commentId"))
+	commentId, exception := parseId(c, "commentId")
 	if exception != nil {
-		// should be proper error handling here
 		return exception
 	}
-	var comment model.Comment
+	comment, exception := tc.comments.FindById(commentId)
+	if exception != nil {
+		return apperror.Database(exception)
+	}
 
-	if exception := comment.FindById(tc.gormDb, uint32(commentId)); exception != nil {
-		// should be proper error handling here
+	if !isVisible(c, comment) {
+		return apperror.NotFound("Comment not found")
+	}
+
+	if exception := tc.loadReactions(c, []*model.Comment{comment}); exception != nil {
 		return exception
 	}
 
+	if exception := tc.comments.LoadAttachments([]*model.Comment{comment}); exception != nil {
+		return apperror.Database(exception)
+	}
+
+	setETag(c, comment)
+
 	return c.JSON(http.StatusOK, comment)
 }
 
-func (tc *CommentController) GetCommentByUserId(c echo.Context) error {
-	userId, exception := strconv.Atoi(c.Param("userId"))
+// GetCommentThread returns a comment with its nested replies
+func (tc *CommentController) GetCommentThread(c echo.Context) error {
+
+	commentId, exception := parseId(c, "commentId")
 	if exception != nil {
-		// should be proper error handling here
 		return exception
 	}
 
+	pageQuery, exception := parsePageQuery(c)
+	if exception != nil {
+		return exception
+	}
+
+	query := model.ThreadQuery{PageQuery: pageQuery}
+
+	if depth := c.QueryParam("depth"); depth != "" {
+		value, exception := strconv.Atoi(depth)
+		if exception != nil || value < 1 || value > model.MaxThreadDepth {
+			return apperror.InvalidParameter("depth", exception)
+		}
+		query.Depth = value
+	}
+
 	var comment model.Comment
 
-	comments, exception := comment.GetByUserId(tc.gormDb, uint32(userId))
+	page, exception := comment.GetThread(tc.gormDb, commentId, query)
+	if exception != nil {
+		return pageException(exception)
+	}
+
+	if !isVisible(c, &comment) {
+		return apperror.NotFound("Comment not found")
+	}
+
+	return c.JSON(http.StatusOK, map[string]interface{}{
+		"data":       comment,
+		"pagination": page,
+	})
+}
+
+func (tc *CommentController) GetCommentByUserId(c echo.Context) error {
+	userId, exception := parseId(c, "userId")
+	if exception != nil {
+		return exception
+	}
+
+	return tc.listByUserId(c, userId, model.StatusPublished)
+}
+
+// GetMyComments lists the comments of the authenticated user
+func (tc *CommentController) GetMyComments(c echo.Context) error {
+	userId, isAuthenticated := middleware.UserId(c)
+	if !isAuthenticated {
+		return apperror.Unauthorized("Authentication required", nil)
+	}
+
+	// Our own comments are listed whatever their moderation state
+	return tc.listByUserId(c, userId, "")
+}
+
+func (tc *CommentController) listByUserId(c echo.Context, userId uint32, status string) error {
+	query, exception := parseListQuery(c)
+	if exception != nil {
+		return exception
+	}
+	query.Status = status
+
+	comments, page, exception := tc.comments.ListByUserId(userId, query)
 	if exception != nil {
-		// should be proper error handling here
+		return pageException(exception)
+	}
+
+	// One query for the whole page
+	if exception := tc.loadReactions(c, comments); exception != nil {
 		return exception
 	}
 
-	return c.JSON(http.StatusOK, comments)
+	if exception := tc.comments.LoadAttachments(comments); exception != nil {
+		return apperror.Database(exception)
+	}
+
+	return c.JSON(http.StatusOK, map[string]interface{}{
+		"data":       comments,
+		"pagination": page,
+	})
 }
 
 func (tc *CommentController) UpdateComment(c echo.Context) error {
 
-	commentId, exception := strconv.Atoi(c.Param("commentId"))
+	commentId, exception := parseId(c, "commentId")
+	if exception != nil {
+		return exception
+	}
 
+	var input entity.CommentInput
+
+	if exception := c.Bind(&input); exception != nil {
+		return apperror.InvalidBody(exception)
+	}
+
+	if exception := c.Validate(&input); exception != nil {
+		return exception
+	}
+
+	ifMatch, exception := parseIfMatch(c)
 	if exception != nil {
-		// should be proper error handling here
 		return exception
 	}
 
-	var comment model.Comment
+	comment, exception := tc.findOwned(c, commentId)
+	if exception != nil {
+		return exception
+	}
 
-	comment.Body = "This is a comment"
-	comment.UserId = 5
+	// Without If-Match the edit is still based on the version we just read
+	version := comment.Version
+	if ifMatch != 0 {
+		version = ifMatch
+	}
 
-	if exception := comment.UpdateBody(tc.gormDb, uint32(commentId), comment.Body); exception != nil {
-		// should be proper error handling here
+	files, exception := formFiles(c)
+	if exception != nil {
 		return exception
 	}
 
+	// New files are added to the ones the comment already has
+	attachments, exception := tc.storeAttachments(files, comment.AttachmentCount)
+	if exception != nil {
+		return exception
+	}
+
+	flags := tc.review(input.Body)
+
+	if exception := tc.comments.UpdateBody(commentId, input.Body, comment.UserId, version, flags); exception != nil {
+		tc.discardAttachments(attachments)
+		return versionException(exception, ifMatch)
+	}
+
+	// The edit is saved already, a retry without If-Match can still add the files
+	if exception := tc.comments.AddAttachments(commentId, attachments); exception != nil {
+		tc.discardAttachments(attachments)
+		return apperror.Database(exception)
+	}
+
+	wasPublished := comment.Status == model.StatusPublished
+
+	comment.Body = input.Body
+	comment.BodyHtml = markdown.Render(input.Body)
+	comment.Version = version + 1
+	comment.AttachmentCount += uint32(len(attachments))
+	if len(flags) > 0 {
+		comment.Status = model.StatusPending
+	}
+
+	if exception := tc.comments.LoadAttachments([]*model.Comment{comment}); exception != nil {
+		return apperror.Database(exception)
+	}
+
+	tc.publishEdit(comment, wasPublished)
+
+	setETag(c, comment)
+
 	return c.JSON(http.StatusOK, comment)
 }
 
 func (tc *CommentController) CreateComment(c echo.Context) error {
 
-	tx := tc.gormDb.Begin()
+	var input entity.CommentInput
 
-	var comment model.Comment
+	if exception := c.Bind(&input); exception != nil {
+		return apperror.InvalidBody(exception)
+	}
 
-	comment.Body = "This is a comment"
-	comment.UserId = 5
+	if exception := c.Validate(&input); exception != nil {
+		return exception
+	}
 
-	tx.Save(&comment)
+	userId, isAuthenticated := middleware.UserId(c)
+	if !isAuthenticated {
+		return apperror.Unauthorized("Authentication required", nil)
+	}
+
+	comment := tc.newComment(&input, userId)
+
+	// Replies need a live, published parent
+	if input.ParentId != nil {
+		parent, exception := tc.comments.FindForWrite(*input.ParentId)
+		if exception != nil {
+			return apperror.Database(exception)
+		}
 
-	if exception := tx.Commit().Error; exception != nil {
-		tx.Rollback()
+		if parent.Status != model.StatusPublished {
+			return apperror.NotFound("Parent comment not found")
+		}
 	}
 
-	return c.JSON(http.StatusOK, map[string]interface{}{
+	files, exception := formFiles(c)
+	if exception != nil {
+		return exception
+	}
+
+	if comment.Attachments, exception = tc.storeAttachments(files, 0); exception != nil {
+		return exception
+	}
+
+	// The reply count of the parent goes up in the same transaction
+	if exception := tc.comments.Create([]*model.Comment{comment}); exception != nil {
+		tc.discardAttachments(comment.Attachments)
+		return apperror.Database(exception)
+	}
+
+	tc.events.Publish(model.EventCommentCreated, comment)
+
+	response := map[string]interface{}{
 		"success":   true,
 		"commentId": comment.Id,
-	})
+		"status":    comment.Status,
+	}
+	if len(comment.Attachments) > 0 {
+		response["attachments"] = comment.Attachments
+	}
+
+	return c.JSON(http.StatusCreated, response)
 }
 
 func (tc *CommentController) DeleteComment(c echo.Context) error {
 
-	commentId, exception := strconv.Atoi(c.Param("commentId"))
-
+	commentId, exception := parseId(c, "commentId")
 	if exception != nil {
-		// should be proper error handling here
 		return exception
 	}
 
-	var comment model.Comment
+	ifMatch, exception := parseIfMatch(c)
+	if exception != nil {
+		return exception
+	}
 
-	if exception := comment.Delete(tc.gormDb, uint32(commentId)); exception != nil {
-		// should be proper error handling here
+	comment, exception := tc.findOwned(c, commentId)
+	if exception != nil {
 		return exception
 	}
 
+	if exception := tc.comments.Delete(commentId, ifMatch); exception != nil {
+		return versionException(exception, ifMatch)
+	}
+
+	deletedAt := time.Now()
+	comment.Deleted = true
+	comment.DeletedAt = &deletedAt
+	comment.Version++
+
+	tc.events.Publish(model.EventCommentDeleted, comment)
+
 	return c.JSON(http.StatusOK, map[string]interface{}{
 		"success": true,
 	})
 }
+
+// RestoreComment undoes the soft delete of one of the caller's comments
+func (tc *CommentController) RestoreComment(c echo.Context) error {
+
+	commentId, exception := parseId(c, "commentId")
+	if exception != nil {
+		return exception
+	}
+
+	comment, exception := tc.comments.FindDeletedById(commentId)
+	if exception != nil {
+		return apperror.Database(exception)
+	}
+
+	if exception := checkOwner(c, comment); exception != nil {
+		return exception
+	}
+
+	if exception := tc.comments.Restore(commentId); exception != nil {
+		return apperror.Database(exception)
+	}
+
+	comment.Deleted = false
+	comment.DeletedAt = nil
+	comment.Version++
+
+	tc.events.Publish(model.EventCommentRestored, comment)
+
+	setETag(c, comment)
+
+	return c.JSON(http.StatusOK, comment)
+}
+
+// findOwned loads a comment and makes sure it belongs to the authenticated user, past the query cache as the write
+// that follows goes by its owner, status and version
+func (tc *CommentController) findOwned(c echo.Context, commentId uint32) (*model.Comment, error) {
+	comment, exception := tc.comments.FindForWrite(commentId)
+	if exception != nil {
+		return nil, apperror.Database(exception)
+	}
+
+	if exception := checkOwner(c, comment); exception != nil {
+		return nil, exception
+	}
+
+	return comment, nil
+}
+
+// newComment builds a comment of the user from the input, held for moderation when the filters flag it
+func (tc *CommentController) newComment(input *entity.CommentInput, userId uint32) *model.Comment {
+	comment := &model.Comment{
+		Body:     input.Body,
+		UserId:   userId,
+		ParentId: input.ParentId,
+		Status:   model.StatusPublished,
+	}
+
+	// The flags are inserted along with the comment
+	if comment.Flags = tc.review(input.Body); len(comment.Flags) > 0 {
+		comment.Status = model.StatusPending
+	}
+
+	return comment
+}
+
+// review runs a body through the moderation filters
+func (tc *CommentController) review(body string) []*model.ModerationFlag {
+	var flags []*model.ModerationFlag
+
+	for _, flag := range tc.moderator.Review(body) {
+		flags = append(flags, &model.ModerationFlag{Filter: flag.Filter, Reason: flag.Reason})
+	}
+
+	return flags
+}
+
+// publishEdit sends the edited comment to the streams, and takes it off the public ones when the edit got a
+// published comment held for moderation
+func (tc *CommentController) publishEdit(comment *model.Comment, wasPublished bool) {
+	tc.events.Publish(model.EventCommentUpdated, comment)
+
+	if wasPublished && comment.Status == model.StatusPending {
+		tc.events.Publish(stream.EventCommentHidden, comment)
+	}
+}
+
+// isVisible tells whether the caller may see the comment, only its author and moderators see it before it is published
+func isVisible(c echo.Context, comment *model.Comment) bool {
+	if comment.Status == model.StatusPublished {
+		return true
+	}
+
+	if userId, isAuthenticated := middleware.UserId(c); isAuthenticated && userId == comment.UserId {
+		return true
+	}
+
+	return middleware.HasRole(c, middleware.RoleModerator)
+}
+
+// checkOwner makes sure the comment belongs to the authenticated user
+func checkOwner(c echo.Context, comment *model.Comment) error {
+	userId, isAuthenticated := middleware.UserId(c)
+	if !isAuthenticated {
+		return apperror.Unauthorized("Authentication required", nil)
+	}
+
+	if comment.UserId != userId {
+		return apperror.Forbidden("You can only change your own comments")
+	}
+
+	return nil
+}
@@ -0,0 +1,189 @@
+package controller
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"log"
+	"mime"
+	"mime/multipart"
+	"net/http"
+	"path/filepath"
+	"strings"
+	"two-in-one/apperror"
+	"two-in-one/attachment"
+	"two-in-one/model"
+
+	"github.com/labstack/echo/v4"
+)
+
+// Bytes read to tell the type of a file, all http.DetectContentType looks at
+const sniffLength = 512
+
+// DownloadAttachment streams a file attached to a comment the caller can see
+func (tc *CommentController) DownloadAttachment(c echo.Context) error {
+
+	commentId, exception := parseId(c, "commentId")
+	if exception != nil {
+		return exception
+	}
+
+	attachmentId, exception := parseId(c, "attachmentId")
+	if exception != nil {
+		return exception
+	}
+
+	comment, exception := tc.comments.FindById(commentId)
+	if exception != nil {
+		return apperror.Database(exception)
+	}
+
+	if !isVisible(c, comment) {
+		return apperror.NotFound("Comment not found")
+	}
+
+	found, exception := tc.comments.FindAttachment(commentId, attachmentId)
+	if exception != nil {
+		return apperror.Database(exception)
+	}
+
+	content, exception := tc.blobs.Get(found.StorageKey)
+	if exception != nil {
+		return apperror.New(http.StatusServiceUnavailable, apperror.CodeUnavailable, "The attachment is currently unavailable")
+	}
+	defer content.Close()
+
+	// Only images are shown inline, anything else is downloaded
+	disposition := "attachment"
+	if strings.HasPrefix(found.ContentType, "image/") {
+		disposition = "inline"
+	}
+
+	header := c.Response().Header()
+	header.Set(echo.HeaderContentDisposition, mime.FormatMediaType(disposition, map[string]string{"filename": found.Name}))
+	header.Set(echo.HeaderContentLength, fmt.Sprint(found.Size))
+	header.Set(echo.HeaderXContentTypeOptions, "nosniff")
+	header.Set("ETag", `"`+found.Checksum+`"`)
+
+	return c.Stream(http.StatusOK, found.ContentType, content)
+}
+
+// formFiles returns the files uploaded as "attachments" of a multipart request, none for any other request
+func formFiles(c echo.Context) ([]*multipart.FileHeader, error) {
+	if !strings.HasPrefix(c.Request().Header.Get(echo.HeaderContentType), echo.MIMEMultipartForm) {
+		return nil, nil
+	}
+
+	form, exception := c.MultipartForm()
+	if exception != nil {
+		return nil, apperror.InvalidBody(exception)
+	}
+
+	return form.File["attachments"], nil
+}
+
+// storeAttachments checks the uploads against the limits and saves them to the blob store, a comment already
+// having some attachments only gets as many more as the limit leaves. Nothing is kept when one of them fails.
+func (tc *CommentController) storeAttachments(files []*multipart.FileHeader, existing uint32) ([]*model.CommentAttachment, error) {
+	if len(files) == 0 {
+		return nil, nil
+	}
+
+	if int(existing)+len(files) > tc.limits.MaxCount {
+		return nil, apperror.Validation(apperror.FieldError{
+			Field:   "attachments",
+			Code:    "max",
+			Message: fmt.Sprintf("A comment can have at most %d attachments", tc.limits.MaxCount),
+		})
+	}
+
+	attachments := make([]*model.CommentAttachment, 0, len(files))
+
+	for _, file := range files {
+		stored, exception := tc.storeAttachment(file)
+		if exception != nil {
+			tc.discardAttachments(attachments)
+			return nil, exception
+		}
+
+		attachments = append(attachments, stored)
+	}
+
+	return attachments, nil
+}
+
+func (tc *CommentController) storeAttachment(file *multipart.FileHeader) (*model.CommentAttachment, error) {
+	tooLarge := apperror.New(http.StatusRequestEntityTooLarge, "attachment_too_large",
+		fmt.Sprintf("Attachments can be at most %d bytes", tc.limits.MaxSize))
+
+	if file.Size > tc.limits.MaxSize {
+		return nil, tooLarge
+	}
+
+	content, exception := file.Open()
+	if exception != nil {
+		return nil, apperror.InvalidBody(exception)
+	}
+	defer content.Close()
+
+	// The type comes from the content, what the client claims doesn't matter
+	head := make([]byte, sniffLength)
+	read, exception := io.ReadFull(content, head)
+	if exception != nil && exception != io.ErrUnexpectedEOF && exception != io.EOF {
+		return nil, apperror.InvalidBody(exception)
+	}
+	head = head[:read]
+
+	contentType := http.DetectContentType(head)
+	if !tc.limits.Allows(contentType) {
+		return nil, apperror.New(http.StatusUnsupportedMediaType, "unsupported_attachment_type",
+			fmt.Sprintf("Files of type %s can't be attached", strings.SplitN(contentType, ";", 2)[0]))
+	}
+
+	// One byte past the limit is enough to know it's too large
+	body := io.LimitReader(io.MultiReader(bytes.NewReader(head), content), tc.limits.MaxSize+1)
+
+	blob, exception := attachment.Save(tc.blobs, body)
+	if exception != nil {
+		return nil, apperror.New(http.StatusServiceUnavailable, apperror.CodeUnavailable, "The attachment could not be stored")
+	}
+
+	stored := &model.CommentAttachment{
+		Name:        attachmentName(file.Filename),
+		Size:        blob.Size,
+		ContentType: contentType,
+		Checksum:    blob.Checksum,
+		StorageKey:  blob.Key,
+	}
+
+	if blob.Size > tc.limits.MaxSize {
+		tc.discardAttachments([]*model.CommentAttachment{stored})
+		return nil, tooLarge
+	}
+
+	return stored, nil
+}
+
+// discardAttachments removes files that were stored for a write that didn't go through
+func (tc *CommentController) discardAttachments(attachments []*model.CommentAttachment) {
+	for _, stored := range attachments {
+		if exception := tc.blobs.Delete(stored.StorageKey); exception != nil {
+			log.Printf("[Attachments] Failed to remove %s: %s", stored.StorageKey, exception.Error())
+		}
+	}
+}
+
+// attachmentName keeps the base name of an uploaded file, without any directory the client sent along
+func attachmentName(filename string) string {
+	name := filepath.Base(strings.ReplaceAll(filename, `\`, "/"))
+
+	if len(name) > 255 {
+		name = strings.ToValidUTF8(name[:255], "")
+	}
+
+	if name == "" || name == "." || name == "/" {
+		return "attachment"
+	}
+
+	return name
+}
@@ -0,0 +1,127 @@
+package controller
+
+import (
+	"bytes"
+	"encoding/json"
+	"mime/multipart"
+	"net/http"
+	"strings"
+	"two-in-one/apperror"
+	"two-in-one/model"
+)
+
+// file is an upload of a multipart request
+type file struct {
+	name    string
+	content string
+}
+
+// setMultipart replaces the echo context with a multipart request carrying a body field and files as "attachments"
+func (suite *CommentMemoryTestSuite) setMultipart(method string, body string, userId uint32, files ...file) {
+	buffer := &bytes.Buffer{}
+	writer := multipart.NewWriter(buffer)
+
+	suite.Require().NoError(writer.WriteField("body", body))
+	for _, upload := range files {
+		part, exception := writer.CreateFormFile("attachments", upload.name)
+		suite.Require().NoError(exception)
+		_, _ = part.Write([]byte(upload.content))
+	}
+	suite.Require().NoError(writer.Close())
+
+	suite.setRequest(method, buffer.String(), userId)
+	suite.Context.Request().Header.Set("Content-Type", writer.FormDataContentType())
+}
+
+func (suite *CommentMemoryTestSuite) Test_CreateComment_Attachments() {
+	suite.setMultipart(http.MethodPost, "with files", 1, file{"notes.txt", "some notes"}, file{`C:\Users\me\more.txt`, "more"})
+
+	suite.NoError(suite.controller.CreateComment(suite.Context))
+	suite.Equal(http.StatusCreated, suite.Recorder.Code)
+
+	var response struct {
+		CommentId   uint32
+		Attachments []*model.CommentAttachment
+	}
+	suite.NoError(json.Unmarshal(suite.Recorder.Body.Bytes(), &response))
+	suite.Require().Len(response.Attachments, 2)
+	suite.Equal("notes.txt", response.Attachments[0].Name)
+	suite.Equal("more.txt", response.Attachments[1].Name)
+	suite.Equal(int64(10), response.Attachments[0].Size)
+	suite.Equal("text/plain; charset=utf-8", response.Attachments[0].ContentType)
+
+	// The comment lists them
+	suite.setRequest(http.MethodGet, "", 0)
+	suite.Context.SetParamNames("commentId")
+	suite.Context.SetParamValues("1")
+	suite.NoError(suite.controller.GetCommentById(suite.Context))
+	suite.Contains(suite.Recorder.Body.String(), `"attachmentCount":2`)
+	suite.Contains(suite.Recorder.Body.String(), `"name":"notes.txt"`)
+	suite.NotContains(suite.Recorder.Body.String(), "StorageKey")
+
+	// And they can be downloaded
+	suite.setRequest(http.MethodGet, "", 0)
+	suite.Context.SetParamNames("commentId", "attachmentId")
+	suite.Context.SetParamValues("1", "1")
+	suite.NoError(suite.controller.DownloadAttachment(suite.Context))
+	suite.Equal("some notes", suite.Recorder.Body.String())
+	suite.Equal("text/plain; charset=utf-8", suite.Recorder.Header().Get("Content-Type"))
+	suite.Equal(`attachment; filename=notes.txt`, suite.Recorder.Header().Get("Content-Disposition"))
+	suite.Equal(`"`+response.Attachments[0].Checksum+`"`, suite.Recorder.Header().Get("ETag"))
+}
+
+func (suite *CommentMemoryTestSuite) Test_CreateComment_AttachmentLimits() {
+	for _, test := range []struct {
+		name       string
+		files      []file
+		wantStatus int
+	}{
+		{"Too large", []file{{"big.txt", strings.Repeat("a", 65)}}, http.StatusRequestEntityTooLarge},
+		{"Wrong type", []file{{"page.txt", "<html><body>hi</body></html>"}}, http.StatusUnsupportedMediaType},
+		{"Too many", []file{{"a.txt", "a"}, {"b.txt", "b"}, {"c.txt", "c"}}, http.StatusUnprocessableEntity},
+	} {
+		suite.setMultipart(http.MethodPost, "with files", 1, test.files...)
+
+		exception := suite.controller.CreateComment(suite.Context)
+
+		suite.Equal(test.wantStatus, apperror.From(exception).Status, test.name)
+	}
+
+	// Nothing was created
+	_, exception := suite.comments.FindById(1)
+	suite.Error(exception)
+}
+
+func (suite *CommentMemoryTestSuite) Test_UpdateComment_Attachments() {
+	suite.setMultipart(http.MethodPost, "first", 1, file{"a.txt", "a"})
+	suite.NoError(suite.controller.CreateComment(suite.Context))
+
+	suite.setMultipart(http.MethodPatch, "second", 1, file{"b.txt", "b"})
+	suite.Context.SetParamNames("commentId")
+	suite.Context.SetParamValues("1")
+	suite.NoError(suite.controller.UpdateComment(suite.Context))
+
+	var updated model.Comment
+	suite.NoError(json.Unmarshal(suite.Recorder.Body.Bytes(), &updated))
+	suite.Equal("second", updated.Body)
+	suite.Equal(uint32(2), updated.AttachmentCount)
+	suite.Len(updated.Attachments, 2)
+
+	// Two is the limit of the suite
+	suite.setMultipart(http.MethodPatch, "third", 1, file{"c.txt", "c"})
+	suite.Context.SetParamNames("commentId")
+	suite.Context.SetParamValues("1")
+
+	exception := suite.controller.UpdateComment(suite.Context)
+	suite.Equal(http.StatusUnprocessableEntity, apperror.From(exception).Status)
+}
+
+func (suite *CommentMemoryTestSuite) Test_DownloadAttachment_NotFound() {
+	suite.create(&model.Comment{Body: "no files", UserId: 1})
+
+	suite.Context.SetParamNames("commentId", "attachmentId")
+	suite.Context.SetParamValues("1", "1")
+
+	exception := suite.controller.DownloadAttachment(suite.Context)
+	suite.Equal(http.StatusNotFound, apperror.From(exception).Status)
+}
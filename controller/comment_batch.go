@@ -0,0 +1,310 @@
+package controller
+
+import (
+	"errors"
+	"net/http"
+	"two-in-one/apperror"
+	"two-in-one/entity"
+	"two-in-one/middleware"
+	"two-in-one/model"
+
+	"github.com/labstack/echo/v4"
+	"gorm.io/gorm"
+)
+
+// codeNotAttempted marks the items an atomic batch gave up on because of another item
+const codeNotAttempted = "not_attempted"
+
+// batchResult is the outcome of one item of a batch, in the order of the request
+type batchResult struct {
+	Index  int         `json:"index"`
+	Id     uint32      `json:"id,omitempty"`
+	Status int         `json:"status"`
+	Error  *batchError `json:"error,omitempty"`
+
+	// The comment to create, its id is only known once written
+	comment *model.Comment
+}
+
+type batchError struct {
+	Code    string                `json:"code"`
+	Message string                `json:"message"`
+	Fields  []apperror.FieldError `json:"fields,omitempty"`
+}
+
+// fail records why an item of a batch can't be written
+func (result *batchResult) fail(exception error) {
+	typed := apperror.From(exception)
+
+	result.Status = typed.Status
+	result.Error = &batchError{Code: typed.Code, Message: typed.Message, Fields: typed.Fields}
+	result.comment = nil
+}
+
+// CreateComments creates up to 500 comments of the caller at once
+func (tc *CommentController) CreateComments(c echo.Context) error {
+
+	var input entity.CommentBatchInput
+
+	if exception := c.Bind(&input); exception != nil {
+		return apperror.InvalidBody(exception)
+	}
+
+	if input.Mode == "" {
+		input.Mode = entity.BatchAtomic
+	}
+
+	if exception := c.Validate(&input); exception != nil {
+		return exception
+	}
+
+	userId, isAuthenticated := middleware.UserId(c)
+	if !isAuthenticated {
+		return apperror.Unauthorized("Authentication required", nil)
+	}
+
+	results := make([]*batchResult, len(input.Comments))
+	var parentIds []uint32
+
+	for i := range input.Comments {
+		results[i] = &batchResult{Index: i}
+
+		if exception := c.Validate(&input.Comments[i]); exception != nil {
+			results[i].fail(exception)
+			continue
+		}
+
+		results[i].comment = tc.newComment(&input.Comments[i], userId)
+		if parentId := input.Comments[i].ParentId; parentId != nil {
+			parentIds = append(parentIds, *parentId)
+		}
+	}
+
+	// Every parent of the batch in one query
+	parents, exception := tc.comments.FindByIds(parentIds)
+	if exception != nil {
+		return apperror.Database(exception)
+	}
+
+	published := make(map[uint32]bool, len(parents))
+	for _, parent := range parents {
+		published[parent.Id] = parent.Status == model.StatusPublished
+	}
+
+	for _, result := range results {
+		if result.comment != nil && result.comment.ParentId != nil && !published[*result.comment.ParentId] {
+			result.fail(apperror.NotFound("Parent comment not found"))
+		}
+	}
+
+	return finishBatch(c, input.Mode, results, http.StatusCreated, func() error {
+		for {
+			var comments []*model.Comment
+			for _, result := range results {
+				if result.comment != nil {
+					comments = append(comments, result.comment)
+				}
+			}
+
+			if len(comments) == 0 {
+				return nil
+			}
+
+			exception := tc.comments.Create(comments)
+			if exception == nil {
+				break
+			}
+
+			// A parent went away since it was checked, a best effort batch goes on without its replies
+			if input.Mode == entity.BatchAtomic || !errors.Is(exception, gorm.ErrRecordNotFound) {
+				return apperror.Database(exception)
+			}
+
+			if exception := tc.failOrphans(results); exception != nil {
+				return exception
+			}
+		}
+
+		var created []*model.Comment
+		for _, result := range results {
+			if result.comment != nil {
+				result.Id = result.comment.Id
+				created = append(created, result.comment)
+			}
+		}
+
+		tc.events.Publish(model.EventCommentCreated, created...)
+
+		return nil
+	})
+}
+
+// failOrphans checks the parents of the items still to create again, failing the items whose parent is no longer
+// live and published. It fails if every parent still is, as the write would fail the same way again.
+func (tc *CommentController) failOrphans(results []*batchResult) error {
+	var parentIds []uint32
+	for _, result := range results {
+		if result.comment != nil && result.comment.ParentId != nil {
+			parentIds = append(parentIds, *result.comment.ParentId)
+		}
+	}
+
+	parents, exception := tc.comments.FindByIds(parentIds)
+	if exception != nil {
+		return apperror.Database(exception)
+	}
+
+	published := make(map[uint32]bool, len(parents))
+	for _, parent := range parents {
+		published[parent.Id] = parent.Status == model.StatusPublished
+	}
+
+	orphans := 0
+	for _, result := range results {
+		if result.comment != nil && result.comment.ParentId != nil && !published[*result.comment.ParentId] {
+			result.fail(apperror.NotFound("Parent comment not found"))
+			orphans++
+		}
+	}
+
+	if orphans == 0 {
+		return apperror.Database(gorm.ErrRecordNotFound)
+	}
+
+	return nil
+}
+
+// DeleteComments soft-deletes up to 500 comments of the caller at once
+func (tc *CommentController) DeleteComments(c echo.Context) error {
+
+	var input entity.DeleteBatchInput
+
+	if exception := c.Bind(&input); exception != nil {
+		return apperror.InvalidBody(exception)
+	}
+
+	if input.Mode == "" {
+		input.Mode = entity.BatchAtomic
+	}
+
+	if exception := c.Validate(&input); exception != nil {
+		return exception
+	}
+
+	userId, isAuthenticated := middleware.UserId(c)
+	if !isAuthenticated {
+		return apperror.Unauthorized("Authentication required", nil)
+	}
+
+	comments, exception := tc.comments.FindByIds(input.Ids)
+	if exception != nil {
+		return apperror.Database(exception)
+	}
+
+	owners := make(map[uint32]uint32, len(comments))
+	for _, comment := range comments {
+		owners[comment.Id] = comment.UserId
+	}
+
+	results := make([]*batchResult, len(input.Ids))
+	seen := make(map[uint32]bool, len(input.Ids))
+	var ids []uint32
+
+	for i, id := range input.Ids {
+		results[i] = &batchResult{Index: i, Id: id}
+		owner, isLive := owners[id]
+
+		switch {
+		case seen[id]:
+			results[i].fail(apperror.New(http.StatusBadRequest, apperror.CodeBadRequest, "The comment is listed more than once"))
+		case !isLive:
+			results[i].fail(apperror.NotFound("Comment not found"))
+		case owner != userId:
+			results[i].fail(apperror.Forbidden("You can only change your own comments"))
+		default:
+			ids = append(ids, id)
+		}
+		seen[id] = true
+	}
+
+	return finishBatch(c, input.Mode, results, http.StatusOK, func() error {
+		// Someone deleting some of them in the meantime fails an atomic batch as a whole
+		deleted, exception := tc.comments.DeleteMany(ids, input.Mode == entity.BatchAtomic)
+		if exception != nil {
+			return versionException(exception, 0)
+		}
+
+		// Only the ones this batch deleted, the others had their event already
+		tc.events.Publish(model.EventCommentDeleted, deleted...)
+
+		// The others went away since they were checked
+		isDeleted := make(map[uint32]bool, len(deleted))
+		for _, comment := range deleted {
+			isDeleted[comment.Id] = true
+		}
+		for _, result := range results {
+			if result.Error == nil && !isDeleted[result.Id] {
+				result.fail(apperror.NotFound("Comment not found"))
+			}
+		}
+
+		return nil
+	})
+}
+
+// finishBatch writes the items that passed their checks, then responds with the result of every item:
+// the success status when all went through, 207 when a best effort batch wrote only some and 422 when an atomic
+// batch wrote nothing because of a failed item. A best effort write can still fail items that changed meanwhile.
+func finishBatch(c echo.Context, mode string, results []*batchResult, successStatus int, write func() error) error {
+	failed := countFailed(results)
+
+	if failed > 0 && mode == entity.BatchAtomic {
+		for _, result := range results {
+			if result.Error == nil {
+				result.Status = http.StatusFailedDependency
+				result.Error = &batchError{Code: codeNotAttempted, Message: "Another item of the batch failed"}
+			}
+		}
+
+		return c.JSON(http.StatusUnprocessableEntity, batchResponse(mode, results, failed))
+	}
+
+	if failed < len(results) {
+		if exception := write(); exception != nil {
+			return exception
+		}
+		failed = countFailed(results)
+	}
+
+	for _, result := range results {
+		if result.Error == nil {
+			result.Status = successStatus
+		}
+	}
+
+	status := successStatus
+	if failed > 0 {
+		status = http.StatusMultiStatus
+	}
+
+	return c.JSON(status, batchResponse(mode, results, failed))
+}
+
+func countFailed(results []*batchResult) int {
+	failed := 0
+	for _, result := range results {
+		if result.Error != nil {
+			failed++
+		}
+	}
+	return failed
+}
+
+func batchResponse(mode string, results []*batchResult, failed int) map[string]interface{} {
+	return map[string]interface{}{
+		"mode":      mode,
+		"succeeded": len(results) - failed,
+		"failed":    failed,
+		"results":   results,
+	}
+}
@@ -0,0 +1,294 @@
+package controller
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+	"two-in-one/apperror"
+	"two-in-one/attachment"
+	"two-in-one/helper/validator"
+	"two-in-one/middleware"
+	"two-in-one/model"
+	"two-in-one/moderation"
+	"two-in-one/repository"
+	"two-in-one/stream"
+
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/suite"
+)
+
+// CommentMemoryTestSuite runs the handlers against the in-memory repository, no SQL involved
+type CommentMemoryTestSuite struct {
+	suite.Suite
+	Context    echo.Context
+	Recorder   *httptest.ResponseRecorder
+	comments   *repository.MemoryCommentRepository
+	controller *CommentController
+}
+
+// SetupTest gives every test an empty repository and a fresh GET request
+func (suite *CommentMemoryTestSuite) SetupTest() {
+	suite.comments = repository.NewMemoryCommentRepository()
+	suite.controller = NewCommentController(
+		nil,
+		suite.comments,
+		moderation.New(moderation.NewBlockedWords([]string{"spam"})),
+		attachment.NewLocalBlobStore(suite.T().TempDir()),
+		&attachment.Config{MaxSize: 64, MaxCount: 2, Types: []string{"text/plain", "image/png"}},
+		stream.NewBus(&stream.Config{Heartbeat: time.Minute, BufferSize: 10}),
+	)
+	suite.setRequest(http.MethodGet, "", 0)
+}
+
+// setRequest replaces the echo context with a JSON request, authenticated as userId unless it is 0
+func (suite *CommentMemoryTestSuite) setRequest(method string, body string, userId uint32) {
+	request := httptest.NewRequest(method, "/", strings.NewReader(body))
+	request.Header.Set("Content-Type", "application/json")
+
+	e := echo.New()
+	e.Validator = validator.New()
+
+	suite.Recorder = httptest.NewRecorder()
+	suite.Context = e.NewContext(request, suite.Recorder)
+
+	if userId != 0 {
+		suite.Context.Set(middleware.UserIdKey, userId)
+	}
+}
+
+// create stores a comment straight in the repository
+func (suite *CommentMemoryTestSuite) create(comment *model.Comment) *model.Comment {
+	suite.Require().NoError(suite.comments.Create([]*model.Comment{comment}))
+	return comment
+}
+
+func (suite *CommentMemoryTestSuite) Test_CreateAndGet() {
+	parent := suite.create(&model.Comment{Body: "parent", UserId: 1})
+
+	suite.setRequest(http.MethodPost, `{"body":"a reply","parentId":1}`, 2)
+	suite.NoError(suite.controller.CreateComment(suite.Context))
+	suite.Equal(http.StatusCreated, suite.Recorder.Code)
+	suite.Contains(suite.Recorder.Body.String(), `"commentId":2`)
+
+	suite.setRequest(http.MethodGet, "", 0)
+	suite.Context.SetParamNames("commentId")
+	suite.Context.SetParamValues("1")
+
+	suite.NoError(suite.controller.GetCommentById(suite.Context))
+
+	var loaded model.Comment
+	suite.NoError(json.Unmarshal(suite.Recorder.Body.Bytes(), &loaded))
+	suite.Equal(parent.Id, loaded.Id)
+	suite.Equal(uint32(1), loaded.ReplyCount)
+	suite.Equal(`"1"`, suite.Recorder.Header().Get("ETag"))
+	suite.Equal("<p>parent</p>\n", loaded.BodyHtml)
+}
+
+func (suite *CommentMemoryTestSuite) Test_CreateComment_Flagged() {
+	suite.setRequest(http.MethodPost, `{"body":"buy spam here"}`, 2)
+	suite.NoError(suite.controller.CreateComment(suite.Context))
+	suite.Contains(suite.Recorder.Body.String(), `"status":"pending"`)
+
+	// Only the author sees it while it waits for a moderator
+	suite.setRequest(http.MethodGet, "", 3)
+	suite.Context.SetParamNames("commentId")
+	suite.Context.SetParamValues("1")
+
+	exception := suite.controller.GetCommentById(suite.Context)
+	suite.Equal(http.StatusNotFound, apperror.From(exception).Status)
+}
+
+func (suite *CommentMemoryTestSuite) Test_GetCommentByUserId_Paginated() {
+	for i := 0; i < 3; i++ {
+		suite.create(&model.Comment{Body: "mine", UserId: 1})
+	}
+
+	suite.Context.SetParamNames("userId")
+	suite.Context.SetParamValues("1")
+	suite.Context.Request().URL.RawQuery = "limit=2"
+
+	suite.NoError(suite.controller.GetCommentByUserId(suite.Context))
+
+	var response struct {
+		Data       []*model.Comment
+		Pagination model.Page
+	}
+	suite.NoError(json.Unmarshal(suite.Recorder.Body.Bytes(), &response))
+	suite.Len(response.Data, 2)
+	suite.NotEmpty(response.Pagination.NextCursor)
+}
+
+func (suite *CommentMemoryTestSuite) Test_UpdateComment_IfMatch() {
+	suite.create(&model.Comment{Body: "before", UserId: 1})
+
+	suite.setRequest(http.MethodPut, `{"body":"after"}`, 1)
+	suite.Context.SetParamNames("commentId")
+	suite.Context.SetParamValues("1")
+	suite.Context.Request().Header.Set("If-Match", `"1"`)
+
+	suite.NoError(suite.controller.UpdateComment(suite.Context))
+	suite.Equal(`"2"`, suite.Recorder.Header().Get("ETag"))
+
+	// The same If-Match again is now stale
+	suite.setRequest(http.MethodPut, `{"body":"again"}`, 1)
+	suite.Context.SetParamNames("commentId")
+	suite.Context.SetParamValues("1")
+	suite.Context.Request().Header.Set("If-Match", `"1"`)
+
+	exception := suite.controller.UpdateComment(suite.Context)
+	suite.Equal(http.StatusPreconditionFailed, apperror.From(exception).Status)
+
+	comment, _ := suite.comments.FindById(1)
+	suite.Equal("after", comment.Body)
+}
+
+func (suite *CommentMemoryTestSuite) Test_UpdateComment_NotOwner() {
+	suite.create(&model.Comment{Body: "before", UserId: 1})
+
+	suite.setRequest(http.MethodPut, `{"body":"after"}`, 2)
+	suite.Context.SetParamNames("commentId")
+	suite.Context.SetParamValues("1")
+
+	exception := suite.controller.UpdateComment(suite.Context)
+	suite.Equal(http.StatusForbidden, apperror.From(exception).Status)
+}
+
+func (suite *CommentMemoryTestSuite) Test_DeleteAndRestore() {
+	suite.create(&model.Comment{Body: "body", UserId: 1})
+
+	suite.setRequest(http.MethodDelete, "", 1)
+	suite.Context.SetParamNames("commentId")
+	suite.Context.SetParamValues("1")
+	suite.NoError(suite.controller.DeleteComment(suite.Context))
+
+	_, exception := suite.comments.FindById(1)
+	suite.Error(exception)
+
+	suite.setRequest(http.MethodPost, "", 1)
+	suite.Context.SetParamNames("commentId")
+	suite.Context.SetParamValues("1")
+	suite.NoError(suite.controller.RestoreComment(suite.Context))
+	suite.Equal(`"3"`, suite.Recorder.Header().Get("ETag"))
+
+	comment, exception := suite.comments.FindById(1)
+	suite.NoError(exception)
+	suite.Equal(uint32(3), comment.Version)
+}
+
+func (suite *CommentMemoryTestSuite) Test_CreateComments_BestEffort() {
+	suite.create(&model.Comment{Body: "held", UserId: 1, Status: model.StatusPending})
+
+	suite.setRequest(http.MethodPost, `{"mode":"best_effort","comments":[{"body":"fine"},{"body":"orphan","parentId":1}]}`, 2)
+	suite.NoError(suite.controller.CreateComments(suite.Context))
+	suite.Equal(http.StatusMultiStatus, suite.Recorder.Code)
+	suite.Contains(suite.Recorder.Body.String(), `"succeeded":1`)
+
+	comment, exception := suite.comments.FindById(2)
+	suite.NoError(exception)
+	suite.Equal("fine", comment.Body)
+}
+
+// racingRepository deletes a comment right after the first check of a batch, as a concurrent request would
+type racingRepository struct {
+	*repository.MemoryCommentRepository
+	victim uint32
+}
+
+func (r *racingRepository) FindByIds(commentIds []uint32) ([]*model.Comment, error) {
+	comments, exception := r.MemoryCommentRepository.FindByIds(commentIds)
+	if r.victim != 0 {
+		_ = r.Delete(r.victim, 0)
+		r.victim = 0
+	}
+	return comments, exception
+}
+
+// racing swaps the repository of the controller for one deleting the victim during the next batch
+func (suite *CommentMemoryTestSuite) racing(victim uint32) {
+	suite.controller.comments = &racingRepository{MemoryCommentRepository: suite.comments, victim: victim}
+}
+
+func (suite *CommentMemoryTestSuite) Test_CreateComments_BestEffortParentGone() {
+	suite.create(&model.Comment{Body: "parent", UserId: 1})
+	suite.racing(1)
+
+	suite.setRequest(http.MethodPost, `{"mode":"best_effort","comments":[{"body":"fine"},{"body":"reply","parentId":1}]}`, 2)
+	suite.NoError(suite.controller.CreateComments(suite.Context))
+	suite.Equal(http.StatusMultiStatus, suite.Recorder.Code)
+	suite.Contains(suite.Recorder.Body.String(), `"succeeded":1`)
+	suite.Contains(suite.Recorder.Body.String(), `"status":404`)
+
+	comment, exception := suite.comments.FindById(2)
+	suite.NoError(exception)
+	suite.Equal("fine", comment.Body)
+}
+
+func (suite *CommentMemoryTestSuite) Test_DeleteComments_BestEffortGone() {
+	suite.create(&model.Comment{Body: "first", UserId: 1})
+	suite.create(&model.Comment{Body: "second", UserId: 1})
+	suite.racing(2)
+
+	suite.setRequest(http.MethodDelete, `{"mode":"best_effort","ids":[1,2]}`, 1)
+	suite.NoError(suite.controller.DeleteComments(suite.Context))
+	suite.Equal(http.StatusMultiStatus, suite.Recorder.Code)
+
+	var response struct {
+		Succeeded int
+		Results   []batchResult
+	}
+	suite.Require().NoError(json.Unmarshal(suite.Recorder.Body.Bytes(), &response))
+	suite.Equal(1, response.Succeeded)
+	suite.Equal(http.StatusOK, response.Results[0].Status)
+	suite.Equal(http.StatusNotFound, response.Results[1].Status)
+}
+
+func (suite *CommentMemoryTestSuite) Test_DeleteComments_Atomic() {
+	suite.create(&model.Comment{Body: "mine", UserId: 1})
+	suite.create(&model.Comment{Body: "someone else's", UserId: 2})
+
+	suite.setRequest(http.MethodDelete, `{"ids":[1,2]}`, 1)
+	suite.NoError(suite.controller.DeleteComments(suite.Context))
+	suite.Equal(http.StatusUnprocessableEntity, suite.Recorder.Code)
+
+	_, exception := suite.comments.FindById(1)
+	suite.NoError(exception)
+
+	suite.setRequest(http.MethodDelete, `{"ids":[1]}`, 1)
+	suite.NoError(suite.controller.DeleteComments(suite.Context))
+	suite.Equal(http.StatusOK, suite.Recorder.Code)
+
+	_, exception = suite.comments.FindById(1)
+	suite.Error(exception)
+}
+
+func (suite *CommentMemoryTestSuite) Test_ToggleReaction() {
+	suite.create(&model.Comment{Body: "body", UserId: 1})
+
+	for _, reacted := range []bool{true, false} {
+		suite.setRequest(http.MethodPost, `{"type":"like"}`, 2)
+		suite.Context.SetParamNames("commentId")
+		suite.Context.SetParamValues("1")
+
+		suite.NoError(suite.controller.ToggleReaction(suite.Context))
+
+		var response struct {
+			Reacted   bool
+			Reactions map[string]int64
+		}
+		suite.NoError(json.Unmarshal(suite.Recorder.Body.Bytes(), &response))
+		suite.Equal(reacted, response.Reacted)
+
+		if reacted {
+			suite.Equal(int64(1), response.Reactions[model.ReactionLike])
+		} else {
+			suite.Empty(response.Reactions)
+		}
+	}
+}
+
+func TestCommentMemorySuite(t *testing.T) {
+	suite.Run(t, new(CommentMemoryTestSuite))
+}
@@ -0,0 +1,52 @@
+package controller
+
+import (
+	"net/http"
+	"strings"
+	"two-in-one/apperror"
+	"two-in-one/mention"
+	"two-in-one/model"
+
+	"github.com/labstack/echo/v4"
+)
+
+// GetMentions lists the published comments mentioning a user, given by id or by username
+func (tc *CommentController) GetMentions(c echo.Context) error {
+
+	// Read the way a mention in a body would be
+	value := c.Param("userId")
+	mentions := mention.Parse("@" + value)
+
+	var userId uint32
+	var username string
+
+	switch {
+	case len(mentions.UserIds) == 1:
+		userId = mentions.UserIds[0]
+	case len(mentions.Usernames) == 1 && mentions.Usernames[0] == strings.ToLower(value):
+		username = mentions.Usernames[0]
+	default:
+		return apperror.InvalidParameter("userId", nil)
+	}
+
+	query, exception := parseListQuery(c)
+	if exception != nil {
+		return exception
+	}
+
+	var comment model.Comment
+
+	comments, page, exception := comment.GetMentioning(tc.gormDb, userId, username, query)
+	if exception != nil {
+		return pageException(exception)
+	}
+
+	if exception := tc.loadReactions(c, comments); exception != nil {
+		return exception
+	}
+
+	return c.JSON(http.StatusOK, map[string]interface{}{
+		"data":       comments,
+		"pagination": page,
+	})
+}
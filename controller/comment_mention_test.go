@@ -0,0 +1,58 @@
+package controller
+
+import (
+	"encoding/json"
+	"net/http"
+	"two-in-one/apperror"
+	"two-in-one/model"
+
+	mocket "github.com/selvatico/go-mocket"
+)
+
+func (suite *CommentTestSuite) Test_GetMentions_ById() {
+	suite.Context.SetParamNames("userId")
+	suite.Context.SetParamValues("7")
+
+	mocket.Catcher.NewMock().
+		OneTime().
+		WithQuery("WHERE c_id IN (SELECT `fk_comment_id` FROM `comment_mentions` WHERE `fk_user_id` = 7)").
+		WithReply([]map[string]interface{}{
+			{"c_id": 3, "c_body": "hey @7", "fk_user_id": 1, "c_status": model.StatusPublished},
+		})
+
+	suite.selectReactions()
+
+	suite.NoError(suite.controller.GetMentions(suite.Context))
+
+	var response struct {
+		Data []*model.Comment `json:"data"`
+	}
+	suite.NoError(json.Unmarshal(suite.Recorder.Body.Bytes(), &response))
+	suite.Require().Len(response.Data, 1)
+	suite.Equal(uint32(3), response.Data[0].Id)
+}
+
+func (suite *CommentTestSuite) Test_GetMentions_ByUsername() {
+	suite.Context.SetParamNames("userId")
+	suite.Context.SetParamValues("Alice")
+
+	mocket.Catcher.NewMock().
+		OneTime().
+		WithQuery("WHERE c_id IN (SELECT `fk_comment_id` FROM `comment_mentions` WHERE `mn_username` = alice)").
+		WithReply([]map[string]interface{}{})
+
+	suite.NoError(suite.controller.GetMentions(suite.Context))
+	suite.Contains(suite.Recorder.Body.String(), `"data":[]`)
+}
+
+func (suite *CommentTestSuite) Test_GetMentions_InvalidUser() {
+	for _, value := range []string{"0", "not a name", "alice."} {
+		suite.SetupTest()
+		suite.Context.SetParamNames("userId")
+		suite.Context.SetParamValues(value)
+
+		exception := suite.controller.GetMentions(suite.Context)
+
+		suite.Equal(http.StatusBadRequest, apperror.From(exception).Status, value)
+	}
+}
@@ -0,0 +1,71 @@
+package controller
+
+import (
+	"net/http"
+	"two-in-one/apperror"
+	"two-in-one/entity"
+	"two-in-one/middleware"
+	"two-in-one/model"
+
+	"github.com/labstack/echo/v4"
+)
+
+// ToggleReaction adds a reaction of the caller to a comment, or takes it back when they already reacted that way
+func (tc *CommentController) ToggleReaction(c echo.Context) error {
+
+	commentId, exception := parseId(c, "commentId")
+	if exception != nil {
+		return exception
+	}
+
+	var input entity.ReactionInput
+
+	if exception := c.Bind(&input); exception != nil {
+		return apperror.InvalidBody(exception)
+	}
+
+	if exception := c.Validate(&input); exception != nil {
+		return exception
+	}
+
+	userId, isAuthenticated := middleware.UserId(c)
+	if !isAuthenticated {
+		return apperror.Unauthorized("Authentication required", nil)
+	}
+
+	comment, exception := tc.comments.FindForWrite(commentId)
+	if exception != nil {
+		return apperror.Database(exception)
+	}
+
+	if !isVisible(c, comment) {
+		return apperror.NotFound("Comment not found")
+	}
+
+	added, exception := tc.comments.ToggleReaction(commentId, userId, input.Type)
+	if exception != nil {
+		return apperror.Database(exception)
+	}
+
+	if exception := tc.loadReactions(c, []*model.Comment{comment}); exception != nil {
+		return exception
+	}
+
+	return c.JSON(http.StatusOK, map[string]interface{}{
+		"type":        input.Type,
+		"reacted":     added,
+		"reactions":   comment.Reactions,
+		"myReactions": comment.MyReactions,
+	})
+}
+
+// loadReactions fills in the reaction counts of the comments, with the caller's own reactions when authenticated
+func (tc *CommentController) loadReactions(c echo.Context, comments []*model.Comment) error {
+	viewerId, _ := middleware.UserId(c)
+
+	if exception := tc.comments.LoadReactions(comments, viewerId); exception != nil {
+		return apperror.Database(exception)
+	}
+
+	return nil
+}
@@ -0,0 +1,96 @@
+package controller
+
+import (
+	"net/http"
+	"two-in-one/apperror"
+	"two-in-one/markdown"
+	"two-in-one/model"
+
+	"github.com/labstack/echo/v4"
+)
+
+// GetCommentRevisions lists the earlier bodies of a comment, newest first
+func (tc *CommentController) GetCommentRevisions(c echo.Context) error {
+
+	commentId, exception := parseId(c, "commentId")
+	if exception != nil {
+		return exception
+	}
+
+	// Only live comments have a visible history
+	comment, exception := tc.comments.FindById(commentId)
+	if exception != nil {
+		return apperror.Database(exception)
+	}
+
+	if !isVisible(c, comment) {
+		return apperror.NotFound("Comment not found")
+	}
+
+	var revision model.CommentRevision
+
+	revisions, exception := revision.GetByCommentId(tc.gormDb, commentId)
+	if exception != nil {
+		return apperror.Database(exception)
+	}
+
+	return c.JSON(http.StatusOK, map[string]interface{}{
+		"data": revisions,
+	})
+}
+
+// RestoreCommentRevision puts the body of an earlier revision back, which is itself recorded as an edit
+func (tc *CommentController) RestoreCommentRevision(c echo.Context) error {
+
+	commentId, exception := parseId(c, "commentId")
+	if exception != nil {
+		return exception
+	}
+
+	revisionNumber, exception := parseId(c, "revision")
+	if exception != nil {
+		return exception
+	}
+
+	ifMatch, exception := parseIfMatch(c)
+	if exception != nil {
+		return exception
+	}
+
+	comment, exception := tc.findOwned(c, commentId)
+	if exception != nil {
+		return exception
+	}
+
+	version := comment.Version
+	if ifMatch != 0 {
+		version = ifMatch
+	}
+
+	var revision model.CommentRevision
+
+	if exception := revision.FindByRevision(tc.gormDb, commentId, revisionNumber); exception != nil {
+		return apperror.Database(exception)
+	}
+
+	flags := tc.review(revision.Body)
+
+	if exception := tc.comments.UpdateBody(commentId, revision.Body, comment.UserId, version, flags); exception != nil {
+		return versionException(exception, ifMatch)
+	}
+
+	wasPublished := comment.Status == model.StatusPublished
+
+	comment.Body = revision.Body
+	comment.BodyHtml = markdown.Render(revision.Body)
+	comment.Version = version + 1
+	if len(flags) > 0 {
+		comment.Status = model.StatusPending
+	}
+
+	tc.publishEdit(comment, wasPublished)
+
+	setETag(c, comment)
+
+	return c.JSON(http.StatusOK, comment)
+}
@@ -0,0 +1,39 @@
+package controller
+
+import (
+	"errors"
+	"net/http"
+	"two-in-one/apperror"
+	"two-in-one/model"
+
+	"github.com/labstack/echo/v4"
+)
+
+// SearchComments finds live comments by the words in their body, most relevant first
+func (tc *CommentController) SearchComments(c echo.Context) error {
+
+	terms := model.SearchTerms(c.QueryParam("q"))
+	if len(terms) == 0 {
+		return apperror.InvalidParameter("q", nil)
+	}
+
+	query, exception := parsePageQuery(c)
+	if exception != nil {
+		return exception
+	}
+
+	var comment model.Comment
+
+	results, page, exception := comment.Search(tc.gormDb, terms, query)
+	if errors.Is(exception, model.ErrSearchUnavailable) {
+		return apperror.New(http.StatusServiceUnavailable, apperror.CodeUnavailable, "Search is not available")
+	}
+	if exception != nil {
+		return pageException(exception)
+	}
+
+	return c.JSON(http.StatusOK, map[string]interface{}{
+		"data":       results,
+		"pagination": page,
+	})
+}
@@ -0,0 +1,93 @@
+package controller
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+	"two-in-one/apperror"
+	"two-in-one/model"
+	"two-in-one/stream"
+
+	"github.com/labstack/echo/v4"
+)
+
+// StreamComments pushes the changes to the comments of a user as Server-Sent Events until the client goes away.
+// A client resuming with Last-Event-ID first gets the events it missed, as far as the replay buffer goes back.
+func (tc *CommentController) StreamComments(c echo.Context) error {
+
+	userId, exception := parseId(c, "userId")
+	if exception != nil {
+		return exception
+	}
+
+	var lastEventId uint64
+	if header := c.Request().Header.Get("Last-Event-ID"); header != "" {
+		lastEventId, exception = strconv.ParseUint(header, 10, 64)
+		if exception != nil {
+			return apperror.InvalidParameter("Last-Event-ID", exception)
+		}
+	}
+
+	subscription, missed := tc.events.Subscribe(userId, lastEventId)
+	defer tc.events.Unsubscribe(subscription)
+
+	response := c.Response()
+	response.Header().Set(echo.HeaderContentType, "text/event-stream")
+	response.Header().Set("Cache-Control", "no-cache")
+	response.Header().Set("Connection", "keep-alive")
+
+	// Proxies like nginx would hold the events back otherwise
+	response.Header().Set("X-Accel-Buffering", "no")
+	response.WriteHeader(http.StatusOK)
+	response.Flush()
+
+	for _, event := range missed {
+		if exception := writeEvent(c, event); exception != nil {
+			return nil
+		}
+	}
+
+	heartbeat := time.NewTicker(tc.events.Heartbeat())
+	defer heartbeat.Stop()
+
+	for {
+		select {
+		case event, isOpen := <-subscription.Events():
+			// Fell too far behind, the client reconnects and catches up from the buffer
+			if !isOpen {
+				return nil
+			}
+			if exception := writeEvent(c, event); exception != nil {
+				return nil
+			}
+		case <-heartbeat.C:
+			if _, exception := fmt.Fprint(response, ": heartbeat\n\n"); exception != nil {
+				return nil
+			}
+			response.Flush()
+		case <-c.Request().Context().Done():
+			return nil
+		}
+	}
+}
+
+// writeEvent sends one event, unless the caller may not see the comment it is about. Hidden events are the other
+// way around, they only go to those who can't see the comment anymore, the others get the update instead.
+func writeEvent(c echo.Context, event *stream.Event) error {
+	visible := isVisible(c, &model.Comment{UserId: event.UserId, Status: event.Status})
+	if event.Type == stream.EventCommentHidden && visible {
+		return nil
+	}
+	if event.Type != stream.EventReset && event.Type != stream.EventCommentHidden && !visible {
+		return nil
+	}
+
+	response := c.Response()
+	if _, exception := fmt.Fprintf(response, "id: %d\nevent: %s\ndata: %s\n\n", event.Id, event.Type, event.Data); exception != nil {
+		return exception
+	}
+	response.Flush()
+
+	return nil
+}
@@ -0,0 +1,170 @@
+package controller
+
+import (
+	"bufio"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"time"
+	"two-in-one/apperror"
+	"two-in-one/model"
+	"two-in-one/stream"
+
+	"github.com/labstack/echo/v4"
+)
+
+// streamed splits a stream into its events, "<id> <type>" each, leaving out the data
+func streamed(body string) []string {
+	var events []string
+	for _, block := range strings.Split(strings.TrimSpace(body), "\n\n") {
+		var id, eventType string
+		for _, line := range strings.Split(block, "\n") {
+			if strings.HasPrefix(line, "id: ") {
+				id = strings.TrimPrefix(line, "id: ")
+			}
+			if strings.HasPrefix(line, "event: ") {
+				eventType = strings.TrimPrefix(line, "event: ")
+			}
+		}
+		if id != "" {
+			events = append(events, id+" "+eventType)
+		}
+	}
+	return events
+}
+
+// setStream replaces the echo context with a stream request of the user's comments whose client is gone already,
+// so that the handler returns once it sent what it missed
+func (suite *CommentMemoryTestSuite) setStream(userId uint32, lastEventId string, viewerId uint32) {
+	suite.setRequest(http.MethodGet, "", viewerId)
+	suite.Context.SetParamNames("userId")
+	suite.Context.SetParamValues(strconv.Itoa(int(userId)))
+	suite.Context.Request().Header.Set("Last-Event-ID", lastEventId)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	suite.Context.SetRequest(suite.Context.Request().WithContext(ctx))
+}
+
+func (suite *CommentMemoryTestSuite) Test_StreamComments_Resume() {
+	suite.setRequest(http.MethodPost, `{"body":"first"}`, 1)
+	suite.NoError(suite.controller.CreateComment(suite.Context))
+
+	suite.setRequest(http.MethodPatch, `{"body":"*edited*"}`, 1)
+	suite.Context.SetParamNames("commentId")
+	suite.Context.SetParamValues("1")
+	suite.NoError(suite.controller.UpdateComment(suite.Context))
+
+	// Held for moderation
+	suite.setRequest(http.MethodPost, `{"body":"buy spam here"}`, 1)
+	suite.NoError(suite.controller.CreateComment(suite.Context))
+
+	suite.setRequest(http.MethodDelete, "", 1)
+	suite.Context.SetParamNames("commentId")
+	suite.Context.SetParamValues("1")
+	suite.NoError(suite.controller.DeleteComment(suite.Context))
+
+	suite.setStream(1, "1", 0)
+	suite.NoError(suite.controller.StreamComments(suite.Context))
+	suite.Equal("text/event-stream", suite.Recorder.Header().Get("Content-Type"))
+	suite.Equal([]string{"2 comment.updated", "4 comment.deleted"}, streamed(suite.Recorder.Body.String()))
+	suite.Contains(suite.Recorder.Body.String(), `"bodyHtml":"\u003cp\u003e\u003cem\u003eedited`)
+	suite.Contains(suite.Recorder.Body.String(), `data: {"id":1,"version":3,"deletedAt":"`)
+	suite.Equal(1, strings.Count(suite.Recorder.Body.String(), `"body"`))
+
+	// The author sees their pending comment
+	suite.setStream(1, "1", 1)
+	suite.NoError(suite.controller.StreamComments(suite.Context))
+	suite.Equal([]string{"2 comment.updated", "3 comment.created", "4 comment.deleted"}, streamed(suite.Recorder.Body.String()))
+
+	// New streams only get what comes next
+	suite.setStream(1, "", 0)
+	suite.NoError(suite.controller.StreamComments(suite.Context))
+	suite.Empty(streamed(suite.Recorder.Body.String()))
+}
+
+func (suite *CommentMemoryTestSuite) Test_StreamComments_Hidden() {
+	suite.setRequest(http.MethodPost, `{"body":"first"}`, 1)
+	suite.NoError(suite.controller.CreateComment(suite.Context))
+
+	// The edit gets the published comment held for moderation
+	suite.setRequest(http.MethodPatch, `{"body":"buy spam here"}`, 1)
+	suite.Context.SetParamNames("commentId")
+	suite.Context.SetParamValues("1")
+	suite.NoError(suite.controller.UpdateComment(suite.Context))
+
+	// Everyone else only learns that it is gone
+	suite.setStream(1, "1", 0)
+	suite.NoError(suite.controller.StreamComments(suite.Context))
+	suite.Equal([]string{"3 comment.hidden"}, streamed(suite.Recorder.Body.String()))
+	suite.Contains(suite.Recorder.Body.String(), `data: {"id":1,"version":2}`)
+	suite.NotContains(suite.Recorder.Body.String(), "spam")
+
+	// The author gets the edit instead
+	suite.setStream(1, "1", 1)
+	suite.NoError(suite.controller.StreamComments(suite.Context))
+	suite.Equal([]string{"2 comment.updated"}, streamed(suite.Recorder.Body.String()))
+}
+
+func (suite *CommentMemoryTestSuite) Test_StreamComments_Reset() {
+	suite.controller.events = stream.NewBus(&stream.Config{Heartbeat: time.Minute, BufferSize: 1})
+
+	for _, body := range []string{`{"body":"first"}`, `{"body":"second"}`, `{"body":"third"}`} {
+		suite.setRequest(http.MethodPost, body, 1)
+		suite.NoError(suite.controller.CreateComment(suite.Context))
+	}
+
+	// Event 2 is gone from the buffer, the client has to load the comments again
+	suite.setStream(1, "1", 0)
+	suite.NoError(suite.controller.StreamComments(suite.Context))
+	suite.Equal([]string{"2 stream.reset", "3 comment.created"}, streamed(suite.Recorder.Body.String()))
+}
+
+func (suite *CommentMemoryTestSuite) Test_StreamComments_Live() {
+	suite.controller.events = stream.NewBus(&stream.Config{Heartbeat: 10 * time.Millisecond, BufferSize: 10})
+
+	e := echo.New()
+	e.GET("/comments/:userId/stream", suite.controller.StreamComments)
+	server := httptest.NewServer(e)
+	defer server.Close()
+
+	response, exception := http.Get(server.URL + "/comments/1/stream")
+	suite.Require().NoError(exception)
+	defer response.Body.Close()
+	suite.Equal(http.StatusOK, response.StatusCode)
+
+	// Subscribed once the headers are out
+	suite.controller.events.Publish(model.EventCommentCreated, &model.Comment{Id: 7, UserId: 2, Status: model.StatusPublished})
+	suite.controller.events.Publish(model.EventCommentCreated, &model.Comment{Id: 8, UserId: 1, Status: model.StatusPublished})
+
+	// Heartbeats come in between while nothing happens
+	reader := bufio.NewReader(response.Body)
+	var lines []string
+	heartbeats := 0
+	for len(lines) < 3 || heartbeats == 0 {
+		line, exception := reader.ReadString('\n')
+		suite.Require().NoError(exception)
+
+		switch line = strings.TrimSpace(line); line {
+		case "":
+		case ": heartbeat":
+			heartbeats++
+		default:
+			lines = append(lines, line)
+		}
+	}
+	suite.Require().Len(lines, 3)
+	suite.Equal("id: 2", lines[0])
+	suite.Equal("event: comment.created", lines[1])
+	suite.Contains(lines[2], `"id":8`)
+}
+
+func (suite *CommentMemoryTestSuite) Test_StreamComments_InvalidLastEventId() {
+	suite.setStream(1, "yesterday", 0)
+
+	exception := suite.controller.StreamComments(suite.Context)
+
+	suite.Equal(http.StatusBadRequest, apperror.From(exception).Status)
+}
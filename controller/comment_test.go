@@ -1,6 +1,8 @@
 package controller
 
 import (
+	"encoding/json"
+	"fmt"
 	"github.com/golang/mock/gomock"
 	"github.com/labstack/echo/v4"
 	mocket "github.com/selvatico/go-mocket"
@@ -8,10 +10,20 @@ import (
 	"gorm.io/gorm"
 	"net/http"
 	"net/http/httptest"
+	"strconv"
+	"strings"
 	"testing"
+	"time"
+	"two-in-one/apperror"
+	"two-in-one/attachment"
 	mocketHelper "two-in-one/helper/mocket"
 	structHelper "two-in-one/helper/struct"
+	"two-in-one/helper/validator"
+	"two-in-one/middleware"
 	"two-in-one/model"
+	"two-in-one/moderation"
+	"two-in-one/repository"
+	"two-in-one/stream"
 )
 
 type CommentTestSuite struct {
@@ -33,15 +45,34 @@ func (suite *CommentTestSuite) SetupSuite() {
 
 	mocketDriver := mocketHelper.Open("mocket")
 	suite.ctrl = gomock.NewController(suite.T())
-	request := httptest.NewRequest(http.MethodGet, "/", nil)
+	suite.MocketDb, _ = gorm.Open(mocketDriver, &gorm.Config{})
+	suite.MocketClient = mocketHelper.New(suite.MocketDb)
+	suite.controller = NewCommentController(
+		suite.MocketDb,
+		repository.NewGormCommentRepository(suite.MocketDb),
+		moderation.New(moderation.NewBlockedWords([]string{"spam"})),
+		attachment.NewLocalBlobStore(suite.T().TempDir()),
+		&attachment.Config{MaxSize: 1024, MaxCount: 2, Types: []string{"text/plain"}},
+		stream.NewBus(&stream.Config{Heartbeat: time.Minute, BufferSize: 10}),
+	)
+}
+
+// SetupTest gives every test a fresh GET request without a body
+func (suite *CommentTestSuite) SetupTest() {
+	suite.setRequest(http.MethodGet, "")
+}
+
+// setRequest replaces the echo context with a JSON request using the given method and body
+func (suite *CommentTestSuite) setRequest(method string, body string) {
+	request := httptest.NewRequest(method, "/", strings.NewReader(body))
 	request.Header.Set("Content-Type", "application/json")
 
+	e := echo.New()
+	e.Validator = validator.New()
+
 	// Track the response payloads
 	suite.Recorder = httptest.NewRecorder()
-	suite.Context = echo.New().NewContext(request, suite.Recorder)
-	suite.MocketDb, _ = gorm.Open(mocketDriver, &gorm.Config{})
-	suite.MocketClient = mocketHelper.New(suite.MocketDb)
-	suite.controller = NewCommentController(suite.MocketDb)
+	suite.Context = e.NewContext(request, suite.Recorder)
 }
 
 func (suite *CommentTestSuite) Test_GetCommentById_Success() {
@@ -56,12 +87,98 @@ func (suite *CommentTestSuite) Test_GetCommentById_Success() {
 				Body:    "",
 				Deleted: false,
 				UserId:  123,
+				Status:  model.StatusPublished,
+				Version: 2,
 			}),
 		},
 	})
 
+	suite.selectReactions(
+		map[string]interface{}{"fk_comment_id": 1, "rc_type": "like", "rc_count": 3, "rc_mine": 0},
+		map[string]interface{}{"fk_comment_id": 1, "rc_type": "heart", "rc_count": 1, "rc_mine": 0},
+	)
+
 	suite.NoError(suite.controller.GetCommentById(suite.Context))
+	suite.Contains(suite.Recorder.Body.String(), `"reactions":{"heart":1,"like":3}`)
+	suite.Contains(suite.Recorder.Body.String(), `"myReactions":[]`)
+	suite.Equal(`"2"`, suite.Recorder.Header().Get("ETag"))
+}
+
+func (suite *CommentTestSuite) Test_GetCommentById_Pending() {
+	for _, test := range []struct {
+		userId     uint32
+		roles      []string
+		wantStatus int
+	}{
+		{0, nil, http.StatusNotFound},
+		{5, nil, http.StatusNotFound},
+		{123, nil, http.StatusOK},
+		{5, []string{middleware.RoleModerator}, http.StatusOK},
+	} {
+		suite.SetupTest()
+		suite.Context.SetParamNames("commentId")
+		suite.Context.SetParamValues("1")
+		if test.userId != 0 {
+			suite.Context.Set(middleware.UserIdKey, test.userId)
+			suite.Context.Set(middleware.RolesKey, test.roles)
+		}
+
+		suite.MocketClient.Select(&mocketHelper.Data{
+			Model: &model.Comment{},
+			Response: []map[string]interface{}{
+				structHelper.MapAsGorm(&model.Comment{Id: 1, UserId: 123, Status: model.StatusPending}),
+			},
+		})
+
+		if test.wantStatus == http.StatusOK {
+			suite.selectReactions()
+		}
+
+		exception := suite.controller.GetCommentById(suite.Context)
+
+		if test.wantStatus == http.StatusOK {
+			suite.NoError(exception)
+			suite.Contains(suite.Recorder.Body.String(), `"status":"pending"`)
+			continue
+		}
+		suite.Equal(test.wantStatus, apperror.From(exception).Status)
+	}
+}
+
+func (suite *CommentTestSuite) Test_GetCommentById_InvalidId() {
+	suite.Context.SetParamNames("commentId")
+	suite.Context.SetParamValues("abc")
+
+	exception := suite.controller.GetCommentById(suite.Context)
+
+	suite.Equal(http.StatusBadRequest, apperror.From(exception).Status)
+}
+
+func (suite *CommentTestSuite) Test_GetCommentById_NotFound() {
+	suite.Context.SetParamNames("commentId")
+	suite.Context.SetParamValues("2")
+
+	suite.MocketClient.Select(&mocketHelper.Data{
+		Model:    &model.Comment{},
+		Response: []map[string]interface{}{},
+	})
 
+	exception := suite.controller.GetCommentById(suite.Context)
+
+	suite.Equal(http.StatusNotFound, apperror.From(exception).Status)
+}
+
+func (suite *CommentTestSuite) Test_GetCommentById_DatabaseError() {
+	suite.Context.SetParamNames("commentId")
+	suite.Context.SetParamValues("3")
+
+	suite.MocketClient.SelectWithException(&mocketHelper.Data{
+		Model: &model.Comment{},
+	})
+
+	exception := suite.controller.GetCommentById(suite.Context)
+
+	suite.Equal(http.StatusServiceUnavailable, apperror.From(exception).Status)
 }
 
 func (suite *CommentTestSuite) Test_GetCommentByUserId_Success() {
@@ -80,38 +197,642 @@ func (suite *CommentTestSuite) Test_GetCommentByUserId_Success() {
 		},
 	})
 
+	suite.selectReactions()
+
+	suite.NoError(suite.controller.GetCommentByUserId(suite.Context))
+}
+
+func (suite *CommentTestSuite) Test_GetCommentByUserId_Paginated() {
+	suite.Context.SetParamNames("userId")
+	suite.Context.SetParamValues("1")
+
+	// The cursor pointing after comment 5
+	suite.setQuery("limit=2&cursor=bjo1")
+
+	suite.MocketClient.Select(&mocketHelper.Data{
+		Model: &model.Comment{},
+		Where: []mocketHelper.Where{
+			{Field: "`fk_user_id`", Value: 1},
+			{Field: "`c_deleted`", Value: false},
+			{Field: "`c_status`", Value: model.StatusPublished},
+			{Field: "c_id", Value: 5, Operator: ">"},
+		},
+		Order:    []string{"c_id ASC"},
+		PageSize: 3,
+		Response: []map[string]interface{}{
+			structHelper.MapAsGorm(&model.Comment{Id: 6, UserId: 1}),
+			structHelper.MapAsGorm(&model.Comment{Id: 7, UserId: 1}),
+			structHelper.MapAsGorm(&model.Comment{Id: 8, UserId: 1}),
+		},
+	})
+
+	suite.selectReactions()
+
+	suite.NoError(suite.controller.GetCommentByUserId(suite.Context))
+
+	var response struct {
+		Data       []*model.Comment `json:"data"`
+		Pagination model.Page       `json:"pagination"`
+	}
+	suite.NoError(json.Unmarshal(suite.Recorder.Body.Bytes(), &response))
+
+	suite.Len(response.Data, 2)
+	suite.Equal(2, response.Pagination.Limit)
+	suite.NotEmpty(response.Pagination.NextCursor)
+	suite.NotEmpty(response.Pagination.PrevCursor)
+	suite.Nil(response.Pagination.Total)
+}
+
+func (suite *CommentTestSuite) Test_GetCommentByUserId_WithTotal() {
+	suite.Context.SetParamNames("userId")
+	suite.Context.SetParamValues("1")
+	suite.setQuery("total=true")
+
+	suite.MocketClient.Select(&mocketHelper.Data{
+		Model:    &model.Comment{},
+		Select:   []string{"count(*)"},
+		Response: []map[string]interface{}{{"count": 1}},
+	})
+
+	suite.MocketClient.Select(&mocketHelper.Data{
+		Model: &model.Comment{},
+		Response: []map[string]interface{}{
+			structHelper.MapAsGorm(&model.Comment{Id: 1, UserId: 1}),
+		},
+	})
+
+	suite.selectReactions()
+
+	suite.NoError(suite.controller.GetCommentByUserId(suite.Context))
+	suite.Contains(suite.Recorder.Body.String(), `"total":1`)
+	suite.NotContains(suite.Recorder.Body.String(), `"nextCursor"`)
+}
+
+func (suite *CommentTestSuite) Test_GetCommentByUserId_NewestSince() {
+	suite.Context.SetParamNames("userId")
+	suite.Context.SetParamValues("1")
+	suite.setQuery("order=newest&since=2022-01-01T00:00:00Z&limit=5")
+
+	suite.MocketClient.Select(&mocketHelper.Data{
+		Model: &model.Comment{},
+		Where: []mocketHelper.Where{
+			{Field: "`fk_user_id`", Value: 1},
+			{Field: "`c_deleted`", Value: false},
+			{Field: "created_at", Value: time.Date(2022, 1, 1, 0, 0, 0, 0, time.UTC), Operator: ">="},
+			{Field: "`c_status`", Value: model.StatusPublished},
+		},
+		Order:    []string{"c_id DESC"},
+		PageSize: 6,
+		Response: []map[string]interface{}{
+			structHelper.MapAsGorm(&model.Comment{Id: 2, UserId: 1}),
+			structHelper.MapAsGorm(&model.Comment{Id: 1, UserId: 1}),
+		},
+	})
+
+	suite.selectReactions()
+
 	suite.NoError(suite.controller.GetCommentByUserId(suite.Context))
 }
 
+func (suite *CommentTestSuite) Test_GetCommentByUserId_InvalidFilters() {
+	for _, query := range []string{"since=yesterday", "until=2022-13-01", "order=random"} {
+		suite.SetupTest()
+		suite.Context.SetParamNames("userId")
+		suite.Context.SetParamValues("1")
+		suite.setQuery(query)
+
+		exception := suite.controller.GetCommentByUserId(suite.Context)
+
+		suite.Equal(http.StatusBadRequest, apperror.From(exception).Status, query)
+	}
+}
+
+func (suite *CommentTestSuite) Test_GetCommentByUserId_InvalidCursor() {
+	suite.Context.SetParamNames("userId")
+	suite.Context.SetParamValues("1")
+	suite.setQuery("cursor=not-a-cursor")
+
+	exception := suite.controller.GetCommentByUserId(suite.Context)
+
+	suite.Equal(http.StatusBadRequest, apperror.From(exception).Status)
+}
+
+func (suite *CommentTestSuite) Test_GetCommentThread_Success() {
+	suite.Context.SetParamNames("commentId")
+	suite.Context.SetParamValues("1")
+	suite.setQuery("depth=2")
+
+	suite.MocketClient.Select(&mocketHelper.Data{
+		Model: &model.Comment{},
+		Response: []map[string]interface{}{
+			structHelper.MapAsGorm(&model.Comment{Id: 1, UserId: 123, ReplyCount: 1, Status: model.StatusPublished}),
+		},
+	})
+
+	suite.MocketClient.Select(&mocketHelper.Data{
+		Model: &model.Comment{},
+		Where: []mocketHelper.Where{
+			{Field: "`fk_parent_id`", Value: 1},
+		},
+		Response: []map[string]interface{}{
+			structHelper.MapAsGorm(&model.Comment{Id: 2, UserId: 5, Deleted: true}),
+		},
+	})
+
+	suite.NoError(suite.controller.GetCommentThread(suite.Context))
+	suite.Contains(suite.Recorder.Body.String(), `"body":"[deleted]"`)
+}
+
+func (suite *CommentTestSuite) Test_GetCommentThread_InvalidDepth() {
+	suite.Context.SetParamNames("commentId")
+	suite.Context.SetParamValues("1")
+	suite.setQuery("depth=100")
+
+	exception := suite.controller.GetCommentThread(suite.Context)
+
+	suite.Equal(http.StatusBadRequest, apperror.From(exception).Status)
+}
+
+func (suite *CommentTestSuite) Test_GetMyComments_Success() {
+	suite.Context.Set(middleware.UserIdKey, uint32(123))
+
+	suite.MocketClient.Select(&mocketHelper.Data{
+		Model: &model.Comment{},
+		Response: []map[string]interface{}{
+			structHelper.MapAsGorm(&model.Comment{
+				Id:     1,
+				UserId: 123,
+			}),
+		},
+	})
+
+	suite.selectReactions(
+		map[string]interface{}{"fk_comment_id": 1, "rc_type": "like", "rc_count": 2, "rc_mine": 1},
+	)
+
+	suite.NoError(suite.controller.GetMyComments(suite.Context))
+	suite.Contains(suite.Recorder.Body.String(), `"myReactions":["like"]`)
+}
+
 func (suite *CommentTestSuite) Test_UpdateComment_Success() {
+	suite.setRequest(http.MethodPatch, `{"body":"An edited comment"}`)
+	suite.Context.SetParamNames("commentId")
+	suite.Context.SetParamValues("1")
+	suite.Context.Set(middleware.UserIdKey, uint32(123))
+
+	suite.selectOwnedComment(1, 123)
+	suite.expectUpdateBody(1, 123)
+
+	suite.NoError(suite.controller.UpdateComment(suite.Context))
+	suite.Equal(http.StatusOK, suite.Recorder.Code)
+	suite.Contains(suite.Recorder.Body.String(), `"body":"An edited comment"`)
+}
+
+func (suite *CommentTestSuite) Test_UpdateComment_Flagged() {
+	suite.setRequest(http.MethodPatch, `{"body":"Now with spam"}`)
 	suite.Context.SetParamNames("commentId")
 	suite.Context.SetParamValues("1")
+	suite.Context.Set(middleware.UserIdKey, uint32(123))
+
+	suite.selectOwnedComment(1, 123)
+	suite.selectOwnedComment(1, 123)
+
+	suite.MocketClient.Select(&mocketHelper.Data{
+		Model:    &model.CommentRevision{},
+		Response: []map[string]interface{}{},
+	})
+
+	suite.MocketClient.Insert(&mocketHelper.Data{
+		Model: &model.CommentRevision{Id: 1},
+	})
+
+	suite.MocketClient.Insert(&mocketHelper.Data{
+		Model: &model.ModerationFlag{Id: 1},
+	})
 
 	suite.MocketClient.Update(&mocketHelper.Data{
 		Model: &model.Comment{Id: 1},
 	})
 
+	suite.expectEvents(&model.Comment{Id: 1, UserId: 123, Status: model.StatusPending, Version: 2})
+
 	suite.NoError(suite.controller.UpdateComment(suite.Context))
+	suite.Contains(suite.Recorder.Body.String(), `"status":"pending"`)
+}
+
+func (suite *CommentTestSuite) Test_UpdateComment_IfMatch() {
+	suite.setRequest(http.MethodPatch, `{"body":"An edited comment"}`)
+	suite.Context.SetParamNames("commentId")
+	suite.Context.SetParamValues("1")
+	suite.Context.Set(middleware.UserIdKey, uint32(123))
+	suite.Context.Request().Header.Set("If-Match", `W/"1"`)
+
+	suite.selectOwnedComment(1, 123)
+	suite.expectUpdateBody(1, 123)
+
+	suite.NoError(suite.controller.UpdateComment(suite.Context))
+	suite.Contains(suite.Recorder.Body.String(), `"version":2`)
+	suite.Equal(`"2"`, suite.Recorder.Header().Get("ETag"))
+}
+
+func (suite *CommentTestSuite) Test_UpdateComment_StaleIfMatch() {
+	for _, header := range []string{`"3"`, `"not-a-version"`} {
+		suite.setRequest(http.MethodPatch, `{"body":"An edited comment"}`)
+		suite.Context.SetParamNames("commentId")
+		suite.Context.SetParamValues("1")
+		suite.Context.Set(middleware.UserIdKey, uint32(123))
+		suite.Context.Request().Header.Set("If-Match", header)
+
+		if header == `"3"` {
+			suite.selectOwnedComment(1, 123)
+			suite.selectOwnedComment(1, 123)
+		}
+
+		exception := suite.controller.UpdateComment(suite.Context)
+
+		suite.Equal(http.StatusPreconditionFailed, apperror.From(exception).Status, header)
+	}
+}
+
+func (suite *CommentTestSuite) Test_UpdateComment_Conflict() {
+	suite.setRequest(http.MethodPatch, `{"body":"An edited comment"}`)
+	suite.Context.SetParamNames("commentId")
+	suite.Context.SetParamValues("1")
+	suite.Context.Set(middleware.UserIdKey, uint32(123))
+
+	suite.selectOwnedComment(1, 123)
+	suite.selectOwnedComment(1, 123)
+
+	suite.MocketClient.Select(&mocketHelper.Data{
+		Model:    &model.CommentRevision{},
+		Response: []map[string]interface{}{},
+	})
+
+	suite.MocketClient.Insert(&mocketHelper.Data{
+		Model: &model.CommentRevision{Id: 1},
+	})
+
+	// Someone else got their edit in first
+	suite.MocketClient.Update(&mocketHelper.Data{
+		Model:    &model.Comment{Id: 1},
+		Response: []map[string]interface{}{{"count": int64(0)}},
+	})
+
+	exception := suite.controller.UpdateComment(suite.Context)
+
+	suite.Equal(http.StatusConflict, apperror.From(exception).Status)
+}
+
+func (suite *CommentTestSuite) Test_UpdateComment_NotOwner() {
+	suite.setRequest(http.MethodPatch, `{"body":"An edited comment"}`)
+	suite.Context.SetParamNames("commentId")
+	suite.Context.SetParamValues("1")
+	suite.Context.Set(middleware.UserIdKey, uint32(5))
+
+	suite.selectOwnedComment(1, 123)
+
+	exception := suite.controller.UpdateComment(suite.Context)
+
+	suite.Equal(http.StatusForbidden, apperror.From(exception).Status)
 }
 
 func (suite *CommentTestSuite) Test_DeleteComment_Success() {
+	suite.setRequest(http.MethodDelete, "")
 	suite.Context.SetParamNames("commentId")
 	suite.Context.SetParamValues("1")
+	suite.Context.Set(middleware.UserIdKey, uint32(123))
+
+	suite.selectOwnedComment(1, 123)
 
 	suite.MocketClient.Update(&mocketHelper.Data{
 		Model: &model.Comment{Id: 1},
 	})
 
+	suite.expectEvents(&model.Comment{Id: 1, UserId: 123, Deleted: true, Version: 2})
+
 	suite.NoError(suite.controller.DeleteComment(suite.Context))
 }
 
+func (suite *CommentTestSuite) Test_DeleteComment_StaleIfMatch() {
+	suite.setRequest(http.MethodDelete, "")
+	suite.Context.SetParamNames("commentId")
+	suite.Context.SetParamValues("1")
+	suite.Context.Set(middleware.UserIdKey, uint32(123))
+	suite.Context.Request().Header.Set("If-Match", `"3"`)
+
+	suite.selectOwnedComment(1, 123)
+
+	suite.MocketClient.Update(&mocketHelper.Data{
+		Model:    &model.Comment{Id: 1},
+		Response: []map[string]interface{}{{"count": int64(0)}},
+	})
+
+	// Still there, so the version is what didn't match
+	suite.MocketClient.Select(&mocketHelper.Data{
+		Model:    &model.Comment{},
+		Select:   []string{"count(*)"},
+		Response: []map[string]interface{}{{"count": 1}},
+	})
+
+	exception := suite.controller.DeleteComment(suite.Context)
+
+	suite.Equal(http.StatusPreconditionFailed, apperror.From(exception).Status)
+}
+
+func (suite *CommentTestSuite) Test_DeleteComment_NotOwner() {
+	suite.setRequest(http.MethodDelete, "")
+	suite.Context.SetParamNames("commentId")
+	suite.Context.SetParamValues("1")
+	suite.Context.Set(middleware.UserIdKey, uint32(5))
+
+	suite.selectOwnedComment(1, 123)
+
+	exception := suite.controller.DeleteComment(suite.Context)
+
+	suite.Equal(http.StatusForbidden, apperror.From(exception).Status)
+}
+
+func (suite *CommentTestSuite) Test_CreateComment_Unauthenticated() {
+	suite.setRequest(http.MethodPost, `{"body":"This is a comment"}`)
+
+	exception := suite.controller.CreateComment(suite.Context)
+
+	suite.Equal(http.StatusUnauthorized, apperror.From(exception).Status)
+}
+
+func (suite *CommentTestSuite) Test_CreateComment_Reply() {
+	suite.setRequest(http.MethodPost, `{"body":"This is a reply","parentId":1}`)
+	suite.Context.Set(middleware.UserIdKey, uint32(5))
+	parentId := uint32(1)
+
+	suite.selectOwnedComment(1, 123)
+
+	suite.MocketClient.Update(&mocketHelper.Data{
+		Model: &model.Comment{Id: 1},
+	})
+
+	suite.selectCacheOwners(map[string]interface{}{"c_id": 1, "fk_user_id": 123})
+
+	suite.MocketClient.Insert(&mocketHelper.Data{
+		Model: &model.Comment{Id: 2},
+	})
+
+	suite.expectEvents(&model.Comment{Id: 1, UserId: 5, ParentId: &parentId, Version: 1})
+
+	suite.NoError(suite.controller.CreateComment(suite.Context))
+	suite.Equal(http.StatusCreated, suite.Recorder.Code)
+}
+
+func (suite *CommentTestSuite) Test_CreateComment_Invalid() {
+	suite.setRequest(http.MethodPost, `{"body":"   ","parentId":0}`)
+	suite.Context.Set(middleware.UserIdKey, uint32(5))
+
+	exception := suite.controller.CreateComment(suite.Context)
+
+	typed := apperror.From(exception)
+	suite.Equal(http.StatusUnprocessableEntity, typed.Status)
+	suite.Len(typed.Fields, 2)
+}
+
 func (suite *CommentTestSuite) Test_CreateComment() {
+	suite.setRequest(http.MethodPost, `{"body":"This is a comment"}`)
+	suite.Context.Set(middleware.UserIdKey, uint32(5))
 
 	suite.MocketClient.Insert(&mocketHelper.Data{
 		Model: &model.Comment{Id: 1},
 	})
 
+	suite.expectEvents(&model.Comment{Id: 1, UserId: 5, Version: 1})
+
 	suite.NoError(suite.controller.CreateComment(suite.Context))
+	suite.Equal(http.StatusCreated, suite.Recorder.Code)
+	suite.Contains(suite.Recorder.Body.String(), `"status":"published"`)
+}
+
+func (suite *CommentTestSuite) Test_CreateComment_Flagged() {
+	suite.setRequest(http.MethodPost, `{"body":"Buy my spam"}`)
+	suite.Context.Set(middleware.UserIdKey, uint32(5))
+
+	suite.MocketClient.Insert(&mocketHelper.Data{
+		Model: &model.Comment{Id: 1},
+	})
+
+	suite.MocketClient.Insert(&mocketHelper.Data{
+		Model: &model.ModerationFlag{Id: 1},
+	})
+
+	suite.expectEvents(&model.Comment{Id: 1, UserId: 5, Status: model.StatusPending, Version: 1})
+
+	suite.NoError(suite.controller.CreateComment(suite.Context))
+	suite.Equal(http.StatusCreated, suite.Recorder.Code)
+	suite.Contains(suite.Recorder.Body.String(), `"status":"pending"`)
+}
+
+func (suite *CommentTestSuite) Test_CreateComment_PendingParent() {
+	suite.setRequest(http.MethodPost, `{"body":"This is a reply","parentId":1}`)
+	suite.Context.Set(middleware.UserIdKey, uint32(5))
+
+	suite.MocketClient.Select(&mocketHelper.Data{
+		Model: &model.Comment{},
+		Response: []map[string]interface{}{
+			structHelper.MapAsGorm(&model.Comment{Id: 1, UserId: 123, Status: model.StatusPending}),
+		},
+	})
+
+	exception := suite.controller.CreateComment(suite.Context)
+
+	suite.Equal(http.StatusNotFound, apperror.From(exception).Status)
+}
+
+// expectUpdateBody mocks the transaction of UpdateBody, which keeps the current body as a revision
+func (suite *CommentTestSuite) expectUpdateBody(commentId uint32, userId uint32) {
+	suite.selectOwnedComment(commentId, userId)
+
+	suite.MocketClient.Select(&mocketHelper.Data{
+		Model: &model.CommentRevision{},
+		Response: []map[string]interface{}{
+			structHelper.MapAsGorm(&model.CommentRevision{Id: 1, CommentId: commentId, Revision: 1}),
+		},
+	})
+
+	suite.MocketClient.Insert(&mocketHelper.Data{
+		Model: &model.CommentRevision{Id: 2},
+	})
+
+	suite.MocketClient.Update(&mocketHelper.Data{
+		Model: &model.Comment{Id: commentId},
+	})
+
+	suite.expectEvents(&model.Comment{Id: commentId, UserId: userId, Body: "An edited comment", Version: 2})
+}
+
+// expectEvents mocks the outbox write of a change, which reads the changed comments back in the same transaction
+func (suite *CommentTestSuite) expectEvents(comments ...*model.Comment) {
+	ids := make([]string, 0, len(comments))
+	rows := make([]map[string]interface{}, 0, len(comments))
+	for _, comment := range comments {
+		ids = append(ids, strconv.Itoa(int(comment.Id)))
+		rows = append(rows, structHelper.MapAsGorm(comment))
+	}
+
+	mocket.Catcher.NewMock().
+		OneTime().
+		WithQuery(fmt.Sprintf("FROM `comments` WHERE c_id IN (%s) ORDER BY c_id", strings.Join(ids, ","))).
+		WithReply(rows)
+
+	suite.MocketClient.Insert(&mocketHelper.Data{
+		Model: &model.OutboxEvent{Id: 1},
+	})
+}
+
+// lockLiveComments mocks the ids DeleteMany finds still live before it deletes them
+func (suite *CommentTestSuite) lockLiveComments(ids ...uint32) {
+	rows := make([]map[string]interface{}, 0, len(ids))
+	for _, id := range ids {
+		rows = append(rows, map[string]interface{}{"c_id": id})
+	}
+
+	mocket.Catcher.NewMock().
+		OneTime().
+		WithQuery("SELECT `c_id` FROM `comments` WHERE c_id IN").
+		WithReply(rows)
+}
+
+// selectCacheOwners mocks the authors of the comments whose counters a write bumps, rows hold c_id and fk_user_id
+func (suite *CommentTestSuite) selectCacheOwners(rows ...map[string]interface{}) {
+	mocket.Catcher.NewMock().
+		OneTime().
+		WithQuery("SELECT `c_id`,`fk_user_id` FROM `comments` WHERE c_id IN").
+		WithReply(rows)
+}
+
+// selectReactions mocks the reaction counts LoadReactions aggregates, rows hold fk_comment_id, rc_type, rc_count and rc_mine
+func (suite *CommentTestSuite) selectReactions(rows ...map[string]interface{}) {
+	mocket.Catcher.NewMock().
+		OneTime().
+		WithQuery("FROM `comment_reactions` WHERE fk_comment_id IN").
+		WithReply(rows)
+}
+
+// setQuery sets the query string of the current request
+func (suite *CommentTestSuite) setQuery(query string) {
+	suite.Context.Request().URL.RawQuery = query
+}
+
+// selectOwnedComment mocks the lookup of a comment belonging to userId
+func (suite *CommentTestSuite) selectOwnedComment(commentId uint32, userId uint32) {
+	suite.MocketClient.Select(&mocketHelper.Data{
+		Model: &model.Comment{},
+		Response: []map[string]interface{}{
+			structHelper.MapAsGorm(&model.Comment{
+				Id:      commentId,
+				Body:    "This is a comment",
+				UserId:  userId,
+				Status:  model.StatusPublished,
+				Version: 1,
+			}),
+		},
+	})
+}
+
+func (suite *CommentTestSuite) Test_RestoreComment_Success() {
+	suite.setRequest(http.MethodPost, "")
+	suite.Context.SetParamNames("commentId")
+	suite.Context.SetParamValues("1")
+	suite.Context.Set(middleware.UserIdKey, uint32(123))
+
+	suite.MocketClient.Select(&mocketHelper.Data{
+		Model: &model.Comment{},
+		Response: []map[string]interface{}{
+			structHelper.MapAsGorm(&model.Comment{Id: 1, UserId: 123, Deleted: true}),
+		},
+	})
+
+	suite.MocketClient.Update(&mocketHelper.Data{
+		Model: &model.Comment{Id: 1},
+	})
+
+	suite.expectEvents(&model.Comment{Id: 1, UserId: 123, Version: 3})
+
+	suite.NoError(suite.controller.RestoreComment(suite.Context))
+	suite.Contains(suite.Recorder.Body.String(), `"deleted":false`)
+}
+
+func (suite *CommentTestSuite) Test_RestoreComment_NotOwner() {
+	suite.setRequest(http.MethodPost, "")
+	suite.Context.SetParamNames("commentId")
+	suite.Context.SetParamValues("1")
+	suite.Context.Set(middleware.UserIdKey, uint32(5))
+
+	suite.MocketClient.Select(&mocketHelper.Data{
+		Model: &model.Comment{},
+		Response: []map[string]interface{}{
+			structHelper.MapAsGorm(&model.Comment{Id: 1, UserId: 123, Deleted: true}),
+		},
+	})
+
+	exception := suite.controller.RestoreComment(suite.Context)
+
+	suite.Equal(http.StatusForbidden, apperror.From(exception).Status)
+}
+
+func (suite *CommentTestSuite) Test_GetCommentRevisions_Success() {
+	suite.Context.SetParamNames("commentId")
+	suite.Context.SetParamValues("1")
+
+	suite.selectOwnedComment(1, 123)
+
+	suite.MocketClient.Select(&mocketHelper.Data{
+		Model: &model.CommentRevision{},
+		Response: []map[string]interface{}{
+			structHelper.MapAsGorm(&model.CommentRevision{Id: 1, CommentId: 1, Revision: 1, Body: "The original", EditorId: 123}),
+		},
+	})
+
+	suite.NoError(suite.controller.GetCommentRevisions(suite.Context))
+	suite.Contains(suite.Recorder.Body.String(), `"body":"The original"`)
+}
+
+func (suite *CommentTestSuite) Test_RestoreCommentRevision_Success() {
+	suite.setRequest(http.MethodPost, "")
+	suite.Context.SetParamNames("commentId", "revision")
+	suite.Context.SetParamValues("1", "1")
+	suite.Context.Set(middleware.UserIdKey, uint32(123))
+
+	suite.selectOwnedComment(1, 123)
+
+	suite.MocketClient.Select(&mocketHelper.Data{
+		Model: &model.CommentRevision{},
+		Response: []map[string]interface{}{
+			structHelper.MapAsGorm(&model.CommentRevision{Id: 1, CommentId: 1, Revision: 1, Body: "The original", EditorId: 123}),
+		},
+	})
+
+	suite.expectUpdateBody(1, 123)
+
+	suite.NoError(suite.controller.RestoreCommentRevision(suite.Context))
+	suite.Contains(suite.Recorder.Body.String(), `"body":"The original"`)
+}
+
+func (suite *CommentTestSuite) Test_RestoreCommentRevision_NotOwner() {
+	suite.setRequest(http.MethodPost, "")
+	suite.Context.SetParamNames("commentId", "revision")
+	suite.Context.SetParamValues("1", "1")
+	suite.Context.Set(middleware.UserIdKey, uint32(5))
+
+	suite.selectOwnedComment(1, 123)
+
+	exception := suite.controller.RestoreCommentRevision(suite.Context)
+
+	suite.Equal(http.StatusForbidden, apperror.From(exception).Status)
+}
+
+func (suite *CommentTestSuite) Test_SearchComments_MissingQuery() {
+	suite.setQuery("q=%20*%20")
+
+	exception := suite.controller.SearchComments(suite.Context)
+
+	suite.Equal(http.StatusBadRequest, apperror.From(exception).Status)
 }
 
 func TestCommentSuite(t *testing.T) {
@@ -121,3 +842,200 @@ func TestCommentSuite(t *testing.T) {
 func (suite *CommentTestSuite) TearDownTest() {
 	suite.ctrl.Finish()
 }
+
+func (suite *CommentTestSuite) Test_ToggleReaction_Added() {
+	suite.setRequest(http.MethodPost, `{"type":"like"}`)
+	suite.Context.SetParamNames("commentId")
+	suite.Context.SetParamValues("1")
+	suite.Context.Set(middleware.UserIdKey, uint32(5))
+
+	suite.selectOwnedComment(1, 123)
+
+	// Nothing to take back
+	mocket.Catcher.NewMock().
+		OneTime().
+		WithQuery("DELETE FROM `comment_reactions`").
+		WithRowsNum(0)
+
+	suite.MocketClient.Insert(&mocketHelper.Data{
+		Model: &model.CommentReaction{Id: 1},
+	})
+
+	// The event goes to the author of the comment
+	mocket.Catcher.NewMock().
+		OneTime().
+		WithQuery("SELECT `fk_user_id` FROM `comments`").
+		WithReply([]map[string]interface{}{{"fk_user_id": 123}})
+
+	suite.MocketClient.Insert(&mocketHelper.Data{
+		Model: &model.OutboxEvent{Id: 1},
+	})
+
+	suite.selectReactions(
+		map[string]interface{}{"fk_comment_id": 1, "rc_type": "like", "rc_count": 1, "rc_mine": 1},
+	)
+
+	suite.NoError(suite.controller.ToggleReaction(suite.Context))
+	suite.Contains(suite.Recorder.Body.String(), `"reacted":true`)
+	suite.Contains(suite.Recorder.Body.String(), `"reactions":{"like":1}`)
+	suite.Contains(suite.Recorder.Body.String(), `"myReactions":["like"]`)
+}
+
+func (suite *CommentTestSuite) Test_ToggleReaction_Removed() {
+	suite.setRequest(http.MethodPost, `{"type":"like"}`)
+	suite.Context.SetParamNames("commentId")
+	suite.Context.SetParamValues("1")
+	suite.Context.Set(middleware.UserIdKey, uint32(5))
+
+	suite.selectOwnedComment(1, 123)
+
+	mocket.Catcher.NewMock().
+		OneTime().
+		WithQuery("DELETE FROM `comment_reactions`").
+		WithRowsNum(1)
+
+	// The event goes to the author of the comment
+	mocket.Catcher.NewMock().
+		OneTime().
+		WithQuery("SELECT `fk_user_id` FROM `comments`").
+		WithReply([]map[string]interface{}{{"fk_user_id": 123}})
+
+	suite.MocketClient.Insert(&mocketHelper.Data{
+		Model: &model.OutboxEvent{Id: 1},
+	})
+
+	suite.selectReactions()
+
+	suite.NoError(suite.controller.ToggleReaction(suite.Context))
+	suite.Contains(suite.Recorder.Body.String(), `"reacted":false`)
+	suite.Contains(suite.Recorder.Body.String(), `"reactions":{}`)
+}
+
+func (suite *CommentTestSuite) Test_ToggleReaction_InvalidType() {
+	suite.setRequest(http.MethodPost, `{"type":"love"}`)
+	suite.Context.SetParamNames("commentId")
+	suite.Context.SetParamValues("1")
+	suite.Context.Set(middleware.UserIdKey, uint32(5))
+
+	exception := suite.controller.ToggleReaction(suite.Context)
+
+	typed := apperror.From(exception)
+	suite.Equal(http.StatusUnprocessableEntity, typed.Status)
+	suite.Equal("oneof", typed.Fields[0].Code)
+}
+
+func (suite *CommentTestSuite) Test_CreateComments_BestEffort() {
+	suite.setRequest(http.MethodPost, `{"mode":"best_effort","comments":[{"body":"A good one"},{"body":"  "}]}`)
+	suite.Context.Set(middleware.UserIdKey, uint32(5))
+
+	suite.MocketClient.Insert(&mocketHelper.Data{
+		Model: &model.Comment{Id: 1},
+	})
+
+	suite.expectEvents(&model.Comment{Id: 1, UserId: 5, Version: 1})
+
+	suite.NoError(suite.controller.CreateComments(suite.Context))
+	suite.Equal(http.StatusMultiStatus, suite.Recorder.Code)
+
+	var response struct {
+		Succeeded int            `json:"succeeded"`
+		Failed    int            `json:"failed"`
+		Results   []*batchResult `json:"results"`
+	}
+	suite.NoError(json.Unmarshal(suite.Recorder.Body.Bytes(), &response))
+
+	suite.Equal(1, response.Succeeded)
+	suite.Equal(1, response.Failed)
+	suite.Equal(http.StatusCreated, response.Results[0].Status)
+	suite.Equal(uint32(1), response.Results[0].Id)
+	suite.Equal(http.StatusUnprocessableEntity, response.Results[1].Status)
+	suite.Equal("body", response.Results[1].Error.Fields[0].Field)
+}
+
+func (suite *CommentTestSuite) Test_CreateComments_AtomicWritesNothing() {
+	suite.setRequest(http.MethodPost, `{"comments":[{"body":"A good one"},{"body":"A reply","parentId":7}]}`)
+	suite.Context.Set(middleware.UserIdKey, uint32(5))
+
+	// The parent doesn't exist
+	suite.MocketClient.Select(&mocketHelper.Data{
+		Model:    &model.Comment{},
+		Response: []map[string]interface{}{},
+	})
+
+	suite.NoError(suite.controller.CreateComments(suite.Context))
+	suite.Equal(http.StatusUnprocessableEntity, suite.Recorder.Code)
+	suite.Contains(suite.Recorder.Body.String(), `"code":"not_attempted"`)
+	suite.Contains(suite.Recorder.Body.String(), `"status":404`)
+}
+
+func (suite *CommentTestSuite) Test_CreateComments_InvalidEnvelope() {
+	for _, body := range []string{`{"comments":[]}`, `{"mode":"sometimes","comments":[{"body":"A good one"}]}`} {
+		suite.setRequest(http.MethodPost, body)
+		suite.Context.Set(middleware.UserIdKey, uint32(5))
+
+		exception := suite.controller.CreateComments(suite.Context)
+
+		suite.Equal(http.StatusUnprocessableEntity, apperror.From(exception).Status, body)
+	}
+}
+
+func (suite *CommentTestSuite) Test_DeleteComments_Success() {
+	suite.setRequest(http.MethodDelete, `{"ids":[1,2]}`)
+	suite.Context.Set(middleware.UserIdKey, uint32(123))
+
+	suite.MocketClient.Select(&mocketHelper.Data{
+		Model: &model.Comment{},
+		Response: []map[string]interface{}{
+			structHelper.MapAsGorm(&model.Comment{Id: 1, UserId: 123}),
+			structHelper.MapAsGorm(&model.Comment{Id: 2, UserId: 123}),
+		},
+	})
+
+	suite.lockLiveComments(1, 2)
+
+	suite.MocketClient.Update(&mocketHelper.Data{
+		Model:    &model.Comment{Id: 1},
+		Response: []map[string]interface{}{{"count": int64(2)}},
+	})
+
+	suite.expectEvents(&model.Comment{Id: 1, UserId: 123, Deleted: true}, &model.Comment{Id: 2, UserId: 123, Deleted: true})
+
+	suite.NoError(suite.controller.DeleteComments(suite.Context))
+	suite.Equal(http.StatusOK, suite.Recorder.Code)
+	suite.Contains(suite.Recorder.Body.String(), `"succeeded":2`)
+}
+
+func (suite *CommentTestSuite) Test_DeleteComments_BestEffort() {
+	suite.setRequest(http.MethodDelete, `{"mode":"best_effort","ids":[1,2,3,1]}`)
+	suite.Context.Set(middleware.UserIdKey, uint32(123))
+
+	suite.MocketClient.Select(&mocketHelper.Data{
+		Model: &model.Comment{},
+		Response: []map[string]interface{}{
+			structHelper.MapAsGorm(&model.Comment{Id: 1, UserId: 123}),
+			structHelper.MapAsGorm(&model.Comment{Id: 2, UserId: 5}),
+		},
+	})
+
+	suite.lockLiveComments(1)
+
+	suite.MocketClient.Update(&mocketHelper.Data{
+		Model: &model.Comment{Id: 1},
+	})
+
+	suite.expectEvents(&model.Comment{Id: 1, UserId: 123, Deleted: true})
+
+	suite.NoError(suite.controller.DeleteComments(suite.Context))
+	suite.Equal(http.StatusMultiStatus, suite.Recorder.Code)
+
+	var response struct {
+		Results []*batchResult `json:"results"`
+	}
+	suite.NoError(json.Unmarshal(suite.Recorder.Body.Bytes(), &response))
+
+	statuses := make([]int, 0, len(response.Results))
+	for _, result := range response.Results {
+		statuses = append(statuses, result.Status)
+	}
+	suite.Equal([]int{http.StatusOK, http.StatusForbidden, http.StatusNotFound, http.StatusBadRequest}, statuses)
+}
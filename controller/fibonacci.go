@@ -1,11 +1,11 @@
 package controller
 
 import (
-	"fmt"
 	"github.com/labstack/echo/v4"
 	"math/big"
 	"net/http"
 	"strconv"
+	"two-in-one/apperror"
 )
 
 // FibonacciController controller object
@@ -19,9 +19,12 @@ func NewFibonacciController() *FibonacciController {
 func (fc *FibonacciController) Get(c echo.Context) error {
 	n, exception := strconv.Atoi(c.Param("n"))
 	if exception != nil {
-		// should be proper error handling here
-		fmt.Println(exception)
-		return exception
+		return apperror.InvalidParameter("n", exception)
+	}
+
+	// The sequence is not defined for negative positions
+	if n < 0 {
+		return apperror.InvalidParameter("n", nil)
 	}
 
 	result := fc.calc(uint(n))
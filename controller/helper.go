@@ -0,0 +1,127 @@
+package controller
+
+import (
+	"errors"
+	"strconv"
+	"strings"
+	"time"
+	"two-in-one/apperror"
+	"two-in-one/model"
+
+	"github.com/labstack/echo/v4"
+)
+
+// parseId reads a numeric id from the path, a malformed value is a 400
+func parseId(c echo.Context, name string) (uint32, error) {
+	value, exception := strconv.ParseUint(c.Param(name), 10, 32)
+	if exception != nil {
+		return 0, apperror.InvalidParameter(name, exception)
+	}
+
+	return uint32(value), nil
+}
+
+// parsePageQuery reads the limit, cursor and total query parameters
+func parsePageQuery(c echo.Context) (model.PageQuery, error) {
+	query := model.PageQuery{
+		Cursor:       c.QueryParam("cursor"),
+		IncludeTotal: c.QueryParam("total") == "true",
+	}
+
+	if limit := c.QueryParam("limit"); limit != "" {
+		value, exception := strconv.Atoi(limit)
+		if exception != nil || value < 1 || value > model.MaxPageLimit {
+			return query, apperror.InvalidParameter("limit", exception)
+		}
+		query.Limit = value
+	}
+
+	return query, nil
+}
+
+// parseListQuery reads the page parameters plus the since/until window and the order
+func parseListQuery(c echo.Context) (model.ListQuery, error) {
+	pageQuery, exception := parsePageQuery(c)
+	if exception != nil {
+		return model.ListQuery{}, exception
+	}
+
+	query := model.ListQuery{PageQuery: pageQuery}
+
+	switch c.QueryParam("order") {
+	case "", "oldest":
+	case "newest":
+		query.Descending = true
+	default:
+		return query, apperror.InvalidParameter("order", nil)
+	}
+
+	if query.Since, exception = parseTime(c, "since"); exception != nil {
+		return query, exception
+	}
+	if query.Until, exception = parseTime(c, "until"); exception != nil {
+		return query, exception
+	}
+
+	return query, nil
+}
+
+// parseTime reads an optional RFC 3339 query parameter
+func parseTime(c echo.Context, name string) (*time.Time, error) {
+	value := c.QueryParam(name)
+	if value == "" {
+		return nil, nil
+	}
+
+	parsed, exception := time.Parse(time.RFC3339, value)
+	if exception != nil {
+		return nil, apperror.InvalidParameter(name, exception)
+	}
+
+	return &parsed, nil
+}
+
+// pageException maps errors of a paginated query, a bad cursor is the client's fault
+func pageException(exception error) error {
+	if errors.Is(exception, model.ErrInvalidCursor) {
+		return apperror.InvalidParameter("cursor", exception)
+	}
+
+	return apperror.Database(exception)
+}
+
+// setETag exposes the version of a comment, quoted as a strong ETag
+func setETag(c echo.Context, comment *model.Comment) {
+	c.Response().Header().Set("ETag", strconv.Quote(strconv.FormatUint(uint64(comment.Version), 10)))
+}
+
+// parseIfMatch reads the comment version from the If-Match header, 0 when there's none or it's "*"
+func parseIfMatch(c echo.Context) (uint32, error) {
+	header := strings.TrimSpace(c.Request().Header.Get("If-Match"))
+	if header == "" || header == "*" {
+		return 0, nil
+	}
+
+	// Weak or strong, it's the same version number
+	tag := strings.Trim(strings.TrimPrefix(header, "W/"), `"`)
+
+	version, exception := strconv.ParseUint(tag, 10, 32)
+	if exception != nil || version == 0 {
+		return 0, apperror.PreconditionFailed("If-Match doesn't match any version of the comment", exception)
+	}
+
+	return uint32(version), nil
+}
+
+// versionException maps a version conflict to a 412 when the client sent If-Match and a 409 when it didn't
+func versionException(exception error, ifMatch uint32) error {
+	if !errors.Is(exception, model.ErrVersionConflict) {
+		return apperror.Database(exception)
+	}
+
+	if ifMatch != 0 {
+		return apperror.PreconditionFailed("The comment was changed since this version", exception)
+	}
+
+	return apperror.Conflict("The comment was changed by someone else, reload it and try again", exception)
+}
@@ -0,0 +1,89 @@
+package controller
+
+import (
+	"net/http"
+	"two-in-one/apperror"
+	"two-in-one/middleware"
+	"two-in-one/model"
+	"two-in-one/stream"
+
+	"github.com/labstack/echo/v4"
+	"gorm.io/gorm"
+)
+
+// ModerationController lets moderators work through the comments the filters held back
+type ModerationController struct {
+	gormDb *gorm.DB
+	events *stream.Bus
+}
+
+func NewModerationController(
+	gormDb *gorm.DB,
+	events *stream.Bus,
+) *ModerationController {
+
+	// Create the base controller instance
+	newInstance := &ModerationController{}
+
+	newInstance.gormDb = gormDb
+	newInstance.events = events
+
+	return newInstance
+}
+
+// GetModerationQueue lists the pending comments, oldest first, with the reasons they were flagged
+func (tc *ModerationController) GetModerationQueue(c echo.Context) error {
+	query, exception := parsePageQuery(c)
+	if exception != nil {
+		return exception
+	}
+
+	var comment model.Comment
+
+	comments, page, exception := comment.GetPending(tc.gormDb, query)
+	if exception != nil {
+		return pageException(exception)
+	}
+
+	return c.JSON(http.StatusOK, map[string]interface{}{
+		"data":       comments,
+		"pagination": page,
+	})
+}
+
+// ApproveComment publishes a pending comment
+func (tc *ModerationController) ApproveComment(c echo.Context) error {
+	return tc.moderate(c, model.StatusPublished)
+}
+
+// RejectComment keeps a pending comment hidden for good
+func (tc *ModerationController) RejectComment(c echo.Context) error {
+	return tc.moderate(c, model.StatusRejected)
+}
+
+func (tc *ModerationController) moderate(c echo.Context, status string) error {
+	commentId, exception := parseId(c, "commentId")
+	if exception != nil {
+		return exception
+	}
+
+	moderatorId, isAuthenticated := middleware.UserId(c)
+	if !isAuthenticated {
+		return apperror.Unauthorized("Authentication required", nil)
+	}
+
+	var comment model.Comment
+
+	if exception := comment.Moderate(tc.gormDb, commentId, status, moderatorId); exception != nil {
+		return apperror.Database(exception)
+	}
+
+	// Streams show the comment to everyone once it is published
+	tc.events.Publish(model.EventCommentUpdated, &comment)
+
+	return c.JSON(http.StatusOK, map[string]interface{}{
+		"success":   true,
+		"commentId": commentId,
+		"status":    status,
+	})
+}
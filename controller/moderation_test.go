@@ -0,0 +1,83 @@
+package controller
+
+import (
+	"net/http"
+	"two-in-one/apperror"
+	mocketHelper "two-in-one/helper/mocket"
+	structHelper "two-in-one/helper/struct"
+	"two-in-one/middleware"
+	"two-in-one/model"
+)
+
+func (suite *CommentTestSuite) Test_GetModerationQueue_Success() {
+	moderationController := NewModerationController(suite.MocketDb, suite.controller.events)
+
+	suite.MocketClient.Select(&mocketHelper.Data{
+		Model: &model.Comment{},
+		Where: []mocketHelper.Where{
+			{Field: "`c_status`", Value: model.StatusPending},
+		},
+		Response: []map[string]interface{}{
+			structHelper.MapAsGorm(&model.Comment{Id: 1, UserId: 5, Body: "Buy my spam", Status: model.StatusPending}),
+		},
+	})
+
+	suite.MocketClient.Select(&mocketHelper.Data{
+		Model: &model.ModerationFlag{},
+		Response: []map[string]interface{}{
+			structHelper.MapAsGorm(&model.ModerationFlag{Id: 1, CommentId: 1, Filter: "blocked_words", Reason: "contains the blocked word \"spam\""}),
+		},
+	})
+
+	suite.NoError(moderationController.GetModerationQueue(suite.Context))
+	suite.Contains(suite.Recorder.Body.String(), `"status":"pending"`)
+	suite.Contains(suite.Recorder.Body.String(), `"filter":"blocked_words"`)
+}
+
+func (suite *CommentTestSuite) Test_ApproveComment_Success() {
+	moderationController := NewModerationController(suite.MocketDb, suite.controller.events)
+
+	suite.setRequest(http.MethodPost, "")
+	suite.Context.SetParamNames("commentId")
+	suite.Context.SetParamValues("1")
+	suite.Context.Set(middleware.UserIdKey, uint32(9))
+
+	suite.MocketClient.Update(&mocketHelper.Data{
+		Model: &model.Comment{Id: 1},
+	})
+
+	suite.MocketClient.Update(&mocketHelper.Data{
+		Model: &model.ModerationFlag{Id: 1},
+	})
+
+	suite.expectEvents(&model.Comment{Id: 1, UserId: 5, Status: model.StatusPublished, Version: 1})
+
+	subscription, _ := suite.controller.events.Subscribe(5, 0)
+	defer suite.controller.events.Unsubscribe(subscription)
+
+	suite.NoError(moderationController.ApproveComment(suite.Context))
+	suite.Contains(suite.Recorder.Body.String(), `"status":"published"`)
+
+	// Streams learn about it too
+	event := <-subscription.Events()
+	suite.Equal(model.EventCommentUpdated, event.Type)
+	suite.Equal(model.StatusPublished, event.Status)
+}
+
+func (suite *CommentTestSuite) Test_RejectComment_NotPending() {
+	moderationController := NewModerationController(suite.MocketDb, suite.controller.events)
+
+	suite.setRequest(http.MethodPost, "")
+	suite.Context.SetParamNames("commentId")
+	suite.Context.SetParamValues("1")
+	suite.Context.Set(middleware.UserIdKey, uint32(9))
+
+	suite.MocketClient.Update(&mocketHelper.Data{
+		Model:    &model.Comment{Id: 1},
+		Response: []map[string]interface{}{{"count": int64(0)}},
+	})
+
+	exception := moderationController.RejectComment(suite.Context)
+
+	suite.Equal(http.StatusNotFound, apperror.From(exception).Status)
+}
@@ -0,0 +1,397 @@
+package controller
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+	"two-in-one/apperror"
+	"two-in-one/attachment"
+	"two-in-one/entity"
+	"two-in-one/middleware"
+	"two-in-one/model"
+
+	"github.com/labstack/echo/v4"
+	"gorm.io/gorm"
+)
+
+// How many comments are read per query when exporting or erasing the comments of a user
+const privacyBatchSize = 500
+
+// The formats of an export
+const (
+	exportNdjson = "ndjson"
+	exportCsv    = "csv"
+)
+
+// The columns of a CSV export, in order. The earlier bodies of a comment follow it as rows of their own with the
+// revision number set, the comment itself has none. The reactions of the user come after the comments, with the id
+// of the comment reacted to and the reaction set.
+var exportColumns = []string{"id", "revision", "parentId", "body", "status", "deleted", "createdAt", "updatedAt", "deletedAt", "reaction"}
+
+// PrivacyController answers the data subject requests of users, exporting and erasing their comments
+type PrivacyController struct {
+	gormDb *gorm.DB
+	blobs  attachment.BlobStore
+}
+
+func NewPrivacyController(
+	gormDb *gorm.DB,
+	blobs attachment.BlobStore,
+) *PrivacyController {
+
+	// Create the base controller instance
+	newInstance := &PrivacyController{}
+
+	newInstance.gormDb = gormDb
+	newInstance.blobs = blobs
+
+	return newInstance
+}
+
+// exportedComment is what an export holds of a comment, only what the user wrote and when
+type exportedComment struct {
+	Id        uint32              `json:"id"`
+	ParentId  *uint32             `json:"parentId"`
+	Body      string              `json:"body"`
+	Status    string              `json:"status"`
+	Deleted   bool                `json:"deleted"`
+	CreatedAt time.Time           `json:"createdAt"`
+	UpdatedAt time.Time           `json:"updatedAt"`
+	DeletedAt *time.Time          `json:"deletedAt"`
+	Revisions []*exportedRevision `json:"revisions"`
+}
+
+// exportedRevision is an earlier body of a comment, createdAt is when an edit replaced it
+type exportedRevision struct {
+	Revision  uint32    `json:"revision"`
+	Body      string    `json:"body"`
+	CreatedAt time.Time `json:"createdAt"`
+}
+
+func newExportedComment(comment *model.Comment) *exportedComment {
+	return &exportedComment{
+		Id:        comment.Id,
+		ParentId:  comment.ParentId,
+		Body:      comment.Body,
+		Status:    comment.Status,
+		Deleted:   comment.Deleted,
+		CreatedAt: comment.CreatedAt,
+		UpdatedAt: comment.UpdatedAt,
+		DeletedAt: comment.DeletedAt,
+		Revisions: []*exportedRevision{},
+	}
+}
+
+// records are the rows of the comment and its revisions in a CSV export, empty cells for what isn't set
+func (exported *exportedComment) records() [][]string {
+	id := strconv.FormatUint(uint64(exported.Id), 10)
+
+	parentId, deletedAt := "", ""
+	if exported.ParentId != nil {
+		parentId = strconv.FormatUint(uint64(*exported.ParentId), 10)
+	}
+	if exported.DeletedAt != nil {
+		deletedAt = exported.DeletedAt.Format(time.RFC3339)
+	}
+
+	records := [][]string{{
+		id,
+		"",
+		parentId,
+		exported.Body,
+		exported.Status,
+		strconv.FormatBool(exported.Deleted),
+		exported.CreatedAt.Format(time.RFC3339),
+		exported.UpdatedAt.Format(time.RFC3339),
+		deletedAt,
+		"",
+	}}
+
+	for _, revision := range exported.Revisions {
+		records = append(records, []string{
+			id,
+			strconv.FormatUint(uint64(revision.Revision), 10),
+			parentId,
+			revision.Body,
+			"",
+			"",
+			revision.CreatedAt.Format(time.RFC3339),
+			"",
+			"",
+			"",
+		})
+	}
+
+	return records
+}
+
+// exportedReaction is a reaction of the user to any comment, their own or someone else's
+type exportedReaction struct {
+	CommentId uint32    `json:"commentId"`
+	Reaction  string    `json:"reaction"`
+	CreatedAt time.Time `json:"createdAt"`
+}
+
+// record is the row of the reaction in a CSV export
+func (exported *exportedReaction) record() []string {
+	return []string{
+		strconv.FormatUint(uint64(exported.CommentId), 10),
+		"",
+		"",
+		"",
+		"",
+		"",
+		exported.CreatedAt.Format(time.RFC3339),
+		"",
+		"",
+		exported.Reaction,
+	}
+}
+
+// ExportComments streams all the comments of a user, soft-deleted and unpublished ones included, and then their
+// reactions, as NDJSON or CSV. Both are read and written privacyBatchSize at a time, never all at once.
+func (tc *PrivacyController) ExportComments(c echo.Context) error {
+	userId, exception := tc.checkSubject(c)
+	if exception != nil {
+		return exception
+	}
+
+	format := c.QueryParam("format")
+	if format == "" {
+		format = exportNdjson
+	}
+
+	contentType := "application/x-ndjson"
+	switch format {
+	case exportNdjson:
+	case exportCsv:
+		contentType = "text/csv; charset=utf-8"
+	default:
+		return apperror.InvalidParameter("format", nil)
+	}
+
+	response := c.Response()
+	encoder := json.NewEncoder(response)
+	writer := csv.NewWriter(response)
+
+	// The headers only go out with the first batch, until then a failure still gets a proper error
+	started := false
+	start := func() error {
+		started = true
+
+		response.Header().Set(echo.HeaderContentType, contentType)
+		response.Header().Set(echo.HeaderContentDisposition, fmt.Sprintf(`attachment; filename="comments-%d.%s"`, userId, format))
+		response.WriteHeader(http.StatusOK)
+
+		if format == exportCsv {
+			return writer.Write(exportColumns)
+		}
+		return nil
+	}
+
+	var comment model.Comment
+	var revision model.CommentRevision
+
+	exception = comment.WalkByUserId(tc.gormDb, userId, privacyBatchSize, func(batch []*model.Comment) error {
+		// The earlier bodies of the batch, only the author edits a comment
+		ids := make([]uint32, 0, len(batch))
+		for _, row := range batch {
+			ids = append(ids, row.Id)
+		}
+
+		revisions, exception := revision.GetByCommentIds(tc.gormDb, ids)
+		if exception != nil {
+			return exception
+		}
+
+		byComment := make(map[uint32][]*exportedRevision, len(batch))
+		for _, row := range revisions {
+			byComment[row.CommentId] = append(byComment[row.CommentId], &exportedRevision{
+				Revision:  row.Revision,
+				Body:      row.Body,
+				CreatedAt: row.CreatedAt,
+			})
+		}
+
+		if !started {
+			if exception := start(); exception != nil {
+				return exception
+			}
+		}
+
+		for _, row := range batch {
+			exported := newExportedComment(row)
+			if earlier, hasRevisions := byComment[row.Id]; hasRevisions {
+				exported.Revisions = earlier
+			}
+
+			if format == exportCsv {
+				for _, record := range exported.records() {
+					if exception := writer.Write(record); exception != nil {
+						return exception
+					}
+				}
+			} else if exception := encoder.Encode(exported); exception != nil {
+				return exception
+			}
+		}
+
+		writer.Flush()
+		response.Flush()
+		return writer.Error()
+	})
+
+	// The reactions go along, erasing the user removes them too
+	if exception == nil {
+		var reaction model.CommentReaction
+
+		exception = reaction.WalkByUserId(tc.gormDb, userId, privacyBatchSize, func(batch []*model.CommentReaction) error {
+			if !started {
+				if exception := start(); exception != nil {
+					return exception
+				}
+			}
+
+			for _, row := range batch {
+				exported := &exportedReaction{CommentId: row.CommentId, Reaction: row.Type, CreatedAt: row.CreatedAt}
+
+				if format == exportCsv {
+					if exception := writer.Write(exported.record()); exception != nil {
+						return exception
+					}
+				} else if exception := encoder.Encode(exported); exception != nil {
+					return exception
+				}
+			}
+
+			writer.Flush()
+			response.Flush()
+			return writer.Error()
+		})
+	}
+
+	if exception != nil {
+		if !started {
+			return apperror.Database(exception)
+		}
+
+		// Too late for an error response, the client gets a cut off export
+		log.Printf("[Export] Export of the comments of user %d broke off: %s", userId, exception.Error())
+		return nil
+	}
+
+	// Nothing to export still gets a file, with just the header row for CSV
+	if !started {
+		if exception := start(); exception != nil {
+			return nil
+		}
+		writer.Flush()
+	}
+
+	return nil
+}
+
+// EraseComments anonymises or deletes all the comments of a user, privacyBatchSize per transaction. The request is
+// recorded as an audit entry before anything is touched, and answered with it once done. A failure half way leaves
+// the batches done so far erased, asking again picks up the rest.
+func (tc *PrivacyController) EraseComments(c echo.Context) error {
+	userId, exception := tc.checkSubject(c)
+	if exception != nil {
+		return exception
+	}
+
+	var input entity.ErasureInput
+
+	if exception := c.Bind(&input); exception != nil {
+		return apperror.InvalidBody(exception)
+	}
+
+	if exception := c.Validate(&input); exception != nil {
+		return exception
+	}
+
+	requestedBy, _ := middleware.UserId(c)
+
+	erasure := &model.CommentErasure{UserId: userId, RequestedBy: requestedBy, Mode: input.Mode}
+
+	if exception := erasure.Start(tc.gormDb); exception != nil {
+		return apperror.Database(exception)
+	}
+
+	failure := tc.erase(erasure)
+	if failure != nil {
+		log.Printf("[Erasure] Erasure %d of the comments of user %d failed: %s", erasure.Id, userId, failure.Error())
+	}
+
+	if exception := erasure.Finish(tc.gormDb, failure); exception != nil {
+		return apperror.Database(exception)
+	}
+
+	if failure != nil {
+		return apperror.Database(failure)
+	}
+
+	return c.JSON(http.StatusOK, erasure)
+}
+
+// erase works through the comments of the user batch by batch, counting on the audit entry as it goes
+func (tc *PrivacyController) erase(erasure *model.CommentErasure) error {
+	var comment model.Comment
+
+	for {
+		batch, exception := comment.FindForErasure(tc.gormDb, erasure.UserId, privacyBatchSize)
+		if exception != nil {
+			return exception
+		}
+
+		// The files go first, a failure leaves the comment to the next request rather than an orphaned file
+		for _, row := range batch {
+			for _, file := range row.Attachments {
+				if exception := tc.blobs.Delete(file.StorageKey); exception != nil {
+					return exception
+				}
+			}
+		}
+
+		anonymised, deleted, exception := comment.Erase(tc.gormDb, erasure.UserId, batch, erasure.Mode)
+		if exception != nil {
+			return exception
+		}
+
+		erasure.Anonymised += anonymised
+		erasure.Deleted += deleted
+
+		// Even a user without comments gets their reactions erased
+		if len(batch) == 0 {
+			return nil
+		}
+	}
+}
+
+// checkSubject reads the user of the request, which only that user and moderators may make
+func (tc *PrivacyController) checkSubject(c echo.Context) (uint32, error) {
+	userId, exception := parseId(c, "userId")
+	if exception != nil {
+		return 0, exception
+	}
+
+	// Anonymised comments belong to user 0
+	if userId == 0 {
+		return 0, apperror.InvalidParameter("userId", nil)
+	}
+
+	callerId, isAuthenticated := middleware.UserId(c)
+	if !isAuthenticated {
+		return 0, apperror.Unauthorized("Authentication required", nil)
+	}
+
+	if callerId != userId && !middleware.HasRole(c, middleware.RoleModerator) {
+		return 0, apperror.Forbidden("You can only ask for your own comments")
+	}
+
+	return userId, nil
+}
@@ -0,0 +1,203 @@
+package controller
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"two-in-one/apperror"
+	"two-in-one/attachment"
+	"two-in-one/helper/validator"
+	"two-in-one/middleware"
+	"two-in-one/model"
+
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/suite"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+)
+
+// PrivacyTestSuite runs the handlers against an in-memory SQLite database and a blob store in a temporary directory
+type PrivacyTestSuite struct {
+	suite.Suite
+	Context    echo.Context
+	Recorder   *httptest.ResponseRecorder
+	gormDb     *gorm.DB
+	blobs      *attachment.LocalBlobStore
+	controller *PrivacyController
+}
+
+func TestPrivacySuite(t *testing.T) {
+	suite.Run(t, new(PrivacyTestSuite))
+}
+
+// SetupTest gives every test two comments of user 1, one of them edited and the other deleted and with a file, and
+// one of user 2 which user 1 reacted to
+func (suite *PrivacyTestSuite) SetupTest() {
+	gormDb, exception := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{})
+	suite.Require().NoError(exception)
+
+	// Every connection to ":memory:" is a separate database
+	sqlDb, _ := gormDb.DB()
+	sqlDb.SetMaxOpenConns(1)
+
+	suite.Require().NoError(gormDb.AutoMigrate(&model.Comment{}, &model.CommentRevision{}, &model.ModerationFlag{}, &model.CommentReaction{}, &model.CommentMention{}, &model.CommentAttachment{}, &model.OutboxEvent{}, &model.CommentErasure{}))
+
+	suite.gormDb = gormDb
+	suite.blobs = attachment.NewLocalBlobStore(suite.T().TempDir())
+	suite.controller = NewPrivacyController(gormDb, suite.blobs)
+
+	suite.Require().NoError(gormDb.Create(&model.Comment{Body: "hello, world", UserId: 1}).Error)
+	suite.Require().NoError(gormDb.Create(&model.Comment{Body: "with a file", UserId: 1, Attachments: []*model.CommentAttachment{{StorageKey: "file"}}}).Error)
+	suite.Require().NoError(gormDb.Create(&model.Comment{Body: "someone else", UserId: 2}).Error)
+	suite.Require().NoError(suite.blobs.Put("file", strings.NewReader("content")))
+
+	var comment model.Comment
+	suite.Require().NoError(comment.UpdateBody(gormDb, 1, "hello, world!", 1, 0, nil))
+	suite.Require().NoError(comment.Delete(gormDb, 2, 0))
+
+	// User 1 reacts to the comment of user 2
+	var reaction model.CommentReaction
+	_, exception = reaction.Toggle(gormDb, 3, 1, "like")
+	suite.Require().NoError(exception)
+}
+
+func (suite *PrivacyTestSuite) TearDownTest() {
+	sqlDb, _ := suite.gormDb.DB()
+	_ = sqlDb.Close()
+}
+
+// setRequest replaces the echo context with a request about the comments of subjectId, made by callerId
+func (suite *PrivacyTestSuite) setRequest(method string, target string, body string, subjectId string, callerId uint32, roles ...string) {
+	request := httptest.NewRequest(method, target, strings.NewReader(body))
+	request.Header.Set("Content-Type", "application/json")
+
+	e := echo.New()
+	e.Validator = validator.New()
+
+	suite.Recorder = httptest.NewRecorder()
+	suite.Context = e.NewContext(request, suite.Recorder)
+	suite.Context.SetParamNames("userId")
+	suite.Context.SetParamValues(subjectId)
+	suite.Context.Set(middleware.UserIdKey, callerId)
+	suite.Context.Set(middleware.RolesKey, roles)
+}
+
+func (suite *PrivacyTestSuite) Test_ExportComments_Ndjson() {
+	suite.setRequest(http.MethodGet, "/", "", "1", 1)
+	suite.Require().NoError(suite.controller.ExportComments(suite.Context))
+
+	suite.Equal(http.StatusOK, suite.Recorder.Code)
+	suite.Equal("application/x-ndjson", suite.Recorder.Header().Get(echo.HeaderContentType))
+	suite.Equal(`attachment; filename="comments-1.ndjson"`, suite.Recorder.Header().Get(echo.HeaderContentDisposition))
+
+	lines := strings.Split(strings.TrimSpace(suite.Recorder.Body.String()), "\n")
+	suite.Require().Len(lines, 3)
+
+	var exported []map[string]interface{}
+	for _, line := range lines {
+		var row map[string]interface{}
+		suite.Require().NoError(json.Unmarshal([]byte(line), &row))
+		exported = append(exported, row)
+	}
+	suite.Equal("hello, world!", exported[0]["body"])
+	suite.Equal(false, exported[0]["deleted"])
+	suite.Require().Len(exported[0]["revisions"], 1)
+	suite.Equal("hello, world", exported[0]["revisions"].([]interface{})[0].(map[string]interface{})["body"])
+	suite.Empty(exported[1]["revisions"])
+	suite.Equal("with a file", exported[1]["body"])
+	suite.Equal(true, exported[1]["deleted"])
+	suite.NotNil(exported[1]["deletedAt"])
+
+	// The reactions of the user come last
+	suite.Equal(float64(3), exported[2]["commentId"])
+	suite.Equal("like", exported[2]["reaction"])
+	suite.NotNil(exported[2]["createdAt"])
+}
+
+func (suite *PrivacyTestSuite) Test_ExportComments_Csv() {
+	// Moderators export anyone's comments
+	suite.setRequest(http.MethodGet, "/?format=csv", "", "1", 9, middleware.RoleModerator)
+	suite.Require().NoError(suite.controller.ExportComments(suite.Context))
+
+	suite.Equal("text/csv; charset=utf-8", suite.Recorder.Header().Get(echo.HeaderContentType))
+
+	lines := strings.Split(strings.TrimSpace(suite.Recorder.Body.String()), "\n")
+	suite.Require().Len(lines, 5)
+	suite.Equal("id,revision,parentId,body,status,deleted,createdAt,updatedAt,deletedAt,reaction", lines[0])
+	suite.True(strings.HasPrefix(lines[1], `1,,,"hello, world!",published,false,`))
+	suite.True(strings.HasPrefix(lines[2], `1,1,,"hello, world",,,`))
+	suite.True(strings.HasPrefix(lines[3], `2,,,with a file,published,true,`))
+	suite.True(strings.HasPrefix(lines[4], `3,,,,,,`))
+	suite.True(strings.HasSuffix(lines[4], `,,,like`))
+
+	// Nothing written still gets the header row
+	suite.setRequest(http.MethodGet, "/?format=csv", "", "5", 5)
+	suite.Require().NoError(suite.controller.ExportComments(suite.Context))
+	suite.Equal("id,revision,parentId,body,status,deleted,createdAt,updatedAt,deletedAt,reaction\n", suite.Recorder.Body.String())
+}
+
+func (suite *PrivacyTestSuite) Test_ExportComments_Invalid() {
+	tests := []struct {
+		target    string
+		subjectId string
+		status    int
+	}{
+		{"/", "2", http.StatusForbidden},
+		{"/", "0", http.StatusBadRequest},
+		{"/?format=xml", "1", http.StatusBadRequest},
+	}
+
+	for _, test := range tests {
+		suite.setRequest(http.MethodGet, test.target, "", test.subjectId, 1)
+		suite.Equal(test.status, apperror.From(suite.controller.ExportComments(suite.Context)).Status, test.target)
+	}
+}
+
+func (suite *PrivacyTestSuite) Test_EraseComments() {
+	suite.setRequest(http.MethodPost, "/", `{"mode":"delete"}`, "1", 1)
+	suite.Require().NoError(suite.controller.EraseComments(suite.Context))
+	suite.Equal(http.StatusOK, suite.Recorder.Code)
+
+	var erasure model.CommentErasure
+	suite.Require().NoError(json.Unmarshal(suite.Recorder.Body.Bytes(), &erasure))
+	suite.Equal(uint32(1), erasure.UserId)
+	suite.Equal(uint32(1), erasure.RequestedBy)
+	suite.Equal(model.ErasureCompleted, erasure.Status)
+	suite.Equal(int64(2), erasure.Deleted)
+
+	// Only the comment of the other user is left, and the file is gone
+	var left []*model.Comment
+	suite.Require().NoError(suite.gormDb.Find(&left).Error)
+	suite.Require().Len(left, 1)
+	suite.Equal(uint32(2), left[0].UserId)
+
+	_, exception := suite.blobs.Get("file")
+	suite.Error(exception)
+
+	// So are the reaction, the revisions and the events
+	for _, related := range []interface{}{&model.CommentReaction{}, &model.CommentRevision{}, &model.OutboxEvent{}} {
+		var count int64
+		suite.Require().NoError(suite.gormDb.Model(related).Count(&count).Error)
+		suite.Equal(int64(0), count)
+	}
+
+	// The audit entry stays
+	var audit []*model.CommentErasure
+	suite.Require().NoError(suite.gormDb.Find(&audit).Error)
+	suite.Require().Len(audit, 1)
+	suite.NotNil(audit[0].CompletedAt)
+}
+
+func (suite *PrivacyTestSuite) Test_EraseComments_Invalid() {
+	suite.setRequest(http.MethodPost, "/", `{"mode":"shred"}`, "1", 1)
+	suite.Equal(http.StatusUnprocessableEntity, apperror.From(suite.controller.EraseComments(suite.Context)).Status)
+
+	suite.setRequest(http.MethodPost, "/", `{"mode":"anonymise"}`, "1", 2)
+	suite.Equal(http.StatusForbidden, apperror.From(suite.controller.EraseComments(suite.Context)).Status)
+
+	var audit int64
+	suite.Require().NoError(suite.gormDb.Model(&model.CommentErasure{}).Count(&audit).Error)
+	suite.Equal(int64(0), audit)
+}
@@ -0,0 +1,253 @@
+package controller
+
+import (
+	"net/http"
+	"strconv"
+	"two-in-one/apperror"
+	"two-in-one/entity"
+	"two-in-one/middleware"
+	"two-in-one/model"
+	"two-in-one/webhook"
+
+	"github.com/labstack/echo/v4"
+	"gorm.io/gorm"
+)
+
+// WebhookController lets users manage the webhook subscriptions that get the events about their comments
+type WebhookController struct {
+	gormDb     *gorm.DB
+	dispatcher *webhook.Dispatcher
+}
+
+func NewWebhookController(
+	gormDb *gorm.DB,
+	dispatcher *webhook.Dispatcher,
+) *WebhookController {
+
+	// Create the base controller instance
+	newInstance := &WebhookController{}
+
+	newInstance.gormDb = gormDb
+	newInstance.dispatcher = dispatcher
+
+	return newInstance
+}
+
+// GetWebhooks lists the caller's subscriptions, oldest first
+func (tc *WebhookController) GetWebhooks(c echo.Context) error {
+	userId, isAuthenticated := middleware.UserId(c)
+	if !isAuthenticated {
+		return apperror.Unauthorized("Authentication required", nil)
+	}
+
+	var subscription model.WebhookSubscription
+
+	subscriptions, exception := subscription.GetByUserId(tc.gormDb, userId)
+	if exception != nil {
+		return apperror.Database(exception)
+	}
+
+	for _, subscription := range subscriptions {
+		subscription.Secret = ""
+	}
+
+	return c.JSON(http.StatusOK, map[string]interface{}{
+		"data": subscriptions,
+	})
+}
+
+// GetWebhook returns one of the caller's subscriptions
+func (tc *WebhookController) GetWebhook(c echo.Context) error {
+	subscription, exception := tc.findOwned(c)
+	if exception != nil {
+		return exception
+	}
+
+	subscription.Secret = ""
+
+	return c.JSON(http.StatusOK, subscription)
+}
+
+// CreateWebhook registers a subscription of the caller, the answer is the only time the secret is shown
+func (tc *WebhookController) CreateWebhook(c echo.Context) error {
+
+	var input entity.WebhookInput
+
+	if exception := c.Bind(&input); exception != nil {
+		return apperror.InvalidBody(exception)
+	}
+
+	if exception := c.Validate(&input); exception != nil {
+		return exception
+	}
+
+	userId, isAuthenticated := middleware.UserId(c)
+	if !isAuthenticated {
+		return apperror.Unauthorized("Authentication required", nil)
+	}
+
+	subscription := &model.WebhookSubscription{
+		UserId: userId,
+		Url:    input.Url,
+		Events: unique(input.Events),
+		Active: input.Active == nil || *input.Active,
+	}
+
+	if input.Secret != nil {
+		subscription.Secret = *input.Secret
+	} else {
+		secret, exception := webhook.NewSecret()
+		if exception != nil {
+			return exception
+		}
+		subscription.Secret = secret
+	}
+
+	if exception := tc.gormDb.Create(subscription).Error; exception != nil {
+		return apperror.Database(exception)
+	}
+
+	return c.JSON(http.StatusCreated, subscription)
+}
+
+// UpdateWebhook changes the fields of a subscription that are set, pausing or resuming it included
+func (tc *WebhookController) UpdateWebhook(c echo.Context) error {
+
+	var input entity.WebhookPatchInput
+
+	if exception := c.Bind(&input); exception != nil {
+		return apperror.InvalidBody(exception)
+	}
+
+	if exception := c.Validate(&input); exception != nil {
+		return exception
+	}
+
+	subscription, exception := tc.findOwned(c)
+	if exception != nil {
+		return exception
+	}
+
+	if input.Url != nil {
+		subscription.Url = *input.Url
+	}
+	if input.Events != nil {
+		subscription.Events = unique(*input.Events)
+	}
+	if input.Secret != nil {
+		subscription.Secret = *input.Secret
+	}
+	if input.Active != nil {
+		subscription.Active = *input.Active
+	}
+
+	if exception := subscription.Update(tc.gormDb); exception != nil {
+		return apperror.Database(exception)
+	}
+
+	// The caller sent the new secret, no need to show it back
+	subscription.Secret = ""
+
+	return c.JSON(http.StatusOK, subscription)
+}
+
+// DeleteWebhook removes a subscription, events not delivered to it yet are dropped
+func (tc *WebhookController) DeleteWebhook(c echo.Context) error {
+	subscription, exception := tc.findOwned(c)
+	if exception != nil {
+		return exception
+	}
+
+	if exception := subscription.Delete(tc.gormDb, subscription.Id); exception != nil {
+		return apperror.Database(exception)
+	}
+
+	return c.JSON(http.StatusOK, map[string]interface{}{
+		"success": true,
+	})
+}
+
+// TestWebhook sends a webhook.test event to a subscription right away and answers with how it went.
+// A receiver that fails is still a 200, the attempt tells what happened.
+func (tc *WebhookController) TestWebhook(c echo.Context) error {
+	subscription, exception := tc.findOwned(c)
+	if exception != nil {
+		return exception
+	}
+
+	attempt, exception := tc.dispatcher.SendTest(subscription)
+	if exception != nil {
+		return apperror.Database(exception)
+	}
+
+	return c.JSON(http.StatusOK, attempt)
+}
+
+// GetWebhookDeliveries lists the latest requests sent to a subscription, newest first, with their status and latency
+func (tc *WebhookController) GetWebhookDeliveries(c echo.Context) error {
+	limit := model.DefaultPageLimit
+
+	if value := c.QueryParam("limit"); value != "" {
+		parsed, exception := strconv.Atoi(value)
+		if exception != nil || parsed < 1 || parsed > model.MaxPageLimit {
+			return apperror.InvalidParameter("limit", exception)
+		}
+		limit = parsed
+	}
+
+	subscription, exception := tc.findOwned(c)
+	if exception != nil {
+		return exception
+	}
+
+	var attempt model.WebhookAttempt
+
+	attempts, exception := attempt.GetBySubscriptionId(tc.gormDb, subscription.Id, limit)
+	if exception != nil {
+		return apperror.Database(exception)
+	}
+
+	return c.JSON(http.StatusOK, map[string]interface{}{
+		"data": attempts,
+	})
+}
+
+// findOwned loads the subscription in the path, the ones of other users don't exist as far as the caller knows
+func (tc *WebhookController) findOwned(c echo.Context) (*model.WebhookSubscription, error) {
+	subscriptionId, exception := parseId(c, "webhookId")
+	if exception != nil {
+		return nil, exception
+	}
+
+	userId, isAuthenticated := middleware.UserId(c)
+	if !isAuthenticated {
+		return nil, apperror.Unauthorized("Authentication required", nil)
+	}
+
+	var subscription model.WebhookSubscription
+
+	if exception := subscription.FindById(tc.gormDb, subscriptionId); exception != nil {
+		return nil, apperror.Database(exception)
+	}
+
+	if subscription.UserId != userId {
+		return nil, apperror.NotFound("Webhook not found")
+	}
+
+	return &subscription, nil
+}
+
+// unique drops repeated values, keeping the first of each
+func unique(values []string) []string {
+	seen := make(map[string]bool, len(values))
+	kept := []string{}
+
+	for _, value := range values {
+		if !seen[value] {
+			seen[value] = true
+			kept = append(kept, value)
+		}
+	}
+
+	return kept
+}
@@ -0,0 +1,225 @@
+package controller
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"two-in-one/apperror"
+	"two-in-one/helper/validator"
+	"two-in-one/middleware"
+	"two-in-one/model"
+	"two-in-one/webhook"
+
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/suite"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+)
+
+// WebhookTestSuite runs the handlers against an in-memory SQLite database and a local receiver
+type WebhookTestSuite struct {
+	suite.Suite
+	Context    echo.Context
+	Recorder   *httptest.ResponseRecorder
+	gormDb     *gorm.DB
+	receiver   *httptest.Server
+	status     int
+	controller *WebhookController
+}
+
+// SetupTest gives every test an empty database and a receiver answering with suite.status
+func (suite *WebhookTestSuite) SetupTest() {
+	gormDb, exception := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{})
+	suite.Require().NoError(exception)
+
+	// Every connection to ":memory:" is a separate database
+	sqlDb, _ := gormDb.DB()
+	sqlDb.SetMaxOpenConns(1)
+
+	suite.Require().NoError(gormDb.AutoMigrate(&model.WebhookSubscription{}, &model.WebhookDelivery{}, &model.WebhookAttempt{}))
+
+	suite.status = http.StatusNoContent
+	suite.receiver = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, request *http.Request) {
+		w.WriteHeader(suite.status)
+	}))
+
+	suite.gormDb = gormDb
+	suite.controller = NewWebhookController(gormDb, webhook.NewDispatcher(gormDb, &webhook.Config{AllowPrivate: true}))
+	suite.setRequest(http.MethodGet, "", 1)
+}
+
+func (suite *WebhookTestSuite) TearDownTest() {
+	suite.receiver.Close()
+
+	sqlDb, _ := suite.gormDb.DB()
+	_ = sqlDb.Close()
+}
+
+// setRequest replaces the echo context with a JSON request, authenticated as userId unless it is 0
+func (suite *WebhookTestSuite) setRequest(method string, body string, userId uint32) {
+	request := httptest.NewRequest(method, "/", strings.NewReader(body))
+	request.Header.Set("Content-Type", "application/json")
+
+	e := echo.New()
+	e.Validator = validator.New()
+
+	suite.Recorder = httptest.NewRecorder()
+	suite.Context = e.NewContext(request, suite.Recorder)
+
+	if userId != 0 {
+		suite.Context.Set(middleware.UserIdKey, userId)
+	}
+}
+
+// create registers a subscription through the handler and returns the answer
+func (suite *WebhookTestSuite) create(body string, userId uint32) *model.WebhookSubscription {
+	suite.setRequest(http.MethodPost, body, userId)
+	suite.Require().NoError(suite.controller.CreateWebhook(suite.Context))
+	suite.Require().Equal(http.StatusCreated, suite.Recorder.Code)
+
+	var subscription model.WebhookSubscription
+	suite.Require().NoError(json.Unmarshal(suite.Recorder.Body.Bytes(), &subscription))
+	return &subscription
+}
+
+func (suite *WebhookTestSuite) Test_CreateAndList() {
+	created := suite.create(`{"url":"`+suite.receiver.URL+`","events":["comment.deleted","comment.deleted"]}`, 1)
+	suite.Equal([]string{model.EventCommentDeleted}, created.Events)
+	suite.True(created.Active)
+
+	// A secret was made up, and this is the only time it is shown
+	suite.Len(created.Secret, 64)
+
+	suite.create(`{"url":"https://example.com/hook","secret":"0123456789abcdef","active":false}`, 2)
+
+	suite.setRequest(http.MethodGet, "", 1)
+	suite.NoError(suite.controller.GetWebhooks(suite.Context))
+
+	var response struct {
+		Data []*model.WebhookSubscription
+	}
+	suite.NoError(json.Unmarshal(suite.Recorder.Body.Bytes(), &response))
+	suite.Require().Len(response.Data, 1)
+	suite.Equal(created.Id, response.Data[0].Id)
+	suite.Empty(response.Data[0].Secret)
+}
+
+func (suite *WebhookTestSuite) Test_CreateWebhook_Invalid() {
+	for _, body := range []string{
+		`{}`,
+		`{"url":"ftp://example.com"}`,
+		`{"url":"https://example.com","events":["comment.liked"]}`,
+		`{"url":"https://example.com","secret":"short"}`,
+	} {
+		suite.setRequest(http.MethodPost, body, 1)
+
+		exception := suite.controller.CreateWebhook(suite.Context)
+
+		suite.Equal(http.StatusUnprocessableEntity, apperror.From(exception).Status, body)
+	}
+}
+
+func (suite *WebhookTestSuite) Test_UpdateWebhook() {
+	created := suite.create(`{"url":"https://example.com/hook"}`, 1)
+
+	suite.setRequest(http.MethodPatch, `{"active":false,"events":["comment.created"]}`, 1)
+	suite.Context.SetParamNames("webhookId")
+	suite.Context.SetParamValues("1")
+	suite.NoError(suite.controller.UpdateWebhook(suite.Context))
+
+	var updated model.WebhookSubscription
+	suite.NoError(json.Unmarshal(suite.Recorder.Body.Bytes(), &updated))
+	suite.False(updated.Active)
+	suite.Equal([]string{model.EventCommentCreated}, updated.Events)
+	suite.Equal("https://example.com/hook", updated.Url)
+	suite.Empty(updated.Secret)
+
+	// The secret was kept
+	var stored model.WebhookSubscription
+	suite.NoError(stored.FindById(suite.gormDb, created.Id))
+	suite.Equal(created.Secret, stored.Secret)
+	suite.False(stored.Active)
+}
+
+func (suite *WebhookTestSuite) Test_OtherUsersWebhook() {
+	suite.create(`{"url":"https://example.com/hook"}`, 1)
+
+	handlers := []echo.HandlerFunc{
+		suite.controller.GetWebhook,
+		suite.controller.UpdateWebhook,
+		suite.controller.DeleteWebhook,
+		suite.controller.TestWebhook,
+		suite.controller.GetWebhookDeliveries,
+	}
+
+	for _, handler := range handlers {
+		suite.setRequest(http.MethodPost, `{}`, 2)
+		suite.Context.SetParamNames("webhookId")
+		suite.Context.SetParamValues("1")
+
+		exception := handler(suite.Context)
+
+		suite.Equal(http.StatusNotFound, apperror.From(exception).Status)
+	}
+}
+
+func (suite *WebhookTestSuite) Test_TestWebhookAndDeliveries() {
+	suite.create(`{"url":"`+suite.receiver.URL+`","active":false}`, 1)
+
+	suite.setRequest(http.MethodPost, "", 1)
+	suite.Context.SetParamNames("webhookId")
+	suite.Context.SetParamValues("1")
+	suite.NoError(suite.controller.TestWebhook(suite.Context))
+	suite.Contains(suite.Recorder.Body.String(), `"success":true`)
+	suite.Contains(suite.Recorder.Body.String(), `"statusCode":204`)
+
+	// A failing receiver is still an answer
+	suite.status = http.StatusGone
+	suite.setRequest(http.MethodPost, "", 1)
+	suite.Context.SetParamNames("webhookId")
+	suite.Context.SetParamValues("1")
+	suite.NoError(suite.controller.TestWebhook(suite.Context))
+	suite.Equal(http.StatusOK, suite.Recorder.Code)
+	suite.Contains(suite.Recorder.Body.String(), `"success":false`)
+
+	suite.setRequest(http.MethodGet, "", 1)
+	suite.Context.SetParamNames("webhookId")
+	suite.Context.SetParamValues("1")
+	suite.NoError(suite.controller.GetWebhookDeliveries(suite.Context))
+
+	var response struct {
+		Data []*model.WebhookAttempt
+	}
+	suite.NoError(json.Unmarshal(suite.Recorder.Body.Bytes(), &response))
+	suite.Require().Len(response.Data, 2)
+	suite.Equal(http.StatusGone, response.Data[0].StatusCode)
+	suite.Equal("receiver answered 410", response.Data[0].Error)
+	suite.Equal(webhook.EventTest, response.Data[1].EventType)
+
+	// The log goes with the subscription
+	suite.setRequest(http.MethodDelete, "", 1)
+	suite.Context.SetParamNames("webhookId")
+	suite.Context.SetParamValues("1")
+	suite.NoError(suite.controller.DeleteWebhook(suite.Context))
+
+	var count int64
+	suite.gormDb.Model(&model.WebhookAttempt{}).Count(&count)
+	suite.Zero(count)
+}
+
+func (suite *WebhookTestSuite) Test_GetWebhookDeliveries_InvalidLimit() {
+	suite.setRequest(http.MethodGet, "", 1)
+	suite.Context.Request().URL.RawQuery = "limit=0"
+	suite.Context.SetParamNames("webhookId")
+	suite.Context.SetParamValues("1")
+
+	exception := suite.controller.GetWebhookDeliveries(suite.Context)
+
+	suite.Equal(http.StatusBadRequest, apperror.From(exception).Status)
+}
+
+func TestWebhookTestSuite(t *testing.T) {
+	suite.Run(t, new(WebhookTestSuite))
+}
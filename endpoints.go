@@ -2,6 +2,7 @@ package main
 
 import (
 	"two-in-one/controller"
+	"two-in-one/middleware"
 
 	dic "github.com/DrBenton/minidic"
 	"github.com/labstack/echo/v4"
@@ -11,17 +12,67 @@ func createEndpoints(e *echo.Echo, container dic.Container) {
 
 	commentController := container.Get("Controller.Comment").(*controller.CommentController)
 	fibonacciController := container.Get("Controller.Fibonacci").(*controller.FibonacciController)
+	moderationController := container.Get("Controller.Moderation").(*controller.ModerationController)
+	webhookController := container.Get("Controller.Webhook").(*controller.WebhookController)
+	privacyController := container.Get("Controller.Privacy").(*controller.PrivacyController)
+	cacheController := container.Get("Controller.Cache").(*controller.CacheController)
+	authMiddleware := container.Get("Middleware.Auth").(*middleware.Auth)
+	idempotencyMiddleware := container.Get("Middleware.Idempotency").(*middleware.Idempotency)
+	rateLimitMiddleware := container.Get("Middleware.RateLimit").(*middleware.RateLimit)
 
-	// todo 	ideally a middleware here would check get the userId from the
-	// todo 	auth token and just call comments/, but now I simplified it to prevent overcomplicating
-	e.GET("comments/:userId", commentController.GetCommentByUserId)
+	requireAuth := authMiddleware.Required()
+	optionalAuth := authMiddleware.Optional()
+
+	// Retried creations with the same Idempotency-Key get the first response again
+	idempotent := idempotencyMiddleware.Keys()
+
+	// Every route takes the limit configured for it, if any, once the caller is known
+	limited := rateLimitMiddleware.Limit()
+
+	// The caller's own comments, the user id comes from the auth token
+	e.GET("comments/me", commentController.GetMyComments, requireAuth, limited)
+	e.GET("comments/search", commentController.SearchComments, limited)
+	e.GET("comments/:userId", commentController.GetCommentByUserId, optionalAuth, limited)
+	e.GET("comments/:userId/stream", commentController.StreamComments, optionalAuth, limited)
+	e.POST("comments", commentController.CreateComment, requireAuth, limited, idempotent)
+	e.POST("comments/batch", commentController.CreateComments, requireAuth, limited, idempotent)
+	e.DELETE("comments/batch", commentController.DeleteComments, requireAuth, limited)
+
+	// Comments mentioning a user, by id or username
+	e.GET("users/:userId/mentions", commentController.GetMentions, optionalAuth, limited)
+
+	// Data subject requests, made by the user or a moderator
+	e.GET("users/:userId/comments/export", privacyController.ExportComments, requireAuth, limited)
+	e.POST("users/:userId/comments/erasure", privacyController.EraseComments, requireAuth, limited)
 
 	commentGroup := e.Group("/comment")
-	commentGroup.GET("/:commentId", commentController.GetCommentById)
-	commentGroup.GET("/:commentId", commentController.UpdateComment)
-	commentGroup.GET("/:commentId", commentController.DeleteComment)
+	// Authors and moderators can see comments that aren't published yet
+	commentGroup.GET("/:commentId", commentController.GetCommentById, optionalAuth, limited)
+	commentGroup.GET("/:commentId/thread", commentController.GetCommentThread, optionalAuth, limited)
+	commentGroup.PATCH("/:commentId", commentController.UpdateComment, requireAuth, limited)
+	commentGroup.DELETE("/:commentId", commentController.DeleteComment, requireAuth, limited)
+	commentGroup.POST("/:commentId/restore", commentController.RestoreComment, requireAuth, limited)
+	commentGroup.GET("/:commentId/revisions", commentController.GetCommentRevisions, optionalAuth, limited)
+	commentGroup.GET("/:commentId/attachments/:attachmentId", commentController.DownloadAttachment, optionalAuth, limited)
+	commentGroup.POST("/:commentId/reactions", commentController.ToggleReaction, requireAuth, limited)
+	commentGroup.POST("/:commentId/revisions/:revision/restore", commentController.RestoreCommentRevision, requireAuth, limited)
+
+	moderationGroup := e.Group("/admin/moderation", requireAuth, authMiddleware.RequireRole(middleware.RoleModerator), limited)
+	moderationGroup.GET("/queue", moderationController.GetModerationQueue)
+	moderationGroup.POST("/:commentId/approve", moderationController.ApproveComment)
+	moderationGroup.POST("/:commentId/reject", moderationController.RejectComment)
+
+	e.GET("admin/cache", cacheController.GetCacheStats, requireAuth, authMiddleware.RequireRole(middleware.RoleModerator), limited)
 
-	commentGroup.GET("/create", commentController.CreateComment)
+	// Each user manages the webhooks that get the events about their own comments
+	webhookGroup := e.Group("/webhooks", requireAuth, limited)
+	webhookGroup.GET("", webhookController.GetWebhooks)
+	webhookGroup.POST("", webhookController.CreateWebhook)
+	webhookGroup.GET("/:webhookId", webhookController.GetWebhook)
+	webhookGroup.PATCH("/:webhookId", webhookController.UpdateWebhook)
+	webhookGroup.DELETE("/:webhookId", webhookController.DeleteWebhook)
+	webhookGroup.POST("/:webhookId/test", webhookController.TestWebhook)
+	webhookGroup.GET("/:webhookId/deliveries", webhookController.GetWebhookDeliveries)
 
-	e.GET("fibonacci/:n", fibonacciController.Get)
+	e.GET("fibonacci/:n", fibonacciController.Get, limited)
 }
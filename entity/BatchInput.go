@@ -0,0 +1,22 @@
+package entity
+
+// Batch modes, an atomic batch writes nothing as soon as one item fails, a best effort batch writes whatever it can
+const (
+	BatchAtomic     = "atomic"
+	BatchBestEffort = "best_effort"
+)
+
+type CommentBatchInput struct {
+	// Atomic when left out
+	Mode string `json:"mode" validate:"oneof=atomic best_effort"`
+
+	// Each one is validated on its own, so one bad comment doesn't hide the others
+	Comments []CommentInput `json:"comments" validate:"required,min=1,max=500"`
+}
+
+type DeleteBatchInput struct {
+	// Atomic when left out
+	Mode string `json:"mode" validate:"oneof=atomic best_effort"`
+
+	Ids []uint32 `json:"ids" validate:"required,min=1,max=500"`
+}
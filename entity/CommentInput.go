@@ -1,5 +1,8 @@
 package entity
 
 type CommentInput struct {
-	Body string `json:"body"`
+	Body string `json:"body" form:"body" validate:"required,utf8,nfc,max=10000"`
+
+	// Set when the comment is a reply
+	ParentId *uint32 `json:"parentId" form:"parentId" validate:"min=1"`
 }
@@ -0,0 +1,6 @@
+package entity
+
+type ErasureInput struct {
+	// One of the model.Erasure* modes
+	Mode string `json:"mode" validate:"required,oneof=anonymise delete"`
+}
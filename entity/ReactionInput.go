@@ -0,0 +1,6 @@
+package entity
+
+type ReactionInput struct {
+	// One of the model.Reaction* types
+	Type string `json:"type" validate:"required,oneof=like dislike laugh heart surprise sad"`
+}
@@ -0,0 +1,22 @@
+package entity
+
+type WebhookInput struct {
+	Url string `json:"url" validate:"required,max=2048,url"`
+
+	// Every type when left out, otherwise some of the model.Event* types
+	Events []string `json:"events" validate:"max=6,oneof=comment.created comment.updated comment.deleted comment.restored reaction.added reaction.removed"`
+
+	// Generated when left out
+	Secret *string `json:"secret" validate:"min=16,max=255"`
+
+	// Active when left out
+	Active *bool `json:"active"`
+}
+
+// WebhookPatchInput only changes the fields that are set
+type WebhookPatchInput struct {
+	Url    *string   `json:"url" validate:"max=2048,url"`
+	Events *[]string `json:"events" validate:"max=6,oneof=comment.created comment.updated comment.deleted comment.restored reaction.added reaction.removed"`
+	Secret *string   `json:"secret" validate:"min=16,max=255"`
+	Active *bool     `json:"active"`
+}
@@ -5,12 +5,16 @@ go 1.16
 require (
 	github.com/DrBenton/minidic v0.0.0-20170930222605-91302b37f38e
 	github.com/go-sql-driver/mysql v1.6.0
+	github.com/golang-jwt/jwt v3.2.2+incompatible
 	github.com/golang/mock v1.6.0
 	github.com/joho/godotenv v1.4.0
 	github.com/labstack/echo/v4 v4.6.3
 	github.com/mattn/go-sqlite3 v2.0.3+incompatible
+	github.com/microcosm-cc/bluemonday v1.0.16
 	github.com/selvatico/go-mocket v1.0.7
 	github.com/stretchr/testify v1.7.0
+	github.com/yuin/goldmark v1.4.12
+	golang.org/x/text v0.3.7
 	gorm.io/driver/mysql v1.2.3
 	gorm.io/driver/sqlite v1.2.6
 	gorm.io/gorm v1.22.5
@@ -0,0 +1,186 @@
+package cache
+
+import (
+	"container/list"
+	"reflect"
+	"sync"
+	"time"
+)
+
+// Cache keeps query results in memory, the least recently used are evicted past the configured size.
+// Each result is stored under the key the query was tagged with, which is how writes invalidate it.
+type Cache struct {
+	sync.Mutex
+	config *Config
+
+	// Most recently used at the front
+	entries  *list.List
+	elements map[string]*list.Element
+
+	// The full keys of the results stored under each tag
+	tags map[string]map[string]struct{}
+
+	// The tags queries are running for, a result read before an invalidation of its tag is never stored
+	flights map[string]*flight
+
+	hits      uint64
+	misses    uint64
+	evictions uint64
+
+	// Overridden by the tests
+	now func() time.Time
+}
+
+// flight counts the queries running for a tag and the invalidations of the tag since the first of them started
+type flight struct {
+	queries    int
+	generation uint64
+}
+
+type entry struct {
+	key     string
+	tag     string
+	value   reflect.Value
+	rows    int64
+	expires time.Time
+}
+
+// Stats are the counters of a cache since it started
+type Stats struct {
+	Hits      uint64 `json:"hits"`
+	Misses    uint64 `json:"misses"`
+	Evictions uint64 `json:"evictions"`
+	Entries   int    `json:"entries"`
+	Size      int    `json:"size"`
+}
+
+func New(config *Config) *Cache {
+	return &Cache{
+		config:   config,
+		entries:  list.New(),
+		elements: map[string]*list.Element{},
+		tags:     map[string]map[string]struct{}{},
+		flights:  map[string]*flight{},
+		now:      time.Now,
+	}
+}
+
+// get returns a result that hasn't expired yet, counting a hit or a miss
+func (c *Cache) get(key string) (*entry, bool) {
+	c.Lock()
+	defer c.Unlock()
+
+	element, isCached := c.elements[key]
+	if isCached && c.now().After(element.Value.(*entry).expires) {
+		c.remove(element)
+		isCached = false
+	}
+
+	if !isCached {
+		c.misses++
+		return nil, false
+	}
+
+	c.hits++
+	c.entries.MoveToFront(element)
+	return element.Value.(*entry), true
+}
+
+// begin records a query running for the tag, returning the generation to store its result with
+func (c *Cache) begin(tag string) uint64 {
+	c.Lock()
+	defer c.Unlock()
+
+	running, isRunning := c.flights[tag]
+	if !isRunning {
+		running = &flight{}
+		c.flights[tag] = running
+	}
+	running.queries++
+
+	return running.generation
+}
+
+// end records a query of the tag done, stored or not
+func (c *Cache) end(tag string) {
+	c.Lock()
+	defer c.Unlock()
+
+	running := c.flights[tag]
+	running.queries--
+	if running.queries == 0 {
+		delete(c.flights, tag)
+	}
+}
+
+// set stores a result under its tag, evicting the least recently used past the size. A result of a generation the
+// tag is past may be older than the write that invalidated it, it is dropped.
+func (c *Cache) set(key string, tag string, generation uint64, value reflect.Value, rows int64) {
+	c.Lock()
+	defer c.Unlock()
+
+	if running, isRunning := c.flights[tag]; !isRunning || running.generation != generation {
+		return
+	}
+
+	if element, isCached := c.elements[key]; isCached {
+		c.remove(element)
+	}
+
+	c.elements[key] = c.entries.PushFront(&entry{
+		key:     key,
+		tag:     tag,
+		value:   value,
+		rows:    rows,
+		expires: c.now().Add(c.config.TTL),
+	})
+
+	if c.tags[tag] == nil {
+		c.tags[tag] = map[string]struct{}{}
+	}
+	c.tags[tag][key] = struct{}{}
+
+	for c.entries.Len() > c.config.Size {
+		c.remove(c.entries.Back())
+		c.evictions++
+	}
+}
+
+// Invalidate drops every result stored under the tags
+func (c *Cache) Invalidate(tags ...string) {
+	c.Lock()
+	defer c.Unlock()
+
+	for _, tag := range tags {
+		if running, isRunning := c.flights[tag]; isRunning {
+			running.generation++
+		}
+
+		for key := range c.tags[tag] {
+			c.remove(c.elements[key])
+		}
+	}
+}
+
+func (c *Cache) Stats() Stats {
+	c.Lock()
+	defer c.Unlock()
+
+	return Stats{
+		Hits:      c.hits,
+		Misses:    c.misses,
+		Evictions: c.evictions,
+		Entries:   c.entries.Len(),
+		Size:      c.config.Size,
+	}
+}
+
+func (c *Cache) remove(element *list.Element) {
+	removed := c.entries.Remove(element).(*entry)
+	delete(c.elements, removed.key)
+
+	delete(c.tags[removed.tag], removed.key)
+	if len(c.tags[removed.tag]) == 0 {
+		delete(c.tags, removed.tag)
+	}
+}
@@ -0,0 +1,92 @@
+package cache
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// store sets a result the way a query does, outside of any invalidation
+func store(cache *Cache, key string, tag string, value reflect.Value) {
+	generation := cache.begin(tag)
+	cache.set(key, tag, generation, value, 1)
+	cache.end(tag)
+}
+
+func TestCache_Evicts(t *testing.T) {
+	cache := New(&Config{Size: 2, TTL: time.Minute})
+
+	store(cache, "a", "tag:a", reflect.ValueOf(1))
+	store(cache, "b", "tag:b", reflect.ValueOf(2))
+
+	// Used last, so b goes first
+	_, isCached := cache.get("a")
+	assert.True(t, isCached)
+
+	store(cache, "c", "tag:c", reflect.ValueOf(3))
+
+	_, isCached = cache.get("b")
+	assert.False(t, isCached)
+	cached, isCached := cache.get("a")
+	assert.True(t, isCached)
+	assert.Equal(t, 1, cached.value.Interface())
+
+	assert.Equal(t, Stats{Hits: 2, Misses: 1, Evictions: 1, Entries: 2, Size: 2}, cache.Stats())
+}
+
+func TestCache_Expires(t *testing.T) {
+	cache := New(&Config{Size: 2, TTL: time.Minute})
+	now := time.Now()
+	cache.now = func() time.Time { return now }
+
+	store(cache, "a", "tag:a", reflect.ValueOf(1))
+
+	now = now.Add(time.Minute)
+	_, isCached := cache.get("a")
+	assert.True(t, isCached)
+
+	now = now.Add(time.Second)
+	_, isCached = cache.get("a")
+	assert.False(t, isCached)
+	assert.Equal(t, 0, cache.Stats().Entries)
+}
+
+func TestCache_Invalidate(t *testing.T) {
+	cache := New(&Config{Size: 10, TTL: time.Minute})
+
+	// Two pages of the same listing
+	store(cache, "first", "comments:user:1", reflect.ValueOf(1))
+	store(cache, "second", "comments:user:1", reflect.ValueOf(2))
+	store(cache, "other", "comments:user:2", reflect.ValueOf(3))
+
+	cache.Invalidate("comments:user:1", "comments:user:3")
+
+	_, isCached := cache.get("first")
+	assert.False(t, isCached)
+	_, isCached = cache.get("second")
+	assert.False(t, isCached)
+	_, isCached = cache.get("other")
+	assert.True(t, isCached)
+	assert.Equal(t, 1, cache.Stats().Entries)
+}
+
+func TestCache_InvalidatedWhileRunning(t *testing.T) {
+	cache := New(&Config{Size: 10, TTL: time.Minute})
+
+	// A write commits while the query reads the old row
+	generation := cache.begin("comment:1")
+	cache.Invalidate("comment:1")
+	cache.set("old", "comment:1", generation, reflect.ValueOf(1), 1)
+	cache.end("comment:1")
+
+	_, isCached := cache.get("old")
+	assert.False(t, isCached)
+
+	// The next query stores its result again
+	store(cache, "new", "comment:1", reflect.ValueOf(2))
+	_, isCached = cache.get("new")
+	assert.True(t, isCached)
+	assert.Empty(t, cache.flights)
+}
@@ -0,0 +1,47 @@
+package cache
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"time"
+)
+
+const (
+	// How many query results are kept by default
+	defaultSize = 1000
+
+	// How long a result is served before it is read again, even if nothing invalidated it
+	defaultTTL = time.Minute
+)
+
+type Config struct {
+	// How many query results are kept, the least recently used go first. Zero turns the cache off.
+	Size int
+
+	// How long a result is kept at most
+	TTL time.Duration
+}
+
+// ConfigFromEnv reads CACHE_SIZE as a number of query results and CACHE_TTL as a Go duration, e.g. "30s"
+func ConfigFromEnv() (*Config, error) {
+	config := &Config{Size: defaultSize, TTL: defaultTTL}
+
+	if size := os.Getenv("CACHE_SIZE"); size != "" {
+		value, exception := strconv.Atoi(size)
+		if exception != nil || value < 0 {
+			return nil, fmt.Errorf("invalid CACHE_SIZE %q", size)
+		}
+		config.Size = value
+	}
+
+	if ttl := os.Getenv("CACHE_TTL"); ttl != "" {
+		value, exception := time.ParseDuration(ttl)
+		if exception != nil || value <= 0 {
+			return nil, fmt.Errorf("invalid CACHE_TTL %q", ttl)
+		}
+		config.TTL = value
+	}
+
+	return config, nil
+}
@@ -0,0 +1,30 @@
+package cache
+
+import (
+	"os"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestConfigFromEnv(t *testing.T) {
+	defer os.Unsetenv("CACHE_SIZE")
+	defer os.Unsetenv("CACHE_TTL")
+
+	config, exception := ConfigFromEnv()
+	assert.NoError(t, exception)
+	assert.Equal(t, defaultSize, config.Size)
+	assert.Equal(t, defaultTTL, config.TTL)
+
+	_ = os.Setenv("CACHE_SIZE", "0")
+	_ = os.Setenv("CACHE_TTL", "30s")
+	config, exception = ConfigFromEnv()
+	assert.NoError(t, exception)
+	assert.Equal(t, 0, config.Size)
+	assert.Equal(t, 30*time.Second, config.TTL)
+
+	_ = os.Setenv("CACHE_TTL", "0s")
+	_, exception = ConfigFromEnv()
+	assert.Error(t, exception)
+}
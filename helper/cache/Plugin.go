@@ -0,0 +1,122 @@
+package cache
+
+import (
+	"fmt"
+	"reflect"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/callbacks"
+)
+
+// Name the cache is registered under as a Gorm plugin
+const Name = "cache"
+
+// Key is the setting a query is tagged with to go through the cache, e.g. tx.Set(cache.Key, "comment:1").
+// Queries without it are never cached.
+const Key = "cache:key"
+
+func (c *Cache) Name() string {
+	return Name
+}
+
+// Initialize wraps the query callback, so tagged queries are answered from the cache when they can be
+func (c *Cache) Initialize(gormDb *gorm.DB) error {
+	return gormDb.Callback().Query().Replace("gorm:query", c.query)
+}
+
+// Invalidate drops the results stored under the tags from the cache registered on the connection, if any
+func Invalidate(gormDb *gorm.DB, tags ...string) {
+	if plugin, isRegistered := gormDb.Config.Plugins[Name].(*Cache); isRegistered {
+		plugin.Invalidate(tags...)
+	}
+}
+
+func (c *Cache) query(db *gorm.DB) {
+	tag, isTagged := db.Get(Key)
+
+	// Transactions read what they are about to write, they always go to the database
+	_, inTransaction := db.Statement.ConnPool.(gorm.TxCommitter)
+
+	if !isTagged || inTransaction || db.Error != nil || db.DryRun {
+		callbacks.Query(db)
+		return
+	}
+
+	// The same tag covers several queries, e.g. the pages of a listing and their count
+	callbacks.BuildQuerySQL(db)
+	if db.Error != nil {
+		return
+	}
+	key := fmt.Sprintf("%v|%s|%v", tag, db.Statement.SQL.String(), db.Statement.Vars)
+
+	// A write may commit and invalidate the tag while the query runs, its result is then stale before it is stored
+	generation := c.begin(fmt.Sprint(tag))
+	defer c.end(fmt.Sprint(tag))
+
+	target := indirect(reflect.ValueOf(db.Statement.Dest))
+	if !target.CanSet() {
+		callbacks.Query(db)
+		return
+	}
+
+	if cached, isCached := c.get(key); isCached && cached.value.Type() == target.Type() {
+		target.Set(clone(cached.value))
+		db.RowsAffected = cached.rows
+		return
+	}
+
+	callbacks.Query(db)
+
+	// Nothing found is an error, which isn't kept
+	if db.Error == nil {
+		c.set(key, fmt.Sprint(tag), generation, clone(target), db.RowsAffected)
+	}
+}
+
+// indirect follows the pointers down to the value the rows are scanned into
+func indirect(value reflect.Value) reflect.Value {
+	for value.Kind() == reflect.Ptr && !value.IsNil() {
+		value = value.Elem()
+	}
+	return value
+}
+
+// clone deep copies a result, the callers change what they get back and the cache must not see it
+func clone(value reflect.Value) reflect.Value {
+	copied := reflect.New(value.Type()).Elem()
+
+	switch value.Kind() {
+	case reflect.Ptr:
+		if !value.IsNil() {
+			copied.Set(reflect.New(value.Type().Elem()))
+			copied.Elem().Set(clone(value.Elem()))
+		}
+	case reflect.Slice:
+		if !value.IsNil() {
+			copied.Set(reflect.MakeSlice(value.Type(), value.Len(), value.Len()))
+			for i := 0; i < value.Len(); i++ {
+				copied.Index(i).Set(clone(value.Index(i)))
+			}
+		}
+	case reflect.Map:
+		if !value.IsNil() {
+			copied.Set(reflect.MakeMapWithSize(value.Type(), value.Len()))
+			iterator := value.MapRange()
+			for iterator.Next() {
+				copied.SetMapIndex(iterator.Key(), clone(iterator.Value()))
+			}
+		}
+	case reflect.Struct:
+		// Unexported fields, such as those of time.Time, are copied as they are
+		copied.Set(value)
+		for i := 0; i < value.NumField(); i++ {
+			if copied.Field(i).CanSet() {
+				copied.Field(i).Set(clone(value.Field(i)))
+			}
+		}
+	default:
+		copied.Set(value)
+	}
+
+	return copied
+}
@@ -0,0 +1,113 @@
+package cache
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+)
+
+type note struct {
+	Id      uint32 `gorm:"primary_key:true"`
+	Body    string
+	Authors []string `gorm:"-"`
+}
+
+func openCachedDb(t *testing.T) (*gorm.DB, *Cache) {
+	gormDb, exception := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{})
+	require.NoError(t, exception)
+
+	// Every connection to ":memory:" is a separate database
+	sqlDb, _ := gormDb.DB()
+	sqlDb.SetMaxOpenConns(1)
+	t.Cleanup(func() {
+		_ = sqlDb.Close()
+	})
+
+	cache := New(&Config{Size: 10, TTL: time.Minute})
+	require.NoError(t, gormDb.Use(cache))
+	require.NoError(t, gormDb.AutoMigrate(&note{}))
+	require.NoError(t, gormDb.Create(&[]*note{{Body: "first"}, {Body: "second"}}).Error)
+
+	return gormDb, cache
+}
+
+func TestPlugin_Query(t *testing.T) {
+	gormDb, cache := openCachedDb(t)
+
+	var found note
+	require.NoError(t, gormDb.Set(Key, "note:1").First(&found, 1).Error)
+	assert.Equal(t, "first", found.Body)
+
+	// The database changes behind the cache's back
+	require.NoError(t, gormDb.Model(&note{}).Where("id", 1).Update("body", "edited").Error)
+
+	var cached note
+	require.NoError(t, gormDb.Set(Key, "note:1").First(&cached, 1).Error)
+	assert.Equal(t, "first", cached.Body)
+
+	// Untagged queries always go to the database
+	var fresh note
+	require.NoError(t, gormDb.First(&fresh, 1).Error)
+	assert.Equal(t, "edited", fresh.Body)
+
+	Invalidate(gormDb, "note:1")
+	require.NoError(t, gormDb.Set(Key, "note:1").First(&cached, 1).Error)
+	assert.Equal(t, "edited", cached.Body)
+
+	assert.Equal(t, uint64(1), cache.Stats().Hits)
+	assert.Equal(t, uint64(2), cache.Stats().Misses)
+}
+
+func TestPlugin_KeyedBySql(t *testing.T) {
+	gormDb, _ := openCachedDb(t)
+
+	// The same tag, different queries
+	var notes []*note
+	require.NoError(t, gormDb.Set(Key, "notes").Order("id").Find(&notes).Error)
+	assert.Len(t, notes, 2)
+
+	var count int64
+	require.NoError(t, gormDb.Set(Key, "notes").Model(&note{}).Where("body", "second").Count(&count).Error)
+	assert.Equal(t, int64(1), count)
+
+	var second []*note
+	require.NoError(t, gormDb.Set(Key, "notes").Where("id > ?", 1).Find(&second).Error)
+	require.Len(t, second, 1)
+	assert.Equal(t, "second", second[0].Body)
+}
+
+func TestPlugin_ReturnsCopies(t *testing.T) {
+	gormDb, _ := openCachedDb(t)
+
+	var notes []*note
+	require.NoError(t, gormDb.Set(Key, "notes").Order("id").Find(&notes).Error)
+	notes[0].Body = "changed by the caller"
+	notes[0].Authors = append(notes[0].Authors, "someone")
+
+	var cached []*note
+	require.NoError(t, gormDb.Set(Key, "notes").Order("id").Find(&cached).Error)
+	assert.Equal(t, "first", cached[0].Body)
+	assert.Empty(t, cached[0].Authors)
+}
+
+func TestPlugin_SkipsTransactionsAndMisses(t *testing.T) {
+	gormDb, cache := openCachedDb(t)
+
+	exception := gormDb.Transaction(func(tx *gorm.DB) error {
+		var found note
+		return tx.Set(Key, "note:1").First(&found, 1).Error
+	})
+	require.NoError(t, exception)
+
+	// Nothing found isn't kept
+	var missing note
+	assert.ErrorIs(t, gormDb.Set(Key, "note:3").First(&missing, 3).Error, gorm.ErrRecordNotFound)
+	require.NoError(t, gormDb.Create(&note{Body: "third"}).Error)
+	require.NoError(t, gormDb.Set(Key, "note:3").First(&missing, 3).Error)
+
+	assert.Equal(t, 1, cache.Stats().Entries)
+}
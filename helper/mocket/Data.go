@@ -21,6 +21,12 @@ type Data struct {
 
 	// Used to determine if we back tick on .First(x) calls
 	Limit int
+
+	// ORDER BY parts, e.g. "c_id DESC", for keyset paginated queries
+	Order []string
+
+	// Adds a LIMIT clause to the query, unlike Limit which only mimics .First(x)
+	PageSize int
 }
 
 type ManyToMany struct {
@@ -33,6 +39,9 @@ type ManyToMany struct {
 type Where struct {
 	Field string
 	Value interface{}
+
+	// Defaults to "=", e.g. ">" or "<" for keyset conditions
+	Operator string
 }
 
 type ModelInterface interface {
@@ -268,7 +268,7 @@ func (mh *Helper) setupManyToManyQuery(data *ManyToMany) {
 
 	// Handle the WHERE query
 	// We use a limit of -1 to mean ALL
-	tx = generateWhere(tx, data.TableName, data.ForeignKey, values, true, -1)
+	tx = generateWhere(tx, data.TableName, data.ForeignKey, values, true, -1, "")
 
 	// Get the response payload
 	tx.Find(&response)
@@ -300,7 +300,17 @@ func (mh *Helper) setupSelectQuery(data *Data) {
 
 	// Loop over the where parts
 	for _, wherePart := range data.Where {
-		tx = generateWhere(tx, data.Model.TableName(), wherePart.Field, wherePart.Value, data.WrapQuotes, data.Limit)
+		tx = generateWhere(tx, data.Model.TableName(), wherePart.Field, wherePart.Value, data.WrapQuotes, data.Limit, wherePart.Operator)
+	}
+
+	// Keyset pagination ordering
+	for _, order := range data.Order {
+		tx = tx.Order(order)
+	}
+
+	// Keyset pagination page size
+	if data.PageSize > 0 {
+		tx = tx.Limit(data.PageSize)
 	}
 
 	// For testing the cache helper
@@ -324,7 +334,7 @@ func (mh *Helper) setupUpdateQuery(data *Data) {
 
 	// Loop over the where parts
 	for _, wherePart := range data.Where {
-		tx = generateWhere(tx, data.Model.TableName(), wherePart.Field, wherePart.Value, data.WrapQuotes, data.Limit)
+		tx = generateWhere(tx, data.Model.TableName(), wherePart.Field, wherePart.Value, data.WrapQuotes, data.Limit, wherePart.Operator)
 	}
 
 	// We have custom fields to update
@@ -346,12 +356,17 @@ func (mh *Helper) setupUpdateQuery(data *Data) {
 	tx.Save(data.Model)
 }
 
-func generateWhere(tx *gorm.DB, tableName, column string, wherePart interface{}, wrapQuotes bool, limit int) *gorm.DB {
+func generateWhere(tx *gorm.DB, tableName, column string, wherePart interface{}, wrapQuotes bool, limit int, customOperator string) *gorm.DB {
 
 	// By default, we're just the column name
 	columnKey := column
 	operator := "= "
 
+	// Comparisons such as the ones keyset pagination uses
+	if customOperator != "" {
+		operator = customOperator + " "
+	}
+
 	// What value do we have?
 	kindOf := reflect.TypeOf(wherePart).Kind()
 
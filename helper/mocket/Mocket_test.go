@@ -266,6 +266,47 @@ func TestMocketHelper_Select(t *testing.T) {
 		mocketHelper.Reset()
 	})
 
+	// Keyset pagination, WHERE x > ? ORDER BY x LIMIT n
+	t.Run("Model.Find with ORDER and LIMIT", func(t *testing.T) {
+
+		data := &Data{
+			Model: &TestModel{},
+			Where: []Where{
+				{
+					Field: "m_key",
+					Value: "test",
+				},
+				{
+					Field:    "m_id",
+					Value:    uint32(10),
+					Operator: ">",
+				},
+			},
+			Order:    []string{"m_id ASC"},
+			PageSize: 3,
+			Response: []map[string]interface{}{
+				structHelper.MapAsGorm(&TestModel{
+					ID: 11,
+				}),
+			},
+		}
+
+		// Make sure Mocket doesn't throw a hissy
+		assert.NotPanics(t, func() {
+
+			// SELECT * FROM `test_model` WHERE m_key = test AND m_id > 10 ORDER BY m_id ASC LIMIT 3
+			mocketHelper.Select(data)
+
+			db.Where("m_key = ?", "test").
+				Where("m_id > ?", uint32(10)).
+				Order("m_id ASC").
+				Limit(3).
+				Find(data.Model)
+
+			mocketHelper.Reset()
+		})
+	})
+
 	// Custom SELECT query using a SELECT with JOIN
 	t.Run("Model.Find with SELECT and JOIN", func(t *testing.T) {
 
@@ -0,0 +1,202 @@
+package validator
+
+import (
+	"fmt"
+	"net/url"
+	"reflect"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	"two-in-one/apperror"
+
+	"golang.org/x/text/unicode/norm"
+)
+
+// Validator checks request entities against their `validate` struct tags, it implements echo.Validator.
+//
+// Rules are applied in the order they are written, separated by commas:
+//   - required  the field can't be empty, whitespace-only strings and nil pointers included
+//   - min=N     strings need at least N characters, numbers need to be at least N
+//   - max=N     strings can have at most N characters, numbers can be at most N
+//   - utf8      strings must be valid UTF-8 and can't contain U+FFFD, which is what invalid bytes decode to
+//   - nfc       normalizes strings to Unicode NFC in place, put it before min/max so they count the result
+//   - oneof=A B strings must be one of the space separated values, so must every item of a list of strings
+//   - url       strings must be absolute http or https URLs
+type Validator struct {
+}
+
+func New() *Validator {
+	return &Validator{}
+}
+
+// Validate checks a pointer to a struct, returning an apperror.Validation listing every failing field
+func (v *Validator) Validate(i interface{}) error {
+	value := reflect.ValueOf(i)
+
+	if value.Kind() != reflect.Ptr || value.Elem().Kind() != reflect.Struct {
+		return fmt.Errorf("validator: expected a pointer to a struct, got %T", i)
+	}
+
+	fields, exception := validateStruct(value.Elem())
+	if exception != nil {
+		return exception
+	}
+
+	if len(fields) > 0 {
+		return apperror.Validation(fields...)
+	}
+
+	return nil
+}
+
+func validateStruct(value reflect.Value) ([]apperror.FieldError, error) {
+	var fields []apperror.FieldError
+
+	valueType := value.Type()
+
+	for i := 0; i < value.NumField(); i++ {
+		field := valueType.Field(i)
+
+		tag := field.Tag.Get("validate")
+		if tag == "" {
+			continue
+		}
+
+		name := fieldName(field)
+
+		for _, rule := range strings.Split(tag, ",") {
+			fieldError, exception := applyRule(value.Field(i), name, strings.TrimSpace(rule))
+			if exception != nil {
+				return nil, exception
+			}
+
+			// One problem per field is enough
+			if fieldError != nil {
+				fields = append(fields, *fieldError)
+				break
+			}
+		}
+	}
+
+	return fields, nil
+}
+
+func applyRule(value reflect.Value, name string, rule string) (*apperror.FieldError, error) {
+	ruleName, argument := rule, ""
+	if index := strings.Index(rule, "="); index >= 0 {
+		ruleName, argument = rule[:index], rule[index+1:]
+	}
+
+	// Optional pointers are only checked when they are set
+	if value.Kind() == reflect.Ptr {
+		if value.IsNil() {
+			if ruleName == "required" {
+				return &apperror.FieldError{Field: name, Code: "required", Message: fmt.Sprintf("%s is required", name)}, nil
+			}
+			return nil, nil
+		}
+		value = value.Elem()
+	}
+
+	switch ruleName {
+	case "required":
+		if value.IsZero() || (value.Kind() == reflect.String && strings.TrimSpace(value.String()) == "") {
+			return &apperror.FieldError{Field: name, Code: "required", Message: fmt.Sprintf("%s is required", name)}, nil
+		}
+
+	case "min", "max":
+		limit, exception := strconv.ParseFloat(argument, 64)
+		if exception != nil {
+			return nil, fmt.Errorf("validator: invalid %s on %s", rule, name)
+		}
+
+		size, unit := measure(value)
+		if ruleName == "min" && size < limit {
+			return &apperror.FieldError{Field: name, Code: "min", Message: fmt.Sprintf("%s must be at least %s%s", name, argument, unit)}, nil
+		}
+		if ruleName == "max" && size > limit {
+			return &apperror.FieldError{Field: name, Code: "max", Message: fmt.Sprintf("%s must be at most %s%s", name, argument, unit)}, nil
+		}
+
+	case "utf8":
+		if value.Kind() == reflect.String && (!utf8.ValidString(value.String()) || strings.ContainsRune(value.String(), utf8.RuneError)) {
+			return &apperror.FieldError{Field: name, Code: "utf8", Message: fmt.Sprintf("%s must be valid UTF-8", name)}, nil
+		}
+
+	case "nfc":
+		if value.Kind() == reflect.String && value.CanSet() {
+			value.SetString(norm.NFC.String(value.String()))
+		}
+
+	case "oneof":
+		allowed := strings.Fields(argument)
+
+		values := []reflect.Value{value}
+		if value.Kind() == reflect.Slice {
+			values = values[:0]
+			for i := 0; i < value.Len(); i++ {
+				values = append(values, value.Index(i))
+			}
+		}
+
+		for _, item := range values {
+			if !isOneOf(item, allowed) {
+				return &apperror.FieldError{Field: name, Code: "oneof", Message: fmt.Sprintf("%s must be one of %s", name, strings.Join(allowed, ", "))}, nil
+			}
+		}
+
+	case "url":
+		if value.Kind() == reflect.String && value.String() != "" {
+			parsed, exception := url.Parse(value.String())
+			if exception != nil || (parsed.Scheme != "http" && parsed.Scheme != "https") || parsed.Host == "" {
+				return &apperror.FieldError{Field: name, Code: "url", Message: fmt.Sprintf("%s must be an http or https URL", name)}, nil
+			}
+		}
+
+	default:
+		return nil, fmt.Errorf("validator: unknown rule %q on %s", ruleName, name)
+	}
+
+	return nil, nil
+}
+
+// isOneOf tells whether a string is one of the allowed values
+func isOneOf(value reflect.Value, allowed []string) bool {
+	for _, candidate := range allowed {
+		if value.Kind() == reflect.String && value.String() == candidate {
+			return true
+		}
+	}
+
+	return false
+}
+
+// measure returns the length of strings in characters, or the value of numbers
+func measure(value reflect.Value) (float64, string) {
+	switch value.Kind() {
+	case reflect.String:
+		return float64(utf8.RuneCountInString(value.String())), " characters"
+	case reflect.Slice, reflect.Map, reflect.Array:
+		return float64(value.Len()), " items"
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return float64(value.Int()), ""
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return float64(value.Uint()), ""
+	case reflect.Float32, reflect.Float64:
+		return value.Float(), ""
+	}
+
+	return 0, ""
+}
+
+// fieldName is the name clients know the field by, its JSON key
+func fieldName(field reflect.StructField) string {
+	if jsonTag := field.Tag.Get("json"); jsonTag != "" {
+		if name := strings.Split(jsonTag, ",")[0]; name != "" && name != "-" {
+			return name
+		}
+	}
+
+	return field.Name
+}
@@ -0,0 +1,125 @@
+package validator
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+
+	"two-in-one/apperror"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type testInput struct {
+	Body     string  `json:"body" validate:"required,utf8,nfc,min=2,max=5"`
+	Count    int     `json:"count" validate:"min=1"`
+	ParentId *uint32 `json:"parentId" validate:"min=1"`
+	Ignored  string  `json:"ignored"`
+}
+
+func TestValidator_Validate(t *testing.T) {
+	validator := New()
+
+	one, zero := uint32(1), uint32(0)
+
+	tests := []struct {
+		name       string
+		input      testInput
+		wantFields map[string]string
+	}{
+		{"Valid", testInput{Body: "Hello", Count: 1, ParentId: &one}, nil},
+		{"Nil pointer is optional", testInput{Body: "Hello", Count: 1}, nil},
+		{"Required", testInput{Body: "  ", Count: 1}, map[string]string{"body": "required"}},
+		{"Too short", testInput{Body: "a", Count: 1}, map[string]string{"body": "min"}},
+		{"Too long", testInput{Body: "Hello world", Count: 1}, map[string]string{"body": "max"}},
+		{"Characters not bytes", testInput{Body: "héllö", Count: 1}, nil},
+		{"Invalid UTF-8", testInput{Body: "a\xffb", Count: 1}, map[string]string{"body": "utf8"}},
+		{"Replacement character", testInput{Body: "a�b", Count: 1}, map[string]string{"body": "utf8"}},
+		{"Several fields", testInput{Body: "", Count: 0, ParentId: &zero}, map[string]string{"body": "required", "count": "min", "parentId": "min"}},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			input := test.input
+			exception := validator.Validate(&input)
+
+			if test.wantFields == nil {
+				assert.NoError(t, exception)
+				return
+			}
+
+			typed := apperror.From(exception)
+			assert.Equal(t, http.StatusUnprocessableEntity, typed.Status)
+
+			gotFields := make(map[string]string)
+			for _, field := range typed.Fields {
+				gotFields[field.Field] = field.Code
+			}
+			assert.Equal(t, test.wantFields, gotFields)
+		})
+	}
+}
+
+func TestValidator_Normalize(t *testing.T) {
+
+	// "e" followed by a combining acute accent, 5 runes that become 4 once composed
+	input := testInput{Body: "cafe\u0301", Count: 1}
+
+	assert.NoError(t, New().Validate(&input))
+	assert.Equal(t, "caf\u00e9", input.Body)
+	assert.Equal(t, 4, len([]rune(input.Body)))
+}
+
+func TestValidator_OneOf(t *testing.T) {
+	type choiceInput struct {
+		Kind string `json:"kind" validate:"required,oneof=like dislike"`
+	}
+
+	assert.NoError(t, New().Validate(&choiceInput{Kind: "dislike"}))
+
+	exception := New().Validate(&choiceInput{Kind: "love"})
+	typed := apperror.From(exception)
+	assert.Equal(t, http.StatusUnprocessableEntity, typed.Status)
+	assert.Equal(t, "oneof", typed.Fields[0].Code)
+	assert.Equal(t, "kind must be one of like, dislike", typed.Fields[0].Message)
+}
+
+func TestValidator_OneOfList(t *testing.T) {
+	type listInput struct {
+		Kinds []string `json:"kinds" validate:"oneof=like dislike"`
+	}
+
+	assert.NoError(t, New().Validate(&listInput{}))
+	assert.NoError(t, New().Validate(&listInput{Kinds: []string{"like", "dislike"}}))
+
+	typed := apperror.From(New().Validate(&listInput{Kinds: []string{"like", "love"}}))
+	assert.Equal(t, "oneof", typed.Fields[0].Code)
+	assert.Equal(t, "kinds", typed.Fields[0].Field)
+}
+
+func TestValidator_Url(t *testing.T) {
+	type urlInput struct {
+		Url string `json:"url" validate:"required,url"`
+	}
+
+	for _, value := range []string{"https://example.com/hook", "http://localhost:8080/hook?x=1"} {
+		assert.NoError(t, New().Validate(&urlInput{Url: value}), value)
+	}
+
+	for _, value := range []string{"example.com/hook", "ftp://example.com", "https://", "javascript:alert(1)"} {
+		typed := apperror.From(New().Validate(&urlInput{Url: value}))
+		assert.Equal(t, "url", typed.Fields[0].Code, value)
+	}
+}
+
+func TestValidator_InvalidRule(t *testing.T) {
+	input := struct {
+		Body string `validate:"sometimes"`
+	}{}
+
+	exception := New().Validate(&input)
+	assert.Error(t, exception)
+	assert.True(t, strings.Contains(exception.Error(), "unknown rule"))
+
+	assert.Error(t, New().Validate(input))
+}
@@ -9,9 +9,20 @@ import (
 	"log"
 	"os"
 
+	"two-in-one/apperror"
+	"two-in-one/attachment"
+	"two-in-one/helper/cache"
+	"two-in-one/helper/validator"
+	"two-in-one/middleware"
+	"two-in-one/moderation"
+	"two-in-one/ratelimit"
+	"two-in-one/stream"
+	"two-in-one/webhook"
+
 	"github.com/go-sql-driver/mysql"
 	"github.com/joho/godotenv"
 	"github.com/labstack/echo/v4"
+	echoMiddleware "github.com/labstack/echo/v4/middleware"
 	gormMysql "gorm.io/driver/mysql"
 	"gorm.io/driver/sqlite"
 	"gorm.io/gorm"
@@ -40,12 +51,150 @@ func main() {
 	// Always close the DB
 	defer closeConnection(gormDb)
 
+	// Bring the schema up to date
+	if exception := migrateDb(gormDb); exception != nil {
+		fmt.Printf("%s", exception.Error())
+		return
+	}
+
+	// How many comment lookups are cached and for how long
+	cacheConfig, exception := cache.ConfigFromEnv()
+
+	// We had a config exception?
+	if exception != nil {
+		fmt.Printf("%s", exception.Error())
+		return
+	}
+
+	// A size of zero leaves the queries alone, the counters stay at zero
+	queryCache := cache.New(cacheConfig)
+	if cacheConfig.Size > 0 {
+		if exception := gormDb.Use(queryCache); exception != nil {
+			fmt.Printf("%s", exception.Error())
+			return
+		}
+	}
+
+	// Limits and storage of comment attachments
+	attachmentConfig, exception := attachment.ConfigFromEnv()
+
+	// We had a config exception?
+	if exception != nil {
+		fmt.Printf("%s", exception.Error())
+		return
+	}
+
+	blobs := attachment.NewLocalBlobStore(attachmentConfig.Directory)
+
+	// How long deleted comments are kept
+	purge, exception := purgeConfigFromEnv()
+
+	// We had a config exception?
+	if exception != nil {
+		fmt.Printf("%s", exception.Error())
+		return
+	}
+
+	// Run as a one-off command, "go run . purge"
+	if len(os.Args) > 1 && os.Args[1] == "purge" {
+		if exception := runPurge(gormDb, blobs, purge); exception != nil {
+			fmt.Printf("%s", exception.Error())
+		}
+		return
+	}
+
+	// Or on a schedule next to the API
+	if purge.Interval > 0 {
+		stopPurge := schedulePurge(gormDb, blobs, purge)
+		defer stopPurge()
+	}
+
+	// How the events of the comment outbox are delivered to the webhooks
+	webhookConfig, exception := webhook.ConfigFromEnv()
+
+	// We had a config exception?
+	if exception != nil {
+		fmt.Printf("%s", exception.Error())
+		return
+	}
+
+	dispatcher := webhook.NewDispatcher(gormDb, webhookConfig)
+	stopWebhooks := dispatcher.Start()
+	defer stopWebhooks()
+
+	// How the live comment streams are kept open and how far back they resume
+	streamConfig, exception := stream.ConfigFromEnv()
+
+	// We had a config exception?
+	if exception != nil {
+		fmt.Printf("%s", exception.Error())
+		return
+	}
+
+	events := stream.NewBus(streamConfig)
+
+	// Load the keys used to verify auth tokens
+	authConfig, exception := middleware.AuthConfigFromEnv()
+
+	// We had a config exception?
+	if exception != nil {
+		fmt.Printf("%s", exception.Error())
+		return
+	}
+
+	// Without a key nobody could ever authenticate
+	if exception := authConfig.Validate(); exception != nil {
+		log.Fatal(exception)
+	}
+
+	// Load the moderation filters new comments go through
+	moderator, exception := moderation.NewFromEnv()
+
+	// We had a config exception?
+	if exception != nil {
+		fmt.Printf("%s", exception.Error())
+		return
+	}
+
+	// How long responses to idempotency keys are replayed
+	idempotencyConfig, exception := middleware.IdempotencyConfigFromEnv()
+
+	// We had a config exception?
+	if exception != nil {
+		fmt.Printf("%s", exception.Error())
+		return
+	}
+
+	// Keyed uploads are read whole too, leave room for every attachment next to the fields
+	if uploads := attachmentConfig.MaxSize*int64(attachmentConfig.MaxCount) + 1<<20; uploads > idempotencyConfig.MaxBodySize {
+		idempotencyConfig.MaxBodySize = uploads
+	}
+
+	// How many requests each client can make on the limited routes
+	rateLimitConfig, exception := ratelimit.ConfigFromEnv()
+
+	// We had a config exception?
+	if exception != nil {
+		fmt.Printf("%s", exception.Error())
+		return
+	}
+
 	// Build our container
-	container := buildContainer(gormDb)
+	container := buildContainer(gormDb, authConfig, moderator, idempotencyConfig, blobs, attachmentConfig, dispatcher, events, rateLimitConfig, queryCache)
 
 	// Reference our echo instance and create it early
 	e := echo.New()
 
+	// Every error leaves as the same JSON envelope, tagged with the request id
+	e.HTTPErrorHandler = apperror.Handler
+	e.Use(echoMiddleware.RequestID())
+
+	// Client addresses only come from the headers of the proxies we trust
+	e.IPExtractor = rateLimitConfig.IPExtractor()
+
+	// Request entities are checked against their validate tags
+	e.Validator = validator.New()
+
 	// Get the API calls
 	createEndpoints(e, container)
 
@@ -171,6 +320,15 @@ func setupDb() (*gorm.DB, error) {
 		return nil, exception
 	}
 
+	// Every connection to ":memory:" is a separate database, keep it to one
+	if dbType == "sqlite3" {
+		sqlDb, exception := gormDb.DB()
+		if exception != nil {
+			return nil, exception
+		}
+		sqlDb.SetMaxOpenConns(1)
+	}
+
 	// Preload by default
 	if os.Getenv("IS_PRELOAD") == "true" {
 		gormDb.Set("gorm:auto_preload", true)
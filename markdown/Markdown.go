@@ -0,0 +1,93 @@
+package markdown
+
+import (
+	"bytes"
+	"regexp"
+
+	"github.com/microcosm-cc/bluemonday"
+	"github.com/yuin/goldmark"
+	"github.com/yuin/goldmark/ast"
+	"github.com/yuin/goldmark/parser"
+	"github.com/yuin/goldmark/renderer"
+	"github.com/yuin/goldmark/renderer/html"
+	"github.com/yuin/goldmark/util"
+)
+
+// The subset comments are parsed with: emphasis, links, code, lists and quotes.
+// Headings, thematic breaks and raw HTML stay plain text, images become links.
+var converter = goldmark.New(
+	goldmark.WithParser(parser.NewParser(
+		parser.WithBlockParsers(
+			util.Prioritized(parser.NewListParser(), 300),
+			util.Prioritized(parser.NewListItemParser(), 400),
+			util.Prioritized(parser.NewCodeBlockParser(), 500),
+			util.Prioritized(parser.NewFencedCodeBlockParser(), 700),
+			util.Prioritized(parser.NewBlockquoteParser(), 800),
+			util.Prioritized(parser.NewParagraphParser(), 1000),
+		),
+		parser.WithInlineParsers(
+			util.Prioritized(parser.NewCodeSpanParser(), 100),
+			util.Prioritized(parser.NewLinkParser(), 200),
+			util.Prioritized(parser.NewAutoLinkParser(), 300),
+			util.Prioritized(parser.NewEmphasisParser(), 500),
+		),
+		parser.WithParagraphTransformers(
+			util.Prioritized(parser.LinkReferenceParagraphTransformer, 100),
+		),
+	)),
+
+	// A new line in a comment is a new line on screen
+	goldmark.WithRendererOptions(
+		html.WithHardWraps(),
+		renderer.WithNodeRenderers(util.Prioritized(imageAsLink{}, 100)),
+	),
+)
+
+// policy is the allow-list whatever the converter produced goes through, links get rel="nofollow"
+var policy = func() *bluemonday.Policy {
+	policy := bluemonday.NewPolicy()
+
+	policy.AllowElements("p", "br", "em", "strong", "code", "pre", "blockquote", "ul", "ol", "li")
+	policy.AllowAttrs("start").Matching(bluemonday.Integer).OnElements("ol")
+	policy.AllowAttrs("class").Matching(regexp.MustCompile(`^language-[\w+-]+$`)).OnElements("code")
+
+	policy.AllowAttrs("href").OnElements("a")
+	policy.AllowURLSchemes("http", "https", "mailto")
+	policy.RequireParseableURLs(true)
+	policy.RequireNoFollowOnLinks(true)
+
+	return policy
+}()
+
+// Render turns a comment body into sanitised HTML
+func Render(body string) string {
+	var buffer bytes.Buffer
+
+	// Only fails when writing to the buffer does, which it doesn't
+	if exception := converter.Convert([]byte(body), &buffer); exception != nil {
+		return policy.Sanitize(body)
+	}
+
+	return policy.Sanitize(buffer.String())
+}
+
+// imageAsLink renders images as a link to the image with the alt text, comments don't embed images
+type imageAsLink struct{}
+
+func (r imageAsLink) RegisterFuncs(registerer renderer.NodeRendererFuncRegisterer) {
+	registerer.Register(ast.KindImage, r.render)
+}
+
+func (r imageAsLink) render(w util.BufWriter, source []byte, node ast.Node, entering bool) (ast.WalkStatus, error) {
+	if !entering {
+		_, _ = w.WriteString("</a>")
+		return ast.WalkContinue, nil
+	}
+
+	// Unsafe destinations are dropped by the policy
+	_, _ = w.WriteString(`<a href="`)
+	_, _ = w.Write(util.EscapeHTML(util.URLEscape(node.(*ast.Image).Destination, true)))
+	_, _ = w.WriteString(`">`)
+
+	return ast.WalkContinue, nil
+}
@@ -0,0 +1,77 @@
+package markdown
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRender(t *testing.T) {
+	tests := []struct {
+		name string
+		body string
+		want string
+	}{
+		{
+			name: "Emphasis",
+			body: "*some* **bold** words",
+			want: "<p><em>some</em> <strong>bold</strong> words</p>\n",
+		},
+		{
+			name: "Line breaks",
+			body: "first\nsecond",
+			want: "<p>first<br>\nsecond</p>\n",
+		},
+		{
+			name: "Link",
+			body: "[docs](https://example.com/docs)",
+			want: `<p><a href="https://example.com/docs" rel="nofollow">docs</a></p>` + "\n",
+		},
+		{
+			name: "Autolink",
+			body: "<https://example.com>",
+			want: `<p><a href="https://example.com" rel="nofollow">https://example.com</a></p>` + "\n",
+		},
+		{
+			name: "Javascript link",
+			body: "[click](javascript:alert(1))",
+			want: "<p>click</p>\n",
+		},
+		{
+			name: "Code",
+			body: "`x < y`\n\n```go\nfmt.Println()\n```",
+			want: "<p><code>x &lt; y</code></p>\n<pre><code class=\"language-go\">fmt.Println()\n</code></pre>\n",
+		},
+		{
+			name: "Lists",
+			body: "- one\n- two\n\n3. three\n4. four",
+			want: "<ul>\n<li>one</li>\n<li>two</li>\n</ul>\n<ol start=\"3\">\n<li>three</li>\n<li>four</li>\n</ol>\n",
+		},
+		{
+			name: "Quote",
+			body: "> quoted",
+			want: "<blockquote>\n<p>quoted</p>\n</blockquote>\n",
+		},
+		{
+			name: "Raw HTML",
+			body: `<script>alert(1)</script><b onclick="x()">bold</b>`,
+			want: "<p>&lt;script&gt;alert(1)&lt;/script&gt;&lt;b onclick=&#34;x()&#34;&gt;bold&lt;/b&gt;</p>\n",
+		},
+		{
+			name: "Headings stay text",
+			body: "# title\n\n---",
+			want: "<p># title</p>\n<p>---</p>\n",
+		},
+		{
+			name: "Images become links",
+			body: "![alt](https://example.com/a.png) ![x](javascript:alert(1))",
+			want: `<p><a href="https://example.com/a.png" rel="nofollow">alt</a> x</p>` + "\n",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			assert.Equal(t, test.want, Render(test.body))
+		})
+	}
+}
@@ -0,0 +1,65 @@
+package mention
+
+import (
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// MaxUsernameLength is the longest @username picked up
+const MaxUsernameLength = 64
+
+// An @ at the start or after anything that can't be part of an e-mail address or a URL,
+// followed by <id>, an id or a username that doesn't end with a dot or a dash
+var pattern = regexp.MustCompile(`(?:^|[^\w@/])@(?:<(\d+)>|([A-Za-z0-9_](?:[A-Za-z0-9_.-]{0,62}[A-Za-z0-9_])?))`)
+
+// Mentions are the users a body mentions, each of them once
+type Mentions struct {
+	// From @<id> and @id
+	UserIds []uint32
+
+	// From @username, lowercased
+	Usernames []string
+}
+
+// IsEmpty tells whether no one is mentioned
+func (m Mentions) IsEmpty() bool {
+	return len(m.UserIds) == 0 && len(m.Usernames) == 0
+}
+
+// Parse finds the @username, @<userId> and @userId mentions of a body
+func Parse(body string) Mentions {
+	var mentions Mentions
+
+	seenIds := make(map[uint32]bool)
+	seenNames := make(map[string]bool)
+
+	for _, match := range pattern.FindAllStringSubmatch(body, -1) {
+		handle := match[1]
+		if handle == "" {
+			handle = match[2]
+		}
+
+		// All digits is an id, whether it came in brackets or not
+		if userId, exception := strconv.ParseUint(handle, 10, 32); exception == nil {
+			if id := uint32(userId); id != 0 && !seenIds[id] {
+				mentions.UserIds = append(mentions.UserIds, id)
+				seenIds[id] = true
+			}
+			continue
+		}
+
+		// Too many digits to be an id
+		if match[2] == "" {
+			continue
+		}
+
+		username := strings.ToLower(handle)
+		if !seenNames[username] {
+			mentions.Usernames = append(mentions.Usernames, username)
+			seenNames[username] = true
+		}
+	}
+
+	return mentions
+}
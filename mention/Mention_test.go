@@ -0,0 +1,57 @@
+package mention
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		name string
+		body string
+		want Mentions
+	}{
+		{
+			name: "Nothing",
+			body: "no mentions here",
+			want: Mentions{},
+		},
+		{
+			name: "Usernames",
+			body: "@alice and @Bob.Smith, thanks @carol_1.",
+			want: Mentions{Usernames: []string{"alice", "bob.smith", "carol_1"}},
+		},
+		{
+			name: "Ids",
+			body: "@<12> and @34 but not @<0>",
+			want: Mentions{UserIds: []uint32{12, 34}},
+		},
+		{
+			name: "Mixed and repeated",
+			body: "@alice @<5> @ALICE @5",
+			want: Mentions{UserIds: []uint32{5}, Usernames: []string{"alice"}},
+		},
+		{
+			name: "Adjacent",
+			body: "(@alice),@bob",
+			want: Mentions{Usernames: []string{"alice", "bob"}},
+		},
+		{
+			name: "E-mail addresses and URLs",
+			body: "mail me@example.com or see https://example.com/@alice",
+			want: Mentions{},
+		},
+		{
+			name: "Id too large",
+			body: "@<99999999999>",
+			want: Mentions{},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			assert.Equal(t, test.want, Parse(test.body))
+		})
+	}
+}
@@ -0,0 +1,197 @@
+package middleware
+
+import (
+	"crypto/rsa"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"strconv"
+	"strings"
+
+	"two-in-one/apperror"
+
+	"github.com/golang-jwt/jwt"
+	"github.com/labstack/echo/v4"
+)
+
+// UserIdKey is the echo context key holding the authenticated user id
+const UserIdKey = "auth:userId"
+
+// RolesKey is the echo context key holding the roles of the authenticated user
+const RolesKey = "auth:roles"
+
+// RoleModerator lets a user work through the moderation queue
+const RoleModerator = "moderator"
+
+// AuthConfig holds the keys tokens are verified against, at least one of them is needed
+type AuthConfig struct {
+	HmacSecret   []byte
+	RsaPublicKey *rsa.PublicKey
+}
+
+// AuthConfigFromEnv reads JWT_HMAC_SECRET and JWT_RSA_PUBLIC_KEY, the latter being a PEM file path or the PEM itself
+func AuthConfigFromEnv() (*AuthConfig, error) {
+	config := &AuthConfig{}
+
+	if secret := os.Getenv("JWT_HMAC_SECRET"); secret != "" {
+		config.HmacSecret = []byte(secret)
+	}
+
+	if publicKey := os.Getenv("JWT_RSA_PUBLIC_KEY"); publicKey != "" {
+		pem := []byte(publicKey)
+
+		// Anything that isn't an inline PEM is a path
+		if !strings.HasPrefix(publicKey, "-----BEGIN") {
+			var exception error
+			if pem, exception = ioutil.ReadFile(publicKey); exception != nil {
+				return nil, exception
+			}
+		}
+
+		rsaKey, exception := jwt.ParseRSAPublicKeyFromPEM(pem)
+		if exception != nil {
+			return nil, fmt.Errorf("invalid JWT_RSA_PUBLIC_KEY: %w", exception)
+		}
+		config.RsaPublicKey = rsaKey
+	}
+
+	return config, nil
+}
+
+// Validate makes sure there is a key to verify tokens with, without one every authenticated request would fail
+func (config *AuthConfig) Validate() error {
+	if len(config.HmacSecret) == 0 && config.RsaPublicKey == nil {
+		return errors.New("missing JWT_HMAC_SECRET or JWT_RSA_PUBLIC_KEY, at least one is needed to verify auth tokens")
+	}
+	return nil
+}
+
+// Auth verifies HS256/RS256 bearer tokens and exposes the user id in their "sub" claim
+type Auth struct {
+	config *AuthConfig
+}
+
+func NewAuth(config *AuthConfig) *Auth {
+	return &Auth{config: config}
+}
+
+// Required rejects requests without a valid bearer token with a 401
+func (a *Auth) Required() echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			if exception := a.authenticate(c); exception != nil {
+				return exception
+			}
+
+			return next(c)
+		}
+	}
+}
+
+// Optional authenticates requests carrying a bearer token and lets anonymous ones through
+func (a *Auth) Optional() echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			if c.Request().Header.Get(echo.HeaderAuthorization) == "" {
+				return next(c)
+			}
+
+			if exception := a.authenticate(c); exception != nil {
+				return exception
+			}
+
+			return next(c)
+		}
+	}
+}
+
+// RequireRole rejects requests whose token has no such role in its "roles" claim with a 403, it goes after Required
+func (a *Auth) RequireRole(role string) echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			if !HasRole(c, role) {
+				return apperror.Forbidden("This requires the " + role + " role")
+			}
+
+			return next(c)
+		}
+	}
+}
+
+func (a *Auth) authenticate(c echo.Context) error {
+	header := c.Request().Header.Get(echo.HeaderAuthorization)
+
+	// We only accept "Bearer <token>"
+	if len(header) < 7 || !strings.EqualFold(header[:7], "bearer ") {
+		return apperror.Unauthorized("Missing bearer token", nil)
+	}
+
+	claims := jwt.MapClaims{}
+	if _, exception := jwt.ParseWithClaims(strings.TrimSpace(header[7:]), claims, a.key); exception != nil {
+		return apperror.Unauthorized("Invalid bearer token", exception)
+	}
+
+	subject, _ := claims["sub"].(string)
+	userId, exception := strconv.ParseUint(subject, 10, 32)
+	if exception != nil || userId == 0 {
+		return apperror.Unauthorized("The token subject is not a user id", exception)
+	}
+
+	c.Set(UserIdKey, uint32(userId))
+	c.Set(RolesKey, roles(claims["roles"]))
+
+	return nil
+}
+
+// roles accepts the claim as a list of strings or as one space separated string
+func roles(claim interface{}) []string {
+	switch value := claim.(type) {
+	case string:
+		return strings.Fields(value)
+	case []interface{}:
+		roles := make([]string, 0, len(value))
+		for _, role := range value {
+			if role, isString := role.(string); isString {
+				roles = append(roles, role)
+			}
+		}
+		return roles
+	}
+
+	return nil
+}
+
+// key picks the verification key matching the token algorithm, anything else than HS256 or RS256 is refused
+func (a *Auth) key(token *jwt.Token) (interface{}, error) {
+	switch token.Method {
+	case jwt.SigningMethodHS256:
+		if len(a.config.HmacSecret) > 0 {
+			return a.config.HmacSecret, nil
+		}
+	case jwt.SigningMethodRS256:
+		if a.config.RsaPublicKey != nil {
+			return a.config.RsaPublicKey, nil
+		}
+	}
+
+	return nil, errors.New("unsupported signing method " + token.Method.Alg())
+}
+
+// UserId returns the authenticated user id of the request, if any
+func UserId(c echo.Context) (uint32, bool) {
+	userId, isSet := c.Get(UserIdKey).(uint32)
+	return userId, isSet
+}
+
+// HasRole tells whether the authenticated user of the request has the role
+func HasRole(c echo.Context, role string) bool {
+	roles, _ := c.Get(RolesKey).([]string)
+	for _, candidate := range roles {
+		if candidate == role {
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,189 @@
+package middleware
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"two-in-one/apperror"
+
+	"github.com/golang-jwt/jwt"
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAuth_Required(t *testing.T) {
+
+	rsaKey, _ := rsa.GenerateKey(rand.Reader, 2048)
+	otherKey, _ := rsa.GenerateKey(rand.Reader, 2048)
+
+	auth := NewAuth(&AuthConfig{
+		HmacSecret:   []byte("secret"),
+		RsaPublicKey: &rsaKey.PublicKey,
+	})
+
+	sign := func(method jwt.SigningMethod, key interface{}, claims jwt.MapClaims) string {
+		token, _ := jwt.NewWithClaims(method, claims).SignedString(key)
+		return "Bearer " + token
+	}
+
+	tests := []struct {
+		name       string
+		header     string
+		wantUserId uint32
+		wantStatus int
+	}{
+		{
+			name:       "HS256",
+			header:     sign(jwt.SigningMethodHS256, []byte("secret"), jwt.MapClaims{"sub": "5"}),
+			wantUserId: 5,
+		},
+		{
+			name:       "RS256",
+			header:     sign(jwt.SigningMethodRS256, rsaKey, jwt.MapClaims{"sub": "7"}),
+			wantUserId: 7,
+		},
+		{
+			name:       "Missing header",
+			header:     "",
+			wantStatus: http.StatusUnauthorized,
+		},
+		{
+			name:       "Wrong HMAC secret",
+			header:     sign(jwt.SigningMethodHS256, []byte("wrong"), jwt.MapClaims{"sub": "5"}),
+			wantStatus: http.StatusUnauthorized,
+		},
+		{
+			name:       "Wrong RSA key",
+			header:     sign(jwt.SigningMethodRS256, otherKey, jwt.MapClaims{"sub": "5"}),
+			wantStatus: http.StatusUnauthorized,
+		},
+		{
+			name:       "Unsupported algorithm",
+			header:     sign(jwt.SigningMethodHS512, []byte("secret"), jwt.MapClaims{"sub": "5"}),
+			wantStatus: http.StatusUnauthorized,
+		},
+		{
+			name:       "Expired",
+			header:     sign(jwt.SigningMethodHS256, []byte("secret"), jwt.MapClaims{"sub": "5", "exp": time.Now().Add(-time.Minute).Unix()}),
+			wantStatus: http.StatusUnauthorized,
+		},
+		{
+			name:       "Subject is not a user id",
+			header:     sign(jwt.SigningMethodHS256, []byte("secret"), jwt.MapClaims{"sub": "admin"}),
+			wantStatus: http.StatusUnauthorized,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			request := httptest.NewRequest(http.MethodGet, "/", nil)
+			if test.header != "" {
+				request.Header.Set(echo.HeaderAuthorization, test.header)
+			}
+			c := echo.New().NewContext(request, httptest.NewRecorder())
+
+			var gotUserId uint32
+			exception := auth.Required()(func(c echo.Context) error {
+				gotUserId, _ = UserId(c)
+				return nil
+			})(c)
+
+			if test.wantStatus != 0 {
+				assert.Equal(t, test.wantStatus, apperror.From(exception).Status)
+				return
+			}
+
+			assert.NoError(t, exception)
+			assert.Equal(t, test.wantUserId, gotUserId)
+		})
+	}
+}
+
+func TestAuth_Optional(t *testing.T) {
+
+	auth := NewAuth(&AuthConfig{HmacSecret: []byte("secret")})
+
+	run := func(header string) (uint32, bool, error) {
+		request := httptest.NewRequest(http.MethodGet, "/", nil)
+		if header != "" {
+			request.Header.Set(echo.HeaderAuthorization, header)
+		}
+		c := echo.New().NewContext(request, httptest.NewRecorder())
+
+		var userId uint32
+		var isSet bool
+		exception := auth.Optional()(func(c echo.Context) error {
+			userId, isSet = UserId(c)
+			return nil
+		})(c)
+
+		return userId, isSet, exception
+	}
+
+	_, isSet, exception := run("")
+	assert.NoError(t, exception)
+	assert.False(t, isSet)
+
+	token, _ := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{"sub": "5"}).SignedString([]byte("secret"))
+	userId, isSet, exception := run("Bearer " + token)
+	assert.NoError(t, exception)
+	assert.True(t, isSet)
+	assert.Equal(t, uint32(5), userId)
+
+	// A broken token is still an error, it must not silently downgrade to anonymous
+	_, _, exception = run("Bearer broken")
+	assert.Equal(t, http.StatusUnauthorized, apperror.From(exception).Status)
+}
+
+func TestAuth_RequireRole(t *testing.T) {
+
+	auth := NewAuth(&AuthConfig{HmacSecret: []byte("secret")})
+
+	tests := []struct {
+		name       string
+		roles      interface{}
+		wantStatus int
+	}{
+		{"Role list", []string{"user", "moderator"}, 0},
+		{"Space separated roles", "user moderator", 0},
+		{"Missing role", []string{"user"}, http.StatusForbidden},
+		{"No roles claim", nil, http.StatusForbidden},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			claims := jwt.MapClaims{"sub": "5"}
+			if test.roles != nil {
+				claims["roles"] = test.roles
+			}
+			token, _ := jwt.NewWithClaims(jwt.SigningMethodHS256, claims).SignedString([]byte("secret"))
+
+			request := httptest.NewRequest(http.MethodGet, "/", nil)
+			request.Header.Set(echo.HeaderAuthorization, "Bearer "+token)
+			c := echo.New().NewContext(request, httptest.NewRecorder())
+
+			exception := auth.Required()(auth.RequireRole("moderator")(func(c echo.Context) error {
+				return nil
+			}))(c)
+
+			if test.wantStatus != 0 {
+				assert.Equal(t, test.wantStatus, apperror.From(exception).Status)
+				return
+			}
+
+			assert.NoError(t, exception)
+		})
+	}
+}
+
+func TestAuthConfig_Validate(t *testing.T) {
+	assert.Error(t, (&AuthConfig{}).Validate())
+	assert.NoError(t, (&AuthConfig{HmacSecret: []byte("secret")}).Validate())
+
+	rsaKey, _ := rsa.GenerateKey(rand.Reader, 2048)
+	assert.NoError(t, (&AuthConfig{RsaPublicKey: &rsaKey.PublicKey}).Validate())
+}
@@ -0,0 +1,320 @@
+package middleware
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+	"io/ioutil"
+	"mime/multipart"
+	"net/http"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"two-in-one/apperror"
+	"two-in-one/model"
+
+	"github.com/labstack/echo/v4"
+	"gorm.io/gorm"
+)
+
+const (
+	// HeaderIdempotencyKey carries the client chosen key of a request that is safe to retry
+	HeaderIdempotencyKey = "Idempotency-Key"
+
+	// HeaderIdempotentReplayed is set on responses served from a stored key
+	HeaderIdempotentReplayed = "Idempotent-Replayed"
+
+	// How long a key is remembered by default
+	defaultIdempotencyTTL = 24 * time.Hour
+
+	// Same as the column size
+	maxIdempotencyKeyLength = 255
+
+	// Room for a batch of 500 comments of 10000 characters, the largest JSON body the keyed routes take
+	defaultIdempotencyMaxBody = 32 << 20
+)
+
+// errBodyTooLarge is returned when a keyed request is larger than IdempotencyConfig.MaxBodySize
+var errBodyTooLarge = errors.New("request body too large")
+
+type IdempotencyConfig struct {
+	// How long the response to a key is replayed, the key can be used for another request after that
+	TTL time.Duration
+
+	// The largest body a keyed request can have in bytes, it is read before the handler runs to fingerprint it
+	MaxBodySize int64
+}
+
+// IdempotencyConfigFromEnv reads IDEMPOTENCY_TTL as a Go duration, e.g. "24h", and IDEMPOTENCY_MAX_BODY_SIZE in bytes
+func IdempotencyConfigFromEnv() (*IdempotencyConfig, error) {
+	config := &IdempotencyConfig{TTL: defaultIdempotencyTTL, MaxBodySize: defaultIdempotencyMaxBody}
+
+	if size := os.Getenv("IDEMPOTENCY_MAX_BODY_SIZE"); size != "" {
+		value, exception := strconv.ParseInt(size, 10, 64)
+		if exception != nil || value <= 0 {
+			return nil, fmt.Errorf("invalid IDEMPOTENCY_MAX_BODY_SIZE %q", size)
+		}
+		config.MaxBodySize = value
+	}
+
+	if ttl := os.Getenv("IDEMPOTENCY_TTL"); ttl != "" {
+		value, exception := time.ParseDuration(ttl)
+		if exception != nil || value <= 0 {
+			return nil, fmt.Errorf("invalid IDEMPOTENCY_TTL %q", ttl)
+		}
+		config.TTL = value
+	}
+
+	return config, nil
+}
+
+// Idempotency stores the response to requests sent with an Idempotency-Key header in the database
+// and replays it when the same request comes again with that key
+type Idempotency struct {
+	gormDb *gorm.DB
+	config *IdempotencyConfig
+}
+
+func NewIdempotency(gormDb *gorm.DB, config *IdempotencyConfig) *Idempotency {
+	return &Idempotency{gormDb: gormDb, config: config}
+}
+
+// Keys makes a route idempotent for requests carrying a key, it goes after Required as keys are per user.
+// Reusing a key for a different request is a 409, and so is retrying while the first request is still running.
+// Server errors aren't stored, the key can be retried right away.
+func (i *Idempotency) Keys() echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			value := c.Request().Header.Get(HeaderIdempotencyKey)
+			if value == "" {
+				return next(c)
+			}
+
+			if len(value) > maxIdempotencyKeyLength {
+				return apperror.New(http.StatusBadRequest, apperror.CodeBadRequest,
+					fmt.Sprintf("The %s header can't be longer than %d characters", HeaderIdempotencyKey, maxIdempotencyKeyLength))
+			}
+
+			hash, exception := requestHash(c, i.config.MaxBodySize)
+			if errors.Is(exception, errBodyTooLarge) {
+				return apperror.New(http.StatusRequestEntityTooLarge, "body_too_large",
+					fmt.Sprintf("Requests with an %s can't be larger than %d bytes", HeaderIdempotencyKey, i.config.MaxBodySize))
+			}
+			if exception != nil {
+				return apperror.InvalidBody(exception)
+			}
+
+			userId, _ := UserId(c)
+
+			key := &model.IdempotencyKey{
+				UserId:      userId,
+				Key:         value,
+				RequestHash: hash,
+				ExpiresAt:   i.gormDb.NowFunc().Add(i.config.TTL),
+			}
+
+			isReserved, exception := key.Reserve(i.gormDb)
+			if exception != nil {
+				return apperror.Database(exception)
+			}
+
+			if !isReserved {
+				return i.replay(c, value, hash)
+			}
+
+			return i.record(c, next, key)
+		}
+	}
+}
+
+// replay answers with the stored response of a key someone already holds
+func (i *Idempotency) replay(c echo.Context, value string, hash string) error {
+	userId, _ := UserId(c)
+
+	var stored model.IdempotencyKey
+
+	if exception := stored.Find(i.gormDb, userId, value); exception != nil {
+		if !errors.Is(exception, gorm.ErrRecordNotFound) {
+			return apperror.Database(exception)
+		}
+
+		// Released or expired between our insert and this lookup, the client can simply retry
+		return apperror.Conflict("The request with this idempotency key is still in progress, retry later", exception)
+	}
+
+	if stored.RequestHash != hash {
+		return apperror.Conflict("The idempotency key was already used for a different request", nil)
+	}
+
+	if !stored.IsComplete() {
+		return apperror.Conflict("The request with this idempotency key is still in progress, retry later", nil)
+	}
+
+	c.Response().Header().Set(HeaderIdempotentReplayed, "true")
+
+	return c.Blob(stored.Status, stored.ContentType, stored.Body)
+}
+
+// record runs the request and stores its response under the key
+func (i *Idempotency) record(c echo.Context, next echo.HandlerFunc, key *model.IdempotencyKey) error {
+	response := c.Response()
+	recorder := &responseRecorder{ResponseWriter: response.Writer}
+	response.Writer = recorder
+
+	// Render errors here so the error response is what gets stored
+	if exception := next(c); exception != nil {
+		c.Error(exception)
+	}
+
+	response.Writer = recorder.ResponseWriter
+
+	if response.Status >= http.StatusInternalServerError {
+		if exception := key.Release(i.gormDb); exception != nil {
+			c.Logger().Errorf("releasing idempotency key %q: %s", key.Key, exception.Error())
+		}
+		return nil
+	}
+
+	// The response is already sent, a failure here only means a retry runs the request again
+	if exception := key.Complete(i.gormDb, response.Status, response.Header().Get(echo.HeaderContentType), recorder.body.Bytes()); exception != nil {
+		c.Logger().Errorf("storing idempotency key %q: %s", key.Key, exception.Error())
+	}
+
+	return nil
+}
+
+// requestHash fingerprints the method, path and body of a request, leaving the body readable for the handler.
+// Bodies past maxBodySize are errBodyTooLarge, they are never read further.
+func requestHash(c echo.Context, maxBodySize int64) (string, error) {
+	request := c.Request()
+
+	if request.ContentLength > maxBodySize {
+		return "", errBodyTooLarge
+	}
+
+	var body *cappedBody
+	if request.Body != nil {
+		body = &cappedBody{ReadCloser: request.Body, limit: maxBodySize}
+		request.Body = body
+	}
+
+	digest := sha256.New()
+	digest.Write([]byte(request.Method + " " + request.URL.Path + "\n"))
+
+	// The boundary changes with every retry of an upload, so it goes by what the form holds
+	if strings.HasPrefix(request.Header.Get(echo.HeaderContentType), echo.MIMEMultipartForm) {
+		if exception := hashForm(c, digest); exception != nil {
+			if body != nil && body.exceeded {
+				return "", errBodyTooLarge
+			}
+			return "", exception
+		}
+		return hex.EncodeToString(digest.Sum(nil)), nil
+	}
+
+	var content []byte
+	if body != nil {
+		var exception error
+		if content, exception = ioutil.ReadAll(body); exception != nil {
+			return "", exception
+		}
+	}
+	request.Body = ioutil.NopCloser(bytes.NewReader(content))
+
+	digest.Write(content)
+
+	return hex.EncodeToString(digest.Sum(nil)), nil
+}
+
+// hashForm adds the fields of a multipart form and the checksums of its files to the digest, in name order. The form
+// is parsed the way the handler would, large files go to temporary files rather than memory, and stays parsed for it.
+func hashForm(c echo.Context, digest hash.Hash) error {
+	form, exception := c.MultipartForm()
+	if exception != nil {
+		return exception
+	}
+
+	fields := make([]string, 0, len(form.Value))
+	for name := range form.Value {
+		fields = append(fields, name)
+	}
+	sort.Strings(fields)
+
+	for _, name := range fields {
+		for _, value := range form.Value[name] {
+			fmt.Fprintf(digest, "%q=%q\n", name, value)
+		}
+	}
+
+	files := make([]string, 0, len(form.File))
+	for name := range form.File {
+		files = append(files, name)
+	}
+	sort.Strings(files)
+
+	for _, name := range files {
+		for _, header := range form.File[name] {
+			checksum, exception := fileChecksum(header)
+			if exception != nil {
+				return exception
+			}
+			fmt.Fprintf(digest, "%q=%q;%q;%d;%x\n", name, header.Filename, header.Header.Get(echo.HeaderContentType), header.Size, checksum)
+		}
+	}
+
+	return nil
+}
+
+// fileChecksum is the SHA-256 of an uploaded file, read a piece at a time
+func fileChecksum(header *multipart.FileHeader) ([]byte, error) {
+	file, exception := header.Open()
+	if exception != nil {
+		return nil, exception
+	}
+	defer file.Close()
+
+	digest := sha256.New()
+	if _, exception := io.Copy(digest, file); exception != nil {
+		return nil, exception
+	}
+
+	return digest.Sum(nil), nil
+}
+
+// cappedBody fails reads past the limit instead of handing out the rest of the body
+type cappedBody struct {
+	io.ReadCloser
+	limit    int64
+	read     int64
+	exceeded bool
+}
+
+func (b *cappedBody) Read(data []byte) (int, error) {
+	read, exception := b.ReadCloser.Read(data)
+
+	b.read += int64(read)
+	if b.read > b.limit {
+		b.exceeded = true
+		return 0, errBodyTooLarge
+	}
+
+	return read, exception
+}
+
+// responseRecorder keeps a copy of everything written to the response
+type responseRecorder struct {
+	http.ResponseWriter
+	body bytes.Buffer
+}
+
+func (r *responseRecorder) Write(data []byte) (int, error) {
+	r.body.Write(data)
+	return r.ResponseWriter.Write(data)
+}
@@ -0,0 +1,255 @@
+package middleware
+
+import (
+	"bytes"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"two-in-one/apperror"
+	"two-in-one/model"
+
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+)
+
+// Small enough to go past in a test
+const testMaxBodySize = 1 << 10
+
+// idempotentServer serves POST /comments behind the idempotency middleware, counting how often the handler ran
+func idempotentServer(t *testing.T, ttl time.Duration, status int) (*echo.Echo, *gorm.DB, *int) {
+	gormDb, exception := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{})
+	require.NoError(t, exception)
+
+	// Every connection to ":memory:" is a separate database
+	sqlDb, _ := gormDb.DB()
+	sqlDb.SetMaxOpenConns(1)
+	t.Cleanup(func() {
+		_ = sqlDb.Close()
+	})
+
+	require.NoError(t, gormDb.AutoMigrate(&model.IdempotencyKey{}))
+
+	calls := 0
+	idempotency := NewIdempotency(gormDb, &IdempotencyConfig{TTL: ttl, MaxBodySize: testMaxBodySize})
+
+	e := echo.New()
+	e.HTTPErrorHandler = apperror.Handler
+	e.POST("/comments", func(c echo.Context) error {
+		calls++
+		if status >= http.StatusBadRequest {
+			return apperror.New(status, "failed", "Failed")
+		}
+		return c.JSON(status, map[string]interface{}{"commentId": calls})
+	}, func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			c.Set(UserIdKey, uint32(c.Request().Header.Get("X-User")[0]-'0'))
+			return next(c)
+		}
+	}, idempotency.Keys())
+
+	return e, gormDb, &calls
+}
+
+func post(e *echo.Echo, userId string, key string, body string) *httptest.ResponseRecorder {
+	request := httptest.NewRequest(http.MethodPost, "/comments", strings.NewReader(body))
+	request.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+	request.Header.Set("X-User", userId)
+	if key != "" {
+		request.Header.Set(HeaderIdempotencyKey, key)
+	}
+
+	recorder := httptest.NewRecorder()
+	e.ServeHTTP(recorder, request)
+
+	return recorder
+}
+
+func TestIdempotency_Replay(t *testing.T) {
+	e, _, calls := idempotentServer(t, time.Hour, http.StatusCreated)
+
+	first := post(e, "1", "abc", `{"body":"hello"}`)
+	assert.Equal(t, http.StatusCreated, first.Code)
+	assert.Empty(t, first.Header().Get(HeaderIdempotentReplayed))
+
+	retry := post(e, "1", "abc", `{"body":"hello"}`)
+	assert.Equal(t, http.StatusCreated, retry.Code)
+	assert.Equal(t, "true", retry.Header().Get(HeaderIdempotentReplayed))
+	assert.Equal(t, first.Body.String(), retry.Body.String())
+	assert.Equal(t, echo.MIMEApplicationJSONCharsetUTF8, retry.Header().Get(echo.HeaderContentType))
+	assert.Equal(t, 1, *calls)
+
+	// Keys are per user
+	other := post(e, "2", "abc", `{"body":"hello"}`)
+	assert.Equal(t, http.StatusCreated, other.Code)
+	assert.Empty(t, other.Header().Get(HeaderIdempotentReplayed))
+
+	// Without a key nothing is remembered
+	post(e, "1", "", `{"body":"hello"}`)
+	post(e, "1", "", `{"body":"hello"}`)
+	assert.Equal(t, 4, *calls)
+}
+
+func TestIdempotency_DifferentPayload(t *testing.T) {
+	e, _, calls := idempotentServer(t, time.Hour, http.StatusCreated)
+
+	post(e, "1", "abc", `{"body":"hello"}`)
+	recorder := post(e, "1", "abc", `{"body":"something else"}`)
+
+	assert.Equal(t, http.StatusConflict, recorder.Code)
+	assert.Contains(t, recorder.Body.String(), apperror.CodeConflict)
+	assert.Equal(t, 1, *calls)
+}
+
+// upload posts a multipart form with a body field and a file, each call with a new boundary
+func upload(e *echo.Echo, key string, body string, content string) *httptest.ResponseRecorder {
+	var form bytes.Buffer
+	writer := multipart.NewWriter(&form)
+	_ = writer.WriteField("body", body)
+	file, _ := writer.CreateFormFile("attachments", "notes.txt")
+	_, _ = file.Write([]byte(content))
+	_ = writer.Close()
+
+	request := httptest.NewRequest(http.MethodPost, "/comments", &form)
+	request.Header.Set(echo.HeaderContentType, writer.FormDataContentType())
+	request.Header.Set("X-User", "1")
+	request.Header.Set(HeaderIdempotencyKey, key)
+
+	recorder := httptest.NewRecorder()
+	e.ServeHTTP(recorder, request)
+
+	return recorder
+}
+
+func TestIdempotency_Multipart(t *testing.T) {
+	e, _, calls := idempotentServer(t, time.Hour, http.StatusCreated)
+
+	first := upload(e, "abc", "hello", "content")
+	assert.Equal(t, http.StatusCreated, first.Code)
+
+	// Same fields and file under another boundary
+	retry := upload(e, "abc", "hello", "content")
+	assert.Equal(t, http.StatusCreated, retry.Code)
+	assert.Equal(t, "true", retry.Header().Get(HeaderIdempotentReplayed))
+	assert.Equal(t, 1, *calls)
+
+	// Another file is another request
+	assert.Equal(t, http.StatusConflict, upload(e, "abc", "hello", "other content").Code)
+	assert.Equal(t, http.StatusConflict, upload(e, "abc", "bye", "content").Code)
+	assert.Equal(t, 1, *calls)
+}
+
+func TestIdempotency_InProgress(t *testing.T) {
+	e, gormDb, calls := idempotentServer(t, time.Hour, http.StatusCreated)
+
+	// Another request holds the key but hasn't answered yet
+	key := &model.IdempotencyKey{UserId: 1, Key: "abc", ExpiresAt: time.Now().Add(time.Hour)}
+	require.NoError(t, gormDb.Create(key).Error)
+
+	recorder := post(e, "1", "abc", `{"body":"hello"}`)
+	assert.Equal(t, http.StatusConflict, recorder.Code)
+	assert.Equal(t, 0, *calls)
+}
+
+func TestIdempotency_Expired(t *testing.T) {
+	e, gormDb, calls := idempotentServer(t, time.Hour, http.StatusCreated)
+
+	post(e, "1", "abc", `{"body":"hello"}`)
+	gormDb.Model(&model.IdempotencyKey{}).Where("ik_key", "abc").Update("ik_expires_at", time.Now().Add(-time.Minute))
+
+	// Past its TTL the key is free again, whatever the payload
+	recorder := post(e, "1", "abc", `{"body":"something else"}`)
+	assert.Equal(t, http.StatusCreated, recorder.Code)
+	assert.Empty(t, recorder.Header().Get(HeaderIdempotentReplayed))
+	assert.Equal(t, 2, *calls)
+}
+
+func TestIdempotency_Errors(t *testing.T) {
+
+	// Client errors are answers too and get replayed
+	e, _, calls := idempotentServer(t, time.Hour, http.StatusUnprocessableEntity)
+
+	post(e, "1", "abc", `{}`)
+	recorder := post(e, "1", "abc", `{}`)
+	assert.Equal(t, http.StatusUnprocessableEntity, recorder.Code)
+	assert.Equal(t, "true", recorder.Header().Get(HeaderIdempotentReplayed))
+	assert.Equal(t, 1, *calls)
+
+	// Server errors release the key for a retry
+	e, _, calls = idempotentServer(t, time.Hour, http.StatusServiceUnavailable)
+
+	post(e, "1", "abc", `{}`)
+	recorder = post(e, "1", "abc", `{}`)
+	assert.Equal(t, http.StatusServiceUnavailable, recorder.Code)
+	assert.Empty(t, recorder.Header().Get(HeaderIdempotentReplayed))
+	assert.Equal(t, 2, *calls)
+}
+
+func TestIdempotency_KeyTooLong(t *testing.T) {
+	e, _, calls := idempotentServer(t, time.Hour, http.StatusCreated)
+
+	recorder := post(e, "1", strings.Repeat("k", maxIdempotencyKeyLength+1), `{}`)
+	assert.Equal(t, http.StatusBadRequest, recorder.Code)
+	assert.Equal(t, 0, *calls)
+}
+
+func TestIdempotency_BodyTooLarge(t *testing.T) {
+	e, _, calls := idempotentServer(t, time.Hour, http.StatusCreated)
+	body := `{"body":"` + strings.Repeat("a", testMaxBodySize) + `"}`
+
+	recorder := post(e, "1", "abc", body)
+	assert.Equal(t, http.StatusRequestEntityTooLarge, recorder.Code)
+
+	// Without a Content-Length the body is cut off while it is read
+	request := httptest.NewRequest(http.MethodPost, "/comments", strings.NewReader(body))
+	request.ContentLength = -1
+	request.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+	request.Header.Set("X-User", "1")
+	request.Header.Set(HeaderIdempotencyKey, "abc")
+	recorder = httptest.NewRecorder()
+	e.ServeHTTP(recorder, request)
+	assert.Equal(t, http.StatusRequestEntityTooLarge, recorder.Code)
+
+	recorder = upload(e, "abc", "hello", strings.Repeat("a", testMaxBodySize))
+	assert.Equal(t, http.StatusRequestEntityTooLarge, recorder.Code)
+	assert.Equal(t, 0, *calls)
+
+	// The key wasn't taken by the failed attempts
+	assert.Equal(t, http.StatusCreated, post(e, "1", "abc", `{"body":"hello"}`).Code)
+}
+
+func TestIdempotencyConfigFromEnv(t *testing.T) {
+	defer os.Unsetenv("IDEMPOTENCY_TTL")
+	defer os.Unsetenv("IDEMPOTENCY_MAX_BODY_SIZE")
+
+	config, exception := IdempotencyConfigFromEnv()
+	assert.NoError(t, exception)
+	assert.Equal(t, defaultIdempotencyTTL, config.TTL)
+	assert.Equal(t, int64(defaultIdempotencyMaxBody), config.MaxBodySize)
+
+	_ = os.Setenv("IDEMPOTENCY_MAX_BODY_SIZE", "1024")
+	config, exception = IdempotencyConfigFromEnv()
+	assert.NoError(t, exception)
+	assert.Equal(t, int64(1024), config.MaxBodySize)
+
+	_ = os.Setenv("IDEMPOTENCY_MAX_BODY_SIZE", "big")
+	_, exception = IdempotencyConfigFromEnv()
+	assert.Error(t, exception)
+	_ = os.Unsetenv("IDEMPOTENCY_MAX_BODY_SIZE")
+
+	_ = os.Setenv("IDEMPOTENCY_TTL", "2h")
+	config, exception = IdempotencyConfigFromEnv()
+	assert.NoError(t, exception)
+	assert.Equal(t, 2*time.Hour, config.TTL)
+
+	_ = os.Setenv("IDEMPOTENCY_TTL", "forever")
+	_, exception = IdempotencyConfigFromEnv()
+	assert.Error(t, exception)
+}
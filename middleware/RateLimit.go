@@ -0,0 +1,80 @@
+package middleware
+
+import (
+	"fmt"
+	"log"
+	"math"
+	"strconv"
+	"time"
+
+	"two-in-one/apperror"
+	"two-in-one/ratelimit"
+
+	"github.com/labstack/echo/v4"
+)
+
+// Headers of the IETF RateLimit draft, sent on every limited route
+const (
+	HeaderRateLimitLimit     = "RateLimit-Limit"
+	HeaderRateLimitRemaining = "RateLimit-Remaining"
+	HeaderRateLimitReset     = "RateLimit-Reset"
+	HeaderRateLimitPolicy    = "RateLimit-Policy"
+
+	// HeaderRetryAfter is only sent when a request was refused, in seconds
+	HeaderRetryAfter = "Retry-After"
+)
+
+// RateLimit holds each client to the limit of the route it calls, with a token bucket per route and client
+type RateLimit struct {
+	store  ratelimit.Store
+	config *ratelimit.Config
+}
+
+func NewRateLimit(store ratelimit.Store, config *ratelimit.Config) *RateLimit {
+	return &RateLimit{store: store, config: config}
+}
+
+// Limit applies the configured limit of the route, routes without one go through untouched. It goes after the auth
+// middleware: authenticated users are limited by user id, everyone else by IP.
+func (r *RateLimit) Limit() echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			route := ratelimit.Route(c.Request().Method, c.Path())
+
+			limit, isLimited := r.config.Limits[route]
+			if !isLimited {
+				return next(c)
+			}
+
+			client := "ip:" + c.RealIP()
+			if userId, isAuthenticated := UserId(c); isAuthenticated {
+				client = "user:" + strconv.FormatUint(uint64(userId), 10)
+			}
+
+			result, exception := r.store.Take(route+" "+client, limit, time.Now())
+			if exception != nil {
+				// A store that is down shouldn't take the API down with it
+				log.Printf("[RateLimit] Letting %s through: %s", client, exception.Error())
+				return next(c)
+			}
+
+			header := c.Response().Header()
+			header.Set(HeaderRateLimitLimit, strconv.Itoa(limit.Requests))
+			header.Set(HeaderRateLimitRemaining, strconv.Itoa(result.Remaining))
+			header.Set(HeaderRateLimitReset, wholeSeconds(result.Reset))
+			header.Set(HeaderRateLimitPolicy, fmt.Sprintf("%d;w=%s", limit.Requests, wholeSeconds(limit.Per)))
+
+			if !result.Allowed {
+				header.Set(HeaderRetryAfter, wholeSeconds(result.RetryAfter))
+				return apperror.TooManyRequests("Too many requests, try again later")
+			}
+
+			return next(c)
+		}
+	}
+}
+
+// wholeSeconds rounds up, so a client waiting that long is sure to get through
+func wholeSeconds(duration time.Duration) string {
+	return strconv.FormatInt(int64(math.Ceil(duration.Seconds())), 10)
+}
@@ -0,0 +1,101 @@
+package middleware
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"two-in-one/apperror"
+	"two-in-one/ratelimit"
+
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/assert"
+)
+
+// failingStore stands in for a store whose service is down
+type failingStore struct{}
+
+func (s *failingStore) Take(key string, limit ratelimit.Limit, now time.Time) (*ratelimit.Result, error) {
+	return nil, errors.New("connection refused")
+}
+
+// limitedServer serves POST /comments with a limit of two requests a minute, and GET /comments without a limit.
+// The X-User header authenticates the caller.
+func limitedServer(store ratelimit.Store) *echo.Echo {
+	rateLimit := NewRateLimit(store, &ratelimit.Config{Limits: map[string]ratelimit.Limit{
+		"POST /comments": {Requests: 2, Per: time.Minute},
+	}})
+
+	authenticate := func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			if user := c.Request().Header.Get("X-User"); user != "" {
+				c.Set(UserIdKey, uint32(user[0]-'0'))
+			}
+			return next(c)
+		}
+	}
+
+	handler := func(c echo.Context) error {
+		return c.NoContent(http.StatusNoContent)
+	}
+
+	e := echo.New()
+	e.HTTPErrorHandler = apperror.Handler
+	e.POST("comments", handler, authenticate, rateLimit.Limit())
+	e.GET("comments", handler, authenticate, rateLimit.Limit())
+
+	return e
+}
+
+func send(e *echo.Echo, method string, userId string, ip string) *httptest.ResponseRecorder {
+	request := httptest.NewRequest(method, "/comments", nil)
+	request.RemoteAddr = ip + ":1234"
+	if userId != "" {
+		request.Header.Set("X-User", userId)
+	}
+
+	recorder := httptest.NewRecorder()
+	e.ServeHTTP(recorder, request)
+	return recorder
+}
+
+func TestRateLimit_Limit(t *testing.T) {
+	e := limitedServer(ratelimit.NewMemoryStore())
+
+	first := send(e, http.MethodPost, "1", "10.0.0.1")
+	assert.Equal(t, http.StatusNoContent, first.Code)
+	assert.Equal(t, "2", first.Header().Get(HeaderRateLimitLimit))
+	assert.Equal(t, "1", first.Header().Get(HeaderRateLimitRemaining))
+	assert.Equal(t, "30", first.Header().Get(HeaderRateLimitReset))
+	assert.Equal(t, "2;w=60", first.Header().Get(HeaderRateLimitPolicy))
+
+	assert.Equal(t, http.StatusNoContent, send(e, http.MethodPost, "1", "10.0.0.1").Code)
+
+	refused := send(e, http.MethodPost, "1", "10.0.0.2")
+	assert.Equal(t, http.StatusTooManyRequests, refused.Code)
+	assert.Equal(t, "0", refused.Header().Get(HeaderRateLimitRemaining))
+	assert.Equal(t, "30", refused.Header().Get(HeaderRetryAfter))
+	assert.Contains(t, refused.Body.String(), `"code":"too_many_requests"`)
+
+	// Other users and anonymous callers have their own buckets, per IP
+	assert.Equal(t, http.StatusNoContent, send(e, http.MethodPost, "2", "10.0.0.1").Code)
+	assert.Equal(t, http.StatusNoContent, send(e, http.MethodPost, "", "10.0.0.1").Code)
+	assert.Equal(t, http.StatusNoContent, send(e, http.MethodPost, "", "10.0.0.1").Code)
+	assert.Equal(t, http.StatusTooManyRequests, send(e, http.MethodPost, "", "10.0.0.1").Code)
+	assert.Equal(t, http.StatusNoContent, send(e, http.MethodPost, "", "10.0.0.2").Code)
+
+	// Routes without a limit go through untouched
+	unlimited := send(e, http.MethodGet, "1", "10.0.0.1")
+	assert.Equal(t, http.StatusNoContent, unlimited.Code)
+	assert.Empty(t, unlimited.Header().Get(HeaderRateLimitLimit))
+}
+
+func TestRateLimit_StoreDown(t *testing.T) {
+	e := limitedServer(&failingStore{})
+
+	for i := 0; i < 3; i++ {
+		assert.Equal(t, http.StatusNoContent, send(e, http.MethodPost, "1", "10.0.0.1").Code)
+	}
+}
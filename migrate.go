@@ -0,0 +1,76 @@
+package main
+
+import (
+	"errors"
+	"log"
+
+	"two-in-one/model"
+
+	"gorm.io/gorm"
+)
+
+// How many comment bodies are rendered per query when backfilling c_body_html
+const renderBatchSize = 500
+
+// migrateDb creates or updates the tables the models need
+func migrateDb(gormDb *gorm.DB) error {
+	exception := gormDb.AutoMigrate(
+		&model.Comment{},
+		&model.CommentRevision{},
+		&model.ModerationFlag{},
+		&model.CommentReaction{},
+		&model.CommentMention{},
+		&model.CommentAttachment{},
+		&model.IdempotencyKey{},
+		&model.OutboxEvent{},
+		&model.WebhookSubscription{},
+		&model.WebhookDelivery{},
+		&model.WebhookAttempt{},
+		&model.CommentErasure{},
+	)
+	if exception != nil {
+		return exception
+	}
+
+	// Search works without it, it just answers with a 503
+	if exception := model.SetupSearch(gormDb); exception != nil {
+		if !errors.Is(exception, model.ErrSearchUnavailable) {
+			return exception
+		}
+		log.Print("[DB] FTS5 is not available, build with -tags sqlite_fts5 to enable search")
+	}
+
+	// Comments written before the timestamps existed get the time of the migration
+	now := gormDb.NowFunc()
+
+	exception = gormDb.Model(&model.Comment{}).
+		Where("created_at IS NULL").
+		UpdateColumns(map[string]interface{}{
+			"created_at": now,
+			"updated_at": now,
+		}).
+		Error
+	if exception != nil {
+		return exception
+	}
+
+	// Same for the ones deleted before deleted_at existed
+	exception = gormDb.Model(&model.Comment{}).
+		Where("c_deleted", true).
+		Where("deleted_at IS NULL").
+		UpdateColumn("deleted_at", now).
+		Error
+	if exception != nil {
+		return exception
+	}
+
+	// And the rendered body of the ones written before it was stored
+	var comment model.Comment
+
+	rendered, exception := comment.RenderMissingHtml(gormDb, renderBatchSize)
+	if rendered > 0 {
+		log.Printf("[DB] Rendered the body of %d comments", rendered)
+	}
+
+	return exception
+}
@@ -0,0 +1,27 @@
+package main
+
+import (
+	"testing"
+
+	"two-in-one/model"
+
+	"github.com/stretchr/testify/assert"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+)
+
+func Test_migrateDb(t *testing.T) {
+
+	// Create a mock DB
+	gormDb, _ := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{})
+
+	// Close our DB
+	defer closeConnection(gormDb)
+
+	assert.NoError(t, migrateDb(gormDb))
+
+	// Tables
+	assert.True(t, gormDb.Migrator().HasTable(&model.Comment{}))
+	assert.True(t, gormDb.Migrator().HasColumn(&model.Comment{}, "fk_parent_id"))
+	assert.True(t, gormDb.Migrator().HasTable(&model.IdempotencyKey{}))
+}
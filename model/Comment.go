@@ -1,50 +1,487 @@
 package model
 
 import (
+	"errors"
+	"fmt"
+	"time"
+
+	"two-in-one/helper/cache"
+	"two-in-one/markdown"
+
 	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// Moderation states, only published comments are shown to everyone
+const (
+	StatusPublished = "published"
+	StatusPending   = "pending"
+	StatusRejected  = "rejected"
 )
 
+// ErrVersionConflict is returned when a comment changed since the version a write was based on
+var ErrVersionConflict = errors.New("the comment was changed in the meantime")
+
 type Comment struct {
-	Id      uint32 `gorm:"column:c_id;primary_key:true" json:"id"`
-	Body    string `gorm:"column:c_body" json:"body"`
-	Deleted bool   `gorm:"column:c_deleted" json:"deleted"`
-	UserId  uint32 `gorm:"column:fk_user_id" json:"userId"`
+	Id         uint32  `gorm:"column:c_id;primary_key:true" json:"id"`
+	Body       string  `gorm:"column:c_body" json:"body"`
+	Deleted    bool    `gorm:"column:c_deleted" json:"deleted"`
+	UserId     uint32  `gorm:"column:fk_user_id" json:"userId"`
+	ParentId   *uint32 `gorm:"column:fk_parent_id;index" json:"parentId"`
+	ReplyCount uint32  `gorm:"column:c_reply_count;not null;default:0" json:"replyCount"`
+
+	// The body rendered from Markdown to sanitised HTML, stored next to it so reads don't render it again
+	BodyHtml string `gorm:"column:c_body_html" json:"bodyHtml"`
+
+	// How many files are attached, so comments without any don't need a lookup
+	AttachmentCount uint32 `gorm:"column:c_attachment_count;not null;default:0" json:"attachmentCount"`
+
+	// Goes up with every edit, delete and restore, served as the ETag of the comment
+	Version uint32 `gorm:"column:c_version;not null;default:1" json:"version"`
+
+	// Pending comments wait in the moderation queue, counted in the ReplyCount of their parent all the same
+	Status string `gorm:"column:c_status;size:16;not null;default:published;index" json:"status"`
+
+	// Filled in by Gorm, rows older than these columns are backfilled by the migration
+	CreatedAt time.Time `gorm:"column:created_at;index" json:"createdAt"`
+	UpdatedAt time.Time `gorm:"column:updated_at" json:"updatedAt"`
+
+	// Set next to c_deleted when the comment is soft-deleted
+	DeletedAt *time.Time `gorm:"column:deleted_at" json:"deletedAt"`
+
+	// Counts per reaction type and the viewer's own reactions, only filled in by LoadReactions
+	Reactions   map[string]int64 `gorm:"-" json:"reactions"`
+	MyReactions []string         `gorm:"-" json:"myReactions"`
+
+	// Why the comment was held for moderation, only filled in by the moderation queue
+	Flags []*ModerationFlag `gorm:"foreignKey:CommentId;references:Id" json:"flags,omitempty"`
+
+	// Inserted along with a new comment, only filled in by LoadAttachments
+	Attachments []*CommentAttachment `gorm:"foreignKey:CommentId;references:Id" json:"attachments,omitempty"`
+
+	// Only filled in when loading a thread
+	Replies       []*Comment `gorm:"-" json:"replies,omitempty"`
+	RepliesCursor string     `gorm:"-" json:"repliesCursor,omitempty"`
 }
 
 func (comment *Comment) TableName() string {
 	return "comments"
 }
 
+// BeforeCreate renders the body of a new comment and counts the attachments inserted with it
+func (comment *Comment) BeforeCreate(tx *gorm.DB) error {
+	comment.BodyHtml = markdown.Render(comment.Body)
+	comment.AttachmentCount = uint32(len(comment.Attachments))
+	return nil
+}
+
+// FindById goes through the query cache when one is registered, until a write invalidates the comment
 func (comment *Comment) FindById(gormDb *gorm.DB, commentId uint32) error {
+	return gormDb.Set(cache.Key, commentCacheTag(commentId)).
+		Model(&comment).
+		Where("c_deleted", false).
+		First(&comment, commentId).
+		Error
+}
+
+// FindForWrite loads a live comment from the database, never from the query cache, for the checks a write relies on
+func (comment *Comment) FindForWrite(gormDb *gorm.DB, commentId uint32) error {
 	return gormDb.Model(&comment).
-		Find(&comment, commentId).
 		Where("c_deleted", false).
+		First(&comment, commentId).
+		Error
+}
+
+// FindDeletedById loads a soft-deleted comment
+func (comment *Comment) FindDeletedById(gormDb *gorm.DB, commentId uint32) error {
+	return gormDb.Model(&comment).
+		Where("c_deleted", true).
+		First(&comment, commentId).
 		Error
 }
 
-func (comment *Comment) GetByUserId(gormDb *gorm.DB, userId uint32) ([]*Comment, error) {
-	var comments []*Comment
-	exception := gormDb.Model(&comment).
+// ListQuery narrows down a listing to a time window
+type ListQuery struct {
+	PageQuery
+
+	// Inclusive bounds on created_at
+	Since *time.Time
+	Until *time.Time
+
+	// Only comments in this moderation state, any state when empty
+	Status string
+}
+
+// GetByUserId returns one keyset page of a user's comments, ordered by c_id which follows the creation order.
+// The pages go through the query cache when one is registered, until a write invalidates the user's comments.
+func (comment *Comment) GetByUserId(gormDb *gorm.DB, userId uint32, query ListQuery) ([]*Comment, *Page, error) {
+	tx := gormDb.Set(cache.Key, userCommentsCacheTag(userId)).
+		Model(&comment).
 		Where("fk_user_id", userId).
-		Where("c_deleted", false).
-		Find(&comments).Error
+		Where("c_deleted", false)
+
+	if query.Since != nil {
+		tx = tx.Where("created_at >= ?", *query.Since)
+	}
+	if query.Until != nil {
+		tx = tx.Where("created_at <= ?", *query.Until)
+	}
+	if query.Status != "" {
+		tx = tx.Where("c_status", query.Status)
+	}
 
-	return comments, exception
+	return paginate(tx, query.PageQuery)
 }
 
-func (comment *Comment) UpdateBody(gormDb *gorm.DB, commentId uint32, body string) error {
-	return gormDb.Model(&comment).
-		Limit(1).
-		Where("c_id", commentId).
-		Where("c_deleted", false).
-		Update("c_body", body).
+// The cache tags of a comment and of the listing of a user's comments
+func commentCacheTag(commentId uint32) string {
+	return fmt.Sprintf("comment:%d", commentId)
+}
+
+func userCommentsCacheTag(userId uint32) string {
+	return fmt.Sprintf("comments:user:%d", userId)
+}
+
+// InvalidateComments drops the cached lookups the changed comments show up in, it goes after the change is committed
+func InvalidateComments(gormDb *gorm.DB, comments []*Comment) {
+	tags := make([]string, 0, 2*len(comments))
+	for _, changed := range comments {
+		tags = append(tags, commentCacheTag(changed.Id), userCommentsCacheTag(changed.UserId))
+	}
+	cache.Invalidate(gormDb, tags...)
+}
+
+// findCacheOwners loads the ids and authors of comments whose counters a change bumps, to invalidate them after it
+func findCacheOwners(tx *gorm.DB, commentIds []uint32) ([]*Comment, error) {
+	var owners []*Comment
+	if len(commentIds) == 0 {
+		return owners, nil
+	}
+
+	exception := tx.Model(&Comment{}).
+		Select("c_id", "fk_user_id").
+		Where("c_id IN ?", commentIds).
+		Find(&owners).
 		Error
+
+	return owners, exception
 }
 
-func (comment *Comment) Delete(gormDb *gorm.DB, commentId uint32) error {
-	return gormDb.Model(&comment).
-		Limit(1).
+// RenderMissingHtml renders the bodies of the comments written before BodyHtml existed, batchSize at a time,
+// returning how many it rendered
+func (comment *Comment) RenderMissingHtml(gormDb *gorm.DB, batchSize int) (int, error) {
+	rendered := 0
+	var lastId uint32
+
+	// Walks the ids, a body rendering to nothing would otherwise come up again and again
+	for {
+		var comments []*Comment
+
+		exception := gormDb.Select("c_id", "c_body").
+			Where("c_id > ?", lastId).
+			Where("c_body_html IS NULL OR (c_body_html = '' AND c_body <> '')").
+			Order("c_id").
+			Limit(batchSize).
+			Find(&comments).
+			Error
+		if exception != nil || len(comments) == 0 {
+			return rendered, exception
+		}
+
+		for _, comment := range comments {
+			exception := gormDb.Model(&Comment{}).
+				Where("c_id", comment.Id).
+				UpdateColumn("c_body_html", markdown.Render(comment.Body)).
+				Error
+			if exception != nil {
+				return rendered, exception
+			}
+		}
+
+		rendered += len(comments)
+		lastId = comments[len(comments)-1].Id
+	}
+}
+
+// IncrementReplyCount bumps the reply counter of a parent comment
+func (comment *Comment) IncrementReplyCount(gormDb *gorm.DB, commentId uint32) error {
+	return gormDb.Model(&Comment{}).
 		Where("c_id", commentId).
-		Update("c_deleted", true).
+		UpdateColumn("c_reply_count", gorm.Expr("c_reply_count + ?", 1)).
 		Error
 }
+
+// UpdateBody replaces the body of a comment, keeping the previous one as a revision in the same transaction.
+// The update only goes through while the comment is still at the given version, 0 takes whatever version it is at.
+// A new body raising flags sends the comment back to the moderation queue.
+func (comment *Comment) UpdateBody(gormDb *gorm.DB, commentId uint32, body string, editorId uint32, version uint32, flags []*ModerationFlag) error {
+	var changed []*Comment
+
+	exception := gormDb.Transaction(func(tx *gorm.DB) error {
+		var current Comment
+
+		if exception := current.FindById(tx, commentId); exception != nil {
+			return exception
+		}
+
+		if version != 0 && current.Version != version {
+			return ErrVersionConflict
+		}
+
+		changes := map[string]interface{}{
+			"c_body":      body,
+			"c_body_html": markdown.Render(body),
+			"c_version":   gorm.Expr("c_version + ?", 1),
+		}
+		if len(flags) > 0 {
+			changes["c_status"] = StatusPending
+		}
+
+		// Someone else may have written in between, the version tells. The update goes first so that of two edits of
+		// the same version only one gets to number the next revision.
+		result := tx.Model(&Comment{}).
+			Limit(1).
+			Where("c_id", commentId).
+			Where("c_deleted", false).
+			Where("c_version", current.Version).
+			Updates(changes)
+
+		if result.Error != nil {
+			return result.Error
+		}
+
+		if result.RowsAffected == 0 {
+			return ErrVersionConflict
+		}
+
+		var revision CommentRevision
+
+		if exception := revision.record(tx, &current, editorId); exception != nil {
+			return exception
+		}
+
+		if len(flags) > 0 {
+			for _, flag := range flags {
+				flag.CommentId = commentId
+			}
+			if exception := tx.Create(&flags).Error; exception != nil {
+				return exception
+			}
+		}
+
+		if exception := syncMentions(tx, commentId, current.Body, body); exception != nil {
+			return exception
+		}
+
+		var exception error
+		changed, exception = recordCommentEvents(tx, EventCommentUpdated, []uint32{commentId})
+		return exception
+	})
+	if exception == nil {
+		InvalidateComments(gormDb, changed)
+	}
+
+	return exception
+}
+
+// Delete soft-deletes a comment, only while it is still at the given version unless that is 0
+func (comment *Comment) Delete(gormDb *gorm.DB, commentId uint32, version uint32) error {
+	var changed []*Comment
+
+	exception := gormDb.Transaction(func(tx *gorm.DB) error {
+		query := tx.Model(&Comment{}).
+			Limit(1).
+			Where("c_id", commentId).
+			Where("c_deleted", false)
+
+		if version != 0 {
+			query = query.Where("c_version", version)
+		}
+
+		result := query.Updates(map[string]interface{}{
+			"c_deleted":  true,
+			"deleted_at": tx.NowFunc(),
+			"c_version":  gorm.Expr("c_version + ?", 1),
+		})
+
+		if result.Error != nil {
+			return result.Error
+		}
+
+		if result.RowsAffected > 0 {
+			var exception error
+			changed, exception = recordCommentEvents(tx, EventCommentDeleted, []uint32{commentId})
+			return exception
+		}
+
+		// A live comment that didn't match is at another version
+		if version != 0 {
+			var live int64
+			exception := tx.Model(&Comment{}).
+				Where("c_id", commentId).
+				Where("c_deleted", false).
+				Count(&live).
+				Error
+			if exception != nil {
+				return exception
+			}
+			if live > 0 {
+				return ErrVersionConflict
+			}
+		}
+
+		// Nothing to delete, either it never existed or it's already gone
+		return gorm.ErrRecordNotFound
+	})
+	if exception == nil {
+		InvalidateComments(gormDb, changed)
+	}
+
+	return exception
+}
+
+// Restore undoes a soft delete
+func (comment *Comment) Restore(gormDb *gorm.DB, commentId uint32) error {
+	var changed []*Comment
+
+	exception := gormDb.Transaction(func(tx *gorm.DB) error {
+		result := tx.Model(&Comment{}).
+			Where("c_id", commentId).
+			Where("c_deleted", true).
+			Updates(map[string]interface{}{
+				"c_deleted":  false,
+				"deleted_at": nil,
+				"c_version":  gorm.Expr("c_version + ?", 1),
+			})
+
+		if result.Error != nil {
+			return result.Error
+		}
+
+		// Nothing to restore, either it never existed or it isn't deleted
+		if result.RowsAffected == 0 {
+			return gorm.ErrRecordNotFound
+		}
+
+		var exception error
+		changed, exception = recordCommentEvents(tx, EventCommentRestored, []uint32{commentId})
+		return exception
+	})
+	if exception == nil {
+		InvalidateComments(gormDb, changed)
+	}
+
+	return exception
+}
+
+// Purge permanently deletes comments soft-deleted before the given time, batchSize at a time.
+// Comments that still have replies are kept as placeholders until their replies are purged too.
+func (comment *Comment) Purge(gormDb *gorm.DB, before time.Time, batchSize int) ([]uint32, error) {
+	var purged []uint32
+
+	for {
+		var batch []*Comment
+		exception := gormDb.Model(&Comment{}).
+			Select("c_id", "fk_parent_id").
+			Where("c_deleted", true).
+			Where("deleted_at < ?", before).
+			Where("c_reply_count", 0).
+			Order("c_id ASC").
+			Limit(batchSize).
+			Find(&batch).
+			Error
+		if exception != nil {
+			return purged, exception
+		}
+
+		if len(batch) == 0 {
+			return purged, nil
+		}
+
+		candidates := make([]uint32, 0, len(batch))
+		for _, row := range batch {
+			candidates = append(candidates, row.Id)
+		}
+
+		var ids []uint32
+		var changed []*Comment
+
+		exception = gormDb.Transaction(func(tx *gorm.DB) error {
+			// A comment restored or replied to since the batch was read is left alone
+			var locked []*Comment
+			exception := tx.Model(&Comment{}).
+				Clauses(clause.Locking{Strength: "UPDATE"}).
+				Select("c_id", "fk_parent_id").
+				Where("c_id IN ?", candidates).
+				Where("c_deleted", true).
+				Where("deleted_at < ?", before).
+				Where("c_reply_count", 0).
+				Find(&locked).
+				Error
+			if exception != nil || len(locked) == 0 {
+				return exception
+			}
+
+			ids = make([]uint32, 0, len(locked))
+			parents := make(map[uint32]int)
+			for _, row := range locked {
+				ids = append(ids, row.Id)
+				if row.ParentId != nil {
+					parents[*row.ParentId]++
+				}
+			}
+
+			if exception := tx.Where("fk_comment_id IN ?", ids).Delete(&CommentRevision{}).Error; exception != nil {
+				return exception
+			}
+
+			if exception := tx.Where("fk_comment_id IN ?", ids).Delete(&ModerationFlag{}).Error; exception != nil {
+				return exception
+			}
+
+			if exception := tx.Where("fk_comment_id IN ?", ids).Delete(&CommentReaction{}).Error; exception != nil {
+				return exception
+			}
+
+			if exception := tx.Where("fk_comment_id IN ?", ids).Delete(&CommentMention{}).Error; exception != nil {
+				return exception
+			}
+
+			result := tx.Where("c_id IN ?", ids).
+				Where("c_deleted", true).
+				Where("deleted_at < ?", before).
+				Where("c_reply_count", 0).
+				Delete(&Comment{})
+			if result.Error != nil {
+				return result.Error
+			}
+
+			// Only on databases without row locks, the next run tries again
+			if result.RowsAffected != int64(len(ids)) {
+				return ErrVersionConflict
+			}
+
+			// The parents lose these replies, which may make them purgeable in the next batch
+			parentIds := make([]uint32, 0, len(parents))
+			for parentId, count := range parents {
+				exception := tx.Model(&Comment{}).
+					Where("c_id", parentId).
+					UpdateColumn("c_reply_count", gorm.Expr("c_reply_count - ?", count)).
+					Error
+				if exception != nil {
+					return exception
+				}
+				parentIds = append(parentIds, parentId)
+			}
+
+			changed, exception = findCacheOwners(tx, parentIds)
+			return exception
+		})
+		if exception != nil {
+			return purged, exception
+		}
+		InvalidateComments(gormDb, changed)
+
+		purged = append(purged, ids...)
+	}
+}
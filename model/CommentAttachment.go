@@ -0,0 +1,137 @@
+package model
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// CommentAttachment is the metadata of a file attached to a comment, the file itself lives in a blob store
+type CommentAttachment struct {
+	Id          uint32 `gorm:"column:ca_id;primary_key:true" json:"id"`
+	CommentId   uint32 `gorm:"column:fk_comment_id;index" json:"commentId"`
+	Name        string `gorm:"column:ca_name;size:255" json:"name"`
+	Size        int64  `gorm:"column:ca_size" json:"size"`
+	ContentType string `gorm:"column:ca_content_type;size:255" json:"contentType"`
+
+	// SHA-256 of the file, hex encoded
+	Checksum string `gorm:"column:ca_checksum;size:64" json:"checksum"`
+
+	// Where the blob store keeps the file
+	StorageKey string `gorm:"column:ca_storage_key;size:128" json:"-"`
+
+	CreatedAt time.Time `gorm:"column:ca_created_at" json:"createdAt"`
+}
+
+func (attachment *CommentAttachment) TableName() string {
+	return "comment_attachments"
+}
+
+// Find loads an attachment of a comment
+func (attachment *CommentAttachment) Find(gormDb *gorm.DB, commentId uint32, attachmentId uint32) error {
+	return gormDb.Where("fk_comment_id", commentId).
+		First(attachment, attachmentId).
+		Error
+}
+
+// Add attaches more files to a live comment, bumping its attachment count in the same transaction
+func (attachment *CommentAttachment) Add(gormDb *gorm.DB, commentId uint32, attachments []*CommentAttachment) error {
+	if len(attachments) == 0 {
+		return nil
+	}
+
+	var changed []*Comment
+
+	exception := gormDb.Transaction(func(tx *gorm.DB) error {
+		result := tx.Model(&Comment{}).
+			Where("c_id", commentId).
+			Where("c_deleted", false).
+			UpdateColumn("c_attachment_count", gorm.Expr("c_attachment_count + ?", len(attachments)))
+
+		if result.Error != nil {
+			return result.Error
+		}
+
+		if result.RowsAffected == 0 {
+			return gorm.ErrRecordNotFound
+		}
+
+		for _, row := range attachments {
+			row.CommentId = commentId
+		}
+
+		if exception := tx.Create(&attachments).Error; exception != nil {
+			return exception
+		}
+
+		var exception error
+		changed, exception = findCacheOwners(tx, []uint32{commentId})
+		return exception
+	})
+	if exception != nil {
+		return exception
+	}
+
+	// The attachment count went up, a stale one would hide the new files
+	InvalidateComments(gormDb, changed)
+
+	return nil
+}
+
+// LoadAttachments fills in the attachments of the comments, only querying for the ones that have some
+func (attachment *CommentAttachment) LoadAttachments(gormDb *gorm.DB, comments []*Comment) error {
+	byId := make(map[uint32]*Comment)
+	ids := make([]uint32, 0)
+
+	for _, comment := range comments {
+		if comment.AttachmentCount > 0 {
+			byId[comment.Id] = comment
+			ids = append(ids, comment.Id)
+		}
+	}
+
+	if len(ids) == 0 {
+		return nil
+	}
+
+	var attachments []*CommentAttachment
+
+	exception := gormDb.Where("fk_comment_id IN ?", ids).
+		Order("ca_id ASC").
+		Find(&attachments).
+		Error
+	if exception != nil {
+		return exception
+	}
+
+	for _, row := range attachments {
+		comment := byId[row.CommentId]
+		comment.Attachments = append(comment.Attachments, row)
+	}
+
+	return nil
+}
+
+// FindOrphans returns up to limit attachments whose comment was purged, their files still need removing
+func (attachment *CommentAttachment) FindOrphans(gormDb *gorm.DB, limit int) ([]*CommentAttachment, error) {
+	var attachments []*CommentAttachment
+
+	exception := gormDb.Where("fk_comment_id NOT IN (?)", gormDb.Model(&Comment{}).Select("c_id")).
+		Order("ca_id ASC").
+		Limit(limit).
+		Find(&attachments).
+		Error
+
+	return attachments, exception
+}
+
+// DeleteByIds removes attachment rows
+func (attachment *CommentAttachment) DeleteByIds(gormDb *gorm.DB, ids []uint32) error {
+	if len(ids) == 0 {
+		return nil
+	}
+
+	return gormDb.Where("ca_id IN ?", ids).
+		Delete(&CommentAttachment{}).
+		Error
+}
@@ -0,0 +1,148 @@
+package model
+
+import (
+	"sort"
+	"strings"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// InsertBatchSize is how many comments go into a single INSERT statement, older SQLite builds allow 999 variables
+const InsertBatchSize = 50
+
+// FindByIds loads the live comments among the given ids, in no particular order
+func (comment *Comment) FindByIds(gormDb *gorm.DB, ids []uint32) ([]*Comment, error) {
+	var comments []*Comment
+
+	if len(ids) == 0 {
+		return comments, nil
+	}
+
+	exception := gormDb.Model(&Comment{}).
+		Where("c_id IN ?", ids).
+		Where("c_deleted", false).
+		Find(&comments).
+		Error
+
+	return comments, exception
+}
+
+// CreateMany inserts comments, with their moderation flags, in one transaction, InsertBatchSize rows per statement.
+// Parents of replies get their reply count bumped in a single UPDATE, and have to be live and published.
+func (comment *Comment) CreateMany(gormDb *gorm.DB, comments []*Comment) error {
+	replies := make(map[uint32]int)
+	for _, row := range comments {
+		if row.ParentId != nil {
+			replies[*row.ParentId]++
+		}
+	}
+
+	var created, parents []*Comment
+
+	exception := gormDb.Transaction(func(tx *gorm.DB) error {
+		if len(replies) > 0 {
+			parentIds := make([]uint32, 0, len(replies))
+			for parentId := range replies {
+				parentIds = append(parentIds, parentId)
+			}
+
+			// Sorted so the same parents always give the same statement
+			sort.Slice(parentIds, func(i, j int) bool { return parentIds[i] < parentIds[j] })
+
+			increment := strings.Builder{}
+			arguments := make([]interface{}, 0, 2*len(parentIds))
+
+			increment.WriteString("c_reply_count + CASE c_id")
+			for _, parentId := range parentIds {
+				increment.WriteString(" WHEN ? THEN ?")
+				arguments = append(arguments, parentId, replies[parentId])
+			}
+			increment.WriteString(" ELSE 0 END")
+
+			result := tx.Model(&Comment{}).
+				Where("c_id IN ?", parentIds).
+				Where("c_deleted", false).
+				Where("c_status", StatusPublished).
+				UpdateColumn("c_reply_count", gorm.Expr(increment.String(), arguments...))
+
+			if result.Error != nil {
+				return result.Error
+			}
+
+			// A parent went away since it was checked
+			if result.RowsAffected != int64(len(parentIds)) {
+				return gorm.ErrRecordNotFound
+			}
+
+			var exception error
+			if parents, exception = findCacheOwners(tx, parentIds); exception != nil {
+				return exception
+			}
+		}
+
+		// Chunked by hand, CreateInBatches would open a nested transaction
+		for start := 0; start < len(comments); start += InsertBatchSize {
+			end := start + InsertBatchSize
+			if end > len(comments) {
+				end = len(comments)
+			}
+
+			if exception := tx.Create(comments[start:end]).Error; exception != nil {
+				return exception
+			}
+		}
+
+		ids := make([]uint32, 0, len(comments))
+		for _, row := range comments {
+			ids = append(ids, row.Id)
+		}
+
+		var exception error
+		created, exception = recordCommentEvents(tx, EventCommentCreated, ids)
+		return exception
+	})
+	if exception != nil {
+		return exception
+	}
+
+	// The parents' reply counts went up along with the listings of the authors
+	InvalidateComments(gormDb, append(created, parents...))
+
+	return nil
+}
+
+// DeleteMany soft-deletes the live comments among the given ids in a single UPDATE, returning them as they are after
+// the delete. It locks them first and writes events only for those, so it should run in a transaction, after which
+// the caller invalidates the cached lookups of the returned comments.
+func (comment *Comment) DeleteMany(gormDb *gorm.DB, ids []uint32) ([]*Comment, error) {
+	if len(ids) == 0 {
+		return nil, nil
+	}
+
+	// Comments someone else deleted in the meantime already had their event
+	var live []uint32
+	exception := gormDb.Model(&Comment{}).
+		Clauses(clause.Locking{Strength: "UPDATE"}).
+		Where("c_id IN ?", ids).
+		Where("c_deleted", false).
+		Pluck("c_id", &live).
+		Error
+	if exception != nil || len(live) == 0 {
+		return nil, exception
+	}
+
+	result := gormDb.Model(&Comment{}).
+		Where("c_id IN ?", live).
+		Where("c_deleted", false).
+		Updates(map[string]interface{}{
+			"c_deleted":  true,
+			"deleted_at": gormDb.NowFunc(),
+			"c_version":  gorm.Expr("c_version + ?", 1),
+		})
+	if result.Error != nil {
+		return nil, result.Error
+	}
+
+	return recordCommentEvents(gormDb, EventCommentDeleted, live)
+}
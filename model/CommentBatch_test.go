@@ -0,0 +1,97 @@
+package model
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gorm.io/gorm"
+)
+
+func TestComment_CreateMany(t *testing.T) {
+	gormDb := openTestDb(t)
+
+	first := &Comment{Body: "first parent", UserId: 1}
+	second := &Comment{Body: "second parent", UserId: 1}
+	require.NoError(t, gormDb.Create(first).Error)
+	require.NoError(t, gormDb.Create(second).Error)
+
+	// More than one INSERT worth of comments
+	var comments []*Comment
+	replies := map[uint32]uint32{}
+	for i := 0; i < InsertBatchSize+20; i++ {
+		comment := &Comment{Body: "imported", UserId: 2}
+		switch i % 3 {
+		case 1:
+			comment.ParentId = &first.Id
+		case 2:
+			comment.ParentId = &second.Id
+		}
+		if comment.ParentId != nil {
+			replies[*comment.ParentId]++
+		}
+		comments = append(comments, comment)
+	}
+	comments[0].Status = StatusPending
+	comments[0].Flags = []*ModerationFlag{{Filter: "links", Reason: "a link"}}
+
+	var comment Comment
+	require.NoError(t, comment.CreateMany(gormDb, comments))
+
+	for _, created := range comments {
+		assert.NotZero(t, created.Id)
+	}
+
+	var count int64
+	require.NoError(t, gormDb.Model(&Comment{}).Where("fk_user_id", 2).Count(&count).Error)
+	assert.Equal(t, int64(InsertBatchSize+20), count)
+
+	require.NoError(t, first.FindById(gormDb, first.Id))
+	require.NoError(t, second.FindById(gormDb, second.Id))
+	assert.Equal(t, replies[first.Id], first.ReplyCount)
+	assert.Equal(t, replies[second.Id], second.ReplyCount)
+
+	require.NoError(t, gormDb.Model(&ModerationFlag{}).Where("fk_comment_id", comments[0].Id).Count(&count).Error)
+	assert.Equal(t, int64(1), count)
+
+	// A parent that's gone fails the whole batch
+	require.NoError(t, second.Delete(gormDb, second.Id, 0))
+	orphan := []*Comment{{Body: "fine", UserId: 3}, {Body: "orphan", UserId: 3, ParentId: &second.Id}}
+	assert.ErrorIs(t, comment.CreateMany(gormDb, orphan), gorm.ErrRecordNotFound)
+
+	require.NoError(t, gormDb.Model(&Comment{}).Where("fk_user_id", 3).Count(&count).Error)
+	assert.Zero(t, count)
+}
+
+func TestComment_DeleteMany(t *testing.T) {
+	gormDb := openTestDb(t)
+
+	var ids []uint32
+	for i := 0; i < 3; i++ {
+		comment := &Comment{Body: "comment", UserId: 1}
+		require.NoError(t, gormDb.Create(comment).Error)
+		ids = append(ids, comment.Id)
+	}
+
+	var comment Comment
+
+	found, exception := comment.FindByIds(gormDb, append(ids, 99))
+	require.NoError(t, exception)
+	assert.Len(t, found, 3)
+
+	require.NoError(t, comment.Delete(gormDb, ids[0], 0))
+
+	deleted, exception := comment.DeleteMany(gormDb, ids)
+	require.NoError(t, exception)
+	assert.Equal(t, ids[1:], commentIds(deleted))
+	assert.True(t, deleted[0].Deleted)
+
+	// The comment deleted before only has the event of that delete
+	var events int64
+	require.NoError(t, gormDb.Model(&OutboxEvent{}).Where("fk_comment_id", ids[0]).Count(&events).Error)
+	assert.Equal(t, int64(1), events)
+
+	found, exception = comment.FindByIds(gormDb, ids)
+	require.NoError(t, exception)
+	assert.Empty(t, found)
+}
@@ -0,0 +1,262 @@
+package model
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// How the comments of a user are erased
+const (
+	// The comments stay as placeholders in their threads, without body, attachments or author
+	ErasureAnonymise = "anonymise"
+
+	// The comments are removed for good, those with replies are anonymised to keep the threads together
+	ErasureDelete = "delete"
+)
+
+// An erasure is running until all the comments of the user are done, or failed half way
+const (
+	ErasureRunning   = "running"
+	ErasureCompleted = "completed"
+	ErasureFailed    = "failed"
+)
+
+// CommentErasure is the audit entry of an erasure request, kept after the comments are gone.
+// It holds ids and counts only, nothing the user wrote.
+type CommentErasure struct {
+	Id          uint32 `gorm:"column:ce_id;primary_key:true" json:"id"`
+	UserId      uint32 `gorm:"column:fk_user_id;index" json:"userId"`
+	RequestedBy uint32 `gorm:"column:fk_requested_by" json:"requestedBy"`
+	Mode        string `gorm:"column:ce_mode;size:16;not null" json:"mode"`
+	Status      string `gorm:"column:ce_status;size:16;not null" json:"status"`
+
+	// How many comments were anonymised and deleted, so far if the erasure failed
+	Anonymised int64 `gorm:"column:ce_anonymised;not null;default:0" json:"anonymised"`
+	Deleted    int64 `gorm:"column:ce_deleted;not null;default:0" json:"deleted"`
+
+	// Why it failed, a new request picks up what is left
+	Error string `gorm:"column:ce_error" json:"error,omitempty"`
+
+	CreatedAt   time.Time  `gorm:"column:ce_created_at" json:"createdAt"`
+	CompletedAt *time.Time `gorm:"column:ce_completed_at" json:"completedAt"`
+}
+
+func (erasure *CommentErasure) TableName() string {
+	return "comment_erasures"
+}
+
+// Start records the request before any comment is touched, so there is an entry even if it never finishes
+func (erasure *CommentErasure) Start(gormDb *gorm.DB) error {
+	erasure.Status = ErasureRunning
+	erasure.CreatedAt = gormDb.NowFunc()
+	return gormDb.Create(erasure).Error
+}
+
+// Finish records the outcome of the request along with the counts
+func (erasure *CommentErasure) Finish(gormDb *gorm.DB, failure error) error {
+	now := gormDb.NowFunc()
+	erasure.CompletedAt = &now
+	erasure.Status = ErasureCompleted
+	if failure != nil {
+		erasure.Status = ErasureFailed
+		erasure.Error = failure.Error()
+	}
+
+	return gormDb.Model(erasure).
+		Select("ce_status", "ce_anonymised", "ce_deleted", "ce_error", "ce_completed_at").
+		Updates(erasure).
+		Error
+}
+
+// WalkByUserId hands all the comments of a user, soft-deleted ones included, to visit batchSize at a time in
+// the order they were written, so they never all sit in memory
+func (comment *Comment) WalkByUserId(gormDb *gorm.DB, userId uint32, batchSize int, visit func(batch []*Comment) error) error {
+	var lastId uint32
+
+	for {
+		var comments []*Comment
+
+		exception := gormDb.Model(&Comment{}).
+			Where("fk_user_id", userId).
+			Where("c_id > ?", lastId).
+			Order("c_id").
+			Limit(batchSize).
+			Find(&comments).
+			Error
+		if exception != nil {
+			return exception
+		}
+
+		if len(comments) == 0 {
+			return nil
+		}
+
+		if exception := visit(comments); exception != nil {
+			return exception
+		}
+
+		lastId = comments[len(comments)-1].Id
+	}
+}
+
+// WalkByUserId hands all the reactions of a user, to any comment, to visit batchSize at a time in the order they
+// were added
+func (reaction *CommentReaction) WalkByUserId(gormDb *gorm.DB, userId uint32, batchSize int, visit func(batch []*CommentReaction) error) error {
+	var lastId uint32
+
+	for {
+		var reactions []*CommentReaction
+
+		exception := gormDb.Model(&CommentReaction{}).
+			Where("fk_user_id", userId).
+			Where("rc_id > ?", lastId).
+			Order("rc_id").
+			Limit(batchSize).
+			Find(&reactions).
+			Error
+		if exception != nil {
+			return exception
+		}
+
+		if len(reactions) == 0 {
+			return nil
+		}
+
+		if exception := visit(reactions); exception != nil {
+			return exception
+		}
+
+		lastId = reactions[len(reactions)-1].Id
+	}
+}
+
+// FindForErasure returns up to limit comments of a user that are still to be erased, soft-deleted ones included,
+// with their attachments loaded so their files can be removed first
+func (comment *Comment) FindForErasure(gormDb *gorm.DB, userId uint32, limit int) ([]*Comment, error) {
+	var comments []*Comment
+
+	exception := gormDb.Model(&Comment{}).
+		Where("fk_user_id", userId).
+		Order("c_id").
+		Limit(limit).
+		Find(&comments).
+		Error
+	if exception != nil {
+		return nil, exception
+	}
+
+	var attachment CommentAttachment
+
+	return comments, attachment.LoadAttachments(gormDb, comments)
+}
+
+// Erase anonymises or deletes a batch of comments of a user from FindForErasure in one transaction, with their
+// revisions, flags, mentions, attachment rows and outbox events, returning how many it anonymised and deleted. Either
+// way the comments no longer belong to the user, so the next batch picks up where this one ended. The reactions of
+// the user go along with the first batch, an empty one only takes those.
+func (comment *Comment) Erase(gormDb *gorm.DB, userId uint32, comments []*Comment, mode string) (int64, int64, error) {
+	var anonymise, remove []uint32
+	parents := make(map[uint32]int)
+
+	for _, row := range comments {
+		// Replies keep their parent, deleted or not
+		if mode == ErasureAnonymise || row.ReplyCount > 0 {
+			anonymise = append(anonymise, row.Id)
+			continue
+		}
+
+		remove = append(remove, row.Id)
+		if row.ParentId != nil {
+			parents[*row.ParentId]++
+		}
+	}
+	ids := append(append([]uint32{}, anonymise...), remove...)
+
+	var anonymised, deleted int64
+	var owners []*Comment
+
+	exception := gormDb.Transaction(func(tx *gorm.DB) error {
+		if exception := eraseReactions(tx, userId); exception != nil {
+			return exception
+		}
+
+		if len(ids) == 0 {
+			return nil
+		}
+
+		// The events hold the comments as they were, body included, delivered or not they go
+		for _, related := range []interface{}{&CommentRevision{}, &ModerationFlag{}, &CommentMention{}, &CommentAttachment{}, &OutboxEvent{}} {
+			if exception := tx.Where("fk_comment_id IN ?", ids).Delete(related).Error; exception != nil {
+				return exception
+			}
+		}
+
+		if len(anonymise) > 0 {
+			now := tx.NowFunc()
+
+			result := tx.Model(&Comment{}).
+				Where("c_id IN ?", anonymise).
+				Updates(map[string]interface{}{
+					"c_body":             "",
+					"c_body_html":        "",
+					"fk_user_id":         0,
+					"c_attachment_count": 0,
+					"c_deleted":          true,
+					"deleted_at":         gorm.Expr("COALESCE(deleted_at, ?)", now),
+					"c_version":          gorm.Expr("c_version + ?", 1),
+				})
+			if result.Error != nil {
+				return result.Error
+			}
+			anonymised = result.RowsAffected
+		}
+
+		if len(remove) > 0 {
+			if exception := tx.Where("fk_comment_id IN ?", remove).Delete(&CommentReaction{}).Error; exception != nil {
+				return exception
+			}
+
+			result := tx.Where("c_id IN ?", remove).Delete(&Comment{})
+			if result.Error != nil {
+				return result.Error
+			}
+			deleted = result.RowsAffected
+
+			// The parents lose these replies, as they do in the purge
+			parentIds := make([]uint32, 0, len(parents))
+			for parentId, count := range parents {
+				exception := tx.Model(&Comment{}).
+					Where("c_id", parentId).
+					UpdateColumn("c_reply_count", gorm.Expr("c_reply_count - ?", count)).
+					Error
+				if exception != nil {
+					return exception
+				}
+				parentIds = append(parentIds, parentId)
+			}
+
+			var exception error
+			owners, exception = findCacheOwners(tx, parentIds)
+			return exception
+		}
+
+		return nil
+	})
+	if exception != nil {
+		return 0, 0, exception
+	}
+
+	InvalidateComments(gormDb, append(comments, owners...))
+
+	return anonymised, deleted, nil
+}
+
+// eraseReactions removes the reactions of a user to any comment, and the outbox events about them, which name the user
+func eraseReactions(tx *gorm.DB, userId uint32) error {
+	if exception := tx.Where("fk_reactor_id", userId).Delete(&OutboxEvent{}).Error; exception != nil {
+		return exception
+	}
+
+	return tx.Where("fk_user_id", userId).Delete(&CommentReaction{}).Error
+}
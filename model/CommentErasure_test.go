@@ -0,0 +1,134 @@
+package model
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gorm.io/gorm"
+)
+
+func TestComment_WalkByUserId(t *testing.T) {
+	gormDb := openTestDb(t)
+
+	for i := 0; i < 5; i++ {
+		require.NoError(t, gormDb.Create(&Comment{Body: "comment", UserId: 1}).Error)
+	}
+	require.NoError(t, gormDb.Create(&Comment{Body: "someone else", UserId: 2}).Error)
+
+	var comment Comment
+	require.NoError(t, comment.Delete(gormDb, 2, 0))
+
+	// Deleted ones included
+	var batches [][]uint32
+	exception := comment.WalkByUserId(gormDb, 1, 2, func(batch []*Comment) error {
+		batches = append(batches, commentIds(batch))
+		return nil
+	})
+	require.NoError(t, exception)
+	assert.Equal(t, [][]uint32{{1, 2}, {3, 4}, {5}}, batches)
+}
+
+func TestComment_Erase(t *testing.T) {
+	for _, mode := range []string{ErasureAnonymise, ErasureDelete} {
+		t.Run(mode, func(t *testing.T) {
+			gormDb := openTestDb(t)
+
+			// Someone else replies to the first comment, which the user replies to in turn
+			first := &Comment{Body: "first", UserId: 1}
+			require.NoError(t, gormDb.Create(first).Error)
+			other := &Comment{Body: "other", UserId: 2, ParentId: &first.Id}
+			require.NoError(t, gormDb.Create(other).Error)
+			own := &Comment{Body: "own reply", UserId: 1, ParentId: &first.Id}
+			require.NoError(t, gormDb.Create(own).Error)
+			require.NoError(t, gormDb.Model(first).UpdateColumn("c_reply_count", 2).Error)
+
+			require.NoError(t, first.UpdateBody(gormDb, first.Id, "edited @alice", 1, 0, nil))
+			require.NoError(t, gormDb.Create(&CommentAttachment{CommentId: own.Id, StorageKey: "key"}).Error)
+			require.NoError(t, gormDb.Model(own).UpdateColumn("c_attachment_count", 1).Error)
+
+			// The user reacts to the reply of someone else, who reacts as well
+			var like, heart CommentReaction
+			_, exception := like.Toggle(gormDb, other.Id, 1, "like")
+			require.NoError(t, exception)
+			_, exception = heart.Toggle(gormDb, other.Id, 2, "heart")
+			require.NoError(t, exception)
+
+			var comment Comment
+			batch, exception := comment.FindForErasure(gormDb, 1, 10)
+			require.NoError(t, exception)
+			require.Equal(t, []uint32{first.Id, own.Id}, commentIds(batch))
+			require.Len(t, batch[1].Attachments, 1)
+
+			anonymised, deleted, exception := comment.Erase(gormDb, 1, batch, mode)
+			require.NoError(t, exception)
+
+			var left []*Comment
+			require.NoError(t, gormDb.Order("c_id").Find(&left).Error)
+
+			// The first comment has a reply of someone else, it stays as a placeholder either way
+			assert.Equal(t, "", left[0].Body)
+			assert.Equal(t, uint32(0), left[0].UserId)
+			assert.True(t, left[0].Deleted)
+			assert.NotNil(t, left[0].DeletedAt)
+			assert.Equal(t, "other", left[1].Body)
+
+			if mode == ErasureDelete {
+				assert.Equal(t, int64(1), anonymised)
+				assert.Equal(t, int64(1), deleted)
+				assert.Equal(t, []uint32{first.Id, other.Id}, commentIds(left))
+				assert.Equal(t, uint32(1), left[0].ReplyCount)
+			} else {
+				assert.Equal(t, int64(2), anonymised)
+				assert.Equal(t, int64(0), deleted)
+				assert.Equal(t, []uint32{first.Id, other.Id, own.Id}, commentIds(left))
+				assert.Equal(t, "", left[2].Body)
+				assert.Equal(t, uint32(0), left[2].AttachmentCount)
+			}
+
+			for _, related := range []interface{}{&CommentRevision{}, &CommentMention{}, &CommentAttachment{}} {
+				var count int64
+				require.NoError(t, gormDb.Model(related).Count(&count).Error)
+				assert.Equal(t, int64(0), count)
+			}
+
+			// Only the reaction of the other user is left, the events name no one else either
+			var reactions []*CommentReaction
+			require.NoError(t, gormDb.Find(&reactions).Error)
+			require.Len(t, reactions, 1)
+			assert.Equal(t, uint32(2), reactions[0].UserId)
+
+			var events []*OutboxEvent
+			require.NoError(t, gormDb.Find(&events).Error)
+			require.Len(t, events, 1)
+			assert.Equal(t, EventReactionAdded, events[0].Type)
+			assert.Equal(t, uint32(2), events[0].ReactorId)
+
+			// Nothing left to erase
+			batch, exception = comment.FindForErasure(gormDb, 1, 10)
+			require.NoError(t, exception)
+			assert.Empty(t, batch)
+		})
+	}
+}
+
+func TestCommentErasure_Audit(t *testing.T) {
+	gormDb := openTestDb(t)
+
+	erasure := &CommentErasure{UserId: 1, RequestedBy: 9, Mode: ErasureDelete}
+	require.NoError(t, erasure.Start(gormDb))
+
+	var stored CommentErasure
+	require.NoError(t, gormDb.First(&stored, erasure.Id).Error)
+	assert.Equal(t, ErasureRunning, stored.Status)
+	assert.Nil(t, stored.CompletedAt)
+
+	erasure.Deleted = 3
+	require.NoError(t, erasure.Finish(gormDb, gorm.ErrInvalidTransaction))
+
+	require.NoError(t, gormDb.First(&stored, erasure.Id).Error)
+	assert.Equal(t, ErasureFailed, stored.Status)
+	assert.Equal(t, int64(3), stored.Deleted)
+	assert.Equal(t, gorm.ErrInvalidTransaction.Error(), stored.Error)
+	assert.NotNil(t, stored.CompletedAt)
+}
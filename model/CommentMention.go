@@ -0,0 +1,86 @@
+package model
+
+import (
+	"strings"
+	"time"
+
+	"two-in-one/mention"
+
+	"gorm.io/gorm"
+)
+
+// CommentMention is a user mentioned in the body of a comment, either by id or by username.
+// Usernames are kept as written, lowercased, as we have no users table to resolve them against.
+type CommentMention struct {
+	Id        uint32    `gorm:"column:mn_id;primary_key:true" json:"id"`
+	CommentId uint32    `gorm:"column:fk_comment_id;index" json:"commentId"`
+	UserId    *uint32   `gorm:"column:fk_user_id;index" json:"userId"`
+	Username  *string   `gorm:"column:mn_username;size:64;index" json:"username"`
+	CreatedAt time.Time `gorm:"column:mn_created_at" json:"createdAt"`
+}
+
+func (mention *CommentMention) TableName() string {
+	return "comment_mentions"
+}
+
+// AfterCreate stores the mentions of a new comment in the same transaction
+func (comment *Comment) AfterCreate(tx *gorm.DB) error {
+	return createMentions(tx, comment.Id, comment.Body)
+}
+
+// syncMentions replaces the mentions of a comment with the ones in its new body,
+// edits of bodies that never mentioned anyone don't touch the table
+func syncMentions(tx *gorm.DB, commentId uint32, previousBody string, body string) error {
+	if mention.Parse(previousBody).IsEmpty() && mention.Parse(body).IsEmpty() {
+		return nil
+	}
+
+	if exception := tx.Where("fk_comment_id", commentId).Delete(&CommentMention{}).Error; exception != nil {
+		return exception
+	}
+
+	return createMentions(tx, commentId, body)
+}
+
+func createMentions(tx *gorm.DB, commentId uint32, body string) error {
+	parsed := mention.Parse(body)
+
+	mentions := make([]*CommentMention, 0, len(parsed.UserIds)+len(parsed.Usernames))
+	for i := range parsed.UserIds {
+		mentions = append(mentions, &CommentMention{CommentId: commentId, UserId: &parsed.UserIds[i]})
+	}
+	for i := range parsed.Usernames {
+		mentions = append(mentions, &CommentMention{CommentId: commentId, Username: &parsed.Usernames[i]})
+	}
+
+	if len(mentions) == 0 {
+		return nil
+	}
+
+	return tx.Create(&mentions).Error
+}
+
+// GetMentioning returns one keyset page of the live, published comments mentioning a user,
+// by id or, when username isn't empty, by username
+func (comment *Comment) GetMentioning(gormDb *gorm.DB, userId uint32, username string, query ListQuery) ([]*Comment, *Page, error) {
+	mentions := gormDb.Model(&CommentMention{}).Select("fk_comment_id")
+	if username != "" {
+		mentions = mentions.Where("mn_username", strings.ToLower(username))
+	} else {
+		mentions = mentions.Where("fk_user_id", userId)
+	}
+
+	tx := gormDb.Model(&comment).
+		Where("c_id IN (?)", mentions).
+		Where("c_deleted", false).
+		Where("c_status", StatusPublished)
+
+	if query.Since != nil {
+		tx = tx.Where("created_at >= ?", *query.Since)
+	}
+	if query.Until != nil {
+		tx = tx.Where("created_at <= ?", *query.Until)
+	}
+
+	return paginate(tx, query.PageQuery)
+}
@@ -0,0 +1,59 @@
+package model
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestComment_GetMentioning(t *testing.T) {
+	gormDb := openTestDb(t)
+
+	var comment Comment
+
+	first := &Comment{Body: "hey @<7> and @Alice", UserId: 1}
+	second := &Comment{Body: "@7 again", UserId: 2}
+	held := &Comment{Body: "@7 pending", UserId: 3, Status: StatusPending}
+	other := &Comment{Body: "@bob only", UserId: 1}
+	require.NoError(t, comment.CreateMany(gormDb, []*Comment{first, second, held, other}))
+
+	ids := func(comments []*Comment) []uint32 {
+		var ids []uint32
+		for _, comment := range comments {
+			ids = append(ids, comment.Id)
+		}
+		return ids
+	}
+
+	comments, page, exception := comment.GetMentioning(gormDb, 7, "", ListQuery{PageQuery: PageQuery{Limit: 1, IncludeTotal: true}})
+	require.NoError(t, exception)
+	assert.Equal(t, []uint32{first.Id}, ids(comments))
+	assert.Equal(t, int64(2), *page.Total)
+
+	comments, _, exception = comment.GetMentioning(gormDb, 0, "ALICE", ListQuery{})
+	require.NoError(t, exception)
+	assert.Equal(t, []uint32{first.Id}, ids(comments))
+
+	// Edits keep the mentions in sync
+	require.NoError(t, comment.UpdateBody(gormDb, first.Id, "now @bob", 1, 0, nil))
+
+	comments, _, exception = comment.GetMentioning(gormDb, 7, "", ListQuery{})
+	require.NoError(t, exception)
+	assert.Equal(t, []uint32{second.Id}, ids(comments))
+
+	comments, _, exception = comment.GetMentioning(gormDb, 0, "bob", ListQuery{})
+	require.NoError(t, exception)
+	assert.Equal(t, []uint32{first.Id, other.Id}, ids(comments))
+
+	var count int64
+	gormDb.Model(&CommentMention{}).Where("fk_comment_id", first.Id).Count(&count)
+	assert.Equal(t, int64(1), count)
+
+	// Deleted comments drop out of the feed
+	require.NoError(t, comment.Delete(gormDb, second.Id, 0))
+
+	comments, _, exception = comment.GetMentioning(gormDb, 7, "", ListQuery{})
+	require.NoError(t, exception)
+	assert.Empty(t, comments)
+}
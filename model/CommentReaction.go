@@ -0,0 +1,121 @@
+package model
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// The reactions a comment can get, entity.ReactionInput validates against the same list
+const (
+	ReactionLike     = "like"
+	ReactionDislike  = "dislike"
+	ReactionLaugh    = "laugh"
+	ReactionHeart    = "heart"
+	ReactionSurprise = "surprise"
+	ReactionSad      = "sad"
+)
+
+// CommentReaction is one reaction of a user to a comment, a user has at most one of each type per comment
+type CommentReaction struct {
+	Id        uint32    `gorm:"column:rc_id;primary_key:true" json:"id"`
+	CommentId uint32    `gorm:"column:fk_comment_id;uniqueIndex:idx_comment_reaction" json:"commentId"`
+	UserId    uint32    `gorm:"column:fk_user_id;uniqueIndex:idx_comment_reaction" json:"userId"`
+	Type      string    `gorm:"column:rc_type;size:16;uniqueIndex:idx_comment_reaction" json:"type"`
+	CreatedAt time.Time `gorm:"column:rc_created_at" json:"createdAt"`
+}
+
+func (reaction *CommentReaction) TableName() string {
+	return "comment_reactions"
+}
+
+// reactionCount is one row of the per comment and type aggregate
+type reactionCount struct {
+	CommentId uint32 `gorm:"column:fk_comment_id"`
+	Type      string `gorm:"column:rc_type"`
+	Count     int64  `gorm:"column:rc_count"`
+
+	// How many of them are the viewer's, 0 or 1
+	Mine int64 `gorm:"column:rc_mine"`
+}
+
+// Toggle adds the reaction of a user to a comment, or takes it back if they already had it
+func (reaction *CommentReaction) Toggle(gormDb *gorm.DB, commentId uint32, userId uint32, reactionType string) (bool, error) {
+	added := false
+
+	exception := gormDb.Transaction(func(tx *gorm.DB) error {
+		result := tx.Where("fk_comment_id", commentId).
+			Where("fk_user_id", userId).
+			Where("rc_type", reactionType).
+			Delete(&CommentReaction{})
+
+		if result.Error != nil {
+			return result.Error
+		}
+
+		reaction.CommentId = commentId
+		reaction.UserId = userId
+		reaction.Type = reactionType
+
+		// Taken back
+		if result.RowsAffected > 0 {
+			return recordReactionEvent(tx, EventReactionRemoved, reaction)
+		}
+
+		// Nothing to take back, so this is a new reaction
+		added = true
+
+		// Unless the same add got in first, which already wrote the event
+		result = tx.Clauses(clause.OnConflict{DoNothing: true}).Create(reaction)
+		if result.Error != nil || result.RowsAffected == 0 {
+			return result.Error
+		}
+
+		return recordReactionEvent(tx, EventReactionAdded, reaction)
+	})
+
+	return added, exception
+}
+
+// LoadReactions fills in the reaction counts of the comments and which of them are the viewer's, in a single query.
+// viewerId 0 is an anonymous viewer.
+func (reaction *CommentReaction) LoadReactions(gormDb *gorm.DB, comments []*Comment, viewerId uint32) error {
+	if len(comments) == 0 {
+		return nil
+	}
+
+	byId := make(map[uint32]*Comment, len(comments))
+	ids := make([]uint32, 0, len(comments))
+	for _, comment := range comments {
+		comment.Reactions = map[string]int64{}
+		comment.MyReactions = []string{}
+		byId[comment.Id] = comment
+		ids = append(ids, comment.Id)
+	}
+
+	var counts []*reactionCount
+	exception := gormDb.Model(&CommentReaction{}).
+		Select("fk_comment_id, rc_type, COUNT(*) AS rc_count, SUM(CASE WHEN fk_user_id = ? THEN 1 ELSE 0 END) AS rc_mine", viewerId).
+		Where("fk_comment_id IN ?", ids).
+		Group("fk_comment_id, rc_type").
+		Find(&counts).
+		Error
+	if exception != nil {
+		return exception
+	}
+
+	for _, count := range counts {
+		comment, isLoaded := byId[count.CommentId]
+		if !isLoaded {
+			continue
+		}
+
+		comment.Reactions[count.Type] = count.Count
+		if viewerId != 0 && count.Mine > 0 {
+			comment.MyReactions = append(comment.MyReactions, count.Type)
+		}
+	}
+
+	return nil
+}
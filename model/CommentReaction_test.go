@@ -0,0 +1,75 @@
+package model
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gorm.io/gorm"
+)
+
+func TestCommentReaction_Toggle(t *testing.T) {
+	gormDb := openTestDb(t)
+
+	first := &Comment{Body: "first", UserId: 1}
+	second := &Comment{Body: "second", UserId: 1}
+	require.NoError(t, gormDb.Create(first).Error)
+	require.NoError(t, gormDb.Create(second).Error)
+
+	toggle := func(commentId uint32, userId uint32, reactionType string) bool {
+		var reaction CommentReaction
+		added, exception := reaction.Toggle(gormDb, commentId, userId, reactionType)
+		require.NoError(t, exception)
+		return added
+	}
+
+	assert.True(t, toggle(first.Id, 1, ReactionLike))
+	assert.True(t, toggle(first.Id, 2, ReactionLike))
+	assert.True(t, toggle(first.Id, 2, ReactionHeart))
+	assert.True(t, toggle(second.Id, 3, ReactionSad))
+
+	// Same type again takes it back
+	assert.True(t, toggle(first.Id, 3, ReactionDislike))
+	assert.False(t, toggle(first.Id, 3, ReactionDislike))
+
+	var reaction CommentReaction
+
+	comments := []*Comment{first, second}
+	require.NoError(t, reaction.LoadReactions(gormDb, comments, 2))
+	assert.Equal(t, map[string]int64{ReactionLike: 2, ReactionHeart: 1}, first.Reactions)
+	assert.ElementsMatch(t, []string{ReactionLike, ReactionHeart}, first.MyReactions)
+	assert.Equal(t, map[string]int64{ReactionSad: 1}, second.Reactions)
+	assert.Empty(t, second.MyReactions)
+
+	// Anonymous viewers have no reactions of their own
+	require.NoError(t, reaction.LoadReactions(gormDb, comments, 0))
+	assert.Empty(t, first.MyReactions)
+	assert.Equal(t, int64(2), first.Reactions[ReactionLike])
+}
+
+func TestCommentReaction_Toggle_ConcurrentAdd(t *testing.T) {
+	gormDb := openTestDb(t)
+
+	comment := &Comment{Body: "comment", UserId: 1}
+	require.NoError(t, gormDb.Create(comment).Error)
+
+	// The same add from another request lands between the delete and the insert
+	added := false
+	require.NoError(t, gormDb.Callback().Create().Before("gorm:create").Register("test:add", func(tx *gorm.DB) {
+		if !added && tx.Statement.Table == "comment_reactions" {
+			added = true
+			require.NoError(t, tx.Session(&gorm.Session{NewDB: true}).Exec(
+				"INSERT INTO comment_reactions (fk_comment_id, fk_user_id, rc_type) VALUES (?, ?, ?)", comment.Id, 2, ReactionLike,
+			).Error)
+		}
+	}))
+
+	var reaction CommentReaction
+	isAdded, exception := reaction.Toggle(gormDb, comment.Id, 2, ReactionLike)
+	require.NoError(t, exception)
+	assert.True(t, isAdded)
+
+	var count int64
+	require.NoError(t, gormDb.Model(&CommentReaction{}).Count(&count).Error)
+	assert.Equal(t, int64(1), count)
+}
@@ -0,0 +1,78 @@
+package model
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// CommentRevision is the body a comment had before an edit, with who edited it and when
+type CommentRevision struct {
+	Id        uint32    `gorm:"column:cr_id;primary_key:true" json:"id"`
+	CommentId uint32    `gorm:"column:fk_comment_id;uniqueIndex:idx_comment_revision" json:"commentId"`
+	Revision  uint32    `gorm:"column:cr_revision;uniqueIndex:idx_comment_revision" json:"revision"`
+	Body      string    `gorm:"column:cr_body" json:"body"`
+	EditorId  uint32    `gorm:"column:fk_editor_id" json:"editorId"`
+	CreatedAt time.Time `gorm:"column:cr_created_at" json:"createdAt"`
+}
+
+func (revision *CommentRevision) TableName() string {
+	return "comment_revisions"
+}
+
+// GetByCommentId lists the revisions of a comment, newest first
+func (revision *CommentRevision) GetByCommentId(gormDb *gorm.DB, commentId uint32) ([]*CommentRevision, error) {
+	var revisions []*CommentRevision
+	exception := gormDb.Model(&revision).
+		Where("fk_comment_id", commentId).
+		Order("cr_revision DESC").
+		Find(&revisions).Error
+
+	return revisions, exception
+}
+
+// GetByCommentIds lists the revisions of several comments, by comment and oldest first
+func (revision *CommentRevision) GetByCommentIds(gormDb *gorm.DB, commentIds []uint32) ([]*CommentRevision, error) {
+	var revisions []*CommentRevision
+	if len(commentIds) == 0 {
+		return revisions, nil
+	}
+
+	exception := gormDb.Model(&revision).
+		Where("fk_comment_id IN ?", commentIds).
+		Order("fk_comment_id").
+		Order("cr_revision").
+		Find(&revisions).Error
+
+	return revisions, exception
+}
+
+// FindByRevision loads a single revision of a comment
+func (revision *CommentRevision) FindByRevision(gormDb *gorm.DB, commentId uint32, number uint32) error {
+	return gormDb.Model(&revision).
+		Where("fk_comment_id", commentId).
+		Where("cr_revision", number).
+		First(&revision).
+		Error
+}
+
+// record stores the current body of a comment as its next revision
+func (revision *CommentRevision) record(gormDb *gorm.DB, comment *Comment, editorId uint32) error {
+	var latest CommentRevision
+	exception := gormDb.Model(&latest).
+		Where("fk_comment_id", comment.Id).
+		Order("cr_revision DESC").
+		Limit(1).
+		Find(&latest).
+		Error
+	if exception != nil {
+		return exception
+	}
+
+	revision.CommentId = comment.Id
+	revision.Revision = latest.Revision + 1
+	revision.Body = comment.Body
+	revision.EditorId = editorId
+
+	return gormDb.Create(revision).Error
+}
@@ -0,0 +1,212 @@
+package model
+
+import (
+	"errors"
+	"html"
+	"strings"
+	"unicode"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+const (
+	searchTable = "comments_fts"
+
+	// Characters of context kept around the first match of a snippet
+	snippetRadius = 60
+)
+
+// ErrSearchUnavailable is returned when the database has no full-text index to search
+var ErrSearchUnavailable = errors.New("full-text search is unavailable")
+
+// SearchResult is a comment matching a search, with its relevance and a highlighted snippet
+type SearchResult struct {
+	Comment
+	Score   float64 `gorm:"column:c_score" json:"score"`
+	Snippet string  `gorm:"-" json:"snippet"`
+}
+
+// SetupSearch creates the full-text index, a FULLTEXT index on MySQL and an FTS5 table kept in sync by triggers on SQLite
+func SetupSearch(gormDb *gorm.DB) error {
+	if gormDb.Dialector.Name() == "mysql" {
+		if gormDb.Migrator().HasIndex(&Comment{}, "idx_comments_body_fulltext") {
+			return nil
+		}
+		return gormDb.Exec("ALTER TABLE comments ADD FULLTEXT INDEX idx_comments_body_fulltext (c_body)").Error
+	}
+
+	if gormDb.Migrator().HasTable(searchTable) {
+		return nil
+	}
+
+	// Only there when go-sqlite3 is built with -tags sqlite_fts5
+	exception := gormDb.Exec("CREATE VIRTUAL TABLE " + searchTable + " USING fts5(c_body, content='comments', content_rowid='c_id')").Error
+	if exception != nil {
+		if strings.Contains(exception.Error(), "no such module") {
+			return ErrSearchUnavailable
+		}
+		return exception
+	}
+
+	statements := []string{
+		`CREATE TRIGGER comments_fts_insert AFTER INSERT ON comments BEGIN
+			INSERT INTO comments_fts(rowid, c_body) VALUES (new.c_id, new.c_body);
+		END`,
+		`CREATE TRIGGER comments_fts_delete AFTER DELETE ON comments BEGIN
+			INSERT INTO comments_fts(comments_fts, rowid, c_body) VALUES ('delete', old.c_id, old.c_body);
+		END`,
+		`CREATE TRIGGER comments_fts_update AFTER UPDATE OF c_body ON comments BEGIN
+			INSERT INTO comments_fts(comments_fts, rowid, c_body) VALUES ('delete', old.c_id, old.c_body);
+			INSERT INTO comments_fts(rowid, c_body) VALUES (new.c_id, new.c_body);
+		END`,
+		// Index whatever was there before the table existed
+		`INSERT INTO comments_fts(comments_fts) VALUES ('rebuild')`,
+	}
+
+	for _, statement := range statements {
+		if exception := gormDb.Exec(statement).Error; exception != nil {
+			return exception
+		}
+	}
+
+	return nil
+}
+
+// Search returns a page of live comments matching the terms, most relevant first
+func (comment *Comment) Search(gormDb *gorm.DB, terms []string, query PageQuery) ([]*SearchResult, *Page, error) {
+	offset, exception := decodeOffset(query.Cursor)
+	if exception != nil {
+		return nil, nil, exception
+	}
+
+	page := &Page{Limit: query.limit()}
+
+	// The matching rows, the score is only selected once they are counted
+	var tx *gorm.DB
+	var score clause.Expr
+	if gormDb.Dialector.Name() == "mysql" {
+		against := strings.Join(terms, " ")
+		tx = gormDb.Table("comments").
+			Where("MATCH(c_body) AGAINST (? IN NATURAL LANGUAGE MODE)", against)
+		score = gorm.Expr("MATCH(c_body) AGAINST (? IN NATURAL LANGUAGE MODE)", against)
+	} else {
+		if !gormDb.Migrator().HasTable(searchTable) {
+			return nil, nil, ErrSearchUnavailable
+		}
+
+		// Quoted terms can't be read as FTS5 operators, bm25 is lower for better matches
+		quoted := make([]string, 0, len(terms))
+		for _, term := range terms {
+			quoted = append(quoted, `"`+term+`"`)
+		}
+		tx = gormDb.Table("comments").
+			Joins("JOIN comments_fts ON comments_fts.rowid = comments.c_id").
+			Where("comments_fts MATCH ?", strings.Join(quoted, " "))
+		score = gorm.Expr("-bm25(comments_fts)")
+	}
+
+	tx = tx.Where("c_deleted", false).
+		Where("c_status", StatusPublished)
+
+	if query.IncludeTotal {
+		var total int64
+		if exception := tx.Session(&gorm.Session{}).Count(&total).Error; exception != nil {
+			return nil, nil, exception
+		}
+		page.Total = &total
+	}
+
+	var results []*SearchResult
+	exception = tx.Select("comments.*, ? AS c_score", score).
+		Order("c_score DESC").
+		Order("comments.c_id DESC").
+		Limit(page.Limit + 1).
+		Offset(offset).
+		Find(&results).
+		Error
+	if exception != nil {
+		return nil, nil, exception
+	}
+
+	if len(results) > page.Limit {
+		results = results[:page.Limit]
+		page.NextCursor = encodeOffset(offset + page.Limit)
+	}
+	if offset > 0 {
+		previous := offset - page.Limit
+		if previous < 0 {
+			previous = 0
+		}
+		page.PrevCursor = encodeOffset(previous)
+	}
+
+	for _, result := range results {
+		result.Snippet = Highlight(result.Body, terms)
+	}
+
+	return results, page, nil
+}
+
+// SearchTerms splits a search query into words, dropping anything that isn't a letter or a digit
+func SearchTerms(query string) []string {
+	return strings.FieldsFunc(strings.ToLower(query), func(char rune) bool {
+		return !unicode.IsLetter(char) && !unicode.IsNumber(char)
+	})
+}
+
+// Highlight returns an HTML-escaped excerpt around the first match, with every match wrapped in <mark>
+func Highlight(body string, terms []string) string {
+	text := []rune(body)
+	lower := []rune(strings.ToLower(body))
+
+	// Find every match as rune offsets
+	type match struct{ start, end int }
+	var matches []match
+	for i := 0; i < len(lower); i++ {
+		for _, term := range terms {
+			needle := []rune(term)
+			if len(needle) > 0 && i+len(needle) <= len(lower) && string(lower[i:i+len(needle)]) == term {
+				matches = append(matches, match{i, i + len(needle)})
+				i += len(needle) - 1
+				break
+			}
+		}
+	}
+
+	// Window around the first match, or the start of the body
+	start, end := 0, len(text)
+	if len(matches) > 0 {
+		start = matches[0].start - snippetRadius
+	}
+	if start < 0 {
+		start = 0
+	}
+	if end > start+2*snippetRadius {
+		end = start + 2*snippetRadius
+	}
+
+	var snippet strings.Builder
+	if start > 0 {
+		snippet.WriteString("…")
+	}
+
+	position := start
+	for _, found := range matches {
+		if found.start < start || found.end > end {
+			continue
+		}
+		snippet.WriteString(html.EscapeString(string(text[position:found.start])))
+		snippet.WriteString("<mark>")
+		snippet.WriteString(html.EscapeString(string(text[found.start:found.end])))
+		snippet.WriteString("</mark>")
+		position = found.end
+	}
+	snippet.WriteString(html.EscapeString(string(text[position:end])))
+
+	if end < len(text) {
+		snippet.WriteString("…")
+	}
+
+	return snippet.String()
+}
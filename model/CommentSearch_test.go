@@ -0,0 +1,65 @@
+package model
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestComment_Search(t *testing.T) {
+	gormDb := openTestDb(t)
+
+	// Needs go-sqlite3 built with -tags sqlite_fts5
+	if exception := SetupSearch(gormDb); exception == ErrSearchUnavailable {
+		t.Skip("FTS5 is not compiled in, run with -tags sqlite_fts5")
+	} else {
+		require.NoError(t, exception)
+	}
+
+	bodies := []string{
+		"The quick brown fox",
+		"A fox, a fox and another fox",
+		"Nothing to see here",
+		"Foxes are not a fox",
+	}
+	for _, body := range bodies {
+		require.NoError(t, gormDb.Create(&Comment{Body: body, UserId: 1}).Error)
+	}
+
+	var comment Comment
+
+	// Edits are indexed and deleted comments are not found
+	require.NoError(t, comment.UpdateBody(gormDb, 3, "Now there is a fox", 1, 0, nil))
+	require.NoError(t, comment.Delete(gormDb, 4, 0))
+
+	results, page, exception := comment.Search(gormDb, SearchTerms("FOX!"), PageQuery{Limit: 2, IncludeTotal: true})
+	require.NoError(t, exception)
+	require.Len(t, results, 2)
+	assert.Equal(t, int64(3), *page.Total)
+	assert.NotEmpty(t, page.NextCursor)
+
+	// Most relevant first
+	assert.Equal(t, uint32(2), results[0].Id)
+	assert.Equal(t, "A <mark>fox</mark>, a <mark>fox</mark> and another <mark>fox</mark>", results[0].Snippet)
+
+	results, page, exception = comment.Search(gormDb, SearchTerms("fox"), PageQuery{Limit: 2, Cursor: page.NextCursor})
+	require.NoError(t, exception)
+	assert.Len(t, results, 1)
+	assert.Empty(t, page.NextCursor)
+	assert.NotEmpty(t, page.PrevCursor)
+}
+
+func TestHighlight(t *testing.T) {
+	assert.Equal(t, "<mark>Fox</mark> &amp; <mark>hound</mark>", Highlight("Fox & hound", []string{"fox", "hound"}))
+	assert.Equal(t, "no match", Highlight("no match", []string{"fox"}))
+
+	long := "Lorem ipsum dolor sit amet, consectetur adipiscing elit, sed do eiusmod tempor incididunt ut labore fox et dolore magna aliqua"
+	snippet := Highlight(long, []string{"fox"})
+	assert.Contains(t, snippet, "<mark>fox</mark>")
+	assert.Equal(t, "…", string([]rune(snippet)[0]))
+}
+
+func TestSearchTerms(t *testing.T) {
+	assert.Equal(t, []string{"fox", "ünïcode", "or", "42"}, SearchTerms(` Fox* "ÜNÏCODE" OR:42 `))
+}
@@ -0,0 +1,144 @@
+package model
+
+import (
+	"gorm.io/gorm"
+)
+
+const (
+	DefaultThreadDepth = 3
+	MaxThreadDepth     = 10
+
+	// DeletedPlaceholder replaces the body of soft-deleted comments inside a thread
+	DeletedPlaceholder = "[deleted]"
+)
+
+// ThreadQuery describes how much of a reply tree to load
+type ThreadQuery struct {
+	// How many levels of replies below the root, 1 means direct replies only
+	Depth int
+
+	// Pages the direct replies of the root, deeper levels only get their first page
+	PageQuery
+}
+
+// GetThread loads a comment with its reply tree, soft-deleted comments are kept as placeholders.
+// Replies waiting for moderation or rejected are left out together with their own replies.
+func (comment *Comment) GetThread(gormDb *gorm.DB, commentId uint32, query ThreadQuery) (*Page, error) {
+
+	// Deleted comments are part of the thread too
+	if exception := gormDb.Model(&comment).First(&comment, commentId).Error; exception != nil {
+		return nil, exception
+	}
+
+	// A deleted comment nobody replied to is just gone
+	if comment.Deleted && comment.ReplyCount == 0 {
+		return nil, gorm.ErrRecordNotFound
+	}
+	comment.placeholder()
+
+	// Direct replies are paginated with the cursor of the query
+	tx := gormDb.Model(&Comment{}).
+		Where("fk_parent_id", comment.Id).
+		Where("c_status", StatusPublished)
+	replies, page, exception := paginate(tx, query.PageQuery)
+	if exception != nil {
+		return nil, exception
+	}
+	comment.Replies = replies
+
+	// Walk down the tree one level per query
+	level := replies
+	for depth := 1; depth < query.depth() && len(level) > 0; depth++ {
+		if level, exception = loadReplies(gormDb, level, page.Limit); exception != nil {
+			return nil, exception
+		}
+	}
+
+	for _, reply := range comment.Replies {
+		reply.placeholderTree()
+	}
+
+	return page, nil
+}
+
+// loadReplies attaches the first limit replies to each parent, returning all loaded replies
+func loadReplies(gormDb *gorm.DB, parents []*Comment, limit int) ([]*Comment, error) {
+	parentsById := make(map[uint32]*Comment, len(parents))
+	parentIds := make([]uint32, 0, len(parents))
+
+	for _, parent := range parents {
+		if parent.ReplyCount == 0 {
+			continue
+		}
+		parentsById[parent.Id] = parent
+		parentIds = append(parentIds, parent.Id)
+	}
+
+	if len(parentIds) == 0 {
+		return nil, nil
+	}
+
+	// Number the replies per parent so one query can take the first page of each. Window functions need MySQL 8.0 or
+	// MariaDB 10.2 at least.
+	numbered := gormDb.Model(&Comment{}).
+		Select("*, ROW_NUMBER() OVER (PARTITION BY fk_parent_id ORDER BY c_id) AS c_row").
+		Where("fk_parent_id IN ?", parentIds).
+		Where("c_status", StatusPublished)
+
+	var replies []*Comment
+	exception := gormDb.Table("(?) AS replies", numbered).
+		Where("c_row <= ?", limit+1).
+		Order("c_id ASC").
+		Find(&replies).
+		Error
+	if exception != nil {
+		return nil, exception
+	}
+
+	loaded := make([]*Comment, 0, len(replies))
+	for _, reply := range replies {
+		parent := parentsById[*reply.ParentId]
+
+		// The extra row only tells us there is a next page
+		if len(parent.Replies) == limit {
+			last := parent.Replies[limit-1]
+			parent.RepliesCursor = cursor{Id: last.Id}.encode()
+			continue
+		}
+
+		parent.Replies = append(parent.Replies, reply)
+		loaded = append(loaded, reply)
+	}
+
+	return loaded, nil
+}
+
+// placeholder hides the content of a soft-deleted comment, keeping its place in the thread
+func (comment *Comment) placeholder() {
+	if !comment.Deleted {
+		return
+	}
+
+	comment.Body = DeletedPlaceholder
+	comment.BodyHtml = DeletedPlaceholder
+	comment.UserId = 0
+}
+
+func (comment *Comment) placeholderTree() {
+	comment.placeholder()
+
+	for _, reply := range comment.Replies {
+		reply.placeholderTree()
+	}
+}
+
+// depth returns the thread depth within the allowed bounds
+func (query ThreadQuery) depth() int {
+	if query.Depth <= 0 {
+		return DefaultThreadDepth
+	}
+	if query.Depth > MaxThreadDepth {
+		return MaxThreadDepth
+	}
+	return query.Depth
+}
@@ -0,0 +1,441 @@
+package model
+
+import (
+	"testing"
+	"time"
+
+	"two-in-one/helper/cache"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+)
+
+// openTestDb returns a migrated in-memory SQLite database
+func openTestDb(t *testing.T) *gorm.DB {
+	gormDb, exception := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{})
+	require.NoError(t, exception)
+
+	// Every connection to ":memory:" is a separate database
+	sqlDb, _ := gormDb.DB()
+	sqlDb.SetMaxOpenConns(1)
+
+	require.NoError(t, gormDb.AutoMigrate(&Comment{}, &CommentRevision{}, &ModerationFlag{}, &CommentReaction{}, &CommentMention{}, &CommentAttachment{}, &OutboxEvent{}, &WebhookSubscription{}, &WebhookDelivery{}, &WebhookAttempt{}, &CommentErasure{}))
+
+	t.Cleanup(func() {
+		_ = sqlDb.Close()
+	})
+
+	return gormDb
+}
+
+// reply creates a comment below parentId and bumps the parent's reply count
+func reply(t *testing.T, gormDb *gorm.DB, parentId uint32, body string) *Comment {
+	comment := &Comment{Body: body, UserId: 1, ParentId: &parentId}
+	require.NoError(t, gormDb.Create(comment).Error)
+	require.NoError(t, comment.IncrementReplyCount(gormDb, parentId))
+	return comment
+}
+
+func TestComment_GetByUserId(t *testing.T) {
+	gormDb := openTestDb(t)
+
+	for i := 0; i < 5; i++ {
+		require.NoError(t, gormDb.Create(&Comment{Body: "comment", UserId: 1}).Error)
+	}
+	require.NoError(t, gormDb.Create(&Comment{Body: "someone else", UserId: 2}).Error)
+
+	var comment Comment
+
+	// First page
+	comments, page, exception := comment.GetByUserId(gormDb, 1, ListQuery{PageQuery: PageQuery{Limit: 2, IncludeTotal: true}})
+	require.NoError(t, exception)
+	assert.Equal(t, []uint32{1, 2}, commentIds(comments))
+	assert.Equal(t, int64(5), *page.Total)
+	assert.Empty(t, page.PrevCursor)
+
+	// Second page
+	comments, page, exception = comment.GetByUserId(gormDb, 1, ListQuery{PageQuery: PageQuery{Limit: 2, Cursor: page.NextCursor}})
+	require.NoError(t, exception)
+	assert.Equal(t, []uint32{3, 4}, commentIds(comments))
+	assert.NotEmpty(t, page.PrevCursor)
+
+	// Last page
+	comments, page, exception = comment.GetByUserId(gormDb, 1, ListQuery{PageQuery: PageQuery{Limit: 2, Cursor: page.NextCursor}})
+	require.NoError(t, exception)
+	assert.Equal(t, []uint32{5}, commentIds(comments))
+	assert.Empty(t, page.NextCursor)
+
+	// And back again
+	comments, _, exception = comment.GetByUserId(gormDb, 1, ListQuery{PageQuery: PageQuery{Limit: 2, Cursor: page.PrevCursor}})
+	require.NoError(t, exception)
+	assert.Equal(t, []uint32{3, 4}, commentIds(comments))
+
+	_, _, exception = comment.GetByUserId(gormDb, 1, ListQuery{PageQuery: PageQuery{Cursor: "garbage"}})
+	assert.ErrorIs(t, exception, ErrInvalidCursor)
+}
+
+func TestComment_GetByUserId_NewestInWindow(t *testing.T) {
+	gormDb := openTestDb(t)
+
+	start := time.Date(2022, 1, 1, 0, 0, 0, 0, time.UTC)
+	for i := 0; i < 5; i++ {
+		require.NoError(t, gormDb.Create(&Comment{Body: "comment", UserId: 1, CreatedAt: start.AddDate(0, 0, i)}).Error)
+	}
+
+	since, until := start.AddDate(0, 0, 1), start.AddDate(0, 0, 3)
+
+	var comment Comment
+
+	comments, page, exception := comment.GetByUserId(gormDb, 1, ListQuery{
+		PageQuery: PageQuery{Limit: 2, Descending: true},
+		Since:     &since,
+		Until:     &until,
+	})
+	require.NoError(t, exception)
+	assert.Equal(t, []uint32{4, 3}, commentIds(comments))
+
+	comments, _, exception = comment.GetByUserId(gormDb, 1, ListQuery{
+		PageQuery: PageQuery{Limit: 2, Descending: true, Cursor: page.NextCursor},
+		Since:     &since,
+		Until:     &until,
+	})
+	require.NoError(t, exception)
+	assert.Equal(t, []uint32{2}, commentIds(comments))
+}
+
+func TestComment_Delete(t *testing.T) {
+	gormDb := openTestDb(t)
+
+	comment := &Comment{Body: "comment", UserId: 1}
+	require.NoError(t, gormDb.Create(comment).Error)
+	assert.False(t, comment.CreatedAt.IsZero())
+	assert.Nil(t, comment.DeletedAt)
+
+	require.NoError(t, comment.Delete(gormDb, comment.Id, 0))
+
+	var stored Comment
+	require.NoError(t, gormDb.First(&stored, comment.Id).Error)
+	assert.True(t, stored.Deleted)
+	assert.NotNil(t, stored.DeletedAt)
+
+	// Only once
+	assert.ErrorIs(t, comment.Delete(gormDb, comment.Id, 0), gorm.ErrRecordNotFound)
+}
+
+func TestComment_Cache(t *testing.T) {
+	gormDb := openTestDb(t)
+	queryCache := cache.New(&cache.Config{Size: 10, TTL: time.Minute})
+	require.NoError(t, gormDb.Use(queryCache))
+
+	var comment Comment
+	require.NoError(t, gormDb.Create(&Comment{Body: "comment", UserId: 1}).Error)
+
+	var found, cached Comment
+	require.NoError(t, found.FindById(gormDb, 1))
+	require.NoError(t, cached.FindById(gormDb, 1))
+	comments, _, exception := comment.GetByUserId(gormDb, 1, ListQuery{PageQuery: PageQuery{Limit: 10}})
+	require.NoError(t, exception)
+	require.Len(t, comments, 1)
+	assert.Equal(t, uint64(1), queryCache.Stats().Hits)
+
+	// Edits invalidate the comment and the listing of its author
+	require.NoError(t, comment.UpdateBody(gormDb, 1, "edited", 1, 0, nil))
+
+	var edited Comment
+	require.NoError(t, edited.FindById(gormDb, 1))
+	assert.Equal(t, "edited", edited.Body)
+	comments, _, exception = comment.GetByUserId(gormDb, 1, ListQuery{PageQuery: PageQuery{Limit: 10}})
+	require.NoError(t, exception)
+	require.Len(t, comments, 1)
+	assert.Equal(t, "edited", comments[0].Body)
+
+	// So do deletes
+	require.NoError(t, comment.Delete(gormDb, 1, 0))
+
+	var deleted Comment
+	assert.ErrorIs(t, deleted.FindById(gormDb, 1), gorm.ErrRecordNotFound)
+	comments, _, exception = comment.GetByUserId(gormDb, 1, ListQuery{PageQuery: PageQuery{Limit: 10}})
+	require.NoError(t, exception)
+	assert.Empty(t, comments)
+	assert.Equal(t, uint64(1), queryCache.Stats().Hits)
+
+	// Moderation decisions and attachments too
+	require.NoError(t, gormDb.Create(&Comment{Body: "pending", UserId: 1, Status: StatusPending}).Error)
+	var pending Comment
+	require.NoError(t, pending.FindById(gormDb, 2))
+	require.NoError(t, comment.Moderate(gormDb, 2, StatusPublished, 9))
+
+	var moderated Comment
+	require.NoError(t, moderated.FindById(gormDb, 2))
+	assert.Equal(t, StatusPublished, moderated.Status)
+
+	var attachment CommentAttachment
+	require.NoError(t, attachment.Add(gormDb, 2, []*CommentAttachment{{Name: "file.txt", StorageKey: "key"}}))
+
+	var attached Comment
+	require.NoError(t, attached.FindById(gormDb, 2))
+	assert.Equal(t, uint32(1), attached.AttachmentCount)
+	assert.Equal(t, uint64(1), queryCache.Stats().Hits)
+
+	// The checks ahead of writes always read the stored row
+	require.NoError(t, gormDb.Model(&Comment{}).Where("c_id", 2).UpdateColumn("c_version", 9).Error)
+	var stale, stored Comment
+	require.NoError(t, stale.FindById(gormDb, 2))
+	require.NoError(t, stored.FindForWrite(gormDb, 2))
+	assert.NotEqual(t, uint32(9), stale.Version)
+	assert.Equal(t, uint32(9), stored.Version)
+}
+
+func TestComment_GetThread(t *testing.T) {
+	gormDb := openTestDb(t)
+
+	root := &Comment{Body: "root", UserId: 1}
+	require.NoError(t, gormDb.Create(root).Error)
+
+	first := reply(t, gormDb, root.Id, "first")
+	second := reply(t, gormDb, root.Id, "second")
+	reply(t, gormDb, root.Id, "third")
+
+	nested := reply(t, gormDb, first.Id, "nested one")
+	reply(t, gormDb, first.Id, "nested two")
+	reply(t, gormDb, first.Id, "nested three")
+	reply(t, gormDb, nested.Id, "too deep")
+
+	// A deleted reply keeps its place
+	require.NoError(t, second.Delete(gormDb, second.Id, 0))
+
+	var thread Comment
+	page, exception := thread.GetThread(gormDb, root.Id, ThreadQuery{Depth: 2, PageQuery: PageQuery{Limit: 2}})
+	require.NoError(t, exception)
+
+	assert.Equal(t, uint32(3), thread.ReplyCount)
+	assert.Equal(t, []uint32{first.Id, second.Id}, commentIds(thread.Replies))
+	assert.NotEmpty(t, page.NextCursor)
+
+	// The deleted reply is a placeholder
+	assert.Equal(t, DeletedPlaceholder, thread.Replies[1].Body)
+	assert.Equal(t, uint32(0), thread.Replies[1].UserId)
+
+	// Second level is limited to a page per parent
+	assert.Len(t, thread.Replies[0].Replies, 2)
+	assert.NotEmpty(t, thread.Replies[0].RepliesCursor)
+
+	// Third level is beyond the depth
+	assert.Nil(t, thread.Replies[0].Replies[0].Replies)
+	assert.Equal(t, uint32(1), thread.Replies[0].Replies[0].ReplyCount)
+}
+
+func TestComment_GetThread_DeletedWithoutReplies(t *testing.T) {
+	gormDb := openTestDb(t)
+
+	comment := &Comment{Body: "lonely", UserId: 1}
+	require.NoError(t, gormDb.Create(comment).Error)
+	require.NoError(t, comment.Delete(gormDb, comment.Id, 0))
+
+	var thread Comment
+	_, exception := thread.GetThread(gormDb, comment.Id, ThreadQuery{})
+	assert.ErrorIs(t, exception, gorm.ErrRecordNotFound)
+}
+
+func commentIds(comments []*Comment) []uint32 {
+	ids := make([]uint32, 0, len(comments))
+	for _, comment := range comments {
+		ids = append(ids, comment.Id)
+	}
+	return ids
+}
+
+func TestComment_UpdateBody(t *testing.T) {
+	gormDb := openTestDb(t)
+
+	comment := &Comment{Body: "original", UserId: 1}
+	require.NoError(t, gormDb.Create(comment).Error)
+
+	require.NoError(t, comment.UpdateBody(gormDb, comment.Id, "first edit", 1, 0, nil))
+	require.NoError(t, comment.UpdateBody(gormDb, comment.Id, "second edit", 1, 0, nil))
+
+	var stored Comment
+	require.NoError(t, stored.FindById(gormDb, comment.Id))
+	assert.Equal(t, "second edit", stored.Body)
+	assert.True(t, !stored.UpdatedAt.Before(stored.CreatedAt))
+
+	var revision CommentRevision
+	revisions, exception := revision.GetByCommentId(gormDb, comment.Id)
+	require.NoError(t, exception)
+	require.Len(t, revisions, 2)
+
+	// Newest first, each keeping the body it replaced
+	assert.Equal(t, uint32(2), revisions[0].Revision)
+	assert.Equal(t, "first edit", revisions[0].Body)
+	assert.Equal(t, uint32(1), revisions[1].Revision)
+	assert.Equal(t, "original", revisions[1].Body)
+	assert.False(t, revisions[1].CreatedAt.IsZero())
+
+	// Deleted comments can not be edited
+	require.NoError(t, comment.Delete(gormDb, comment.Id, 0))
+	assert.ErrorIs(t, comment.UpdateBody(gormDb, comment.Id, "too late", 1, 0, nil), gorm.ErrRecordNotFound)
+}
+
+func TestComment_BodyHtml(t *testing.T) {
+	gormDb := openTestDb(t)
+
+	comment := &Comment{Body: "*hello*", UserId: 1}
+	require.NoError(t, gormDb.Create(comment).Error)
+
+	var stored Comment
+	require.NoError(t, stored.FindById(gormDb, comment.Id))
+	assert.Equal(t, "<p><em>hello</em></p>\n", stored.BodyHtml)
+
+	require.NoError(t, comment.UpdateBody(gormDb, comment.Id, "<b>bye</b>", 1, 0, nil))
+
+	var updated Comment
+	require.NoError(t, updated.FindById(gormDb, comment.Id))
+	assert.Equal(t, "<p>&lt;b&gt;bye&lt;/b&gt;</p>\n", updated.BodyHtml)
+
+	// Comments from before the column existed are rendered by the migration
+	old := &Comment{Body: "`old`", UserId: 1}
+	require.NoError(t, gormDb.Create(old).Error)
+	require.NoError(t, gormDb.Model(old).UpdateColumn("c_body_html", gorm.Expr("NULL")).Error)
+
+	rendered, exception := comment.RenderMissingHtml(gormDb, 1)
+	require.NoError(t, exception)
+	assert.Equal(t, 1, rendered)
+
+	var backfilled Comment
+	require.NoError(t, backfilled.FindById(gormDb, old.Id))
+	assert.Equal(t, "<p><code>old</code></p>\n", backfilled.BodyHtml)
+}
+
+func TestComment_Versions(t *testing.T) {
+	gormDb := openTestDb(t)
+
+	comment := &Comment{Body: "original", UserId: 1}
+	require.NoError(t, gormDb.Create(comment).Error)
+	assert.Equal(t, uint32(1), comment.Version)
+
+	require.NoError(t, comment.UpdateBody(gormDb, comment.Id, "first edit", 1, 1, nil))
+
+	// A second editor still on version 1 loses
+	assert.ErrorIs(t, comment.UpdateBody(gormDb, comment.Id, "stale edit", 2, 1, nil), ErrVersionConflict)
+	assert.ErrorIs(t, comment.Delete(gormDb, comment.Id, 1), ErrVersionConflict)
+
+	var stored Comment
+	require.NoError(t, stored.FindById(gormDb, comment.Id))
+	assert.Equal(t, "first edit", stored.Body)
+	assert.Equal(t, uint32(2), stored.Version)
+
+	require.NoError(t, comment.Delete(gormDb, comment.Id, 2))
+	require.NoError(t, comment.Restore(gormDb, comment.Id))
+
+	require.NoError(t, stored.FindById(gormDb, comment.Id))
+	assert.Equal(t, uint32(4), stored.Version)
+
+	// Gone is still a 404, whatever the version
+	assert.ErrorIs(t, comment.Delete(gormDb, 99, 4), gorm.ErrRecordNotFound)
+}
+
+func TestComment_Restore(t *testing.T) {
+	gormDb := openTestDb(t)
+
+	comment := &Comment{Body: "comment", UserId: 1}
+	require.NoError(t, gormDb.Create(comment).Error)
+
+	// Only deleted comments can be restored
+	assert.ErrorIs(t, comment.Restore(gormDb, comment.Id), gorm.ErrRecordNotFound)
+
+	require.NoError(t, comment.Delete(gormDb, comment.Id, 0))
+	require.NoError(t, comment.Restore(gormDb, comment.Id))
+
+	var stored Comment
+	require.NoError(t, stored.FindById(gormDb, comment.Id))
+	assert.Nil(t, stored.DeletedAt)
+}
+
+func TestComment_Purge(t *testing.T) {
+	gormDb := openTestDb(t)
+
+	longAgo := time.Now().Add(-48 * time.Hour)
+
+	parent := &Comment{Body: "parent", UserId: 1}
+	require.NoError(t, gormDb.Create(parent).Error)
+	child := reply(t, gormDb, parent.Id, "child")
+	recent := &Comment{Body: "recent", UserId: 1}
+	require.NoError(t, gormDb.Create(recent).Error)
+	alive := &Comment{Body: "alive", UserId: 1}
+	require.NoError(t, gormDb.Create(alive).Error)
+
+	require.NoError(t, child.UpdateBody(gormDb, child.Id, "edited child", 1, 0, nil))
+
+	for _, comment := range []*Comment{parent, child, recent} {
+		require.NoError(t, comment.Delete(gormDb, comment.Id, 0))
+	}
+	require.NoError(t, gormDb.Model(&Comment{}).
+		Where("c_id IN ?", []uint32{parent.Id, child.Id}).
+		UpdateColumn("deleted_at", longAgo).Error)
+
+	var comment Comment
+
+	// The child goes first, which frees up the parent for the next batch
+	purged, exception := comment.Purge(gormDb, time.Now().Add(-24*time.Hour), 1)
+	require.NoError(t, exception)
+	assert.Equal(t, []uint32{child.Id, parent.Id}, purged)
+
+	var remaining []*Comment
+	require.NoError(t, gormDb.Order("c_id").Find(&remaining).Error)
+	assert.Equal(t, []uint32{recent.Id, alive.Id}, commentIds(remaining))
+
+	var revisions int64
+	require.NoError(t, gormDb.Model(&CommentRevision{}).Count(&revisions).Error)
+	assert.Equal(t, int64(0), revisions)
+}
+
+func TestComment_Purge_RestoredMeanwhile(t *testing.T) {
+	gormDb := openTestDb(t)
+
+	longAgo := time.Now().Add(-48 * time.Hour)
+
+	comment := &Comment{Body: "restored", UserId: 1}
+	require.NoError(t, gormDb.Create(comment).Error)
+	require.NoError(t, comment.Delete(gormDb, comment.Id, 0))
+	require.NoError(t, gormDb.Model(comment).UpdateColumn("deleted_at", longAgo).Error)
+
+	// Restored right after the purge picked it
+	restored := false
+	require.NoError(t, gormDb.Callback().Query().After("gorm:query").Register("test:restore", func(tx *gorm.DB) {
+		if !restored {
+			restored = true
+			require.NoError(t, comment.Restore(gormDb, comment.Id))
+		}
+	}))
+
+	purged, exception := comment.Purge(gormDb, time.Now().Add(-24*time.Hour), 10)
+	require.NoError(t, exception)
+	assert.Empty(t, purged)
+
+	var stored Comment
+	require.NoError(t, gormDb.First(&stored, comment.Id).Error)
+	assert.False(t, stored.Deleted)
+}
+
+func TestComment_UpdateBody_ConcurrentEdit(t *testing.T) {
+	gormDb := openTestDb(t)
+
+	comment := &Comment{Body: "first", UserId: 1}
+	require.NoError(t, gormDb.Create(comment).Error)
+
+	// Another edit of the same version gets in between the read and the write, numbering the revision first
+	edited := false
+	require.NoError(t, gormDb.Callback().Update().Before("gorm:update").Register("test:edit", func(tx *gorm.DB) {
+		if !edited {
+			edited = true
+			other := tx.Session(&gorm.Session{NewDB: true})
+			require.NoError(t, other.Create(&CommentRevision{CommentId: comment.Id, Revision: 1, Body: "first", EditorId: 1}).Error)
+			require.NoError(t, other.Model(&Comment{}).Where("c_id", comment.Id).UpdateColumn("c_version", 2).Error)
+		}
+	}))
+
+	// A conflict rather than a broken unique index
+	assert.ErrorIs(t, comment.UpdateBody(gormDb, comment.Id, "second", 1, 0, nil), ErrVersionConflict)
+}
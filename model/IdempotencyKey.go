@@ -0,0 +1,102 @@
+package model
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// IdempotencyKey remembers the response to a request sent with an Idempotency-Key header, so a retry gets it again
+// instead of repeating the write. Keys are per user, anonymous requests share user 0.
+type IdempotencyKey struct {
+	Id     uint32 `gorm:"column:ik_id;primary_key:true"`
+	UserId uint32 `gorm:"column:fk_user_id;uniqueIndex:idx_idempotency_key"`
+	Key    string `gorm:"column:ik_key;size:255;uniqueIndex:idx_idempotency_key"`
+
+	// SHA-256 of the method, path and body, a retry has to send the very same request
+	RequestHash string `gorm:"column:ik_request_hash;size:64"`
+
+	// 0 while the first request is still being handled
+	Status      int    `gorm:"column:ik_status;not null;default:0"`
+	ContentType string `gorm:"column:ik_content_type;size:255"`
+	Body        []byte `gorm:"column:ik_body"`
+
+	CreatedAt time.Time `gorm:"column:ik_created_at"`
+	ExpiresAt time.Time `gorm:"column:ik_expires_at;index"`
+}
+
+func (key *IdempotencyKey) TableName() string {
+	return "idempotency_keys"
+}
+
+// IsComplete tells whether the response of the first request was stored
+func (key *IdempotencyKey) IsComplete() bool {
+	return key.Status != 0
+}
+
+// Reserve claims the key of the user for a request, returning false when someone else already holds it.
+// An expired record of the key is dropped first.
+func (key *IdempotencyKey) Reserve(gormDb *gorm.DB) (bool, error) {
+	now := gormDb.NowFunc()
+
+	exception := gormDb.Where("fk_user_id", key.UserId).
+		Where("ik_key", key.Key).
+		Where("ik_expires_at <= ?", now).
+		Delete(&IdempotencyKey{}).
+		Error
+	if exception != nil {
+		return false, exception
+	}
+
+	key.Status = 0
+	key.CreatedAt = now
+
+	// Two requests racing for the same key, the unique index lets only one of them in
+	result := gormDb.Clauses(clause.OnConflict{DoNothing: true}).Create(key)
+	if result.Error != nil {
+		return false, result.Error
+	}
+
+	return result.RowsAffected == 1, nil
+}
+
+// Find loads the unexpired record of a key of the user
+func (key *IdempotencyKey) Find(gormDb *gorm.DB, userId uint32, value string) error {
+	return gormDb.Where("fk_user_id", userId).
+		Where("ik_key", value).
+		Where("ik_expires_at > ?", gormDb.NowFunc()).
+		First(key).
+		Error
+}
+
+// Complete stores the response of the request holding the key
+func (key *IdempotencyKey) Complete(gormDb *gorm.DB, status int, contentType string, body []byte) error {
+	key.Status = status
+	key.ContentType = contentType
+	key.Body = body
+
+	return gormDb.Model(&IdempotencyKey{}).
+		Where("ik_id", key.Id).
+		Updates(map[string]interface{}{
+			"ik_status":       status,
+			"ik_content_type": contentType,
+			"ik_body":         body,
+		}).
+		Error
+}
+
+// Release gives the key up without a response, so the request can be retried with it
+func (key *IdempotencyKey) Release(gormDb *gorm.DB) error {
+	return gormDb.Where("ik_id", key.Id).
+		Delete(&IdempotencyKey{}).
+		Error
+}
+
+// DeleteExpired removes the records past their TTL, returning how many there were
+func (key *IdempotencyKey) DeleteExpired(gormDb *gorm.DB) (int64, error) {
+	result := gormDb.Where("ik_expires_at <= ?", gormDb.NowFunc()).
+		Delete(&IdempotencyKey{})
+
+	return result.RowsAffected, result.Error
+}
@@ -0,0 +1,88 @@
+package model
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// ModerationFlag is one reason a comment was held for moderation, resolved once a moderator decides
+type ModerationFlag struct {
+	Id        uint32    `gorm:"column:mf_id;primary_key:true" json:"id"`
+	CommentId uint32    `gorm:"column:fk_comment_id;index" json:"commentId"`
+	Filter    string    `gorm:"column:mf_filter;size:64" json:"filter"`
+	Reason    string    `gorm:"column:mf_reason" json:"reason"`
+	CreatedAt time.Time `gorm:"column:mf_created_at" json:"createdAt"`
+
+	// Who approved or rejected the comment, and when
+	ModeratorId *uint32    `gorm:"column:fk_moderator_id" json:"moderatorId"`
+	ResolvedAt  *time.Time `gorm:"column:mf_resolved_at" json:"resolvedAt"`
+}
+
+func (flag *ModerationFlag) TableName() string {
+	return "comment_moderation_flags"
+}
+
+// GetPending returns one keyset page of the moderation queue, oldest first, with the open flags of each comment
+func (comment *Comment) GetPending(gormDb *gorm.DB, query PageQuery) ([]*Comment, *Page, error) {
+	tx := gormDb.Model(&Comment{}).
+		Preload("Flags", "mf_resolved_at IS NULL").
+		Where("c_status", StatusPending).
+		Where("c_deleted", false)
+
+	return paginate(tx, query)
+}
+
+// Moderate publishes or rejects a pending comment and resolves its flags, writing a comment.updated event since who
+// can see the comment changed. The comment is loaded as it is after the decision.
+func (comment *Comment) Moderate(gormDb *gorm.DB, commentId uint32, status string, moderatorId uint32) error {
+	exception := gormDb.Transaction(func(tx *gorm.DB) error {
+		result := tx.Model(&Comment{}).
+			Where("c_id", commentId).
+			Where("c_status", StatusPending).
+			Where("c_deleted", false).
+			Updates(map[string]interface{}{
+				"c_status":  status,
+				"c_version": gorm.Expr("c_version + ?", 1),
+			})
+
+		if result.Error != nil {
+			return result.Error
+		}
+
+		// Not in the queue, either it never existed or someone already decided
+		if result.RowsAffected == 0 {
+			return gorm.ErrRecordNotFound
+		}
+
+		exception := tx.Model(&ModerationFlag{}).
+			Where("fk_comment_id", commentId).
+			Where("mf_resolved_at IS NULL").
+			Updates(map[string]interface{}{
+				"fk_moderator_id": moderatorId,
+				"mf_resolved_at":  tx.NowFunc(),
+			}).
+			Error
+		if exception != nil {
+			return exception
+		}
+
+		changed, exception := recordCommentEvents(tx, EventCommentUpdated, []uint32{commentId})
+		if exception != nil {
+			return exception
+		}
+		if len(changed) > 0 {
+			*comment = *changed[0]
+		}
+
+		return nil
+	})
+	if exception != nil {
+		return exception
+	}
+
+	// Published comments show up where only their author saw them before
+	InvalidateComments(gormDb, []*Comment{comment})
+
+	return nil
+}
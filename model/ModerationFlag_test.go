@@ -0,0 +1,110 @@
+package model
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gorm.io/gorm"
+)
+
+func TestComment_Moderate(t *testing.T) {
+	gormDb := openTestDb(t)
+
+	published := &Comment{Body: "fine", UserId: 1}
+	require.NoError(t, gormDb.Create(published).Error)
+	assert.Equal(t, StatusPublished, published.Status)
+
+	// The flags go in with the comment
+	pending := &Comment{Body: "spam", UserId: 1, Status: StatusPending, Flags: []*ModerationFlag{
+		{Filter: "blocked_words", Reason: "spam"},
+		{Filter: "links", Reason: "a link"},
+	}}
+	require.NoError(t, gormDb.Create(pending).Error)
+
+	var comment Comment
+
+	queue, _, exception := comment.GetPending(gormDb, PageQuery{})
+	require.NoError(t, exception)
+	require.Equal(t, []uint32{pending.Id}, commentIds(queue))
+	assert.Len(t, queue[0].Flags, 2)
+
+	// Hidden from the public listing, not from its author
+	listed, _, exception := comment.GetByUserId(gormDb, 1, ListQuery{Status: StatusPublished})
+	require.NoError(t, exception)
+	assert.Equal(t, []uint32{published.Id}, commentIds(listed))
+
+	listed, _, exception = comment.GetByUserId(gormDb, 1, ListQuery{})
+	require.NoError(t, exception)
+	assert.Equal(t, []uint32{published.Id, pending.Id}, commentIds(listed))
+
+	require.NoError(t, comment.Moderate(gormDb, pending.Id, StatusPublished, 9))
+	assert.Equal(t, pending.Id, comment.Id)
+	assert.Equal(t, StatusPublished, comment.Status)
+
+	// Edits based on what was read before the decision no longer apply
+	assert.Equal(t, pending.Version+1, comment.Version)
+
+	// Subscribers learn that it is visible now
+	var event OutboxEvent
+	require.NoError(t, gormDb.Where("fk_comment_id", pending.Id).First(&event).Error)
+	assert.Equal(t, EventCommentUpdated, event.Type)
+	assert.Contains(t, event.Payload, `"status":"published"`)
+
+	var flags []*ModerationFlag
+	require.NoError(t, gormDb.Where("fk_comment_id", pending.Id).Find(&flags).Error)
+	for _, flag := range flags {
+		assert.Equal(t, uint32(9), *flag.ModeratorId)
+		assert.NotNil(t, flag.ResolvedAt)
+	}
+
+	// Already decided, or never in the queue
+	assert.ErrorIs(t, comment.Moderate(gormDb, pending.Id, StatusRejected, 9), gorm.ErrRecordNotFound)
+	assert.ErrorIs(t, comment.Moderate(gormDb, published.Id, StatusRejected, 9), gorm.ErrRecordNotFound)
+
+	queue, _, exception = comment.GetPending(gormDb, PageQuery{})
+	require.NoError(t, exception)
+	assert.Empty(t, queue)
+}
+
+func TestComment_UpdateBody_Flagged(t *testing.T) {
+	gormDb := openTestDb(t)
+
+	comment := &Comment{Body: "fine", UserId: 1}
+	require.NoError(t, gormDb.Create(comment).Error)
+
+	require.NoError(t, comment.UpdateBody(gormDb, comment.Id, "spam", 1, 0, []*ModerationFlag{{Filter: "blocked_words", Reason: "spam"}}))
+
+	var updated Comment
+	require.NoError(t, updated.FindById(gormDb, comment.Id))
+	assert.Equal(t, "spam", updated.Body)
+	assert.Equal(t, StatusPending, updated.Status)
+
+	queue, _, exception := updated.GetPending(gormDb, PageQuery{})
+	require.NoError(t, exception)
+	require.Len(t, queue, 1)
+	assert.Equal(t, comment.Id, queue[0].Flags[0].CommentId)
+}
+
+func TestComment_GetThread_HidesPendingReplies(t *testing.T) {
+	gormDb := openTestDb(t)
+
+	root := &Comment{Body: "root", UserId: 1}
+	require.NoError(t, gormDb.Create(root).Error)
+
+	visible := reply(t, gormDb, root.Id, "visible")
+	pending := reply(t, gormDb, root.Id, "pending")
+	require.NoError(t, gormDb.Model(&Comment{}).Where("c_id", pending.Id).Update("c_status", StatusPending).Error)
+
+	// Below a visible reply too
+	reply(t, gormDb, visible.Id, "nested visible")
+	nestedPending := reply(t, gormDb, visible.Id, "nested pending")
+	require.NoError(t, gormDb.Model(&Comment{}).Where("c_id", nestedPending.Id).Update("c_status", StatusRejected).Error)
+
+	var comment Comment
+
+	_, exception := comment.GetThread(gormDb, root.Id, ThreadQuery{})
+	require.NoError(t, exception)
+	require.Equal(t, []uint32{visible.Id}, commentIds(comment.Replies))
+	assert.Len(t, comment.Replies[0].Replies, 1)
+}
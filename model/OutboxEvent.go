@@ -0,0 +1,222 @@
+package model
+
+import (
+	"encoding/json"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// The changes to comments that are written to the outbox
+const (
+	EventCommentCreated  = "comment.created"
+	EventCommentUpdated  = "comment.updated"
+	EventCommentDeleted  = "comment.deleted"
+	EventCommentRestored = "comment.restored"
+	EventReactionAdded   = "reaction.added"
+	EventReactionRemoved = "reaction.removed"
+)
+
+// An outbox event is pending until it was handed to the subscriptions, each of them gets a WebhookDelivery of it
+const (
+	OutboxPending    = "pending"
+	OutboxDispatched = "dispatched"
+)
+
+// OutboxEvent is a change to a comment, written in the transaction of the change and delivered later on.
+// Events are delivered at least once, receivers tell repeats apart by the id.
+type OutboxEvent struct {
+	Id        uint64 `gorm:"column:ob_id;primary_key:true" json:"id"`
+	Type      string `gorm:"column:ob_type;size:32;not null" json:"type"`
+	CommentId uint32 `gorm:"column:fk_comment_id;index" json:"commentId"`
+
+	// Author of the comment, the subscriptions of that user get the event
+	UserId uint32 `gorm:"column:fk_user_id" json:"userId"`
+
+	// Who reacted, for the reaction events, so they can be found when that user's data is erased
+	ReactorId uint32 `gorm:"column:fk_reactor_id;index" json:"reactorId"`
+
+	// The comment as it was right after the change, or the reaction, as JSON
+	Payload string `gorm:"column:ob_payload;type:text" json:"payload"`
+
+	Status       string     `gorm:"column:ob_status;size:16;not null;default:pending;index" json:"status"`
+	CreatedAt    time.Time  `gorm:"column:ob_created_at" json:"createdAt"`
+	DispatchedAt *time.Time `gorm:"column:ob_dispatched_at;index" json:"dispatchedAt"`
+}
+
+func (event *OutboxEvent) TableName() string {
+	return "outbox_events"
+}
+
+// newOutboxEvent builds a pending event
+func newOutboxEvent(gormDb *gorm.DB, eventType string, commentId uint32, userId uint32, data interface{}) (*OutboxEvent, error) {
+	payload, exception := json.Marshal(data)
+	if exception != nil {
+		return nil, exception
+	}
+
+	now := gormDb.NowFunc()
+
+	return &OutboxEvent{
+		Type:      eventType,
+		CommentId: commentId,
+		UserId:    userId,
+		Payload:   string(payload),
+		Status:    OutboxPending,
+		CreatedAt: now,
+	}, nil
+}
+
+// recordCommentEvents writes an event for each of the comments, read back so the payload is what was just stored,
+// and returns them. It has to run in the transaction of the change, so the events go out with it or not at all.
+func recordCommentEvents(tx *gorm.DB, eventType string, commentIds []uint32) ([]*Comment, error) {
+	if len(commentIds) == 0 {
+		return nil, nil
+	}
+
+	var comments []*Comment
+	exception := tx.Model(&Comment{}).
+		Where("c_id IN ?", commentIds).
+		Order("c_id").
+		Find(&comments).
+		Error
+	if exception != nil {
+		return nil, exception
+	}
+
+	if len(comments) == 0 {
+		return nil, nil
+	}
+
+	events := make([]*OutboxEvent, 0, len(comments))
+	for _, comment := range comments {
+		event, exception := newOutboxEvent(tx, eventType, comment.Id, comment.UserId, comment)
+		if exception != nil {
+			return nil, exception
+		}
+		events = append(events, event)
+	}
+
+	return comments, tx.Create(&events).Error
+}
+
+// recordReactionEvent writes the event of a reaction added or taken back, in the transaction of the toggle.
+// It goes to the author of the comment, not to whoever reacted.
+func recordReactionEvent(tx *gorm.DB, eventType string, reaction *CommentReaction) error {
+	var comment Comment
+
+	exception := tx.Model(&Comment{}).
+		Select("fk_user_id").
+		Where("c_id", reaction.CommentId).
+		Take(&comment).
+		Error
+	if exception != nil {
+		return exception
+	}
+
+	event, exception := newOutboxEvent(tx, eventType, reaction.CommentId, comment.UserId, reaction)
+	if exception != nil {
+		return exception
+	}
+	event.ReactorId = reaction.UserId
+
+	return tx.Create(event).Error
+}
+
+// FindPending loads up to limit events that weren't handed to the subscriptions yet, oldest first
+func (event *OutboxEvent) FindPending(gormDb *gorm.DB, limit int) ([]*OutboxEvent, error) {
+	var events []*OutboxEvent
+
+	exception := gormDb.Model(&OutboxEvent{}).
+		Where("ob_status", OutboxPending).
+		Order("ob_id ASC").
+		Limit(limit).
+		Find(&events).
+		Error
+
+	return events, exception
+}
+
+// FindByIds loads the events with the given ids, in no particular order
+func (event *OutboxEvent) FindByIds(gormDb *gorm.DB, ids []uint64) ([]*OutboxEvent, error) {
+	var events []*OutboxEvent
+
+	if len(ids) == 0 {
+		return events, nil
+	}
+
+	exception := gormDb.Model(&OutboxEvent{}).
+		Where("ob_id IN ?", ids).
+		Find(&events).
+		Error
+
+	return events, exception
+}
+
+// Dispatch queues a delivery of each event to every active subscription it matches, then marks the events
+// dispatched, all in one transaction. Receivers lists the ids of subscriptions that get every event, whoever it is for.
+func (event *OutboxEvent) Dispatch(gormDb *gorm.DB, events []*OutboxEvent, receivers []uint32) error {
+	if len(events) == 0 {
+		return nil
+	}
+
+	userIds := make([]uint32, 0, len(events))
+	eventIds := make([]uint64, 0, len(events))
+	for _, event := range events {
+		userIds = append(userIds, event.UserId)
+		eventIds = append(eventIds, event.Id)
+	}
+
+	return gormDb.Transaction(func(tx *gorm.DB) error {
+		var subscription WebhookSubscription
+
+		subscriptions, exception := subscription.FindActiveByUserIds(tx, userIds)
+		if exception != nil {
+			return exception
+		}
+
+		now := tx.NowFunc()
+
+		var deliveries []*WebhookDelivery
+		for _, event := range events {
+			for _, receiver := range receivers {
+				deliveries = append(deliveries, newWebhookDelivery(event.Id, receiver, now))
+			}
+
+			for _, subscription := range subscriptions {
+				if subscription.UserId == event.UserId && subscription.Matches(event.Type) {
+					deliveries = append(deliveries, newWebhookDelivery(event.Id, subscription.Id, now))
+				}
+			}
+		}
+
+		// Another dispatcher may have queued some of them already
+		if len(deliveries) > 0 {
+			exception := tx.Clauses(clause.OnConflict{DoNothing: true}).
+				Create(&deliveries).
+				Error
+			if exception != nil {
+				return exception
+			}
+		}
+
+		return tx.Model(&OutboxEvent{}).
+			Where("ob_id IN ?", eventIds).
+			UpdateColumns(map[string]interface{}{
+				"ob_status":        OutboxDispatched,
+				"ob_dispatched_at": now,
+			}).
+			Error
+	})
+}
+
+// DeleteDispatched removes the events dispatched before the given time that have no delivery left
+func (event *OutboxEvent) DeleteDispatched(gormDb *gorm.DB, before time.Time) (int64, error) {
+	result := gormDb.Where("ob_status", OutboxDispatched).
+		Where("ob_dispatched_at < ?", before).
+		Where("ob_id NOT IN (?)", gormDb.Model(&WebhookDelivery{}).Select("fk_event_id")).
+		Delete(&OutboxEvent{})
+
+	return result.RowsAffected, result.Error
+}
@@ -0,0 +1,132 @@
+package model
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestOutboxEvent_Recorded(t *testing.T) {
+	gormDb := openTestDb(t)
+
+	var comment Comment
+	var reaction CommentReaction
+
+	first := &Comment{Body: "first", UserId: 1}
+	second := &Comment{Body: "second", UserId: 1}
+	third := &Comment{Body: "third", UserId: 1}
+	require.NoError(t, comment.CreateMany(gormDb, []*Comment{first, second, third}))
+	require.NoError(t, comment.UpdateBody(gormDb, first.Id, "edited", 1, 0, nil))
+	require.NoError(t, comment.Delete(gormDb, first.Id, 0))
+	require.NoError(t, comment.Restore(gormDb, first.Id))
+	_, exception := comment.DeleteMany(gormDb, []uint32{first.Id, second.Id})
+	require.NoError(t, exception)
+	_, exception = reaction.Toggle(gormDb, second.Id, 2, ReactionLike)
+	require.NoError(t, exception)
+	_, exception = (&CommentReaction{}).Toggle(gormDb, second.Id, 2, ReactionLike)
+	require.NoError(t, exception)
+
+	// Failed writes leave nothing behind
+	assert.ErrorIs(t, comment.UpdateBody(gormDb, third.Id, "too late", 1, 5, nil), ErrVersionConflict)
+	assert.Error(t, comment.Delete(gormDb, first.Id, 0))
+
+	var events []*OutboxEvent
+	require.NoError(t, gormDb.Order("ob_id").Find(&events).Error)
+
+	var types []string
+	for _, event := range events {
+		types = append(types, event.Type)
+		assert.Equal(t, OutboxPending, event.Status)
+
+		// The events are for the author, also when someone else reacted
+		assert.Equal(t, uint32(1), event.UserId)
+	}
+	assert.Equal(t, []string{
+		EventCommentCreated, EventCommentCreated, EventCommentCreated,
+		EventCommentUpdated, EventCommentDeleted, EventCommentRestored,
+		EventCommentDeleted, EventCommentDeleted,
+		EventReactionAdded, EventReactionRemoved,
+	}, types)
+
+	// The payload is the comment as it was stored by the change
+	var updated Comment
+	require.NoError(t, json.Unmarshal([]byte(events[3].Payload), &updated))
+	assert.Equal(t, first.Id, updated.Id)
+	assert.Equal(t, "edited", updated.Body)
+	assert.Equal(t, uint32(2), updated.Version)
+
+	var deleted Comment
+	require.NoError(t, json.Unmarshal([]byte(events[4].Payload), &deleted))
+	assert.True(t, deleted.Deleted)
+
+	var liked CommentReaction
+	require.NoError(t, json.Unmarshal([]byte(events[8].Payload), &liked))
+	assert.Equal(t, second.Id, liked.CommentId)
+	assert.Equal(t, ReactionLike, liked.Type)
+}
+
+func TestOutboxEvent_Dispatch(t *testing.T) {
+	gormDb := openTestDb(t)
+
+	var comment Comment
+	var event OutboxEvent
+
+	everything := &WebhookSubscription{UserId: 1, Url: "https://example.com/all", Secret: "s", Active: true}
+	deletes := &WebhookSubscription{UserId: 1, Url: "https://example.com/deletes", Secret: "s", Active: true, Events: []string{EventCommentDeleted}}
+	paused := &WebhookSubscription{UserId: 1, Url: "https://example.com/paused", Secret: "s"}
+	other := &WebhookSubscription{UserId: 2, Url: "https://example.com/other", Secret: "s", Active: true}
+	for _, subscription := range []*WebhookSubscription{everything, deletes, paused, other} {
+		require.NoError(t, gormDb.Create(subscription).Error)
+	}
+
+	mine := &Comment{Body: "mine", UserId: 1}
+	require.NoError(t, comment.CreateMany(gormDb, []*Comment{mine}))
+	require.NoError(t, comment.Delete(gormDb, mine.Id, 0))
+
+	events, exception := event.FindPending(gormDb, 10)
+	require.NoError(t, exception)
+	require.Len(t, events, 2)
+
+	// Subscription 0 is the receiver that gets everything
+	require.NoError(t, event.Dispatch(gormDb, events, []uint32{0}))
+
+	// Dispatching twice queues nothing more
+	require.NoError(t, event.Dispatch(gormDb, events, []uint32{0}))
+
+	var deliveries []*WebhookDelivery
+	require.NoError(t, gormDb.Order("fk_event_id, fk_subscription_id").Find(&deliveries).Error)
+
+	type queued struct {
+		EventId        uint64
+		SubscriptionId uint32
+	}
+	var got []queued
+	for _, delivery := range deliveries {
+		got = append(got, queued{delivery.EventId, delivery.SubscriptionId})
+		assert.Equal(t, DeliveryPending, delivery.Status)
+	}
+	assert.Equal(t, []queued{
+		{events[0].Id, 0}, {events[0].Id, everything.Id},
+		{events[1].Id, 0}, {events[1].Id, everything.Id}, {events[1].Id, deletes.Id},
+	}, got)
+
+	events, exception = event.FindPending(gormDb, 10)
+	require.NoError(t, exception)
+	assert.Empty(t, events)
+
+	// Events go once the last of their deliveries is gone
+	later := gormDb.NowFunc().Add(time.Hour)
+
+	removed, exception := event.DeleteDispatched(gormDb, later)
+	require.NoError(t, exception)
+	assert.Zero(t, removed)
+
+	require.NoError(t, gormDb.Where("1 = 1").Delete(&WebhookDelivery{}).Error)
+
+	removed, exception = event.DeleteDispatched(gormDb, later)
+	require.NoError(t, exception)
+	assert.Equal(t, int64(2), removed)
+}
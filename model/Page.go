@@ -0,0 +1,219 @@
+package model
+
+import (
+	"encoding/base64"
+	"errors"
+	"fmt"
+
+	"gorm.io/gorm"
+)
+
+const (
+	DefaultPageLimit = 20
+	MaxPageLimit     = 100
+)
+
+// ErrInvalidCursor is returned when a cursor was not issued by us
+var ErrInvalidCursor = errors.New("invalid cursor")
+
+// PageQuery describes which keyset page to load
+type PageQuery struct {
+	Limit        int
+	Cursor       string
+	IncludeTotal bool
+
+	// Newest first instead of oldest first
+	Descending bool
+}
+
+// Page is returned next to the rows of a keyset page
+type Page struct {
+	Limit      int    `json:"limit"`
+	NextCursor string `json:"nextCursor,omitempty"`
+	PrevCursor string `json:"prevCursor,omitempty"`
+	Total      *int64 `json:"total,omitempty"`
+}
+
+// cursor points just past a row, forwards or backwards
+type cursor struct {
+	Id       uint32
+	Backward bool
+}
+
+// encode turns a cursor into an opaque string
+func (cur cursor) encode() string {
+	direction := "n"
+	if cur.Backward {
+		direction = "p"
+	}
+
+	return base64.RawURLEncoding.EncodeToString([]byte(fmt.Sprintf("%s:%d", direction, cur.Id)))
+}
+
+// decodeCursor reads a cursor issued by encode, an empty string is the first page
+func decodeCursor(value string) (cursor, error) {
+	var cur cursor
+
+	if value == "" {
+		return cur, nil
+	}
+
+	raw, exception := base64.RawURLEncoding.DecodeString(value)
+	if exception != nil {
+		return cur, ErrInvalidCursor
+	}
+
+	var direction string
+	if _, exception := fmt.Sscanf(string(raw), "%1s:%d", &direction, &cur.Id); exception != nil {
+		return cur, ErrInvalidCursor
+	}
+
+	switch direction {
+	case "n":
+	case "p":
+		cur.Backward = true
+	default:
+		return cur, ErrInvalidCursor
+	}
+
+	return cur, nil
+}
+
+// encodeOffset turns an offset into an opaque cursor, for pages that can't be keyset paginated
+func encodeOffset(offset int) string {
+	return base64.RawURLEncoding.EncodeToString([]byte(fmt.Sprintf("o:%d", offset)))
+}
+
+// decodeOffset reads a cursor issued by encodeOffset, an empty string is the first page
+func decodeOffset(value string) (int, error) {
+	if value == "" {
+		return 0, nil
+	}
+
+	raw, exception := base64.RawURLEncoding.DecodeString(value)
+	if exception != nil {
+		return 0, ErrInvalidCursor
+	}
+
+	var offset int
+	if _, exception := fmt.Sscanf(string(raw), "o:%d", &offset); exception != nil || offset < 0 {
+		return 0, ErrInvalidCursor
+	}
+
+	return offset, nil
+}
+
+// limit returns the page size within the allowed bounds
+func (query PageQuery) limit() int {
+	if query.Limit <= 0 {
+		return DefaultPageLimit
+	}
+	if query.Limit > MaxPageLimit {
+		return MaxPageLimit
+	}
+	return query.Limit
+}
+
+// paginate loads one keyset page of comments on c_id from an already filtered query
+func paginate(tx *gorm.DB, query PageQuery) ([]*Comment, *Page, error) {
+	cur, exception := decodeCursor(query.Cursor)
+	if exception != nil {
+		return nil, nil, exception
+	}
+
+	page := &Page{Limit: query.limit()}
+
+	// Counted before the cursor narrows the query down
+	if query.IncludeTotal {
+		var total int64
+		if exception := tx.Session(&gorm.Session{}).Count(&total).Error; exception != nil {
+			return nil, nil, exception
+		}
+		page.Total = &total
+	}
+
+	// Going backwards we read in reverse and flip the rows afterwards
+	operator, order := ">", "ASC"
+	if cur.Backward != query.Descending {
+		operator, order = "<", "DESC"
+	}
+
+	if cur.Backward || cur.Id > 0 {
+		tx = tx.Where("c_id "+operator+" ?", cur.Id)
+	}
+	tx = tx.Order("c_id " + order)
+
+	// One extra row tells us if there is another page
+	var comments []*Comment
+	if exception := tx.Limit(page.Limit + 1).Find(&comments).Error; exception != nil {
+		return nil, nil, exception
+	}
+
+	return finishPage(comments, cur, page), page, nil
+}
+
+// PaginateSlice cuts the keyset page paginate would load out of comments already in memory, sorted by id
+func PaginateSlice(comments []*Comment, query PageQuery) ([]*Comment, *Page, error) {
+	cur, exception := decodeCursor(query.Cursor)
+	if exception != nil {
+		return nil, nil, exception
+	}
+
+	page := &Page{Limit: query.limit()}
+
+	if query.IncludeTotal {
+		total := int64(len(comments))
+		page.Total = &total
+	}
+
+	// Walk the rows in the order the SQL query would read them
+	descending := cur.Backward != query.Descending
+	rows := make([]*Comment, 0, page.Limit+1)
+
+	for i := range comments {
+		comment := comments[i]
+		if descending {
+			comment = comments[len(comments)-1-i]
+		}
+
+		if cur.Backward || cur.Id > 0 {
+			if (descending && comment.Id >= cur.Id) || (!descending && comment.Id <= cur.Id) {
+				continue
+			}
+		}
+
+		if rows = append(rows, comment); len(rows) > page.Limit {
+			break
+		}
+	}
+
+	return finishPage(rows, cur, page), page, nil
+}
+
+// finishPage trims the extra row of a page, puts backward pages back in order and sets the cursors around it
+func finishPage(comments []*Comment, cur cursor, page *Page) []*Comment {
+	hasMore := len(comments) > page.Limit
+	if hasMore {
+		comments = comments[:page.Limit]
+	}
+
+	if cur.Backward {
+		for i, j := 0, len(comments)-1; i < j; i, j = i+1, j-1 {
+			comments[i], comments[j] = comments[j], comments[i]
+		}
+	}
+
+	if len(comments) == 0 {
+		return comments
+	}
+
+	// We came from the other side, so there is always something back there
+	if hasMore || cur.Backward {
+		page.NextCursor = cursor{Id: comments[len(comments)-1].Id}.encode()
+	}
+	if (hasMore && cur.Backward) || (!cur.Backward && cur.Id > 0) {
+		page.PrevCursor = cursor{Id: comments[0].Id, Backward: true}.encode()
+	}
+
+	return comments
+}
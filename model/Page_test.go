@@ -0,0 +1,55 @@
+package model
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// PaginateSlice has to hand out the same pages and cursors as paginate
+func TestPaginateSlice(t *testing.T) {
+	gormDb := openTestDb(t)
+
+	var all []*Comment
+	for i := 0; i < 7; i++ {
+		comment := &Comment{Body: "comment", UserId: 1}
+		require.NoError(t, gormDb.Create(comment).Error)
+		all = append(all, comment)
+	}
+
+	for _, descending := range []bool{false, true} {
+		query := PageQuery{Limit: 3, Descending: descending, IncludeTotal: true}
+
+		// Walk forward to the end, then back to the start
+		var pages [][]uint32
+		for {
+			fromDb, dbPage, exception := paginate(gormDb.Model(&Comment{}), query)
+			require.NoError(t, exception)
+
+			fromSlice, slicePage, exception := PaginateSlice(all, query)
+			require.NoError(t, exception)
+
+			assert.Equal(t, commentIds(fromDb), commentIds(fromSlice))
+			assert.Equal(t, dbPage, slicePage)
+			pages = append(pages, commentIds(fromSlice))
+
+			if slicePage.NextCursor == "" {
+				break
+			}
+			query.Cursor = slicePage.NextCursor
+		}
+		assert.Len(t, pages, 3, "descending %v", descending)
+
+		fromDb, dbPage, exception := paginate(gormDb.Model(&Comment{}), PageQuery{Limit: 3, Descending: descending, Cursor: cursor{Id: pages[2][0], Backward: true}.encode()})
+		require.NoError(t, exception)
+		fromSlice, slicePage, exception := PaginateSlice(all, PageQuery{Limit: 3, Descending: descending, Cursor: cursor{Id: pages[2][0], Backward: true}.encode()})
+		require.NoError(t, exception)
+		assert.Equal(t, commentIds(fromDb), commentIds(fromSlice))
+		assert.Equal(t, pages[1], commentIds(fromSlice))
+		assert.Equal(t, dbPage, slicePage)
+	}
+
+	_, _, exception := PaginateSlice(all, PageQuery{Cursor: "nope"})
+	assert.ErrorIs(t, exception, ErrInvalidCursor)
+}
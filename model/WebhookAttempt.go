@@ -0,0 +1,64 @@
+package model
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// WebhookAttempt is one request sent to a receiver, kept as the delivery log of its subscription
+type WebhookAttempt struct {
+	Id             uint64 `gorm:"column:wa_id;primary_key:true" json:"id"`
+	SubscriptionId uint32 `gorm:"column:fk_subscription_id;index" json:"subscriptionId"`
+
+	// Both 0 for test events
+	DeliveryId uint64 `gorm:"column:fk_delivery_id" json:"deliveryId"`
+	EventId    uint64 `gorm:"column:fk_event_id" json:"eventId"`
+
+	EventType string `gorm:"column:wa_event_type;size:32" json:"eventType"`
+
+	// HTTP status the receiver answered with, 0 when it didn't answer at all
+	StatusCode int    `gorm:"column:wa_status_code" json:"statusCode"`
+	Success    bool   `gorm:"column:wa_success" json:"success"`
+	Error      string `gorm:"column:wa_error;size:255" json:"error,omitempty"`
+
+	// How long the receiver took to answer, in milliseconds
+	LatencyMs int64 `gorm:"column:wa_latency_ms" json:"latencyMs"`
+
+	CreatedAt time.Time `gorm:"column:wa_created_at;index" json:"createdAt"`
+}
+
+func (attempt *WebhookAttempt) TableName() string {
+	return "webhook_attempts"
+}
+
+// Record stores the attempt, cutting the error down to the size of its column
+func (attempt *WebhookAttempt) Record(gormDb *gorm.DB) error {
+	if len(attempt.Error) > 255 {
+		attempt.Error = attempt.Error[:255]
+	}
+
+	return gormDb.Create(attempt).Error
+}
+
+// GetBySubscriptionId lists the latest attempts sent to a subscription, newest first
+func (attempt *WebhookAttempt) GetBySubscriptionId(gormDb *gorm.DB, subscriptionId uint32, limit int) ([]*WebhookAttempt, error) {
+	attempts := []*WebhookAttempt{}
+
+	exception := gormDb.Model(&WebhookAttempt{}).
+		Where("fk_subscription_id", subscriptionId).
+		Order("wa_id DESC").
+		Limit(limit).
+		Find(&attempts).
+		Error
+
+	return attempts, exception
+}
+
+// DeleteBefore removes the attempts older than the given time, returning how many it removed
+func (attempt *WebhookAttempt) DeleteBefore(gormDb *gorm.DB, before time.Time) (int64, error) {
+	result := gormDb.Where("wa_created_at < ?", before).
+		Delete(&WebhookAttempt{})
+
+	return result.RowsAffected, result.Error
+}
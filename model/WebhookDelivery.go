@@ -0,0 +1,155 @@
+package model
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// Delivery states, dead ones ran out of attempts and are left for someone to look at
+const (
+	DeliveryPending   = "pending"
+	DeliveryDelivered = "delivered"
+	DeliveryDead      = "dead"
+)
+
+// WebhookDelivery is one event on its way to one subscription, retried until it gets through or runs out of attempts.
+// Subscription 0 is the receiver set up in the environment, which gets every event.
+type WebhookDelivery struct {
+	Id             uint64 `gorm:"column:wd_id;primary_key:true" json:"id"`
+	EventId        uint64 `gorm:"column:fk_event_id;uniqueIndex:idx_webhook_delivery" json:"eventId"`
+	SubscriptionId uint32 `gorm:"column:fk_subscription_id;uniqueIndex:idx_webhook_delivery" json:"subscriptionId"`
+
+	Status   string `gorm:"column:wd_status;size:16;not null;default:pending;index:idx_webhook_due,priority:1" json:"status"`
+	Attempts uint32 `gorm:"column:wd_attempts;not null;default:0" json:"attempts"`
+
+	// Pending deliveries are sent once this has passed, moved ahead while one is being sent and after every failure
+	NextAttemptAt time.Time `gorm:"column:wd_next_attempt_at;index:idx_webhook_due,priority:2" json:"nextAttemptAt"`
+	LastError     string    `gorm:"column:wd_last_error;size:255" json:"lastError"`
+
+	CreatedAt   time.Time  `gorm:"column:wd_created_at" json:"createdAt"`
+	DeliveredAt *time.Time `gorm:"column:wd_delivered_at" json:"deliveredAt"`
+}
+
+func (delivery *WebhookDelivery) TableName() string {
+	return "webhook_deliveries"
+}
+
+// newWebhookDelivery builds a pending delivery, due right away
+func newWebhookDelivery(eventId uint64, subscriptionId uint32, now time.Time) *WebhookDelivery {
+	return &WebhookDelivery{
+		EventId:        eventId,
+		SubscriptionId: subscriptionId,
+		Status:         DeliveryPending,
+		NextAttemptAt:  now,
+		CreatedAt:      now,
+	}
+}
+
+// FindDue loads up to limit pending deliveries whose next attempt is due, oldest first
+func (delivery *WebhookDelivery) FindDue(gormDb *gorm.DB, now time.Time, limit int) ([]*WebhookDelivery, error) {
+	var deliveries []*WebhookDelivery
+
+	exception := gormDb.Model(&WebhookDelivery{}).
+		Where("wd_status", DeliveryPending).
+		Where("wd_next_attempt_at <= ?", now).
+		Order("wd_next_attempt_at ASC").
+		Order("wd_id ASC").
+		Limit(limit).
+		Find(&deliveries).
+		Error
+
+	return deliveries, exception
+}
+
+// Claim moves the next attempt of a due delivery to until, returning false when another dispatcher got to it first.
+// Should the dispatcher die while sending, the delivery is due again once the claim runs out.
+func (delivery *WebhookDelivery) Claim(gormDb *gorm.DB, until time.Time) (bool, error) {
+	result := gormDb.Model(&WebhookDelivery{}).
+		Where("wd_id", delivery.Id).
+		Where("wd_status", DeliveryPending).
+		Where("wd_next_attempt_at", delivery.NextAttemptAt).
+		UpdateColumn("wd_next_attempt_at", until)
+
+	if result.Error != nil {
+		return false, result.Error
+	}
+
+	if result.RowsAffected == 0 {
+		return false, nil
+	}
+
+	delivery.NextAttemptAt = until
+	return true, nil
+}
+
+// MarkDelivered records a successful attempt
+func (delivery *WebhookDelivery) MarkDelivered(gormDb *gorm.DB) error {
+	now := gormDb.NowFunc()
+
+	delivery.Status = DeliveryDelivered
+	delivery.Attempts++
+	delivery.LastError = ""
+	delivery.DeliveredAt = &now
+
+	return gormDb.Model(&WebhookDelivery{}).
+		Where("wd_id", delivery.Id).
+		UpdateColumns(map[string]interface{}{
+			"wd_status":       delivery.Status,
+			"wd_attempts":     delivery.Attempts,
+			"wd_last_error":   delivery.LastError,
+			"wd_delivered_at": now,
+		}).
+		Error
+}
+
+// MarkFailed records a failed attempt, the delivery is tried again at next or, when next is nil, given up on
+func (delivery *WebhookDelivery) MarkFailed(gormDb *gorm.DB, reason string, next *time.Time) error {
+	if len(reason) > 255 {
+		reason = reason[:255]
+	}
+
+	delivery.Attempts++
+	delivery.LastError = reason
+
+	changes := map[string]interface{}{
+		"wd_attempts":   delivery.Attempts,
+		"wd_last_error": reason,
+	}
+
+	if next != nil {
+		delivery.NextAttemptAt = *next
+		changes["wd_next_attempt_at"] = *next
+	} else {
+		delivery.Status = DeliveryDead
+		changes["wd_status"] = DeliveryDead
+	}
+
+	return gormDb.Model(&WebhookDelivery{}).
+		Where("wd_id", delivery.Id).
+		UpdateColumns(changes).
+		Error
+}
+
+// Drop gives up on a delivery without attempting it, when its subscription was paused or removed
+func (delivery *WebhookDelivery) Drop(gormDb *gorm.DB, reason string) error {
+	delivery.Status = DeliveryDead
+	delivery.LastError = reason
+
+	return gormDb.Model(&WebhookDelivery{}).
+		Where("wd_id", delivery.Id).
+		UpdateColumns(map[string]interface{}{
+			"wd_status":     DeliveryDead,
+			"wd_last_error": reason,
+		}).
+		Error
+}
+
+// DeleteDelivered removes the deliveries that got through before the given time, returning how many it removed
+func (delivery *WebhookDelivery) DeleteDelivered(gormDb *gorm.DB, before time.Time) (int64, error) {
+	result := gormDb.Where("wd_status", DeliveryDelivered).
+		Where("wd_delivered_at < ?", before).
+		Delete(&WebhookDelivery{})
+
+	return result.RowsAffected, result.Error
+}
@@ -0,0 +1,152 @@
+package model
+
+import (
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// EventTypes lists every type of outbox event, the ones a subscription can filter on
+var EventTypes = []string{
+	EventCommentCreated,
+	EventCommentUpdated,
+	EventCommentDeleted,
+	EventCommentRestored,
+	EventReactionAdded,
+	EventReactionRemoved,
+}
+
+// WebhookSubscription is a receiver a user registered for the events about their comments
+type WebhookSubscription struct {
+	Id     uint32 `gorm:"column:ws_id;primary_key:true" json:"id"`
+	UserId uint32 `gorm:"column:fk_user_id;index" json:"userId"`
+	Url    string `gorm:"column:ws_url;size:2048;not null" json:"url"`
+
+	// Comma separated in the column, every type when empty
+	EventTypes string   `gorm:"column:ws_event_types;size:255" json:"-"`
+	Events     []string `gorm:"-" json:"events"`
+
+	// Signs the requests, only ever shown when the subscription is created or given a new one
+	Secret string `gorm:"column:ws_secret;size:255;not null" json:"secret,omitempty"`
+
+	// Paused subscriptions get nothing, not even later on
+	Active bool `gorm:"column:ws_active;not null" json:"active"`
+
+	CreatedAt time.Time `gorm:"column:ws_created_at" json:"createdAt"`
+	UpdatedAt time.Time `gorm:"column:ws_updated_at" json:"updatedAt"`
+}
+
+func (subscription *WebhookSubscription) TableName() string {
+	return "webhook_subscriptions"
+}
+
+// BeforeSave joins the event filter into its column
+func (subscription *WebhookSubscription) BeforeSave(tx *gorm.DB) error {
+	subscription.EventTypes = strings.Join(subscription.Events, ",")
+	return nil
+}
+
+// AfterFind splits the event filter out of its column
+func (subscription *WebhookSubscription) AfterFind(tx *gorm.DB) error {
+	subscription.Events = []string{}
+	if subscription.EventTypes != "" {
+		subscription.Events = strings.Split(subscription.EventTypes, ",")
+	}
+	return nil
+}
+
+// Matches tells whether the subscription wants events of the type
+func (subscription *WebhookSubscription) Matches(eventType string) bool {
+	if len(subscription.Events) == 0 {
+		return true
+	}
+
+	for _, candidate := range subscription.Events {
+		if candidate == eventType {
+			return true
+		}
+	}
+
+	return false
+}
+
+func (subscription *WebhookSubscription) FindById(gormDb *gorm.DB, subscriptionId uint32) error {
+	return gormDb.Model(&subscription).
+		First(&subscription, subscriptionId).
+		Error
+}
+
+// FindByIds loads the subscriptions with the given ids, in no particular order
+func (subscription *WebhookSubscription) FindByIds(gormDb *gorm.DB, ids []uint32) ([]*WebhookSubscription, error) {
+	var subscriptions []*WebhookSubscription
+
+	if len(ids) == 0 {
+		return subscriptions, nil
+	}
+
+	exception := gormDb.Model(&WebhookSubscription{}).
+		Where("ws_id IN ?", ids).
+		Find(&subscriptions).
+		Error
+
+	return subscriptions, exception
+}
+
+// GetByUserId lists the subscriptions of a user, oldest first
+func (subscription *WebhookSubscription) GetByUserId(gormDb *gorm.DB, userId uint32) ([]*WebhookSubscription, error) {
+	subscriptions := []*WebhookSubscription{}
+
+	exception := gormDb.Model(&WebhookSubscription{}).
+		Where("fk_user_id", userId).
+		Order("ws_id ASC").
+		Find(&subscriptions).
+		Error
+
+	return subscriptions, exception
+}
+
+// FindActiveByUserIds loads the subscriptions of the users that aren't paused
+func (subscription *WebhookSubscription) FindActiveByUserIds(gormDb *gorm.DB, userIds []uint32) ([]*WebhookSubscription, error) {
+	var subscriptions []*WebhookSubscription
+
+	exception := gormDb.Model(&WebhookSubscription{}).
+		Where("fk_user_id IN ?", userIds).
+		Where("ws_active", true).
+		Find(&subscriptions).
+		Error
+
+	return subscriptions, exception
+}
+
+// Update saves the url, the event filter, the secret and the state of the subscription
+func (subscription *WebhookSubscription) Update(gormDb *gorm.DB) error {
+	return gormDb.Model(&subscription).
+		Select("ws_url", "ws_event_types", "ws_secret", "ws_active", "ws_updated_at").
+		Updates(subscription).
+		Error
+}
+
+// Delete removes a subscription with its deliveries and their log
+func (subscription *WebhookSubscription) Delete(gormDb *gorm.DB, subscriptionId uint32) error {
+	return gormDb.Transaction(func(tx *gorm.DB) error {
+		if exception := tx.Where("fk_subscription_id", subscriptionId).Delete(&WebhookAttempt{}).Error; exception != nil {
+			return exception
+		}
+
+		if exception := tx.Where("fk_subscription_id", subscriptionId).Delete(&WebhookDelivery{}).Error; exception != nil {
+			return exception
+		}
+
+		result := tx.Delete(&WebhookSubscription{}, subscriptionId)
+		if result.Error != nil {
+			return result.Error
+		}
+
+		if result.RowsAffected == 0 {
+			return gorm.ErrRecordNotFound
+		}
+
+		return nil
+	})
+}
@@ -0,0 +1,46 @@
+package moderation
+
+import (
+	"strings"
+	"unicode"
+)
+
+// BlockedWords flags bodies containing any word of a configured list, ignoring case
+type BlockedWords struct {
+	words map[string]struct{}
+}
+
+func NewBlockedWords(words []string) *BlockedWords {
+	filter := &BlockedWords{words: make(map[string]struct{}, len(words))}
+
+	for _, word := range words {
+		if word = strings.ToLower(strings.TrimSpace(word)); word != "" {
+			filter.words[word] = struct{}{}
+		}
+	}
+
+	return filter
+}
+
+func (f *BlockedWords) Name() string {
+	return "blocked_words"
+}
+
+func (f *BlockedWords) Check(body string) (string, bool) {
+	if len(f.words) == 0 {
+		return "", false
+	}
+
+	// Whole words only, so "class" doesn't trip over "ass"
+	for _, word := range strings.FieldsFunc(strings.ToLower(body), isSeparator) {
+		if _, isBlocked := f.words[word]; isBlocked {
+			return "contains the blocked word \"" + word + "\"", true
+		}
+	}
+
+	return "", false
+}
+
+func isSeparator(char rune) bool {
+	return !unicode.IsLetter(char) && !unicode.IsNumber(char)
+}
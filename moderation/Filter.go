@@ -0,0 +1,15 @@
+package moderation
+
+// Filter screens a comment body, returning why it was flagged
+type Filter interface {
+	// Name identifies the filter in the review queue
+	Name() string
+
+	Check(body string) (reason string, flagged bool)
+}
+
+// Flag is a reason a Filter held a comment back
+type Flag struct {
+	Filter string
+	Reason string
+}
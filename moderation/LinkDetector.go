@@ -0,0 +1,28 @@
+package moderation
+
+import (
+	"regexp"
+)
+
+// Scheme links, www. hosts and bare domains on common top level domains
+var linkPattern = regexp.MustCompile(`(?i)\b(?:[a-z][a-z0-9+.-]*://\S+|www\.\S+|[a-z0-9-]+(?:\.[a-z0-9-]+)*\.(?:com|net|org|io|info|biz|ru|cn|xyz|top|co|me|ly|gg)\b)`)
+
+// LinkDetector flags bodies containing links or URLs
+type LinkDetector struct {
+}
+
+func NewLinkDetector() *LinkDetector {
+	return &LinkDetector{}
+}
+
+func (f *LinkDetector) Name() string {
+	return "links"
+}
+
+func (f *LinkDetector) Check(body string) (string, bool) {
+	if link := linkPattern.FindString(body); link != "" {
+		return "contains the link \"" + link + "\"", true
+	}
+
+	return "", false
+}
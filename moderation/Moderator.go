@@ -0,0 +1,75 @@
+package moderation
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// Moderator runs a body through every filter
+type Moderator struct {
+	filters []Filter
+}
+
+func New(filters ...Filter) *Moderator {
+	return &Moderator{filters: filters}
+}
+
+// Review returns a Flag for every filter the body trips, none means it can be published
+func (m *Moderator) Review(body string) []Flag {
+	var flags []Flag
+
+	for _, filter := range m.filters {
+		if reason, flagged := filter.Check(body); flagged {
+			flags = append(flags, Flag{Filter: filter.Name(), Reason: reason})
+		}
+	}
+
+	return flags
+}
+
+// NewFromEnv builds the default filters from the environment:
+//   - MODERATION_BLOCKED_WORDS a comma separated word list
+//   - MODERATION_LINKS "true" holds comments with links, Markdown links are allowed by default
+//   - MODERATION_CAPS_RATIO share of capitals that counts as shouting, 0.7 by default
+//   - MODERATION_MAX_REPEAT how often a character or word may repeat in a row, 10 by default
+func NewFromEnv() (*Moderator, error) {
+	var filters []Filter
+
+	if words := os.Getenv("MODERATION_BLOCKED_WORDS"); words != "" {
+		filters = append(filters, NewBlockedWords(strings.Split(words, ",")))
+	}
+
+	if value := os.Getenv("MODERATION_LINKS"); value != "" {
+		holdLinks, exception := strconv.ParseBool(value)
+		if exception != nil {
+			return nil, fmt.Errorf("invalid MODERATION_LINKS %q", value)
+		}
+		if holdLinks {
+			filters = append(filters, NewLinkDetector())
+		}
+	}
+
+	capsRatio := 0.7
+	if value := os.Getenv("MODERATION_CAPS_RATIO"); value != "" {
+		parsed, exception := strconv.ParseFloat(value, 64)
+		if exception != nil || parsed <= 0 || parsed > 1 {
+			return nil, fmt.Errorf("invalid MODERATION_CAPS_RATIO %q", value)
+		}
+		capsRatio = parsed
+	}
+
+	maxRepeat := 10
+	if value := os.Getenv("MODERATION_MAX_REPEAT"); value != "" {
+		parsed, exception := strconv.Atoi(value)
+		if exception != nil || parsed < 1 {
+			return nil, fmt.Errorf("invalid MODERATION_MAX_REPEAT %q", value)
+		}
+		maxRepeat = parsed
+	}
+
+	filters = append(filters, NewShouting(capsRatio, 12, maxRepeat))
+
+	return New(filters...), nil
+}
@@ -0,0 +1,73 @@
+package moderation
+
+import (
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFilters(t *testing.T) {
+
+	tests := []struct {
+		name        string
+		filter      Filter
+		body        string
+		wantFlagged bool
+	}{
+		{"Blocked word", NewBlockedWords([]string{"Spam", " eggs "}), "I like spam!", true},
+		{"Blocked word ignores case", NewBlockedWords([]string{"spam"}), "SPAM", true},
+		{"Blocked word needs the whole word", NewBlockedWords([]string{"ass"}), "A classic", false},
+		{"No blocked words configured", NewBlockedWords(nil), "anything", false},
+		{"Scheme link", NewLinkDetector(), "see https://example.test/x", true},
+		{"www link", NewLinkDetector(), "go to www.example", true},
+		{"Bare domain", NewLinkDetector(), "buy at cheap-pills.com today", true},
+		{"No link", NewLinkDetector(), "a sentence. Another one.", false},
+		{"Shouting", NewShouting(0.7, 12, 10), "THIS IS THE BEST COMMENT EVER", true},
+		{"Short caps are fine", NewShouting(0.7, 12, 10), "OK", false},
+		{"Normal casing", NewShouting(0.7, 12, 10), "This is a Normal Comment", false},
+		{"Repeated character", NewShouting(0.7, 12, 3), "Nooooo", true},
+		{"Repeated word", NewShouting(0.7, 12, 3), "buy buy buy buy now", true},
+		{"Some repetition is fine", NewShouting(0.7, 12, 3), "Good good", false},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			reason, flagged := test.filter.Check(test.body)
+			assert.Equal(t, test.wantFlagged, flagged)
+			if flagged {
+				assert.NotEmpty(t, reason)
+			}
+		})
+	}
+}
+
+func TestModerator_Review(t *testing.T) {
+	moderator := New(NewBlockedWords([]string{"spam"}), NewLinkDetector(), NewShouting(0.7, 12, 10))
+
+	assert.Empty(t, moderator.Review("A perfectly fine comment"))
+
+	flags := moderator.Review("SPAM AT HTTP://SPAM.EXAMPLE NOW")
+	assert.Len(t, flags, 3)
+	assert.Equal(t, "blocked_words", flags[0].Filter)
+	assert.Equal(t, "links", flags[1].Filter)
+	assert.Equal(t, "shouting", flags[2].Filter)
+}
+
+func TestNewFromEnv_Links(t *testing.T) {
+	defer os.Unsetenv("MODERATION_LINKS")
+
+	// Links are part of Markdown, only held when asked for
+	moderator, exception := NewFromEnv()
+	assert.NoError(t, exception)
+	assert.Empty(t, moderator.Review("See [the docs](https://example.com)"))
+
+	_ = os.Setenv("MODERATION_LINKS", "true")
+	moderator, exception = NewFromEnv()
+	assert.NoError(t, exception)
+	assert.NotEmpty(t, moderator.Review("See [the docs](https://example.com)"))
+
+	_ = os.Setenv("MODERATION_LINKS", "sometimes")
+	_, exception = NewFromEnv()
+	assert.Error(t, exception)
+}
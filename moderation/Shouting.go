@@ -0,0 +1,81 @@
+package moderation
+
+import (
+	"fmt"
+	"strings"
+	"unicode"
+)
+
+// Shouting flags bodies written mostly in capitals or repeating the same character or word over and over
+type Shouting struct {
+	// Share of upper case letters above which a body is shouting, e.g. 0.7
+	CapsRatio float64
+
+	// Bodies with fewer letters are never shouting, "OK" is fine
+	MinLetters int
+
+	// How many times in a row a character or a word may repeat
+	MaxRepeat int
+}
+
+func NewShouting(capsRatio float64, minLetters int, maxRepeat int) *Shouting {
+	return &Shouting{
+		CapsRatio:  capsRatio,
+		MinLetters: minLetters,
+		MaxRepeat:  maxRepeat,
+	}
+}
+
+func (f *Shouting) Name() string {
+	return "shouting"
+}
+
+func (f *Shouting) Check(body string) (string, bool) {
+	letters, upper := 0, 0
+	run, previous := 0, rune(0)
+
+	for _, char := range body {
+		if unicode.IsLetter(char) {
+			letters++
+			if unicode.IsUpper(char) {
+				upper++
+			}
+		}
+
+		// Whitespace doesn't count, "aaaa    " is just one run
+		if unicode.IsSpace(char) {
+			continue
+		}
+
+		if char == previous {
+			run++
+		} else {
+			run, previous = 1, char
+		}
+
+		if f.MaxRepeat > 0 && run > f.MaxRepeat {
+			return fmt.Sprintf("repeats \"%c\" more than %d times", char, f.MaxRepeat), true
+		}
+	}
+
+	if letters >= f.MinLetters && letters > 0 && float64(upper)/float64(letters) > f.CapsRatio {
+		return fmt.Sprintf("%.0f%% of the letters are capitals", 100*float64(upper)/float64(letters)), true
+	}
+
+	if f.MaxRepeat > 0 {
+		run, previousWord := 0, ""
+		for _, word := range strings.FieldsFunc(strings.ToLower(body), isSeparator) {
+			if word == previousWord {
+				run++
+			} else {
+				run, previousWord = 1, word
+			}
+
+			if run > f.MaxRepeat {
+				return fmt.Sprintf("repeats \"%s\" more than %d times", word, f.MaxRepeat), true
+			}
+		}
+	}
+
+	return "", false
+}
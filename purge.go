@@ -0,0 +1,166 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"time"
+
+	"two-in-one/attachment"
+	"two-in-one/model"
+
+	"gorm.io/gorm"
+)
+
+const (
+	// How long soft-deleted comments are kept by default, 30 days
+	defaultRetention = 30 * 24 * time.Hour
+
+	// How many comments are purged per transaction
+	purgeBatchSize = 500
+)
+
+type purgeConfig struct {
+	// Soft-deleted comments older than this are purged
+	Retention time.Duration
+
+	// How often the server runs the purge, zero disables the schedule
+	Interval time.Duration
+}
+
+// purgeConfigFromEnv reads COMMENT_RETENTION and PURGE_INTERVAL as Go durations, e.g. "720h"
+func purgeConfigFromEnv() (*purgeConfig, error) {
+	config := &purgeConfig{Retention: defaultRetention}
+
+	if retention := os.Getenv("COMMENT_RETENTION"); retention != "" {
+		value, exception := time.ParseDuration(retention)
+		if exception != nil || value <= 0 {
+			return nil, fmt.Errorf("invalid COMMENT_RETENTION %q", retention)
+		}
+		config.Retention = value
+	}
+
+	if interval := os.Getenv("PURGE_INTERVAL"); interval != "" {
+		value, exception := time.ParseDuration(interval)
+		if exception != nil || value <= 0 {
+			return nil, fmt.Errorf("invalid PURGE_INTERVAL %q", interval)
+		}
+		config.Interval = value
+	}
+
+	return config, nil
+}
+
+// runPurge permanently deletes the comments soft-deleted for longer than the retention, with their attached files.
+// Webhook events delivered before then go too, with the delivery log.
+func runPurge(gormDb *gorm.DB, blobs attachment.BlobStore, config *purgeConfig) error {
+	before := gormDb.NowFunc().Add(-config.Retention)
+
+	var comment model.Comment
+
+	purged, exception := comment.Purge(gormDb, before, purgeBatchSize)
+
+	// Whatever made it before a failure is gone for good, so always log it
+	if len(purged) > 0 {
+		log.Printf("[Purge] Purged %d comments deleted before %s: %v", len(purged), before.Format(time.RFC3339), purged)
+	} else {
+		log.Printf("[Purge] Nothing deleted before %s to purge", before.Format(time.RFC3339))
+	}
+	if exception != nil {
+		return exception
+	}
+
+	// The files of purged comments, also the ones left over by an earlier purge that failed half way
+	if exception := purgeAttachments(gormDb, blobs); exception != nil {
+		return exception
+	}
+
+	// Expired idempotency keys go on the same schedule
+	var key model.IdempotencyKey
+
+	expired, exception := key.DeleteExpired(gormDb)
+	if expired > 0 {
+		log.Printf("[Purge] Removed %d expired idempotency keys", expired)
+	}
+	if exception != nil {
+		return exception
+	}
+
+	// So do webhook deliveries that got through as long ago as the comments, and the log of their attempts
+	var delivery model.WebhookDelivery
+
+	removed, exception := delivery.DeleteDelivered(gormDb, before)
+	if removed > 0 {
+		log.Printf("[Purge] Removed %d delivered webhook events", removed)
+	}
+	if exception != nil {
+		return exception
+	}
+
+	var attempt model.WebhookAttempt
+
+	if _, exception := attempt.DeleteBefore(gormDb, before); exception != nil {
+		return exception
+	}
+
+	// Events are kept as long as one of their deliveries is, dead ones are left for someone to look at
+	var event model.OutboxEvent
+
+	_, exception = event.DeleteDispatched(gormDb, before)
+
+	return exception
+}
+
+// purgeAttachments removes the files of comments that no longer exist, then their rows
+func purgeAttachments(gormDb *gorm.DB, blobs attachment.BlobStore) error {
+	var attachment model.CommentAttachment
+	removed := 0
+
+	for {
+		orphans, exception := attachment.FindOrphans(gormDb, purgeBatchSize)
+		if exception != nil || len(orphans) == 0 {
+			if removed > 0 {
+				log.Printf("[Purge] Removed %d attachments", removed)
+			}
+			return exception
+		}
+
+		ids := make([]uint32, 0, len(orphans))
+		for _, orphan := range orphans {
+			// The row stays when its file can't be removed, the next purge tries again
+			if exception := blobs.Delete(orphan.StorageKey); exception != nil {
+				return exception
+			}
+			ids = append(ids, orphan.Id)
+		}
+
+		if exception := attachment.DeleteByIds(gormDb, ids); exception != nil {
+			return exception
+		}
+		removed += len(ids)
+	}
+}
+
+// schedulePurge runs the purge every interval until the returned function is called
+func schedulePurge(gormDb *gorm.DB, blobs attachment.BlobStore, config *purgeConfig) (stop func()) {
+	ticker := time.NewTicker(config.Interval)
+	done := make(chan struct{})
+
+	go func() {
+		for {
+			select {
+			case <-ticker.C:
+				if exception := runPurge(gormDb, blobs, config); exception != nil {
+					log.Printf("[Purge] Failed: %s", exception.Error())
+				}
+			case <-done:
+				ticker.Stop()
+				return
+			}
+		}
+	}()
+
+	return func() {
+		close(done)
+	}
+}
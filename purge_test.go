@@ -0,0 +1,89 @@
+package main
+
+import (
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"two-in-one/attachment"
+	"two-in-one/model"
+
+	"github.com/stretchr/testify/assert"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+)
+
+func Test_purgeConfigFromEnv(t *testing.T) {
+	defer os.Unsetenv("COMMENT_RETENTION")
+	defer os.Unsetenv("PURGE_INTERVAL")
+
+	config, exception := purgeConfigFromEnv()
+	assert.NoError(t, exception)
+	assert.Equal(t, defaultRetention, config.Retention)
+	assert.Zero(t, config.Interval)
+
+	_ = os.Setenv("COMMENT_RETENTION", "48h")
+	_ = os.Setenv("PURGE_INTERVAL", "1h")
+	config, exception = purgeConfigFromEnv()
+	assert.NoError(t, exception)
+	assert.Equal(t, 48*time.Hour, config.Retention)
+	assert.Equal(t, time.Hour, config.Interval)
+
+	_ = os.Setenv("COMMENT_RETENTION", "a month")
+	_, exception = purgeConfigFromEnv()
+	assert.Error(t, exception)
+}
+
+func Test_runPurge(t *testing.T) {
+
+	// Create a mock DB
+	gormDb, _ := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{})
+
+	// Close our DB
+	defer closeConnection(gormDb)
+
+	assert.NoError(t, migrateDb(gormDb))
+
+	deletedAt := time.Now().Add(-72 * time.Hour)
+	gormDb.Create(&model.Comment{Body: "old", UserId: 1, Deleted: true, DeletedAt: &deletedAt})
+	gormDb.Create(&model.Comment{Body: "alive", UserId: 1})
+	gormDb.Create(&model.IdempotencyKey{Key: "expired", ExpiresAt: time.Now().Add(-time.Hour)})
+	gormDb.Create(&model.IdempotencyKey{Key: "fresh", ExpiresAt: time.Now().Add(time.Hour)})
+	gormDb.Create(&model.OutboxEvent{Type: model.EventCommentCreated, Status: model.OutboxDispatched, DispatchedAt: &deletedAt})
+	gormDb.Create(&model.OutboxEvent{Type: model.EventCommentDeleted, Status: model.OutboxDispatched, DispatchedAt: &deletedAt})
+	gormDb.Create(&model.WebhookDelivery{EventId: 1, SubscriptionId: 1, Status: model.DeliveryDelivered, DeliveredAt: &deletedAt})
+	gormDb.Create(&model.WebhookDelivery{EventId: 2, SubscriptionId: 1, Status: model.DeliveryDead})
+	gormDb.Create(&model.WebhookAttempt{SubscriptionId: 1, EventId: 1, CreatedAt: deletedAt})
+	gormDb.Create(&model.WebhookAttempt{SubscriptionId: 1, EventId: 2})
+
+	// The old comment had a file attached
+	blobs := attachment.NewLocalBlobStore(t.TempDir())
+	assert.NoError(t, blobs.Put("old-file", strings.NewReader("content")))
+	gormDb.Create(&model.CommentAttachment{CommentId: 1, Name: "old.txt", StorageKey: "old-file"})
+
+	assert.NoError(t, runPurge(gormDb, blobs, &purgeConfig{Retention: 48 * time.Hour}))
+
+	var count int64
+	gormDb.Model(&model.Comment{}).Count(&count)
+	assert.Equal(t, int64(1), count)
+
+	gormDb.Model(&model.IdempotencyKey{}).Count(&count)
+	assert.Equal(t, int64(1), count)
+
+	// The dead delivery keeps its event around
+	gormDb.Model(&model.OutboxEvent{}).Count(&count)
+	assert.Equal(t, int64(1), count)
+
+	gormDb.Model(&model.WebhookDelivery{}).Count(&count)
+	assert.Equal(t, int64(1), count)
+
+	gormDb.Model(&model.WebhookAttempt{}).Count(&count)
+	assert.Equal(t, int64(1), count)
+
+	gormDb.Model(&model.CommentAttachment{}).Count(&count)
+	assert.Zero(t, count)
+
+	_, exception := blobs.Get("old-file")
+	assert.ErrorIs(t, exception, attachment.ErrBlobNotFound)
+}
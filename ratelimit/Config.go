@@ -0,0 +1,164 @@
+package ratelimit
+
+import (
+	"fmt"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/labstack/echo/v4"
+)
+
+// Limit lets a client make Requests per period, all at once or spread out
+type Limit struct {
+	Requests int
+	Per      time.Duration
+}
+
+// Config holds the limit of every limited route, keyed by method and route path as in "POST /comments"
+type Config struct {
+	Limits map[string]Limit
+
+	// The proxies whose X-Forwarded-For is believed, without any the address of the connection is the client's
+	TrustedProxies []*net.IPNet
+}
+
+// The writes and the exports are limited out of the box, with room for the batch endpoints doing up to 500 comments
+// at a time
+var defaultLimits = map[string]Limit{
+	"POST /comments":                                       {Requests: 30, Per: time.Minute},
+	"POST /comments/batch":                                 {Requests: 5, Per: time.Minute},
+	"DELETE /comments/batch":                               {Requests: 5, Per: time.Minute},
+	"PATCH /comment/:commentId":                            {Requests: 30, Per: time.Minute},
+	"DELETE /comment/:commentId":                           {Requests: 30, Per: time.Minute},
+	"POST /comment/:commentId/restore":                     {Requests: 30, Per: time.Minute},
+	"POST /comment/:commentId/reactions":                   {Requests: 60, Per: time.Minute},
+	"POST /comment/:commentId/revisions/:revision/restore": {Requests: 30, Per: time.Minute},
+	"GET /users/:userId/comments/export":                   {Requests: 5, Per: time.Minute},
+	"POST /users/:userId/comments/erasure":                 {Requests: 5, Per: time.Hour},
+}
+
+// Route is the key of a route in Config.Limits
+func Route(method string, path string) string {
+	return method + " " + path
+}
+
+// ConfigFromEnv starts from the default limits and applies RATE_LIMITS, a comma separated list of
+// "<METHOD> <route>=<requests>/<period>" entries, e.g. "POST /comments=10/1m". The period is a Go duration and
+// "<METHOD> <route>=off" lifts the limit of a route. TRUSTED_PROXIES is a comma separated list of the addresses or
+// CIDR ranges of the proxies in front of the API, e.g. "10.0.0.0/8,192.168.1.10".
+func ConfigFromEnv() (*Config, error) {
+	config := &Config{Limits: make(map[string]Limit, len(defaultLimits))}
+	for route, limit := range defaultLimits {
+		config.Limits[route] = limit
+	}
+
+	proxies, exception := parseProxies(os.Getenv("TRUSTED_PROXIES"))
+	if exception != nil {
+		return nil, exception
+	}
+	config.TrustedProxies = proxies
+
+	raw := os.Getenv("RATE_LIMITS")
+	if strings.TrimSpace(raw) == "" {
+		return config, nil
+	}
+
+	for _, entry := range strings.Split(raw, ",") {
+		route, limit, exception := parseEntry(strings.TrimSpace(entry))
+		if exception != nil {
+			return nil, fmt.Errorf("invalid RATE_LIMITS entry %q", entry)
+		}
+
+		if limit == nil {
+			delete(config.Limits, route)
+		} else {
+			config.Limits[route] = *limit
+		}
+	}
+
+	return config, nil
+}
+
+// parseEntry reads one entry of RATE_LIMITS, the limit is nil for "off"
+func parseEntry(entry string) (string, *Limit, error) {
+	index := strings.LastIndex(entry, "=")
+	if index < 0 {
+		return "", nil, fmt.Errorf("missing limit")
+	}
+
+	fields := strings.Fields(entry[:index])
+	if len(fields) != 2 || !strings.HasPrefix(fields[1], "/") {
+		return "", nil, fmt.Errorf("invalid route")
+	}
+	route := Route(strings.ToUpper(fields[0]), fields[1])
+
+	value := strings.TrimSpace(entry[index+1:])
+	if value == "off" {
+		return route, nil, nil
+	}
+
+	parts := strings.SplitN(value, "/", 2)
+	if len(parts) != 2 {
+		return "", nil, fmt.Errorf("invalid limit")
+	}
+
+	requests, exception := strconv.Atoi(parts[0])
+	if exception != nil || requests < 1 {
+		return "", nil, fmt.Errorf("invalid requests")
+	}
+
+	per, exception := time.ParseDuration(parts[1])
+	if exception != nil || per <= 0 {
+		return "", nil, fmt.Errorf("invalid period")
+	}
+
+	return route, &Limit{Requests: requests, Per: per}, nil
+}
+
+// parseProxies reads TRUSTED_PROXIES, a single address is a range of its own
+func parseProxies(raw string) ([]*net.IPNet, error) {
+	var proxies []*net.IPNet
+
+	for _, entry := range strings.Split(raw, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+
+		if ip := net.ParseIP(entry); ip != nil {
+			bits := 8 * net.IPv6len
+			if ip.To4() != nil {
+				ip, bits = ip.To4(), 8*net.IPv4len
+			}
+			proxies = append(proxies, &net.IPNet{IP: ip, Mask: net.CIDRMask(bits, bits)})
+			continue
+		}
+
+		_, proxy, exception := net.ParseCIDR(entry)
+		if exception != nil {
+			return nil, fmt.Errorf("invalid TRUSTED_PROXIES entry %q", entry)
+		}
+		proxies = append(proxies, proxy)
+	}
+
+	return proxies, nil
+}
+
+// IPExtractor tells echo where the address of the client comes from. Behind trusted proxies it is the last address
+// of X-Forwarded-For none of them added, otherwise the headers are set by the client and only the connection counts.
+func (config *Config) IPExtractor() echo.IPExtractor {
+	if len(config.TrustedProxies) == 0 {
+		return echo.ExtractIPDirect()
+	}
+
+	// Only the listed proxies, not every private or loopback address echo trusts out of the box
+	options := []echo.TrustOption{echo.TrustLoopback(false), echo.TrustLinkLocal(false), echo.TrustPrivateNet(false)}
+	for _, proxy := range config.TrustedProxies {
+		options = append(options, echo.TrustIPRange(proxy))
+	}
+
+	return echo.ExtractIPFromXFFHeader(options...)
+}
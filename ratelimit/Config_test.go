@@ -0,0 +1,67 @@
+package ratelimit
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestConfigFromEnv(t *testing.T) {
+	defer os.Unsetenv("RATE_LIMITS")
+
+	config, exception := ConfigFromEnv()
+	assert.NoError(t, exception)
+	assert.Equal(t, defaultLimits, config.Limits)
+
+	_ = os.Setenv("RATE_LIMITS", "post /comments=10/1m, GET /comments/search=100/10s,PATCH /comment/:commentId=off")
+	config, exception = ConfigFromEnv()
+	assert.NoError(t, exception)
+	assert.Equal(t, Limit{Requests: 10, Per: time.Minute}, config.Limits["POST /comments"])
+	assert.Equal(t, Limit{Requests: 100, Per: 10 * time.Second}, config.Limits["GET /comments/search"])
+	assert.NotContains(t, config.Limits, "PATCH /comment/:commentId")
+
+	// The defaults stay as they were
+	assert.Equal(t, Limit{Requests: 30, Per: time.Minute}, defaultLimits["POST /comments"])
+	assert.Equal(t, Limit{Requests: 5, Per: time.Minute}, config.Limits["POST /comments/batch"])
+
+	for _, invalid := range []string{"POST /comments", "POST comments=1/1m", "/comments=1/1m", "POST /comments=0/1m", "POST /comments=5/soon", "POST /comments=5"} {
+		_ = os.Setenv("RATE_LIMITS", invalid)
+		_, exception = ConfigFromEnv()
+		assert.Error(t, exception, invalid)
+	}
+}
+
+func TestConfig_IPExtractor(t *testing.T) {
+	defer os.Unsetenv("TRUSTED_PROXIES")
+
+	request := httptest.NewRequest(http.MethodGet, "/comments", nil)
+	request.RemoteAddr = "10.0.0.2:4321"
+	request.Header.Set(echo.HeaderXForwardedFor, "203.0.113.7, 198.51.100.1")
+	request.Header.Set(echo.HeaderXRealIP, "198.51.100.1")
+
+	// Without trusted proxies the headers are the client's word
+	config, exception := ConfigFromEnv()
+	require.NoError(t, exception)
+	assert.Equal(t, "10.0.0.2", config.IPExtractor()(request))
+
+	// Behind them the last address they didn't add is the client
+	_ = os.Setenv("TRUSTED_PROXIES", "10.0.0.0/24, 198.51.100.1")
+	config, exception = ConfigFromEnv()
+	require.NoError(t, exception)
+	assert.Len(t, config.TrustedProxies, 2)
+	assert.Equal(t, "203.0.113.7", config.IPExtractor()(request))
+
+	// A connection from anywhere else is the client
+	request.RemoteAddr = "192.168.1.5:4321"
+	assert.Equal(t, "192.168.1.5", config.IPExtractor()(request))
+
+	_ = os.Setenv("TRUSTED_PROXIES", "10.0.0.0/33")
+	_, exception = ConfigFromEnv()
+	assert.Error(t, exception)
+}
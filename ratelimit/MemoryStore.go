@@ -0,0 +1,82 @@
+package ratelimit
+
+import (
+	"sync"
+	"time"
+)
+
+// How often full buckets are cleared out, a missing bucket is the same as a full one
+const sweepInterval = time.Minute
+
+// MemoryStore keeps the buckets in the memory of the process, each instance of the API limits on its own
+type MemoryStore struct {
+	sync.Mutex
+	buckets   map[string]*bucket
+	lastSweep time.Time
+}
+
+type bucket struct {
+	tokens  float64
+	updated time.Time
+
+	// When the bucket is full again if nothing is taken from it
+	fullAt time.Time
+}
+
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{buckets: map[string]*bucket{}}
+}
+
+func (s *MemoryStore) Take(key string, limit Limit, now time.Time) (*Result, error) {
+	s.Lock()
+	defer s.Unlock()
+
+	s.sweep(now)
+
+	capacity := float64(limit.Requests)
+	perSecond := capacity / limit.Per.Seconds()
+
+	current := s.buckets[key]
+	if current == nil {
+		current = &bucket{tokens: capacity, updated: now}
+		s.buckets[key] = current
+	} else if elapsed := now.Sub(current.updated); elapsed > 0 {
+		current.tokens += elapsed.Seconds() * perSecond
+		if current.tokens > capacity {
+			current.tokens = capacity
+		}
+		current.updated = now
+	}
+
+	result := &Result{}
+	if current.tokens >= 1 {
+		current.tokens--
+		result.Allowed = true
+	} else {
+		result.RetryAfter = seconds((1 - current.tokens) / perSecond)
+	}
+
+	result.Remaining = int(current.tokens)
+	result.Reset = seconds((capacity - current.tokens) / perSecond)
+	current.fullAt = now.Add(result.Reset)
+
+	return result, nil
+}
+
+// sweep drops the buckets that filled up again, once per sweepInterval
+func (s *MemoryStore) sweep(now time.Time) {
+	if now.Sub(s.lastSweep) < sweepInterval {
+		return
+	}
+	s.lastSweep = now
+
+	for key, current := range s.buckets {
+		if !now.Before(current.fullAt) {
+			delete(s.buckets, key)
+		}
+	}
+}
+
+func seconds(value float64) time.Duration {
+	return time.Duration(value * float64(time.Second))
+}
@@ -0,0 +1,66 @@
+package ratelimit
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMemoryStore_Take(t *testing.T) {
+	store := NewMemoryStore()
+	limit := Limit{Requests: 3, Per: 3 * time.Second}
+	now := time.Now()
+
+	// The bucket starts full
+	for remaining := 2; remaining >= 0; remaining-- {
+		result, exception := store.Take("client", limit, now)
+		require.NoError(t, exception)
+		assert.True(t, result.Allowed)
+		assert.Equal(t, remaining, result.Remaining)
+	}
+
+	result, exception := store.Take("client", limit, now)
+	require.NoError(t, exception)
+	assert.False(t, result.Allowed)
+	assert.Equal(t, time.Second, result.RetryAfter)
+	assert.Equal(t, 3*time.Second, result.Reset)
+
+	// Other keys have their own bucket
+	result, exception = store.Take("someone else", limit, now)
+	require.NoError(t, exception)
+	assert.True(t, result.Allowed)
+
+	// One token a second comes back
+	result, exception = store.Take("client", limit, now.Add(1500*time.Millisecond))
+	require.NoError(t, exception)
+	assert.True(t, result.Allowed)
+	assert.Equal(t, 0, result.Remaining)
+	assert.Equal(t, 2500*time.Millisecond, result.Reset)
+
+	result, exception = store.Take("client", limit, now.Add(1600*time.Millisecond))
+	require.NoError(t, exception)
+	assert.False(t, result.Allowed)
+	assert.Equal(t, 400*time.Millisecond, result.RetryAfter)
+
+	// And it never holds more than the limit
+	result, exception = store.Take("client", limit, now.Add(time.Hour))
+	require.NoError(t, exception)
+	assert.Equal(t, 2, result.Remaining)
+}
+
+func TestMemoryStore_Sweep(t *testing.T) {
+	store := NewMemoryStore()
+	limit := Limit{Requests: 1, Per: time.Second}
+	now := time.Now()
+
+	_, _ = store.Take("full again", limit, now)
+	_, _ = store.Take("slow", Limit{Requests: 1, Per: time.Hour}, now)
+
+	// Only the bucket that filled up again is dropped
+	_, _ = store.Take("new", limit, now.Add(sweepInterval))
+	assert.Len(t, store.buckets, 2)
+	assert.Contains(t, store.buckets, "slow")
+	assert.NotContains(t, store.buckets, "full again")
+}
@@ -0,0 +1,27 @@
+package ratelimit
+
+import (
+	"time"
+)
+
+// Store keeps the token buckets of the clients. Instances of the API only share their limits through a store
+// backed by a shared service.
+type Store interface {
+	// Take takes a token from the bucket under the key, which refills at the pace of the limit and holds at most
+	// limit.Requests tokens. A new bucket starts full.
+	Take(key string, limit Limit, now time.Time) (*Result, error)
+}
+
+// Result says whether a request may go ahead and how the bucket it was taken from stands
+type Result struct {
+	Allowed bool
+
+	// Whole tokens left in the bucket
+	Remaining int
+
+	// Until the bucket is full again
+	Reset time.Duration
+
+	// Until the next token, only set when the request was refused
+	RetryAfter time.Duration
+}
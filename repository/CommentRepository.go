@@ -0,0 +1,57 @@
+package repository
+
+import (
+	"two-in-one/model"
+)
+
+// CommentRepository reads and writes comments. Missing comments are reported as gorm.ErrRecordNotFound
+// and writes based on a stale version as model.ErrVersionConflict, whatever the storage.
+type CommentRepository interface {
+	// FindById loads a live comment
+	FindById(commentId uint32) (*model.Comment, error)
+
+	// FindForWrite loads a live comment as it is stored right now, for the checks ahead of a write
+	FindForWrite(commentId uint32) (*model.Comment, error)
+
+	// FindDeletedById loads a soft-deleted comment
+	FindDeletedById(commentId uint32) (*model.Comment, error)
+
+	// FindByIds loads the live comments among the ids, in no particular order
+	FindByIds(commentIds []uint32) ([]*model.Comment, error)
+
+	// ListByUserId returns one keyset page of the live comments of a user
+	ListByUserId(userId uint32, query model.ListQuery) ([]*model.Comment, *model.Page, error)
+
+	// Create inserts the comments with their flags and attachments and bumps the reply count of their parents, all or nothing.
+	// Parents have to be live and published.
+	Create(comments []*model.Comment) error
+
+	// UpdateBody replaces the body of a live comment at the given version, 0 takes whatever version it is at.
+	// Flags send the comment back to the moderation queue.
+	UpdateBody(commentId uint32, body string, editorId uint32, version uint32, flags []*model.ModerationFlag) error
+
+	// Delete soft-deletes a live comment at the given version, 0 takes whatever version it is at
+	Delete(commentId uint32, version uint32) error
+
+	// DeleteMany soft-deletes the live comments among the ids, returning the ones it deleted as they are now.
+	// When atomic it deletes nothing unless all of them are still live.
+	DeleteMany(commentIds []uint32, atomic bool) ([]*model.Comment, error)
+
+	// Restore undoes a soft delete
+	Restore(commentId uint32) error
+
+	// ToggleReaction adds the reaction of a user to a comment, or takes it back, telling which it did
+	ToggleReaction(commentId uint32, userId uint32, reactionType string) (bool, error)
+
+	// LoadReactions fills in the reaction counts of the comments and which of them are the viewer's, 0 is anonymous
+	LoadReactions(comments []*model.Comment, viewerId uint32) error
+
+	// AddAttachments attaches more files to a live comment
+	AddAttachments(commentId uint32, attachments []*model.CommentAttachment) error
+
+	// LoadAttachments fills in the attachments of the comments
+	LoadAttachments(comments []*model.Comment) error
+
+	// FindAttachment loads an attachment of a comment
+	FindAttachment(commentId uint32, attachmentId uint32) (*model.CommentAttachment, error)
+}
@@ -0,0 +1,308 @@
+package repository
+
+import (
+	"sync"
+	"testing"
+
+	"two-in-one/model"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+)
+
+// implementations are run through the same tests, both have to behave alike
+var implementations = map[string]func(t *testing.T) CommentRepository{
+	"gorm": func(t *testing.T) CommentRepository {
+		gormDb, exception := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{})
+		require.NoError(t, exception)
+
+		// Every connection to ":memory:" is a separate database
+		sqlDb, _ := gormDb.DB()
+		sqlDb.SetMaxOpenConns(1)
+
+		require.NoError(t, gormDb.AutoMigrate(&model.Comment{}, &model.CommentRevision{}, &model.ModerationFlag{}, &model.CommentReaction{}, &model.CommentMention{}, &model.CommentAttachment{}, &model.OutboxEvent{}, &model.WebhookSubscription{}, &model.WebhookDelivery{}, &model.WebhookAttempt{}))
+
+		t.Cleanup(func() {
+			_ = sqlDb.Close()
+		})
+
+		return NewGormCommentRepository(gormDb)
+	},
+	"memory": func(t *testing.T) CommentRepository {
+		return NewMemoryCommentRepository()
+	},
+}
+
+func forEach(t *testing.T, test func(t *testing.T, repo CommentRepository)) {
+	for name, open := range implementations {
+		t.Run(name, func(t *testing.T) {
+			test(t, open(t))
+		})
+	}
+}
+
+func create(t *testing.T, repo CommentRepository, comments ...*model.Comment) {
+	require.NoError(t, repo.Create(comments))
+}
+
+func TestCommentRepository_Create(t *testing.T) {
+	forEach(t, func(t *testing.T, repo CommentRepository) {
+		parent := &model.Comment{Body: "parent", UserId: 1}
+		create(t, repo, parent)
+		assert.NotZero(t, parent.Id)
+
+		first := &model.Comment{Body: "first", UserId: 2, ParentId: &parent.Id}
+		second := &model.Comment{Body: "second", UserId: 2, ParentId: &parent.Id}
+		create(t, repo, first, second)
+
+		loaded, exception := repo.FindById(parent.Id)
+		require.NoError(t, exception)
+		assert.Equal(t, uint32(2), loaded.ReplyCount)
+		assert.Equal(t, model.StatusPublished, loaded.Status)
+		assert.Equal(t, uint32(1), loaded.Version)
+
+		// A pending parent can't be replied to, and nothing of the batch is written
+		pending := &model.Comment{Body: "pending", UserId: 1, Status: model.StatusPending}
+		create(t, repo, pending)
+
+		exception = repo.Create([]*model.Comment{
+			{Body: "fine", UserId: 2, ParentId: &parent.Id},
+			{Body: "not fine", UserId: 2, ParentId: &pending.Id},
+		})
+		assert.ErrorIs(t, exception, gorm.ErrRecordNotFound)
+
+		loaded, exception = repo.FindById(parent.Id)
+		require.NoError(t, exception)
+		assert.Equal(t, uint32(2), loaded.ReplyCount)
+	})
+}
+
+func TestCommentRepository_FindByIds(t *testing.T) {
+	forEach(t, func(t *testing.T, repo CommentRepository) {
+		first := &model.Comment{Body: "first", UserId: 1}
+		second := &model.Comment{Body: "second", UserId: 1}
+		create(t, repo, first, second)
+		require.NoError(t, repo.Delete(second.Id, 0))
+
+		comments, exception := repo.FindByIds([]uint32{first.Id, second.Id, 999})
+		require.NoError(t, exception)
+		require.Len(t, comments, 1)
+		assert.Equal(t, first.Id, comments[0].Id)
+
+		_, exception = repo.FindById(second.Id)
+		assert.ErrorIs(t, exception, gorm.ErrRecordNotFound)
+
+		deleted, exception := repo.FindDeletedById(second.Id)
+		require.NoError(t, exception)
+		assert.True(t, deleted.Deleted)
+	})
+}
+
+func TestCommentRepository_ListByUserId(t *testing.T) {
+	forEach(t, func(t *testing.T, repo CommentRepository) {
+		for i := 0; i < 5; i++ {
+			create(t, repo, &model.Comment{Body: "mine", UserId: 1})
+		}
+		create(t, repo, &model.Comment{Body: "someone else's", UserId: 2})
+		create(t, repo, &model.Comment{Body: "held", UserId: 1, Status: model.StatusPending})
+
+		comments, page, exception := repo.ListByUserId(1, model.ListQuery{
+			PageQuery: model.PageQuery{Limit: 2, IncludeTotal: true},
+			Status:    model.StatusPublished,
+		})
+		require.NoError(t, exception)
+		require.Len(t, comments, 2)
+		assert.Equal(t, int64(5), *page.Total)
+		assert.NotEmpty(t, page.NextCursor)
+
+		next, _, exception := repo.ListByUserId(1, model.ListQuery{
+			PageQuery: model.PageQuery{Limit: 2, Cursor: page.NextCursor},
+			Status:    model.StatusPublished,
+		})
+		require.NoError(t, exception)
+		require.Len(t, next, 2)
+		assert.Greater(t, next[0].Id, comments[1].Id)
+
+		all, _, exception := repo.ListByUserId(1, model.ListQuery{})
+		require.NoError(t, exception)
+		assert.Len(t, all, 6)
+	})
+}
+
+func TestCommentRepository_UpdateBody(t *testing.T) {
+	forEach(t, func(t *testing.T, repo CommentRepository) {
+		comment := &model.Comment{Body: "before", UserId: 1}
+		create(t, repo, comment)
+
+		require.NoError(t, repo.UpdateBody(comment.Id, "after", 1, 1, nil))
+		assert.ErrorIs(t, repo.UpdateBody(comment.Id, "stale", 1, 1, nil), model.ErrVersionConflict)
+
+		flags := []*model.ModerationFlag{{Filter: "blocked_words", Reason: "spam"}}
+		require.NoError(t, repo.UpdateBody(comment.Id, "spam", 1, 0, flags))
+
+		loaded, exception := repo.FindById(comment.Id)
+		require.NoError(t, exception)
+		assert.Equal(t, "spam", loaded.Body)
+		assert.Equal(t, uint32(3), loaded.Version)
+		assert.Equal(t, model.StatusPending, loaded.Status)
+
+		assert.ErrorIs(t, repo.UpdateBody(999, "missing", 1, 0, nil), gorm.ErrRecordNotFound)
+	})
+}
+
+func TestCommentRepository_DeleteAndRestore(t *testing.T) {
+	forEach(t, func(t *testing.T, repo CommentRepository) {
+		comment := &model.Comment{Body: "body", UserId: 1}
+		create(t, repo, comment)
+
+		assert.ErrorIs(t, repo.Delete(comment.Id, 5), model.ErrVersionConflict)
+		require.NoError(t, repo.Delete(comment.Id, 1))
+		assert.ErrorIs(t, repo.Delete(comment.Id, 0), gorm.ErrRecordNotFound)
+
+		require.NoError(t, repo.Restore(comment.Id))
+		assert.ErrorIs(t, repo.Restore(comment.Id), gorm.ErrRecordNotFound)
+
+		loaded, exception := repo.FindById(comment.Id)
+		require.NoError(t, exception)
+		assert.Equal(t, uint32(3), loaded.Version)
+		assert.Nil(t, loaded.DeletedAt)
+	})
+}
+
+func TestCommentRepository_DeleteMany(t *testing.T) {
+	forEach(t, func(t *testing.T, repo CommentRepository) {
+		first := &model.Comment{Body: "first", UserId: 1}
+		second := &model.Comment{Body: "second", UserId: 1}
+		third := &model.Comment{Body: "third", UserId: 1}
+		create(t, repo, first, second, third)
+		require.NoError(t, repo.Delete(third.Id, 0))
+
+		// Atomic deletes nothing once one of them is gone
+		_, exception := repo.DeleteMany([]uint32{first.Id, third.Id}, true)
+		assert.ErrorIs(t, exception, model.ErrVersionConflict)
+
+		_, exception = repo.FindById(first.Id)
+		require.NoError(t, exception)
+
+		deleted, exception := repo.DeleteMany([]uint32{first.Id, second.Id, third.Id}, false)
+		require.NoError(t, exception)
+		require.Len(t, deleted, 2)
+		assert.Equal(t, first.Id, deleted[0].Id)
+		assert.Equal(t, second.Id, deleted[1].Id)
+		assert.True(t, deleted[1].Deleted)
+
+		remaining, exception := repo.FindByIds([]uint32{first.Id, second.Id})
+		require.NoError(t, exception)
+		assert.Empty(t, remaining)
+	})
+}
+
+func TestCommentRepository_Reactions(t *testing.T) {
+	forEach(t, func(t *testing.T, repo CommentRepository) {
+		comment := &model.Comment{Body: "body", UserId: 1}
+		create(t, repo, comment)
+
+		reacted, exception := repo.ToggleReaction(comment.Id, 2, model.ReactionLike)
+		require.NoError(t, exception)
+		assert.True(t, reacted)
+
+		_, exception = repo.ToggleReaction(comment.Id, 3, model.ReactionLike)
+		require.NoError(t, exception)
+		_, exception = repo.ToggleReaction(comment.Id, 2, model.ReactionHeart)
+		require.NoError(t, exception)
+
+		reacted, exception = repo.ToggleReaction(comment.Id, 2, model.ReactionHeart)
+		require.NoError(t, exception)
+		assert.False(t, reacted)
+
+		comments := []*model.Comment{comment}
+		require.NoError(t, repo.LoadReactions(comments, 2))
+		assert.Equal(t, map[string]int64{model.ReactionLike: 2}, comment.Reactions)
+		assert.Equal(t, []string{model.ReactionLike}, comment.MyReactions)
+
+		require.NoError(t, repo.LoadReactions(comments, 0))
+		assert.Empty(t, comment.MyReactions)
+	})
+}
+
+func TestCommentRepository_Attachments(t *testing.T) {
+	forEach(t, func(t *testing.T, repo CommentRepository) {
+		comment := &model.Comment{
+			Body:        "body",
+			UserId:      1,
+			Attachments: []*model.CommentAttachment{{Name: "a.png", Size: 3, ContentType: "image/png", StorageKey: "key-a"}},
+		}
+		plain := &model.Comment{Body: "no files", UserId: 1}
+		create(t, repo, comment, plain)
+
+		require.NoError(t, repo.AddAttachments(comment.Id, []*model.CommentAttachment{{Name: "b.txt", Size: 5, ContentType: "text/plain", StorageKey: "key-b"}}))
+		assert.ErrorIs(t, repo.AddAttachments(999, []*model.CommentAttachment{{Name: "c.txt"}}), gorm.ErrRecordNotFound)
+
+		loaded, exception := repo.FindById(comment.Id)
+		require.NoError(t, exception)
+		assert.Equal(t, uint32(2), loaded.AttachmentCount)
+		assert.Empty(t, loaded.Attachments)
+
+		comments := []*model.Comment{loaded, plain}
+		require.NoError(t, repo.LoadAttachments(comments))
+		require.Len(t, loaded.Attachments, 2)
+		assert.Equal(t, "a.png", loaded.Attachments[0].Name)
+		assert.Equal(t, "b.txt", loaded.Attachments[1].Name)
+		assert.Empty(t, plain.Attachments)
+
+		attachment, exception := repo.FindAttachment(comment.Id, loaded.Attachments[1].Id)
+		require.NoError(t, exception)
+		assert.Equal(t, "key-b", attachment.StorageKey)
+
+		_, exception = repo.FindAttachment(plain.Id, loaded.Attachments[1].Id)
+		assert.ErrorIs(t, exception, gorm.ErrRecordNotFound)
+	})
+}
+
+func TestMemoryCommentRepository_Copies(t *testing.T) {
+	repo := NewMemoryCommentRepository()
+
+	comment := &model.Comment{Body: "body", UserId: 1}
+	create(t, repo, comment)
+	comment.Body = "changed by the caller"
+
+	loaded, exception := repo.FindById(comment.Id)
+	require.NoError(t, exception)
+	assert.Equal(t, "body", loaded.Body)
+
+	loaded.Body = "changed again"
+
+	loaded, exception = repo.FindById(comment.Id)
+	require.NoError(t, exception)
+	assert.Equal(t, "body", loaded.Body)
+}
+
+func TestMemoryCommentRepository_Concurrent(t *testing.T) {
+	repo := NewMemoryCommentRepository()
+
+	parent := &model.Comment{Body: "parent", UserId: 1}
+	create(t, repo, parent)
+
+	var wait sync.WaitGroup
+	for i := 0; i < 50; i++ {
+		wait.Add(1)
+
+		go func(userId uint32) {
+			defer wait.Done()
+
+			assert.NoError(t, repo.Create([]*model.Comment{{Body: "reply", UserId: userId, ParentId: &parent.Id}}))
+			_, exception := repo.ToggleReaction(parent.Id, userId, model.ReactionLike)
+			assert.NoError(t, exception)
+		}(uint32(i + 2))
+	}
+	wait.Wait()
+
+	loaded, exception := repo.FindById(parent.Id)
+	require.NoError(t, exception)
+	assert.Equal(t, uint32(50), loaded.ReplyCount)
+
+	require.NoError(t, repo.LoadReactions([]*model.Comment{loaded}, 0))
+	assert.Equal(t, int64(50), loaded.Reactions[model.ReactionLike])
+}
@@ -0,0 +1,134 @@
+package repository
+
+import (
+	"two-in-one/model"
+
+	"gorm.io/gorm"
+)
+
+// GormCommentRepository stores comments in the SQL database through the model methods
+type GormCommentRepository struct {
+	gormDb *gorm.DB
+}
+
+func NewGormCommentRepository(gormDb *gorm.DB) *GormCommentRepository {
+	return &GormCommentRepository{gormDb: gormDb}
+}
+
+func (r *GormCommentRepository) FindById(commentId uint32) (*model.Comment, error) {
+	var comment model.Comment
+
+	if exception := comment.FindById(r.gormDb, commentId); exception != nil {
+		return nil, exception
+	}
+
+	return &comment, nil
+}
+
+func (r *GormCommentRepository) FindForWrite(commentId uint32) (*model.Comment, error) {
+	var comment model.Comment
+
+	if exception := comment.FindForWrite(r.gormDb, commentId); exception != nil {
+		return nil, exception
+	}
+
+	return &comment, nil
+}
+
+func (r *GormCommentRepository) FindDeletedById(commentId uint32) (*model.Comment, error) {
+	var comment model.Comment
+
+	if exception := comment.FindDeletedById(r.gormDb, commentId); exception != nil {
+		return nil, exception
+	}
+
+	return &comment, nil
+}
+
+func (r *GormCommentRepository) FindByIds(commentIds []uint32) ([]*model.Comment, error) {
+	var comment model.Comment
+	return comment.FindByIds(r.gormDb, commentIds)
+}
+
+func (r *GormCommentRepository) ListByUserId(userId uint32, query model.ListQuery) ([]*model.Comment, *model.Page, error) {
+	var comment model.Comment
+	return comment.GetByUserId(r.gormDb, userId, query)
+}
+
+func (r *GormCommentRepository) Create(comments []*model.Comment) error {
+	var comment model.Comment
+	return comment.CreateMany(r.gormDb, comments)
+}
+
+func (r *GormCommentRepository) UpdateBody(commentId uint32, body string, editorId uint32, version uint32, flags []*model.ModerationFlag) error {
+	var comment model.Comment
+	return comment.UpdateBody(r.gormDb, commentId, body, editorId, version, flags)
+}
+
+func (r *GormCommentRepository) Delete(commentId uint32, version uint32) error {
+	var comment model.Comment
+	return comment.Delete(r.gormDb, commentId, version)
+}
+
+func (r *GormCommentRepository) DeleteMany(commentIds []uint32, atomic bool) ([]*model.Comment, error) {
+	var deleted []*model.Comment
+
+	exception := r.gormDb.Transaction(func(tx *gorm.DB) error {
+		var comment model.Comment
+		var exception error
+
+		if deleted, exception = comment.DeleteMany(tx, commentIds); exception != nil {
+			return exception
+		}
+
+		// Someone deleted some of them in the meantime, all or nothing means nothing then
+		if atomic && len(deleted) != len(commentIds) {
+			return model.ErrVersionConflict
+		}
+
+		return nil
+	})
+	if exception != nil {
+		return nil, exception
+	}
+
+	// Only once committed, a read in between would cache the comments again
+	model.InvalidateComments(r.gormDb, deleted)
+
+	return deleted, nil
+}
+
+func (r *GormCommentRepository) Restore(commentId uint32) error {
+	var comment model.Comment
+	return comment.Restore(r.gormDb, commentId)
+}
+
+func (r *GormCommentRepository) ToggleReaction(commentId uint32, userId uint32, reactionType string) (bool, error) {
+	var reaction model.CommentReaction
+	return reaction.Toggle(r.gormDb, commentId, userId, reactionType)
+}
+
+func (r *GormCommentRepository) LoadReactions(comments []*model.Comment, viewerId uint32) error {
+	var reaction model.CommentReaction
+	return reaction.LoadReactions(r.gormDb, comments, viewerId)
+}
+
+func (r *GormCommentRepository) AddAttachments(commentId uint32, attachments []*model.CommentAttachment) error {
+	var attachment model.CommentAttachment
+	return attachment.Add(r.gormDb, commentId, attachments)
+}
+
+func (r *GormCommentRepository) LoadAttachments(comments []*model.Comment) error {
+	var attachment model.CommentAttachment
+	return attachment.LoadAttachments(r.gormDb, comments)
+}
+
+func (r *GormCommentRepository) FindAttachment(commentId uint32, attachmentId uint32) (*model.CommentAttachment, error) {
+	var attachment model.CommentAttachment
+
+	if exception := attachment.Find(r.gormDb, commentId, attachmentId); exception != nil {
+		return nil, exception
+	}
+
+	return &attachment, nil
+}
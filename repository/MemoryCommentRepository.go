@@ -0,0 +1,380 @@
+package repository
+
+import (
+	"sort"
+	"sync"
+	"time"
+
+	"two-in-one/markdown"
+	"two-in-one/model"
+
+	"gorm.io/gorm"
+)
+
+// MemoryCommentRepository keeps comments in memory, for tests and running without a database.
+// It is safe for concurrent use and hands out copies, so callers can't change what it stores behind its back.
+// Unlike the SQL storage it keeps no revisions, mentions, moderation flags or outbox events, flagged comments are only marked pending.
+type MemoryCommentRepository struct {
+	mutex       sync.RWMutex
+	comments    map[uint32]*model.Comment
+	reactions   map[reactionKey]struct{}
+	attachments map[uint32][]*model.CommentAttachment
+	lastId      uint32
+
+	lastAttachmentId uint32
+}
+
+type reactionKey struct {
+	CommentId uint32
+	UserId    uint32
+	Type      string
+}
+
+func NewMemoryCommentRepository() *MemoryCommentRepository {
+	return &MemoryCommentRepository{
+		comments:    make(map[uint32]*model.Comment),
+		reactions:   make(map[reactionKey]struct{}),
+		attachments: make(map[uint32][]*model.CommentAttachment),
+	}
+}
+
+func (r *MemoryCommentRepository) FindById(commentId uint32) (*model.Comment, error) {
+	r.mutex.RLock()
+	defer r.mutex.RUnlock()
+
+	comment, isLive := r.live(commentId)
+	if !isLive {
+		return nil, gorm.ErrRecordNotFound
+	}
+
+	return clone(comment), nil
+}
+
+// FindForWrite is FindById, nothing is cached in memory
+func (r *MemoryCommentRepository) FindForWrite(commentId uint32) (*model.Comment, error) {
+	return r.FindById(commentId)
+}
+
+func (r *MemoryCommentRepository) FindDeletedById(commentId uint32) (*model.Comment, error) {
+	r.mutex.RLock()
+	defer r.mutex.RUnlock()
+
+	comment, exists := r.comments[commentId]
+	if !exists || !comment.Deleted {
+		return nil, gorm.ErrRecordNotFound
+	}
+
+	return clone(comment), nil
+}
+
+func (r *MemoryCommentRepository) FindByIds(commentIds []uint32) ([]*model.Comment, error) {
+	r.mutex.RLock()
+	defer r.mutex.RUnlock()
+
+	comments := []*model.Comment{}
+	seen := make(map[uint32]bool, len(commentIds))
+
+	for _, commentId := range commentIds {
+		if comment, isLive := r.live(commentId); isLive && !seen[commentId] {
+			comments = append(comments, clone(comment))
+			seen[commentId] = true
+		}
+	}
+
+	return comments, nil
+}
+
+func (r *MemoryCommentRepository) ListByUserId(userId uint32, query model.ListQuery) ([]*model.Comment, *model.Page, error) {
+	r.mutex.RLock()
+	defer r.mutex.RUnlock()
+
+	var comments []*model.Comment
+
+	for _, comment := range r.comments {
+		switch {
+		case comment.UserId != userId || comment.Deleted:
+		case query.Since != nil && comment.CreatedAt.Before(*query.Since):
+		case query.Until != nil && comment.CreatedAt.After(*query.Until):
+		case query.Status != "" && comment.Status != query.Status:
+		default:
+			comments = append(comments, clone(comment))
+		}
+	}
+
+	sort.Slice(comments, func(i, j int) bool { return comments[i].Id < comments[j].Id })
+
+	return model.PaginateSlice(comments, query.PageQuery)
+}
+
+func (r *MemoryCommentRepository) Create(comments []*model.Comment) error {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	// Checked up front, nothing is written unless every parent is fine
+	for _, comment := range comments {
+		if comment.ParentId == nil {
+			continue
+		}
+		if parent, isLive := r.live(*comment.ParentId); !isLive || parent.Status != model.StatusPublished {
+			return gorm.ErrRecordNotFound
+		}
+	}
+
+	now := time.Now()
+
+	for _, comment := range comments {
+		r.lastId++
+
+		comment.Id = r.lastId
+		comment.CreatedAt = now
+		comment.UpdatedAt = now
+		comment.Version = 1
+		comment.BodyHtml = markdown.Render(comment.Body)
+		comment.AttachmentCount = uint32(len(comment.Attachments))
+		r.attach(comment.Id, comment.Attachments, now)
+		if comment.Status == "" {
+			comment.Status = model.StatusPublished
+		}
+
+		if comment.ParentId != nil {
+			r.comments[*comment.ParentId].ReplyCount++
+		}
+
+		r.comments[comment.Id] = clone(comment)
+	}
+
+	return nil
+}
+
+func (r *MemoryCommentRepository) UpdateBody(commentId uint32, body string, editorId uint32, version uint32, flags []*model.ModerationFlag) error {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	comment, isLive := r.live(commentId)
+	if !isLive {
+		return gorm.ErrRecordNotFound
+	}
+
+	if version != 0 && comment.Version != version {
+		return model.ErrVersionConflict
+	}
+
+	comment.Body = body
+	comment.BodyHtml = markdown.Render(body)
+	comment.Version++
+	comment.UpdatedAt = time.Now()
+
+	if len(flags) > 0 {
+		comment.Status = model.StatusPending
+	}
+
+	return nil
+}
+
+func (r *MemoryCommentRepository) Delete(commentId uint32, version uint32) error {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	comment, isLive := r.live(commentId)
+	if !isLive {
+		return gorm.ErrRecordNotFound
+	}
+
+	if version != 0 && comment.Version != version {
+		return model.ErrVersionConflict
+	}
+
+	r.delete(comment)
+
+	return nil
+}
+
+func (r *MemoryCommentRepository) DeleteMany(commentIds []uint32, atomic bool) ([]*model.Comment, error) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	var toDelete []*model.Comment
+	seen := make(map[uint32]bool, len(commentIds))
+
+	for _, commentId := range commentIds {
+		if comment, isLive := r.live(commentId); isLive && !seen[commentId] {
+			toDelete = append(toDelete, comment)
+			seen[commentId] = true
+		}
+	}
+
+	if atomic && len(toDelete) != len(commentIds) {
+		return nil, model.ErrVersionConflict
+	}
+
+	deleted := make([]*model.Comment, 0, len(toDelete))
+	for _, comment := range toDelete {
+		r.delete(comment)
+		deleted = append(deleted, clone(comment))
+	}
+
+	return deleted, nil
+}
+
+func (r *MemoryCommentRepository) Restore(commentId uint32) error {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	comment, exists := r.comments[commentId]
+	if !exists || !comment.Deleted {
+		return gorm.ErrRecordNotFound
+	}
+
+	comment.Deleted = false
+	comment.DeletedAt = nil
+	comment.Version++
+
+	return nil
+}
+
+func (r *MemoryCommentRepository) ToggleReaction(commentId uint32, userId uint32, reactionType string) (bool, error) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	key := reactionKey{CommentId: commentId, UserId: userId, Type: reactionType}
+
+	if _, exists := r.reactions[key]; exists {
+		delete(r.reactions, key)
+		return false, nil
+	}
+
+	r.reactions[key] = struct{}{}
+
+	return true, nil
+}
+
+func (r *MemoryCommentRepository) LoadReactions(comments []*model.Comment, viewerId uint32) error {
+	r.mutex.RLock()
+	defer r.mutex.RUnlock()
+
+	byId := make(map[uint32]*model.Comment, len(comments))
+	for _, comment := range comments {
+		comment.Reactions = map[string]int64{}
+		comment.MyReactions = []string{}
+		byId[comment.Id] = comment
+	}
+
+	for key := range r.reactions {
+		comment, isLoaded := byId[key.CommentId]
+		if !isLoaded {
+			continue
+		}
+
+		comment.Reactions[key.Type]++
+		if viewerId != 0 && key.UserId == viewerId {
+			comment.MyReactions = append(comment.MyReactions, key.Type)
+		}
+	}
+
+	// Map order is random, the SQL storage doesn't promise an order either but stable is nicer
+	for _, comment := range comments {
+		sort.Strings(comment.MyReactions)
+	}
+
+	return nil
+}
+
+func (r *MemoryCommentRepository) AddAttachments(commentId uint32, attachments []*model.CommentAttachment) error {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	comment, isLive := r.live(commentId)
+	if !isLive {
+		return gorm.ErrRecordNotFound
+	}
+
+	comment.AttachmentCount += uint32(len(attachments))
+	r.attach(commentId, attachments, time.Now())
+
+	return nil
+}
+
+func (r *MemoryCommentRepository) LoadAttachments(comments []*model.Comment) error {
+	r.mutex.RLock()
+	defer r.mutex.RUnlock()
+
+	for _, comment := range comments {
+		comment.Attachments = nil
+		for _, attachment := range r.attachments[comment.Id] {
+			copied := *attachment
+			comment.Attachments = append(comment.Attachments, &copied)
+		}
+	}
+
+	return nil
+}
+
+func (r *MemoryCommentRepository) FindAttachment(commentId uint32, attachmentId uint32) (*model.CommentAttachment, error) {
+	r.mutex.RLock()
+	defer r.mutex.RUnlock()
+
+	for _, attachment := range r.attachments[commentId] {
+		if attachment.Id == attachmentId {
+			copied := *attachment
+			return &copied, nil
+		}
+	}
+
+	return nil, gorm.ErrRecordNotFound
+}
+
+// attach stores copies of new attachments of a comment, giving them their id, the caller holds the lock
+func (r *MemoryCommentRepository) attach(commentId uint32, attachments []*model.CommentAttachment, now time.Time) {
+	for _, attachment := range attachments {
+		r.lastAttachmentId++
+
+		attachment.Id = r.lastAttachmentId
+		attachment.CommentId = commentId
+		attachment.CreatedAt = now
+
+		copied := *attachment
+		r.attachments[commentId] = append(r.attachments[commentId], &copied)
+	}
+}
+
+// live returns the stored comment unless it is missing or soft-deleted, the caller holds the lock
+func (r *MemoryCommentRepository) live(commentId uint32) (*model.Comment, bool) {
+	comment, exists := r.comments[commentId]
+	if !exists || comment.Deleted {
+		return nil, false
+	}
+
+	return comment, true
+}
+
+// delete soft-deletes a stored comment, the caller holds the lock
+func (r *MemoryCommentRepository) delete(comment *model.Comment) {
+	now := time.Now()
+
+	comment.Deleted = true
+	comment.DeletedAt = &now
+	comment.Version++
+}
+
+// clone copies a comment, so the stored one and the one handed out don't share anything that can change
+func clone(comment *model.Comment) *model.Comment {
+	copied := *comment
+
+	if comment.DeletedAt != nil {
+		deletedAt := *comment.DeletedAt
+		copied.DeletedAt = &deletedAt
+	}
+
+	if comment.ParentId != nil {
+		parentId := *comment.ParentId
+		copied.ParentId = &parentId
+	}
+
+	copied.Flags = nil
+	copied.Attachments = nil
+	copied.Replies = nil
+	copied.Reactions = nil
+	copied.MyReactions = nil
+
+	return &copied
+}
@@ -0,0 +1,196 @@
+package stream
+
+import (
+	"encoding/json"
+	"log"
+	"sync"
+	"time"
+
+	"two-in-one/model"
+)
+
+// EventReset tells a resuming client that some events were lost and it should load the comments again
+const EventReset = "stream.reset"
+
+// EventCommentHidden tells the clients that can't see pending comments that an edit sent a published one back to
+// moderation, like a delete it only holds the id and version
+const EventCommentHidden = "comment.hidden"
+
+// How many events a subscriber can fall behind before it is dropped, it then catches up from the buffer when it
+// reconnects
+const subscriberBacklog = 64
+
+// Event is a change to a comment of a user, Data is the comment as JSON right after the change, or only its id,
+// version and deletedAt once deleted or hidden
+type Event struct {
+	Id     uint64
+	Type   string
+	UserId uint32
+	Status string
+	Data   json.RawMessage
+}
+
+// Subscription follows the events about the comments of one user
+type Subscription struct {
+	userId uint32
+	events chan *Event
+}
+
+// Events delivers the events as they are published, it is closed when the subscriber fell too far behind
+func (subscription *Subscription) Events() <-chan *Event {
+	return subscription.events
+}
+
+// Bus hands the comment changes of this process to the streams following them. The latest events are kept in a
+// ring buffer so that a client can resume after a reconnect, the ids start over when the process does.
+type Bus struct {
+	sync.Mutex
+	config *Config
+	lastId uint64
+
+	// Oldest event at next once the buffer is full
+	buffer []*Event
+	next   int
+
+	subscribers map[*Subscription]bool
+}
+
+func NewBus(config *Config) *Bus {
+	return &Bus{
+		config:      config,
+		buffer:      make([]*Event, 0, config.BufferSize),
+		subscribers: map[*Subscription]bool{},
+	}
+}
+
+// Heartbeat is how often idle streams get a comment line, so proxies keep them open
+func (b *Bus) Heartbeat() time.Duration {
+	return b.config.Heartbeat
+}
+
+// deletedComment is what a comment.deleted event holds, the body and the rest of what was deleted stay out of it
+type deletedComment struct {
+	Id        uint32     `json:"id"`
+	Version   uint32     `json:"version"`
+	DeletedAt *time.Time `json:"deletedAt"`
+}
+
+// hiddenComment is what a comment.hidden event holds, the edit that got the comment held stays out of it
+type hiddenComment struct {
+	Id      uint32 `json:"id"`
+	Version uint32 `json:"version"`
+}
+
+// Publish sends an event of the type for every comment, to be called once the change is committed
+func (b *Bus) Publish(eventType string, comments ...*model.Comment) {
+	for _, comment := range comments {
+		var data []byte
+		var exception error
+		switch eventType {
+		case model.EventCommentDeleted:
+			data, exception = json.Marshal(&deletedComment{Id: comment.Id, Version: comment.Version, DeletedAt: comment.DeletedAt})
+		case EventCommentHidden:
+			data, exception = json.Marshal(&hiddenComment{Id: comment.Id, Version: comment.Version})
+		default:
+			data, exception = json.Marshal(comment)
+		}
+		if exception != nil {
+			log.Printf("[Stream] Failed to encode comment %d: %s", comment.Id, exception.Error())
+			continue
+		}
+
+		b.publish(&Event{
+			Type:   eventType,
+			UserId: comment.UserId,
+			Status: comment.Status,
+			Data:   data,
+		})
+	}
+}
+
+func (b *Bus) publish(event *Event) {
+	b.Lock()
+	defer b.Unlock()
+
+	b.lastId++
+	event.Id = b.lastId
+
+	if len(b.buffer) < b.config.BufferSize {
+		b.buffer = append(b.buffer, event)
+	} else {
+		b.buffer[b.next] = event
+		b.next = (b.next + 1) % len(b.buffer)
+	}
+
+	for subscription := range b.subscribers {
+		if subscription.userId != event.UserId {
+			continue
+		}
+
+		select {
+		case subscription.events <- event:
+		default:
+			// Publishing never waits on a slow client
+			b.drop(subscription)
+		}
+	}
+}
+
+// Subscribe starts following the events about the comments of a user. Given the id of the last event a client got,
+// the events after it that are still buffered come back to be sent first. When some of them were pushed out of the
+// buffer already, or the id is from before a restart, an EventReset comes first.
+func (b *Bus) Subscribe(userId uint32, lastEventId uint64) (*Subscription, []*Event) {
+	b.Lock()
+	defer b.Unlock()
+
+	subscription := &Subscription{
+		userId: userId,
+		events: make(chan *Event, subscriberBacklog),
+	}
+	b.subscribers[subscription] = true
+
+	if lastEventId == 0 {
+		return subscription, nil
+	}
+
+	// The buffer holds every event since oldest
+	oldest := b.lastId + 1
+	if len(b.buffer) > 0 {
+		oldest = b.buffer[b.next].Id
+	}
+
+	var missed []*Event
+
+	complete := lastEventId <= b.lastId && lastEventId+1 >= oldest
+	if lastEventId > b.lastId {
+		lastEventId = 0
+	}
+	if !complete {
+		// Resuming from the reset picks up where the buffer starts
+		missed = append(missed, &Event{Id: oldest - 1, Type: EventReset, UserId: userId, Data: json.RawMessage("{}")})
+	}
+
+	for i := range b.buffer {
+		event := b.buffer[(b.next+i)%len(b.buffer)]
+		if event.Id > lastEventId && event.UserId == userId {
+			missed = append(missed, event)
+		}
+	}
+
+	return subscription, missed
+}
+
+// Unsubscribe stops a subscription, which may have been dropped already
+func (b *Bus) Unsubscribe(subscription *Subscription) {
+	b.Lock()
+	defer b.Unlock()
+
+	if b.subscribers[subscription] {
+		b.drop(subscription)
+	}
+}
+
+func (b *Bus) drop(subscription *Subscription) {
+	delete(b.subscribers, subscription)
+	close(subscription.events)
+}
@@ -0,0 +1,127 @@
+package stream
+
+import (
+	"encoding/json"
+	"fmt"
+	"testing"
+	"time"
+
+	"two-in-one/model"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// ids lists the ids and types of events, for shorter assertions
+func ids(events []*Event) []string {
+	var list []string
+	for _, event := range events {
+		list = append(list, fmt.Sprintf("%d %s", event.Id, event.Type))
+	}
+	return list
+}
+
+func TestBus_Live(t *testing.T) {
+	bus := NewBus(&Config{BufferSize: 10})
+
+	mine, missed := bus.Subscribe(1, 0)
+	assert.Empty(t, missed)
+	defer bus.Unsubscribe(mine)
+
+	bus.Publish(model.EventCommentCreated, &model.Comment{Id: 1, UserId: 2, Body: "someone else's"})
+	bus.Publish(model.EventCommentCreated, &model.Comment{Id: 2, UserId: 1, Body: "mine", Status: model.StatusPublished})
+
+	// Only the events about the user's comments come through
+	event := <-mine.Events()
+	assert.Equal(t, uint64(2), event.Id)
+	assert.Equal(t, model.EventCommentCreated, event.Type)
+	assert.Equal(t, model.StatusPublished, event.Status)
+
+	var comment model.Comment
+	require.NoError(t, json.Unmarshal(event.Data, &comment))
+	assert.Equal(t, "mine", comment.Body)
+
+	select {
+	case event := <-mine.Events():
+		t.Fatalf("unexpected event %d", event.Id)
+	default:
+	}
+}
+
+func TestBus_Deleted(t *testing.T) {
+	bus := NewBus(&Config{BufferSize: 10})
+
+	mine, _ := bus.Subscribe(1, 0)
+	defer bus.Unsubscribe(mine)
+
+	deletedAt := time.Date(2022, 1, 2, 3, 4, 5, 0, time.UTC)
+	bus.Publish(model.EventCommentDeleted, &model.Comment{Id: 2, UserId: 1, Body: "gone", Status: model.StatusPublished, Deleted: true, DeletedAt: &deletedAt, Version: 3})
+
+	// Still routed by author and status, without what was deleted
+	event := <-mine.Events()
+	assert.Equal(t, model.StatusPublished, event.Status)
+	assert.JSONEq(t, `{"id":2,"version":3,"deletedAt":"2022-01-02T03:04:05Z"}`, string(event.Data))
+}
+
+func TestBus_Hidden(t *testing.T) {
+	bus := NewBus(&Config{BufferSize: 10})
+
+	mine, _ := bus.Subscribe(1, 0)
+	defer bus.Unsubscribe(mine)
+
+	bus.Publish(EventCommentHidden, &model.Comment{Id: 2, UserId: 1, Body: "buy spam here", Status: model.StatusPending, Version: 4})
+
+	event := <-mine.Events()
+	assert.Equal(t, model.StatusPending, event.Status)
+	assert.JSONEq(t, `{"id":2,"version":4}`, string(event.Data))
+}
+
+func TestBus_SlowSubscriber(t *testing.T) {
+	bus := NewBus(&Config{BufferSize: 10})
+
+	slow, _ := bus.Subscribe(1, 0)
+
+	for i := 0; i <= subscriberBacklog; i++ {
+		bus.Publish(model.EventCommentUpdated, &model.Comment{Id: 1, UserId: 1})
+	}
+
+	// It got dropped instead of holding up publishing, and is closed after its backlog
+	received := 0
+	for range slow.Events() {
+		received++
+	}
+	assert.Equal(t, subscriberBacklog, received)
+
+	// Unsubscribing afterwards is fine
+	bus.Unsubscribe(slow)
+}
+
+func TestBus_Resume(t *testing.T) {
+	bus := NewBus(&Config{BufferSize: 3})
+
+	bus.Publish(model.EventCommentCreated, &model.Comment{Id: 1, UserId: 1})
+	bus.Publish(model.EventCommentUpdated, &model.Comment{Id: 1, UserId: 1})
+	bus.Publish(model.EventCommentDeleted, &model.Comment{Id: 1, UserId: 1})
+	bus.Publish(model.EventCommentCreated, &model.Comment{Id: 2, UserId: 2})
+	bus.Publish(model.EventCommentRestored, &model.Comment{Id: 1, UserId: 1})
+
+	for _, test := range []struct {
+		name        string
+		lastEventId uint64
+		want        []string
+	}{
+		{"Up to date", 5, nil},
+		{"Missed one", 3, []string{"5 comment.restored"}},
+		{"Missed the oldest buffered", 2, []string{"3 comment.deleted", "5 comment.restored"}},
+
+		// Event 2 was pushed out of the buffer already
+		{"Missed too many", 1, []string{"2 stream.reset", "3 comment.deleted", "5 comment.restored"}},
+
+		// An id of an earlier run of the server
+		{"Restarted", 9, []string{"2 stream.reset", "3 comment.deleted", "5 comment.restored"}},
+	} {
+		subscription, missed := bus.Subscribe(1, test.lastEventId)
+		assert.Equal(t, test.want, ids(missed), test.name)
+		bus.Unsubscribe(subscription)
+	}
+}
@@ -0,0 +1,50 @@
+package stream
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"time"
+)
+
+const (
+	// Proxies tend to drop connections that stay quiet for a minute
+	defaultHeartbeat = 15 * time.Second
+
+	// How many of the latest events a reconnecting client can catch up on
+	defaultBufferSize = 1000
+)
+
+// Config says how often idle streams get a heartbeat and how far back they can resume
+type Config struct {
+	Heartbeat time.Duration
+
+	// Events kept for Last-Event-ID, shared by every user
+	BufferSize int
+}
+
+// ConfigFromEnv reads STREAM_HEARTBEAT as a Go duration and STREAM_BUFFER_SIZE
+func ConfigFromEnv() (*Config, error) {
+	config := &Config{
+		Heartbeat:  defaultHeartbeat,
+		BufferSize: defaultBufferSize,
+	}
+
+	if heartbeat := os.Getenv("STREAM_HEARTBEAT"); heartbeat != "" {
+		value, exception := time.ParseDuration(heartbeat)
+		if exception != nil || value <= 0 {
+			return nil, fmt.Errorf("invalid STREAM_HEARTBEAT %q", heartbeat)
+		}
+		config.Heartbeat = value
+	}
+
+	if bufferSize := os.Getenv("STREAM_BUFFER_SIZE"); bufferSize != "" {
+		value, exception := strconv.Atoi(bufferSize)
+		if exception != nil || value < 1 {
+			return nil, fmt.Errorf("invalid STREAM_BUFFER_SIZE %q", bufferSize)
+		}
+		config.BufferSize = value
+	}
+
+	return config, nil
+}
@@ -0,0 +1,30 @@
+package stream
+
+import (
+	"os"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestConfigFromEnv(t *testing.T) {
+	defer os.Unsetenv("STREAM_HEARTBEAT")
+	defer os.Unsetenv("STREAM_BUFFER_SIZE")
+
+	config, exception := ConfigFromEnv()
+	assert.NoError(t, exception)
+	assert.Equal(t, defaultHeartbeat, config.Heartbeat)
+	assert.Equal(t, defaultBufferSize, config.BufferSize)
+
+	_ = os.Setenv("STREAM_HEARTBEAT", "30s")
+	_ = os.Setenv("STREAM_BUFFER_SIZE", "50")
+	config, exception = ConfigFromEnv()
+	assert.NoError(t, exception)
+	assert.Equal(t, 30*time.Second, config.Heartbeat)
+	assert.Equal(t, 50, config.BufferSize)
+
+	_ = os.Setenv("STREAM_BUFFER_SIZE", "0")
+	_, exception = ConfigFromEnv()
+	assert.Error(t, exception)
+}
@@ -0,0 +1,114 @@
+package webhook
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"syscall"
+	"time"
+)
+
+// ErrForbiddenAddress is returned when a receiver is on the API's own network, e.g. the cloud metadata service
+var ErrForbiddenAddress = errors.New("webhook receivers can't be on a loopback, private or link-local address")
+
+// Redirects a receiver can answer with before the delivery fails
+const maxRedirects = 10
+
+// The ranges receivers can't be in, the loopback, private, shared, link-local, multicast and reserved ones
+var forbiddenRanges = parseRanges(
+	"0.0.0.0/8", "10.0.0.0/8", "100.64.0.0/10", "127.0.0.0/8", "169.254.0.0/16", "172.16.0.0/12", "192.0.0.0/24",
+	"192.168.0.0/16", "198.18.0.0/15", "224.0.0.0/4", "240.0.0.0/4",
+	"::/128", "::1/128", "fc00::/7", "fe80::/10", "ff00::/8",
+)
+
+func parseRanges(cidrs ...string) []*net.IPNet {
+	ranges := make([]*net.IPNet, 0, len(cidrs))
+	for _, cidr := range cidrs {
+		_, ipRange, exception := net.ParseCIDR(cidr)
+		if exception != nil {
+			panic(exception)
+		}
+		ranges = append(ranges, ipRange)
+	}
+	return ranges
+}
+
+// isForbidden tells whether an address is in one of the forbidden ranges, IPv4 mapped into IPv6 included
+func isForbidden(ip net.IP) bool {
+	if ipv4 := ip.To4(); ipv4 != nil {
+		ip = ipv4
+	}
+
+	for _, ipRange := range forbiddenRanges {
+		if ipRange.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// checkDial runs once the host of a connection is resolved, so a name that resolves elsewhere the next time is
+// still checked against the address actually dialled
+func checkDial(network string, address string, _ syscall.RawConn) error {
+	host, _, exception := net.SplitHostPort(address)
+	if exception != nil {
+		return exception
+	}
+
+	ip := net.ParseIP(host)
+	if ip == nil || isForbidden(ip) {
+		return fmt.Errorf("%w: %s", ErrForbiddenAddress, host)
+	}
+	return nil
+}
+
+// checkRedirect refuses redirects to the forbidden ranges before following them, the dial is checked again anyway
+func checkRedirect(request *http.Request, via []*http.Request) error {
+	if len(via) >= maxRedirects {
+		return fmt.Errorf("stopped after %d redirects", maxRedirects)
+	}
+
+	host := request.URL.Hostname()
+	if ip := net.ParseIP(host); ip != nil {
+		if isForbidden(ip) {
+			return fmt.Errorf("%w: %s", ErrForbiddenAddress, host)
+		}
+		return nil
+	}
+
+	addresses, exception := net.DefaultResolver.LookupIPAddr(request.Context(), host)
+	if exception != nil {
+		return exception
+	}
+	for _, address := range addresses {
+		if isForbidden(address.IP) {
+			return fmt.Errorf("%w: %s resolves to %s", ErrForbiddenAddress, host, address.IP)
+		}
+	}
+	return nil
+}
+
+// newClient makes the client events are posted with, it only reaches public addresses unless allowPrivate is set
+func newClient(timeout time.Duration, allowPrivate bool) *http.Client {
+	if allowPrivate {
+		return &http.Client{Timeout: timeout}
+	}
+
+	dialer := &net.Dialer{
+		Timeout:   timeout,
+		KeepAlive: 30 * time.Second,
+		Control:   checkDial,
+	}
+
+	// Straight to the receiver, a proxy would make the dial check look at the proxy instead
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.Proxy = nil
+	transport.DialContext = dialer.DialContext
+
+	return &http.Client{
+		Timeout:       timeout,
+		Transport:     transport,
+		CheckRedirect: checkRedirect,
+	}
+}
@@ -0,0 +1,45 @@
+package webhook
+
+import (
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestIsForbidden(t *testing.T) {
+	for _, address := range []string{"127.0.0.1", "10.1.2.3", "172.20.0.1", "192.168.1.1", "169.254.169.254", "100.64.0.1", "0.0.0.0", "::1", "fd00::1", "fe80::1", "::ffff:127.0.0.1"} {
+		assert.True(t, isForbidden(net.ParseIP(address)), address)
+	}
+
+	for _, address := range []string{"93.184.216.34", "8.8.8.8", "172.32.0.1", "2606:4700::1111"} {
+		assert.False(t, isForbidden(net.ParseIP(address)), address)
+	}
+}
+
+func TestNewClient_Forbidden(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, request *http.Request) {
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer server.Close()
+
+	// The receiver is on the loopback, refused when it is dialled
+	_, exception := newClient(time.Second, false).Get(server.URL)
+	assert.ErrorIs(t, exception, ErrForbiddenAddress)
+
+	response, exception := newClient(time.Second, true).Get(server.URL)
+	require.NoError(t, exception)
+	_ = response.Body.Close()
+	assert.Equal(t, http.StatusNoContent, response.StatusCode)
+
+	// Redirects to the metadata service aren't followed
+	request := httptest.NewRequest(http.MethodGet, "http://169.254.169.254/latest/meta-data/", nil)
+	assert.ErrorIs(t, checkRedirect(request, nil), ErrForbiddenAddress)
+
+	request = httptest.NewRequest(http.MethodGet, "http://93.184.216.34/hook", nil)
+	assert.NoError(t, checkRedirect(request, nil))
+}
@@ -0,0 +1,140 @@
+package webhook
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"time"
+)
+
+const (
+	// 8 attempts over roughly an hour by default, 30s doubling up to 30m between them
+	defaultMaxAttempts = 8
+	defaultBackoff     = 30 * time.Second
+	defaultMaxBackoff  = 30 * time.Minute
+
+	// How often the outbox is checked and how long a receiver gets to answer
+	defaultInterval = 5 * time.Second
+	defaultTimeout  = 10 * time.Second
+
+	// How many events are picked up per check
+	defaultBatchSize = 100
+
+	// How many receivers are sent to at the same time
+	defaultWorkers = 4
+)
+
+// Config says how hard delivering events is tried, and where every event goes next to the subscriptions
+type Config struct {
+	// Receiver of every event, optional
+	Url string
+
+	// Key of the HMAC-SHA256 signature, shared with the receiver
+	Secret string
+
+	// A delivery is dead after this many failed attempts
+	MaxAttempts uint32
+
+	// Wait before the second attempt, doubled with every further one up to MaxBackoff
+	Backoff    time.Duration
+	MaxBackoff time.Duration
+
+	Interval  time.Duration
+	Timeout   time.Duration
+	BatchSize int
+
+	// Receivers that are sent to side by side, the events of one receiver still go out one after the other
+	Workers int
+
+	// Receivers can be on loopback, private and link-local addresses, only for setups where every user is trusted
+	AllowPrivate bool
+}
+
+// Enabled tells whether there is a receiver for every event
+func (config *Config) Enabled() bool {
+	return config.Url != ""
+}
+
+// ConfigFromEnv reads WEBHOOK_URL, WEBHOOK_SECRET, WEBHOOK_MAX_ATTEMPTS, WEBHOOK_WORKERS, WEBHOOK_ALLOW_PRIVATE as a
+// boolean, and WEBHOOK_BACKOFF, WEBHOOK_MAX_BACKOFF, WEBHOOK_INTERVAL and WEBHOOK_TIMEOUT as Go durations
+func ConfigFromEnv() (*Config, error) {
+	config := &Config{
+		Url:         os.Getenv("WEBHOOK_URL"),
+		Secret:      os.Getenv("WEBHOOK_SECRET"),
+		MaxAttempts: defaultMaxAttempts,
+		Backoff:     defaultBackoff,
+		MaxBackoff:  defaultMaxBackoff,
+		Interval:    defaultInterval,
+		Timeout:     defaultTimeout,
+		BatchSize:   defaultBatchSize,
+		Workers:     defaultWorkers,
+	}
+
+	// Unsigned events would be worthless to the receiver
+	if config.Url != "" && config.Secret == "" {
+		return nil, fmt.Errorf("missing WEBHOOK_SECRET for WEBHOOK_URL %q", config.Url)
+	}
+
+	if maxAttempts := os.Getenv("WEBHOOK_MAX_ATTEMPTS"); maxAttempts != "" {
+		value, exception := strconv.ParseUint(maxAttempts, 10, 32)
+		if exception != nil || value == 0 {
+			return nil, fmt.Errorf("invalid WEBHOOK_MAX_ATTEMPTS %q", maxAttempts)
+		}
+		config.MaxAttempts = uint32(value)
+	}
+
+	if workers := os.Getenv("WEBHOOK_WORKERS"); workers != "" {
+		value, exception := strconv.Atoi(workers)
+		if exception != nil || value <= 0 {
+			return nil, fmt.Errorf("invalid WEBHOOK_WORKERS %q", workers)
+		}
+		config.Workers = value
+	}
+
+	if allowPrivate := os.Getenv("WEBHOOK_ALLOW_PRIVATE"); allowPrivate != "" {
+		value, exception := strconv.ParseBool(allowPrivate)
+		if exception != nil {
+			return nil, fmt.Errorf("invalid WEBHOOK_ALLOW_PRIVATE %q", allowPrivate)
+		}
+		config.AllowPrivate = value
+	}
+
+	durations := []struct {
+		name  string
+		value *time.Duration
+	}{
+		{"WEBHOOK_BACKOFF", &config.Backoff},
+		{"WEBHOOK_MAX_BACKOFF", &config.MaxBackoff},
+		{"WEBHOOK_INTERVAL", &config.Interval},
+		{"WEBHOOK_TIMEOUT", &config.Timeout},
+	}
+
+	for _, duration := range durations {
+		raw := os.Getenv(duration.name)
+		if raw == "" {
+			continue
+		}
+
+		value, exception := time.ParseDuration(raw)
+		if exception != nil || value <= 0 {
+			return nil, fmt.Errorf("invalid %s %q", duration.name, raw)
+		}
+		*duration.value = value
+	}
+
+	return config, nil
+}
+
+// BackoffAfter is the wait after the given number of failed attempts
+func (config *Config) BackoffAfter(attempts uint32) time.Duration {
+	wait := config.Backoff
+	for i := uint32(1); i < attempts && wait < config.MaxBackoff; i++ {
+		wait *= 2
+	}
+
+	if wait > config.MaxBackoff {
+		return config.MaxBackoff
+	}
+
+	return wait
+}
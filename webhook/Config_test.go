@@ -0,0 +1,67 @@
+package webhook
+
+import (
+	"os"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestConfigFromEnv(t *testing.T) {
+	defer os.Unsetenv("WEBHOOK_URL")
+	defer os.Unsetenv("WEBHOOK_SECRET")
+	defer os.Unsetenv("WEBHOOK_BACKOFF")
+	defer os.Unsetenv("WEBHOOK_ALLOW_PRIVATE")
+
+	config, exception := ConfigFromEnv()
+	assert.NoError(t, exception)
+	assert.False(t, config.Enabled())
+	assert.Equal(t, uint32(defaultMaxAttempts), config.MaxAttempts)
+
+	// A receiver needs a secret to check the events with
+	_ = os.Setenv("WEBHOOK_URL", "https://example.com/hook")
+	_, exception = ConfigFromEnv()
+	assert.Error(t, exception)
+
+	_ = os.Setenv("WEBHOOK_SECRET", "s3cret")
+	_ = os.Setenv("WEBHOOK_BACKOFF", "1m")
+	config, exception = ConfigFromEnv()
+	assert.NoError(t, exception)
+	assert.True(t, config.Enabled())
+	assert.Equal(t, time.Minute, config.Backoff)
+	assert.False(t, config.AllowPrivate)
+
+	_ = os.Setenv("WEBHOOK_ALLOW_PRIVATE", "true")
+	config, exception = ConfigFromEnv()
+	assert.NoError(t, exception)
+	assert.True(t, config.AllowPrivate)
+
+	_ = os.Setenv("WEBHOOK_ALLOW_PRIVATE", "sometimes")
+	_, exception = ConfigFromEnv()
+	assert.Error(t, exception)
+	_ = os.Unsetenv("WEBHOOK_ALLOW_PRIVATE")
+
+	assert.Equal(t, defaultWorkers, config.Workers)
+	_ = os.Setenv("WEBHOOK_WORKERS", "0")
+	_, exception = ConfigFromEnv()
+	assert.Error(t, exception)
+	_ = os.Unsetenv("WEBHOOK_WORKERS")
+
+	_ = os.Setenv("WEBHOOK_BACKOFF", "-1s")
+	_, exception = ConfigFromEnv()
+	assert.Error(t, exception)
+}
+
+func TestConfig_BackoffAfter(t *testing.T) {
+	config := &Config{Backoff: time.Second, MaxBackoff: 10 * time.Second}
+
+	var waits []time.Duration
+	for attempts := uint32(1); attempts <= 6; attempts++ {
+		waits = append(waits, config.BackoffAfter(attempts))
+	}
+
+	assert.Equal(t, []time.Duration{
+		time.Second, 2 * time.Second, 4 * time.Second, 8 * time.Second, 10 * time.Second, 10 * time.Second,
+	}, waits)
+}
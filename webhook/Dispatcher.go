@@ -0,0 +1,387 @@
+package webhook
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"sync"
+	"time"
+
+	"two-in-one/model"
+
+	"gorm.io/gorm"
+)
+
+// EventTest is the type of the events sent by SendTest, they aren't stored in the outbox
+const EventTest = "webhook.test"
+
+// The receiver from the environment takes the place of subscription 0
+const configuredReceiver uint32 = 0
+
+// Envelope is the JSON body of every event, data is the comment or reaction the event is about
+type Envelope struct {
+	Id        uint64          `json:"id"`
+	Type      string          `json:"type"`
+	CreatedAt time.Time       `json:"createdAt"`
+	Data      json.RawMessage `json:"data"`
+}
+
+// target is where a delivery goes and what it is signed with
+type target struct {
+	url    string
+	secret string
+}
+
+// Dispatcher hands the events of the outbox to the subscriptions and delivers them, retrying failures with an
+// exponential backoff
+type Dispatcher struct {
+	gormDb *gorm.DB
+	config *Config
+	client *http.Client
+}
+
+func NewDispatcher(gormDb *gorm.DB, config *Config) *Dispatcher {
+	return &Dispatcher{
+		gormDb: gormDb,
+		config: config,
+		client: newClient(config.Timeout, config.AllowPrivate),
+	}
+}
+
+// Dispatch queues the new events for their subscriptions, then sends one batch of the deliveries that are due,
+// returning how many of them got through
+func (d *Dispatcher) Dispatch() (int, error) {
+	if exception := d.queue(); exception != nil {
+		return 0, exception
+	}
+
+	return d.deliver()
+}
+
+// queue hands every pending event of the outbox to the subscriptions that want it
+func (d *Dispatcher) queue() error {
+	var event model.OutboxEvent
+
+	var receivers []uint32
+	if d.config.Enabled() {
+		receivers = append(receivers, configuredReceiver)
+	}
+
+	for {
+		events, exception := event.FindPending(d.gormDb, d.config.BatchSize)
+		if exception != nil {
+			return exception
+		}
+
+		if exception := event.Dispatch(d.gormDb, events, receivers); exception != nil {
+			return exception
+		}
+
+		if len(events) < d.config.BatchSize {
+			return nil
+		}
+	}
+}
+
+// deliver sends the deliveries that are due. Those of different receivers go out side by side on up to Workers
+// goroutines, those of one receiver one after the other in the order of their events.
+func (d *Dispatcher) deliver() (int, error) {
+	var delivery model.WebhookDelivery
+
+	deliveries, exception := delivery.FindDue(d.gormDb, d.gormDb.NowFunc(), d.config.BatchSize)
+	if exception != nil || len(deliveries) == 0 {
+		return 0, exception
+	}
+
+	events, subscriptions, exception := d.load(deliveries)
+	if exception != nil {
+		return 0, exception
+	}
+
+	// Grouped by receiver, in the order they came in
+	var receivers []uint32
+	groups := map[uint32][]*model.WebhookDelivery{}
+	for _, delivery := range deliveries {
+		if _, seen := groups[delivery.SubscriptionId]; !seen {
+			receivers = append(receivers, delivery.SubscriptionId)
+		}
+		groups[delivery.SubscriptionId] = append(groups[delivery.SubscriptionId], delivery)
+	}
+
+	workers := d.config.Workers
+	if workers > len(receivers) {
+		workers = len(receivers)
+	}
+	if workers < 1 {
+		workers = 1
+	}
+
+	queue := make(chan []*model.WebhookDelivery)
+	var wait sync.WaitGroup
+	var lock sync.Mutex
+
+	delivered := 0
+	var failure error
+
+	for i := 0; i < workers; i++ {
+		wait.Add(1)
+		go func() {
+			defer wait.Done()
+
+			for group := range queue {
+				count, exception := d.deliverGroup(group, events, subscriptions)
+
+				lock.Lock()
+				delivered += count
+				if exception != nil && failure == nil {
+					failure = exception
+				}
+				lock.Unlock()
+			}
+		}()
+	}
+
+	for _, receiver := range receivers {
+		queue <- groups[receiver]
+	}
+	close(queue)
+	wait.Wait()
+
+	return delivered, failure
+}
+
+// deliverGroup sends the deliveries of one receiver in order, stopping at the first database failure
+func (d *Dispatcher) deliverGroup(deliveries []*model.WebhookDelivery, events map[uint64]*model.OutboxEvent, subscriptions map[uint32]*model.WebhookSubscription) (int, error) {
+	delivered := 0
+	for _, delivery := range deliveries {
+		event := events[delivery.EventId]
+		if event == nil {
+			if exception := delivery.Drop(d.gormDb, "the event was removed"); exception != nil {
+				return delivered, exception
+			}
+			continue
+		}
+
+		to, reason := d.target(delivery.SubscriptionId, subscriptions)
+		if to == nil {
+			if exception := delivery.Drop(d.gormDb, reason); exception != nil {
+				return delivered, exception
+			}
+			continue
+		}
+
+		// Held until the request is sure to be over, then it is due again should this dispatcher die
+		claimed, exception := delivery.Claim(d.gormDb, d.gormDb.NowFunc().Add(2*d.config.Timeout))
+		if exception != nil {
+			return delivered, exception
+		}
+		if !claimed {
+			continue
+		}
+
+		attempt, failure := d.send(to, &Envelope{
+			Id:        event.Id,
+			Type:      event.Type,
+			CreatedAt: event.CreatedAt,
+			Data:      json.RawMessage(event.Payload),
+		})
+		attempt.SubscriptionId = delivery.SubscriptionId
+		attempt.DeliveryId = delivery.Id
+		attempt.EventId = event.Id
+
+		if exception := attempt.Record(d.gormDb); exception != nil {
+			return delivered, exception
+		}
+
+		if failure != nil {
+			if exception := d.fail(delivery, failure); exception != nil {
+				return delivered, exception
+			}
+			continue
+		}
+
+		if exception := delivery.MarkDelivered(d.gormDb); exception != nil {
+			return delivered, exception
+		}
+		delivered++
+	}
+
+	return delivered, nil
+}
+
+// load fetches the events and the subscriptions of the deliveries, by id
+func (d *Dispatcher) load(deliveries []*model.WebhookDelivery) (map[uint64]*model.OutboxEvent, map[uint32]*model.WebhookSubscription, error) {
+	eventIds := make([]uint64, 0, len(deliveries))
+	subscriptionIds := make([]uint32, 0, len(deliveries))
+	for _, delivery := range deliveries {
+		eventIds = append(eventIds, delivery.EventId)
+		if delivery.SubscriptionId != configuredReceiver {
+			subscriptionIds = append(subscriptionIds, delivery.SubscriptionId)
+		}
+	}
+
+	var event model.OutboxEvent
+	var subscription model.WebhookSubscription
+
+	eventList, exception := event.FindByIds(d.gormDb, eventIds)
+	if exception != nil {
+		return nil, nil, exception
+	}
+
+	subscriptionList, exception := subscription.FindByIds(d.gormDb, subscriptionIds)
+	if exception != nil {
+		return nil, nil, exception
+	}
+
+	events := make(map[uint64]*model.OutboxEvent, len(eventList))
+	for _, event := range eventList {
+		events[event.Id] = event
+	}
+
+	subscriptions := make(map[uint32]*model.WebhookSubscription, len(subscriptionList))
+	for _, subscription := range subscriptionList {
+		subscriptions[subscription.Id] = subscription
+	}
+
+	return events, subscriptions, nil
+}
+
+// target resolves where a delivery goes, or why it can't go anywhere anymore
+func (d *Dispatcher) target(subscriptionId uint32, subscriptions map[uint32]*model.WebhookSubscription) (*target, string) {
+	if subscriptionId == configuredReceiver {
+		if !d.config.Enabled() {
+			return nil, "no receiver is configured"
+		}
+		return &target{url: d.config.Url, secret: d.config.Secret}, ""
+	}
+
+	subscription := subscriptions[subscriptionId]
+	if subscription == nil {
+		return nil, "the subscription was removed"
+	}
+	if !subscription.Active {
+		return nil, "the subscription is paused"
+	}
+
+	return &target{url: subscription.Url, secret: subscription.Secret}, ""
+}
+
+// fail schedules the next attempt of a delivery, or gives up on it after the last one
+func (d *Dispatcher) fail(delivery *model.WebhookDelivery, failure error) error {
+	if delivery.Attempts+1 >= d.config.MaxAttempts {
+		log.Printf("[Webhook] Giving up on delivery %d after %d attempts: %s", delivery.Id, delivery.Attempts+1, failure.Error())
+		return delivery.MarkFailed(d.gormDb, failure.Error(), nil)
+	}
+
+	next := d.gormDb.NowFunc().Add(d.config.BackoffAfter(delivery.Attempts + 1))
+	return delivery.MarkFailed(d.gormDb, failure.Error(), &next)
+}
+
+// SendTest sends a test event to a subscription right away, whether it is paused or not, and logs the attempt
+func (d *Dispatcher) SendTest(subscription *model.WebhookSubscription) (*model.WebhookAttempt, error) {
+	data, exception := json.Marshal(map[string]interface{}{"subscriptionId": subscription.Id})
+	if exception != nil {
+		return nil, exception
+	}
+
+	attempt, _ := d.send(&target{url: subscription.Url, secret: subscription.Secret}, &Envelope{
+		Type:      EventTest,
+		CreatedAt: d.gormDb.NowFunc(),
+		Data:      data,
+	})
+	attempt.SubscriptionId = subscription.Id
+
+	if exception := attempt.Record(d.gormDb); exception != nil {
+		return nil, exception
+	}
+
+	return attempt, nil
+}
+
+// send posts one event, anything but a 2xx answer is a failure. The attempt comes back either way.
+func (d *Dispatcher) send(to *target, envelope *Envelope) (*model.WebhookAttempt, error) {
+	attempt := &model.WebhookAttempt{
+		EventType: envelope.Type,
+		CreatedAt: d.gormDb.NowFunc(),
+	}
+
+	failure := d.post(to, envelope, attempt)
+	if failure != nil {
+		attempt.Error = failure.Error()
+	} else {
+		attempt.Success = true
+	}
+
+	return attempt, failure
+}
+
+func (d *Dispatcher) post(to *target, envelope *Envelope, attempt *model.WebhookAttempt) error {
+	body, exception := json.Marshal(envelope)
+	if exception != nil {
+		return exception
+	}
+
+	request, exception := http.NewRequest(http.MethodPost, to.url, bytes.NewReader(body))
+	if exception != nil {
+		return exception
+	}
+
+	request.Header.Set("Content-Type", "application/json")
+	request.Header.Set(HeaderEventId, fmt.Sprint(envelope.Id))
+	request.Header.Set(HeaderEventType, envelope.Type)
+	request.Header.Set(HeaderSignature, Sign(to.secret, time.Now(), body))
+
+	started := time.Now()
+	response, exception := d.client.Do(request)
+	attempt.LatencyMs = time.Since(started).Milliseconds()
+	if exception != nil {
+		return exception
+	}
+
+	// Drained so the connection can be reused
+	_, _ = io.Copy(ioutil.Discard, io.LimitReader(response.Body, 64<<10))
+	_ = response.Body.Close()
+
+	attempt.StatusCode = response.StatusCode
+	if response.StatusCode < 200 || response.StatusCode > 299 {
+		return fmt.Errorf("receiver answered %d", response.StatusCode)
+	}
+
+	return nil
+}
+
+// Start dispatches every interval until the returned function is called
+func (d *Dispatcher) Start() (stop func()) {
+	ticker := time.NewTicker(d.config.Interval)
+	done := make(chan struct{})
+
+	go func() {
+		for {
+			select {
+			case <-ticker.C:
+				// A full batch means there may be more waiting
+				for {
+					delivered, exception := d.Dispatch()
+					if exception != nil {
+						log.Printf("[Webhook] Failed: %s", exception.Error())
+						break
+					}
+					if delivered < d.config.BatchSize {
+						break
+					}
+				}
+			case <-done:
+				ticker.Stop()
+				return
+			}
+		}
+	}()
+
+	return func() {
+		close(done)
+	}
+}
@@ -0,0 +1,296 @@
+package webhook
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"two-in-one/model"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+)
+
+// receiver is a webhook endpoint answering with the given statuses in turn, it keeps the events it got
+type receiver struct {
+	sync.Mutex
+	t        *testing.T
+	statuses []int
+	events   []*Envelope
+}
+
+func (r *receiver) ServeHTTP(w http.ResponseWriter, request *http.Request) {
+	r.Lock()
+	defer r.Unlock()
+
+	body, exception := ioutil.ReadAll(request.Body)
+	assert.NoError(r.t, exception)
+
+	// Every attempt has to be signed
+	assert.NoError(r.t, Verify("s3cret", request.Header.Get(HeaderSignature), body, time.Now(), time.Minute))
+
+	var envelope Envelope
+	assert.NoError(r.t, json.Unmarshal(body, &envelope))
+	assert.Equal(r.t, envelope.Type, request.Header.Get(HeaderEventType))
+	r.events = append(r.events, &envelope)
+
+	status := http.StatusNoContent
+	if len(r.statuses) > 0 {
+		status, r.statuses = r.statuses[0], r.statuses[1:]
+	}
+	w.WriteHeader(status)
+}
+
+// openTestDb returns a migrated in-memory SQLite database whose clock is moved by hand
+func openTestDb(t *testing.T, now *time.Time) *gorm.DB {
+	gormDb, exception := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{
+		NowFunc: func() time.Time { return *now },
+	})
+	require.NoError(t, exception)
+
+	// Every connection to ":memory:" is a separate database
+	sqlDb, _ := gormDb.DB()
+	sqlDb.SetMaxOpenConns(1)
+
+	require.NoError(t, gormDb.AutoMigrate(&model.Comment{}, &model.CommentMention{}, &model.CommentAttachment{}, &model.OutboxEvent{}, &model.WebhookSubscription{}, &model.WebhookDelivery{}, &model.WebhookAttempt{}))
+
+	t.Cleanup(func() {
+		_ = sqlDb.Close()
+	})
+
+	return gormDb
+}
+
+func TestDispatcher(t *testing.T) {
+	now := time.Now().UTC()
+	gormDb := openTestDb(t, &now)
+
+	// The first event gets through on its third attempt, the second one never does
+	target := &receiver{t: t, statuses: []int{
+		http.StatusInternalServerError, http.StatusInternalServerError,
+		http.StatusBadGateway, http.StatusBadGateway,
+		http.StatusNoContent, http.StatusServiceUnavailable,
+	}}
+	server := httptest.NewServer(target)
+	defer server.Close()
+
+	dispatcher := NewDispatcher(gormDb, &Config{
+		Url:         server.URL,
+		Secret:      "s3cret",
+		MaxAttempts: 3,
+		Backoff:     time.Minute,
+		MaxBackoff:  time.Hour,
+		Timeout:     time.Second,
+		BatchSize:   10,
+
+		// The receiver is on the loopback
+		AllowPrivate: true,
+	})
+
+	var comment model.Comment
+	first := &model.Comment{Body: "first", UserId: 1}
+	require.NoError(t, comment.CreateMany(gormDb, []*model.Comment{first}))
+	now = now.Add(time.Second)
+	require.NoError(t, comment.Delete(gormDb, first.Id, 0))
+
+	delivered, exception := dispatcher.Dispatch()
+	require.NoError(t, exception)
+	assert.Equal(t, 0, delivered)
+	assert.Len(t, target.events, 2)
+
+	// Nothing is due until the backoff is over
+	delivered, exception = dispatcher.Dispatch()
+	require.NoError(t, exception)
+	assert.Equal(t, 0, delivered)
+	assert.Len(t, target.events, 2)
+
+	now = now.Add(time.Minute)
+	delivered, exception = dispatcher.Dispatch()
+	require.NoError(t, exception)
+	assert.Equal(t, 0, delivered)
+	assert.Len(t, target.events, 4)
+
+	// The wait doubles after every failure
+	now = now.Add(time.Minute)
+	delivered, exception = dispatcher.Dispatch()
+	require.NoError(t, exception)
+	assert.Equal(t, 0, delivered)
+	assert.Len(t, target.events, 4)
+
+	now = now.Add(time.Minute)
+	delivered, exception = dispatcher.Dispatch()
+	require.NoError(t, exception)
+	assert.Equal(t, 1, delivered)
+	require.Len(t, target.events, 6)
+
+	// Same event every time, so receivers can drop repeats
+	assert.Equal(t, target.events[0].Id, target.events[4].Id)
+	assert.Equal(t, model.EventCommentCreated, target.events[0].Type)
+	assert.Equal(t, model.EventCommentDeleted, target.events[5].Type)
+
+	var data model.Comment
+	require.NoError(t, json.Unmarshal(target.events[5].Data, &data))
+	assert.Equal(t, first.Id, data.Id)
+	assert.True(t, data.Deleted)
+
+	var deliveries []*model.WebhookDelivery
+	require.NoError(t, gormDb.Order("wd_id").Find(&deliveries).Error)
+	require.Len(t, deliveries, 2)
+	assert.Equal(t, model.DeliveryDelivered, deliveries[0].Status)
+	assert.Equal(t, uint32(3), deliveries[0].Attempts)
+	assert.Equal(t, model.DeliveryDead, deliveries[1].Status)
+	assert.Equal(t, uint32(3), deliveries[1].Attempts)
+	assert.Equal(t, "receiver answered 503", deliveries[1].LastError)
+
+	// Every attempt is in the log of the configured receiver
+	var attempt model.WebhookAttempt
+	attempts, exception := attempt.GetBySubscriptionId(gormDb, 0, 10)
+	require.NoError(t, exception)
+	require.Len(t, attempts, 6)
+	assert.Equal(t, http.StatusServiceUnavailable, attempts[0].StatusCode)
+	assert.False(t, attempts[0].Success)
+	assert.Equal(t, http.StatusNoContent, attempts[1].StatusCode)
+	assert.True(t, attempts[1].Success)
+
+	// Dead deliveries stay dead
+	now = now.Add(time.Hour)
+	delivered, exception = dispatcher.Dispatch()
+	require.NoError(t, exception)
+	assert.Equal(t, 0, delivered)
+	assert.Len(t, target.events, 6)
+}
+
+func TestDispatcher_Subscriptions(t *testing.T) {
+	now := time.Now().UTC()
+	gormDb := openTestDb(t, &now)
+
+	target := &receiver{t: t}
+	server := httptest.NewServer(target)
+	defer server.Close()
+
+	// No receiver in the environment, only the subscriptions get events
+	dispatcher := NewDispatcher(gormDb, &Config{
+		MaxAttempts: 3,
+		Backoff:     time.Minute,
+		MaxBackoff:  time.Hour,
+		Timeout:     time.Second,
+		BatchSize:   10,
+
+		// The receiver is on the loopback
+		AllowPrivate: true,
+	})
+
+	deletes := &model.WebhookSubscription{UserId: 1, Url: server.URL, Secret: "s3cret", Active: true, Events: []string{model.EventCommentDeleted}}
+	paused := &model.WebhookSubscription{UserId: 1, Url: server.URL, Secret: "s3cret", Active: true}
+	for _, subscription := range []*model.WebhookSubscription{deletes, paused} {
+		require.NoError(t, gormDb.Create(subscription).Error)
+	}
+
+	var comment model.Comment
+	first := &model.Comment{Body: "first", UserId: 1}
+	require.NoError(t, comment.CreateMany(gormDb, []*model.Comment{first}))
+	require.NoError(t, comment.Delete(gormDb, first.Id, 0))
+
+	// Queued for both, then one is paused before anything went out
+	var event model.OutboxEvent
+	events, exception := event.FindPending(gormDb, 10)
+	require.NoError(t, exception)
+	require.NoError(t, event.Dispatch(gormDb, events, nil))
+
+	paused.Active = false
+	require.NoError(t, paused.Update(gormDb))
+
+	delivered, exception := dispatcher.Dispatch()
+	require.NoError(t, exception)
+	assert.Equal(t, 1, delivered)
+	require.Len(t, target.events, 1)
+	assert.Equal(t, model.EventCommentDeleted, target.events[0].Type)
+
+	var deliveries []*model.WebhookDelivery
+	require.NoError(t, gormDb.Where("fk_subscription_id", paused.Id).Find(&deliveries).Error)
+	require.Len(t, deliveries, 2)
+	for _, delivery := range deliveries {
+		assert.Equal(t, model.DeliveryDead, delivery.Status)
+		assert.Equal(t, "the subscription is paused", delivery.LastError)
+	}
+
+	// Test events go out even to paused subscriptions, and are logged like the rest
+	attempt, exception := dispatcher.SendTest(paused)
+	require.NoError(t, exception)
+	assert.True(t, attempt.Success)
+	assert.Equal(t, http.StatusNoContent, attempt.StatusCode)
+	require.Len(t, target.events, 2)
+	assert.Equal(t, EventTest, target.events[1].Type)
+
+	attempts, exception := attempt.GetBySubscriptionId(gormDb, paused.Id, 10)
+	require.NoError(t, exception)
+	require.Len(t, attempts, 1)
+	assert.Equal(t, EventTest, attempts[0].EventType)
+	assert.Zero(t, attempts[0].DeliveryId)
+}
+
+func TestDispatcher_Workers(t *testing.T) {
+	now := time.Now().UTC()
+	gormDb := openTestDb(t, &now)
+
+	// The slow receiver holds every request until released
+	release := make(chan struct{})
+	slowTarget := &receiver{t: t}
+	slow := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, request *http.Request) {
+		<-release
+		slowTarget.ServeHTTP(w, request)
+	}))
+	defer slow.Close()
+
+	fastTarget := &receiver{t: t}
+	fast := httptest.NewServer(fastTarget)
+	defer fast.Close()
+
+	dispatcher := NewDispatcher(gormDb, &Config{
+		MaxAttempts: 3,
+		Backoff:     time.Minute,
+		MaxBackoff:  time.Hour,
+		Timeout:     5 * time.Second,
+		BatchSize:   10,
+		Workers:     2,
+
+		// The receivers are on the loopback
+		AllowPrivate: true,
+	})
+
+	for _, url := range []string{slow.URL, fast.URL} {
+		require.NoError(t, gormDb.Create(&model.WebhookSubscription{UserId: 1, Url: url, Secret: "s3cret", Active: true}).Error)
+	}
+
+	var comment model.Comment
+	require.NoError(t, comment.CreateMany(gormDb, []*model.Comment{{Body: "first", UserId: 1}, {Body: "second", UserId: 1}}))
+
+	done := make(chan int)
+	go func() {
+		delivered, exception := dispatcher.Dispatch()
+		assert.NoError(t, exception)
+		done <- delivered
+	}()
+
+	// The fast receiver isn't held up by the slow one
+	require.Eventually(t, func() bool {
+		fastTarget.Lock()
+		defer fastTarget.Unlock()
+		return len(fastTarget.events) == 2
+	}, 2*time.Second, 10*time.Millisecond)
+
+	close(release)
+	assert.Equal(t, 4, <-done)
+
+	// Each receiver got the events in order
+	for _, target := range []*receiver{slowTarget, fastTarget} {
+		require.Len(t, target.events, 2)
+		assert.Less(t, target.events[0].Id, target.events[1].Id)
+	}
+}
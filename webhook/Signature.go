@@ -0,0 +1,107 @@
+package webhook
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Headers sent with every event
+const (
+	HeaderSignature = "Webhook-Signature"
+	HeaderEventId   = "Webhook-Id"
+	HeaderEventType = "Webhook-Event"
+)
+
+var (
+	// ErrInvalidSignature is returned when the signature header is malformed or doesn't match the body
+	ErrInvalidSignature = errors.New("invalid webhook signature")
+
+	// ErrExpiredSignature is returned when the signature was made too long ago, which may be a replay
+	ErrExpiredSignature = errors.New("expired webhook signature")
+)
+
+// NewSecret makes a random signing key, 64 hex characters
+func NewSecret() (string, error) {
+	raw := make([]byte, 32)
+	if _, exception := rand.Read(raw); exception != nil {
+		return "", exception
+	}
+
+	return hex.EncodeToString(raw), nil
+}
+
+// Sign makes the signature header of a body sent at the given time, "t=<unix seconds>,v1=<hex HMAC-SHA256>".
+// The timestamp is signed along with the body as "<unix seconds>.<body>", so it can't be swapped out.
+func Sign(secret string, timestamp time.Time, body []byte) string {
+	unix := strconv.FormatInt(timestamp.Unix(), 10)
+	return "t=" + unix + ",v1=" + hex.EncodeToString(mac(secret, unix, body))
+}
+
+// Verify checks a signature header against the body, rejecting signatures older than tolerance
+func Verify(secret string, header string, body []byte, now time.Time, tolerance time.Duration) error {
+	var unix string
+	var signatures [][]byte
+
+	for _, part := range strings.Split(header, ",") {
+		name, value, found := cut(strings.TrimSpace(part), "=")
+		if !found {
+			return ErrInvalidSignature
+		}
+
+		switch name {
+		case "t":
+			unix = value
+		case "v1":
+			signature, exception := hex.DecodeString(value)
+			if exception != nil {
+				return ErrInvalidSignature
+			}
+			signatures = append(signatures, signature)
+		}
+	}
+
+	seconds, exception := strconv.ParseInt(unix, 10, 64)
+	if exception != nil || len(signatures) == 0 {
+		return ErrInvalidSignature
+	}
+
+	expected := mac(secret, unix, body)
+	matched := false
+	for _, signature := range signatures {
+		if hmac.Equal(signature, expected) {
+			matched = true
+		}
+	}
+	if !matched {
+		return ErrInvalidSignature
+	}
+
+	age := now.Sub(time.Unix(seconds, 0))
+	if age > tolerance || age < -tolerance {
+		return ErrExpiredSignature
+	}
+
+	return nil
+}
+
+func mac(secret string, unix string, body []byte) []byte {
+	hash := hmac.New(sha256.New, []byte(secret))
+	hash.Write([]byte(unix))
+	hash.Write([]byte("."))
+	hash.Write(body)
+	return hash.Sum(nil)
+}
+
+// cut is strings.Cut, which needs Go 1.18
+func cut(value string, separator string) (string, string, bool) {
+	if index := strings.Index(value, separator); index >= 0 {
+		return value[:index], value[index+len(separator):], true
+	}
+	return value, "", false
+}
@@ -0,0 +1,36 @@
+package webhook
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestVerify(t *testing.T) {
+	body := []byte(`{"id":1}`)
+	sent := time.Unix(1700000000, 0)
+	header := Sign("s3cret", sent, body)
+
+	assert.Regexp(t, `^t=1700000000,v1=[0-9a-f]{64}$`, header)
+	assert.NoError(t, Verify("s3cret", header, body, sent.Add(time.Minute), 5*time.Minute))
+
+	for _, test := range []struct {
+		name   string
+		secret string
+		header string
+		body   string
+		want   error
+	}{
+		{"other secret", "guess", header, `{"id":1}`, ErrInvalidSignature},
+		{"other body", "s3cret", header, `{"id":2}`, ErrInvalidSignature},
+		{"other timestamp", "s3cret", "t=1700000001" + header[12:], `{"id":1}`, ErrInvalidSignature},
+		{"no signature", "s3cret", "t=1700000000", `{"id":1}`, ErrInvalidSignature},
+		{"garbage", "s3cret", "nonsense", `{"id":1}`, ErrInvalidSignature},
+	} {
+		assert.Equal(t, test.want, Verify(test.secret, test.header, []byte(test.body), sent, 5*time.Minute), test.name)
+	}
+
+	// Replayed long after it was sent
+	assert.Equal(t, ErrExpiredSignature, Verify("s3cret", header, body, sent.Add(time.Hour), 5*time.Minute))
+}